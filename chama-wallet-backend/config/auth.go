@@ -0,0 +1,114 @@
+package config
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minSigningKeyLength is the shortest HMAC secret accepted for signing tokens
+const minSigningKeyLength = 32
+
+type AuthConfig struct {
+	SigningKeys     map[string][]byte // token signing secrets by key ID
+	ActiveKeyID     string            // key new tokens are signed with; the others only verify
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	StepUpTTL       time.Duration // how long a second-factor check covers sensitive actions
+	TOTPIssuer      string        // name shown in authenticator apps
+
+	LockoutThreshold int           // failed sign-ins before an account is locked
+	LockoutBase      time.Duration // first lockout; each further failure doubles it
+	LockoutMax       time.Duration
+}
+
+var Auth *AuthConfig
+
+// InitAuthConfig loads the token signing keys and lifetimes.
+//
+// JWT_SIGNING_KEYS is a comma separated list of kid:secret pairs. New tokens are signed
+// with JWT_ACTIVE_KEY_ID, or the first key listed, and tokens signed with any listed key
+// stay valid, so a key is rotated by adding the new one in front and dropping the old one
+// once its tokens have expired. JWT_SECRET alone is used as a single key with ID "default".
+func InitAuthConfig() error {
+	auth := &AuthConfig{SigningKeys: map[string][]byte{}}
+
+	var err error
+	if auth.AccessTokenTTL, err = time.ParseDuration(getEnvOrDefault("ACCESS_TOKEN_TTL", "15m")); err != nil {
+		return fmt.Errorf("invalid ACCESS_TOKEN_TTL: %w", err)
+	}
+	if auth.RefreshTokenTTL, err = time.ParseDuration(getEnvOrDefault("REFRESH_TOKEN_TTL", "720h")); err != nil {
+		return fmt.Errorf("invalid REFRESH_TOKEN_TTL: %w", err)
+	}
+	if auth.StepUpTTL, err = time.ParseDuration(getEnvOrDefault("STEP_UP_TTL", "5m")); err != nil {
+		return fmt.Errorf("invalid STEP_UP_TTL: %w", err)
+	}
+	auth.TOTPIssuer = getEnvOrDefault("TOTP_ISSUER", "Chama Wallet")
+
+	if auth.LockoutThreshold, err = strconv.Atoi(getEnvOrDefault("LOGIN_LOCKOUT_THRESHOLD", "5")); err != nil || auth.LockoutThreshold < 1 {
+		return fmt.Errorf("invalid LOGIN_LOCKOUT_THRESHOLD: must be a positive number")
+	}
+	if auth.LockoutBase, err = time.ParseDuration(getEnvOrDefault("LOGIN_LOCKOUT_BASE", "1m")); err != nil {
+		return fmt.Errorf("invalid LOGIN_LOCKOUT_BASE: %w", err)
+	}
+	if auth.LockoutMax, err = time.ParseDuration(getEnvOrDefault("LOGIN_LOCKOUT_MAX", "1h")); err != nil {
+		return fmt.Errorf("invalid LOGIN_LOCKOUT_MAX: %w", err)
+	}
+
+	keys := strings.TrimSpace(os.Getenv("JWT_SIGNING_KEYS"))
+	if keys == "" && os.Getenv("JWT_SECRET") != "" {
+		keys = "default:" + os.Getenv("JWT_SECRET")
+	}
+
+	for _, pair := range strings.Split(keys, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kid, secret, ok := strings.Cut(pair, ":")
+		if !ok || kid == "" {
+			return fmt.Errorf("JWT_SIGNING_KEYS entries must look like kid:secret")
+		}
+		if len(secret) < minSigningKeyLength {
+			return fmt.Errorf("signing key %q must be at least %d characters", kid, minSigningKeyLength)
+		}
+		if _, exists := auth.SigningKeys[kid]; exists {
+			return fmt.Errorf("signing key %q is listed twice", kid)
+		}
+		auth.SigningKeys[kid] = []byte(secret)
+		if auth.ActiveKeyID == "" {
+			auth.ActiveKeyID = kid
+		}
+	}
+
+	if len(auth.SigningKeys) == 0 {
+		if Config != nil && Config.IsMainnet {
+			return fmt.Errorf("JWT_SIGNING_KEYS or JWT_SECRET is required for mainnet")
+		}
+		// Tokens signed with a generated key stop verifying on restart; refresh tokens
+		// are stored server side, so clients just refresh
+		secret := make([]byte, minSigningKeyLength)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		auth.SigningKeys["ephemeral"] = secret
+		auth.ActiveKeyID = "ephemeral"
+		slog.Warn("no JWT signing key configured, using a generated one for this process")
+	}
+
+	if active := os.Getenv("JWT_ACTIVE_KEY_ID"); active != "" {
+		if _, ok := auth.SigningKeys[active]; !ok {
+			return fmt.Errorf("JWT_ACTIVE_KEY_ID %q is not in JWT_SIGNING_KEYS", active)
+		}
+		auth.ActiveKeyID = active
+	}
+
+	Auth = auth
+	slog.Info("auth configured", "active_key_id", auth.ActiveKeyID, "keys", len(auth.SigningKeys))
+
+	return nil
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"strings"
 
@@ -10,14 +11,14 @@ import (
 )
 
 type StellarConfig struct {
-	Network            string
-	HorizonURL         string
-	SorobanRPCURL      string
-	NetworkPassphrase  string
-	ContractID         string
-	IsMainnet          bool
-	USDCAssetCode      string
-	USDCAssetIssuer    string
+	Network           string
+	HorizonURL        string
+	SorobanRPCURL     string
+	NetworkPassphrase string
+	ContractID        string
+	IsMainnet         bool
+	USDCAssetCode     string
+	USDCAssetIssuer   string
 }
 
 var Config *StellarConfig
@@ -31,11 +32,11 @@ func InitStellarConfig() {
 	isMainnet := stellarNetwork == "mainnet"
 
 	config := &StellarConfig{
-		Network:           stellarNetwork,
-		IsMainnet:         isMainnet,
-		ContractID:        os.Getenv("SOROBAN_CONTRACT_ID"),
-		USDCAssetCode:     os.Getenv("USDC_ASSET_CODE"),
-		USDCAssetIssuer:   os.Getenv("USDC_ASSET_ISSUER"),
+		Network:         stellarNetwork,
+		IsMainnet:       isMainnet,
+		ContractID:      os.Getenv("SOROBAN_CONTRACT_ID"),
+		USDCAssetCode:   os.Getenv("USDC_ASSET_CODE"),
+		USDCAssetIssuer: os.Getenv("USDC_ASSET_ISSUER"),
 	}
 
 	if isMainnet {
@@ -43,23 +44,19 @@ func InitStellarConfig() {
 		config.HorizonURL = getEnvOrDefault("STELLAR_HORIZON_URL", "https://horizon.stellar.org")
 		config.SorobanRPCURL = getEnvOrDefault("STELLAR_SOROBAN_RPC_URL", "https://soroban-rpc.mainnet.stellar.org:443")
 		config.NetworkPassphrase = getEnvOrDefault("STELLAR_NETWORK_PASSPHRASE", "Public Global Stellar Network ; September 2015")
-		
-		fmt.Println("🌐 Stellar Mainnet Configuration Loaded")
-		fmt.Printf("   Horizon: %s\n", config.HorizonURL)
-		fmt.Printf("   Soroban RPC: %s\n", config.SorobanRPCURL)
-		fmt.Printf("   Contract ID: %s\n", config.ContractID)
 	} else {
 		// Testnet configuration
 		config.HorizonURL = getEnvOrDefault("STELLAR_HORIZON_URL", "https://horizon-testnet.stellar.org")
 		config.SorobanRPCURL = getEnvOrDefault("STELLAR_SOROBAN_RPC_URL", "https://soroban-testnet.stellar.org:443")
 		config.NetworkPassphrase = getEnvOrDefault("STELLAR_NETWORK_PASSPHRASE", "Test SDF Network ; September 2015")
-		
-		fmt.Println("🧪 Stellar Testnet Configuration Loaded")
-		fmt.Printf("   Horizon: %s\n", config.HorizonURL)
-		fmt.Printf("   Soroban RPC: %s\n", config.SorobanRPCURL)
-		fmt.Printf("   Contract ID: %s\n", config.ContractID)
 	}
 
+	slog.Info("stellar configuration loaded",
+		"network", config.Network,
+		"horizon", config.HorizonURL,
+		"soroban_rpc", config.SorobanRPCURL,
+		"contract_id", config.ContractID,
+	)
 	Config = config
 }
 
@@ -111,7 +108,7 @@ func ValidateMainnetConfig() error {
 		return fmt.Errorf("SOROBAN_SECRET_KEY is required for mainnet")
 	}
 
-	fmt.Println("✅ Mainnet configuration validated")
+	slog.Info("mainnet configuration validated")
 	return nil
 }
 
@@ -134,4 +131,4 @@ func GetAssetInfo() map[string]map[string]string {
 	}
 
 	return assets
-}
\ No newline at end of file
+}
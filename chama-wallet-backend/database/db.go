@@ -3,35 +3,65 @@ package database
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
-	"chama-wallet-backend/models"
+	"chama-wallet-backend/logging"
 )
 
 var DB *gorm.DB
 
-func ConnectDB() {
-
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		dsn = "host=localhost user=chama_user password=malika dbname=chama_wallet port=5432 sslmode=disable"
-	}
+// DefaultSQLiteDSN is an in-memory database shared by every connection in the process
+const DefaultSQLiteDSN = "file::memory:?cache=shared"
 
+func ConnectDB() {
 	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	DB, err = Open(os.Getenv("DB_DRIVER"), os.Getenv("DATABASE_URL"))
 	if err != nil {
-		log.Fatal("failed to connect to database:", err)
+		logging.Fatal("failed to connect to database", "error", err)
 	}
 
-	err = DB.AutoMigrate(&models.Group{}, &models.Member{}, &models.Contribution{})
-	err = DB.AutoMigrate(&models.Group{}, &models.Member{}, &models.Contribution{}, &models.User{})
-	if err != nil {
-		log.Fatal("failed to migrate database:", err)
+	slog.Info("connected to database", "driver", DB.Dialector.Name())
+}
+
+// Open connects to Postgres, or to SQLite when driver is "sqlite". SQLite needs no server
+// and is meant for tests and local runs.
+func Open(driver, dsn string) (*gorm.DB, error) {
+	// TranslateError turns unique violations into gorm.ErrDuplicatedKey. Queries are
+	// logged without their bound values.
+	cfg := &gorm.Config{TranslateError: true, Logger: logging.NewGormLogger()}
+
+	switch driver {
+	case "", "postgres":
+		if dsn == "" {
+			dsn = "host=localhost user=chama_user password=malika dbname=chama_wallet port=5432 sslmode=disable"
+		}
+		return gorm.Open(postgres.Open(dsn), cfg)
+
+	case "sqlite":
+		if dsn == "" {
+			dsn = DefaultSQLiteDSN
+		}
+		db, err := gorm.Open(sqlite.Open(dsn), cfg)
+		if err != nil {
+			return nil, err
+		}
+		// SQLite allows one writer; a single connection queues writes instead of failing them
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
+		return db, nil
 	}
+	return nil, fmt.Errorf("unsupported DB_DRIVER %q", driver)
+}
 
-	fmt.Println("Connected to the database successfully.")
+// IsSQLite reports whether db is a SQLite database
+func IsSQLite(db *gorm.DB) bool {
+	return db.Dialector.Name() == "sqlite"
 }
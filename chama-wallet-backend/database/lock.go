@@ -0,0 +1,24 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ForUpdate locks the rows the query reads until the transaction ends. SQLite has no
+// row locks (a write transaction locks the whole database), so the clause is skipped there.
+func ForUpdate(tx *gorm.DB) *gorm.DB {
+	if IsSQLite(tx) {
+		return tx
+	}
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"})
+}
+
+// LockKey serializes transactions that take the same key, until the transaction ends.
+// On SQLite write transactions already run one at a time.
+func LockKey(tx *gorm.DB, key string) error {
+	if IsSQLite(tx) {
+		return nil
+	}
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", key).Error
+}
@@ -1,31 +1,82 @@
 package database
 
 import (
-    "chama-wallet-backend/models"
-    "log"
+	"log/slog"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"chama-wallet-backend/logging"
+	"chama-wallet-backend/models"
 )
 
+// RunMigrations applies any pending schema migrations
 func RunMigrations() {
-    log.Println("Running database migrations...")
-    
-    err := DB.AutoMigrate(
-        &models.User{},
-        &models.Group{},
-        &models.Member{},
-        &models.Contribution{},
-        &models.GroupInvitation{},
-        &models.AdminNomination{},
-        &models.PayoutRequest{},
-        &models.PayoutApproval{},
-        &models.PayoutSchedule{},
-        &models.Notification{},
-        &models.RoundContribution{},
-        &models.RoundStatus{},
-    )
-    
-    if err != nil {
-        log.Fatalf("Failed to run migrations: %v", err)
-    }
-    
-    log.Println("✅ Database migrations completed successfully")
+	slog.Info("running database migrations")
+
+	if IsSQLite(DB) {
+		if err := MigrateSQLite(DB); err != nil {
+			logging.Fatal("failed to migrate SQLite database", "error", err)
+		}
+		slog.Info("SQLite schema created from the models")
+		return
+	}
+
+	applied, err := MigrateUp(DB)
+	if err != nil {
+		logging.Fatal("failed to run migrations", "error", err)
+	}
+
+	slog.Info("database migrations completed", "applied", applied)
+}
+
+// MigrateSQLite creates the schema on a SQLite database. The versioned migrations are
+// written for Postgres, so SQLite gets the schema from the models' gorm tags instead.
+func MigrateSQLite(db *gorm.DB) error {
+	err := db.AutoMigrate(
+		&models.User{},
+		&models.Session{},
+		&models.RecoveryCode{},
+		&models.Group{},
+		&models.Member{},
+		&models.GroupInvitation{},
+		&models.AdminNomination{},
+		&models.Contribution{},
+		&models.RoundContribution{},
+		&models.RoundStatus{},
+		&models.Penalty{},
+		&models.Loan{},
+		&models.LoanGuarantor{},
+		&models.LoanInstallment{},
+		&models.LoanRepayment{},
+		&models.ProfitEntry{},
+		&models.Settlement{},
+		&models.SettlementPayout{},
+		&models.BidWindow{},
+		&models.PayoutBid{},
+		&models.PayoutSchedule{},
+		&models.PayoutRequest{},
+		&models.PayoutApproval{},
+		&models.Notification{},
+		&models.IdempotencyKey{},
+		&models.PaymentCursor{},
+		&models.ScheduledJob{},
+		&models.AuditEvent{},
+		&models.RateLimitBucket{},
+		&models.LoginThrottle{},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Keep the audit log append-only, as the Postgres migration does
+	for _, trigger := range []string{"UPDATE", "DELETE"} {
+		err := db.Exec(`CREATE TRIGGER IF NOT EXISTS audit_events_no_` + strings.ToLower(trigger) + `
+			BEFORE ` + trigger + ` ON audit_events
+			BEGIN SELECT RAISE(ABORT, 'audit_events is append-only'); END`).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,344 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+var (
+	dollarQuoted = regexp.MustCompile(`(?s)\$\$.*?\$\$`)
+	lineComment  = regexp.MustCompile(`--[^\n]*`)
+	createTable  = regexp.MustCompile(`(?is)^CREATE\s+TABLE\s+(IF\s+NOT\s+EXISTS\s+)?(\w+)\s*\((.*)\)$`)
+	alterTable   = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?(\w+)\s+(.*)$`)
+	dropTable    = regexp.MustCompile(`(?is)^DROP\s+TABLE\s+(?:IF\s+EXISTS\s+)?(\w+)`)
+	addColumn    = regexp.MustCompile(`(?is)^ADD\s+COLUMN\s+(IF\s+NOT\s+EXISTS\s+)?(\w+)`)
+	dropColumn   = regexp.MustCompile(`(?is)^DROP\s+COLUMN\s+(?:IF\s+EXISTS\s+)?(\w+)`)
+	renameColumn = regexp.MustCompile(`(?is)^RENAME\s+COLUMN\s+(\w+)\s+TO\s+(\w+)`)
+	uniqueIndex  = regexp.MustCompile(`(?is)^CREATE\s+UNIQUE\s+INDEX\s+(?:IF\s+NOT\s+EXISTS\s+)?(\w+)\s+ON\s+(\w+)\s*\(([^)]*)\)`)
+	tableUnique  = regexp.MustCompile(`(?is)^UNIQUE\s*\(([^)]*)\)`)
+	columnUnique = regexp.MustCompile(`(?i)\sUNIQUE\b`)
+	dropIndex    = regexp.MustCompile(`(?is)^DROP\s+INDEX\s+(?:IF\s+EXISTS\s+)?(\w+)`)
+)
+
+// splitTopLevel splits s on commas outside parentheses
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, strings.TrimSpace(s[start:]))
+}
+
+// postgresSchema replays the up migrations on an empty database. It returns the columns
+// of each table they leave behind and the unique indexes, each as "table(column, ...)".
+func postgresSchema(t *testing.T) (map[string]map[string]bool, map[string]string) {
+	t.Helper()
+	tables := map[string]map[string]bool{}
+	unique := map[string]string{} // index or constraint -> table(columns)
+	replayMigrations(t, tables, unique)
+	return tables, unique
+}
+
+// replayMigrations applies the up migrations' table, column and unique index changes to
+// tables and unique as Postgres would: IF NOT EXISTS leaves a table or column that is
+// already there alone, and creating one again without it fails the migration.
+func replayMigrations(t *testing.T, tables map[string]map[string]bool, unique map[string]string) {
+	t.Helper()
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, migration := range migrations {
+		sql := lineComment.ReplaceAllString(dollarQuoted.ReplaceAllString(migration.Up, ""), "")
+		for _, statement := range strings.Split(sql, ";") {
+			statement = strings.TrimSpace(statement)
+
+			if m := createTable.FindStringSubmatch(statement); m != nil {
+				table := strings.ToLower(m[2])
+				if tables[table] != nil {
+					if m[1] == "" {
+						t.Fatalf("migration %04d creates table %s, which already exists", migration.Version, table)
+					}
+					continue
+				}
+				columns := map[string]bool{}
+				for _, item := range splitTopLevel(m[3]) {
+					name := strings.ToLower(strings.Fields(item)[0])
+					switch name {
+					case "unique":
+						if c := tableUnique.FindStringSubmatch(item); c != nil {
+							unique[table+" "+item] = indexKey(table, strings.Split(c[1], ","))
+						}
+						continue
+					case "constraint", "primary", "foreign", "check", "exclude":
+						continue
+					}
+					name = strings.Trim(name, `"`)
+					columns[name] = true
+					if columnUnique.MatchString(item) {
+						unique[table+"."+name] = indexKey(table, []string{name})
+					}
+				}
+				tables[table] = columns
+				continue
+			}
+
+			if m := uniqueIndex.FindStringSubmatch(statement); m != nil {
+				unique[strings.ToLower(m[1])] = indexKey(m[2], strings.Split(m[3], ","))
+				continue
+			}
+			if m := dropIndex.FindStringSubmatch(statement); m != nil {
+				delete(unique, strings.ToLower(m[1]))
+				continue
+			}
+
+			if m := dropTable.FindStringSubmatch(statement); m != nil {
+				delete(tables, strings.ToLower(m[1]))
+				continue
+			}
+
+			m := alterTable.FindStringSubmatch(statement)
+			if m == nil {
+				continue
+			}
+			table := strings.ToLower(m[1])
+			for _, action := range splitTopLevel(m[2]) {
+				if c := addColumn.FindStringSubmatch(action); c != nil {
+					column := strings.ToLower(c[2])
+					if tables[table] == nil {
+						t.Fatalf("migration %04d adds %s to unknown table %s", migration.Version, column, table)
+					}
+					if tables[table][column] && c[1] == "" {
+						t.Fatalf("migration %04d adds %s.%s, which already exists", migration.Version, table, column)
+					}
+					tables[table][column] = true
+				} else if c := dropColumn.FindStringSubmatch(action); c != nil {
+					delete(tables[table], strings.ToLower(c[1]))
+				} else if c := renameColumn.FindStringSubmatch(action); c != nil {
+					delete(tables[table], strings.ToLower(c[1]))
+					tables[table][strings.ToLower(c[2])] = true
+				}
+			}
+		}
+	}
+}
+
+// indexKey names an index by its table and columns, which are what behaviour depends on
+func indexKey(table string, columns []string) string {
+	for i := range columns {
+		columns[i] = strings.ToLower(strings.Trim(strings.TrimSpace(columns[i]), `"`))
+	}
+	return strings.ToLower(table) + "(" + strings.Join(columns, ", ") + ")"
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TestSQLiteSchemaMatchesMigrations checks the SQLite schema built from the models has
+// the tables, columns and unique indexes the Postgres migrations create, so tests and
+// offline mode run against the schema production has
+func TestSQLiteSchemaMatchesMigrations(t *testing.T) {
+	want, wantUnique := postgresSchema(t)
+	if len(want) == 0 {
+		t.Fatal("no tables found in the migrations")
+	}
+
+	db, err := Open("sqlite", fmt.Sprintf("file:schema-%s?mode=memory&cache=shared", uuid.NewString()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}()
+	if err := MigrateSQLite(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	var sqliteTables []string
+	if err := db.Raw(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'`).
+		Scan(&sqliteTables).Error; err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]map[string]bool{}
+	for _, table := range sqliteTables {
+		var columns []struct{ Name string }
+		if err := db.Raw(`SELECT name FROM pragma_table_info(?)`, table).Scan(&columns).Error; err != nil {
+			t.Fatal(err)
+		}
+		got[table] = map[string]bool{}
+		for _, column := range columns {
+			got[table][strings.ToLower(column.Name)] = true
+		}
+	}
+
+	for _, table := range sortedKeys(mapKeys(want)) {
+		columns, ok := got[table]
+		if !ok {
+			t.Errorf("table %s is created by the migrations but not on SQLite", table)
+			continue
+		}
+		for _, column := range sortedKeys(want[table]) {
+			if !columns[column] {
+				t.Errorf("column %s.%s is created by the migrations but not on SQLite", table, column)
+			}
+		}
+		for _, column := range sortedKeys(columns) {
+			if !want[table][column] {
+				t.Errorf("column %s.%s exists on SQLite but no migration creates it", table, column)
+			}
+		}
+	}
+	for _, table := range sortedKeys(mapKeys(got)) {
+		if _, ok := want[table]; !ok {
+			t.Errorf("table %s exists on SQLite but no migration creates it", table)
+		}
+	}
+
+	// Duplicate checks rely on unique indexes, so both schemas need the same ones
+	gotUnique := map[string]bool{}
+	for _, table := range sqliteTables {
+		var indexes []struct {
+			Name   string
+			Unique bool
+			Origin string
+		}
+		if err := db.Raw(`SELECT name, "unique", origin FROM pragma_index_list(?)`, table).Scan(&indexes).Error; err != nil {
+			t.Fatal(err)
+		}
+		for _, index := range indexes {
+			if !index.Unique || index.Origin == "pk" {
+				continue
+			}
+			var columns []string
+			if err := db.Raw(`SELECT name FROM pragma_index_info(?) ORDER BY seqno`, index.Name).Scan(&columns).Error; err != nil {
+				t.Fatal(err)
+			}
+			gotUnique[indexKey(table, columns)] = true
+		}
+	}
+	wantUniqueSet := map[string]bool{}
+	for _, key := range wantUnique {
+		wantUniqueSet[key] = true
+	}
+	for _, key := range sortedKeys(wantUniqueSet) {
+		if !gotUnique[key] {
+			t.Errorf("unique index on %s is created by the migrations but not on SQLite", key)
+		}
+	}
+	for _, key := range sortedKeys(gotUnique) {
+		if !wantUniqueSet[key] {
+			t.Errorf("unique index on %s exists on SQLite but no migration creates it", key)
+		}
+	}
+}
+
+// baselineSchema is the schema GORM AutoMigrate created from the models before the
+// migrations were versioned, which production databases started from
+var baselineSchema = map[string][]string{
+	"users": {"id", "email", "name", "password", "wallet", "secret_key", "created_at", "updated_at"},
+	"groups": {"id", "name", "description", "wallet", "secret_key", "creator_id", "contract_id", "status",
+		"contribution_amount", "contribution_period", "payout_order", "current_round", "max_members",
+		"min_members", "next_contribution_date", "is_approved", "created_at", "updated_at"},
+	"members":           {"id", "group_id", "user_id", "wallet", "role", "joined_at", "status"},
+	"contributions":     {"id", "group_id", "user_id", "amount", "round", "status", "tx_hash", "created_at", "updated_at"},
+	"group_invitations": {"id", "group_id", "inviter_id", "email", "user_id", "status", "created_at", "expires_at"},
+	"admin_nominations": {"id", "group_id", "nominator_id", "nominee_id", "status", "created_at"},
+	"payout_requests":   {"id", "group_id", "recipient_id", "amount", "round", "status", "created_at"},
+	"payout_approvals":  {"id", "payout_request_id", "admin_id", "approved", "created_at"},
+	"payout_schedules": {"id", "group_id", "member_id", "round", "amount", "due_date", "status", "paid_at",
+		"tx_hash", "created_at", "updated_at"},
+	"notifications": {"id", "user_id", "group_id", "type", "title", "data", "status", "message", "read", "created_at"},
+	"round_contributions": {"id", "group_id", "member_id", "round", "amount", "status", "tx_hash",
+		"created_at", "updated_at"},
+	"round_statuses": {"id", "group_id", "round", "total_required", "total_received", "contributors_count",
+		"required_count", "status", "payout_authorized", "created_at", "updated_at"},
+}
+
+// TestMigrationsUpgradeBaselineSchema checks a database AutoMigrate created ends up with
+// the same tables, columns and unique indexes as a new one once the migrations have run
+func TestMigrationsUpgradeBaselineSchema(t *testing.T) {
+	want, wantUnique := postgresSchema(t)
+
+	tables := map[string]map[string]bool{}
+	for table, columns := range baselineSchema {
+		tables[table] = map[string]bool{}
+		for _, column := range columns {
+			tables[table][column] = true
+		}
+	}
+	unique := map[string]string{"uni_users_email": "users(email)"}
+	replayMigrations(t, tables, unique)
+
+	for _, table := range sortedKeys(mapKeys(want)) {
+		if tables[table] == nil {
+			t.Errorf("table %s is missing after upgrading", table)
+			continue
+		}
+		for _, column := range sortedKeys(want[table]) {
+			if !tables[table][column] {
+				t.Errorf("column %s.%s is missing after upgrading", table, column)
+			}
+		}
+		for _, column := range sortedKeys(tables[table]) {
+			if !want[table][column] {
+				t.Errorf("column %s.%s exists after upgrading but not on a new database", table, column)
+			}
+		}
+	}
+	for _, table := range sortedKeys(mapKeys(tables)) {
+		if want[table] == nil {
+			t.Errorf("table %s exists after upgrading but not on a new database", table)
+		}
+	}
+
+	got, wantSet := map[string]bool{}, map[string]bool{}
+	for _, key := range unique {
+		got[key] = true
+	}
+	for _, key := range wantUnique {
+		wantSet[key] = true
+	}
+	for _, key := range sortedKeys(wantSet) {
+		if !got[key] {
+			t.Errorf("unique index on %s is missing after upgrading", key)
+		}
+	}
+	for _, key := range sortedKeys(got) {
+		if !wantSet[key] {
+			t.Errorf("unique index on %s exists after upgrading but not on a new database", key)
+		}
+	}
+}
+
+func mapKeys(m map[string]map[string]bool) map[string]bool {
+	keys := map[string]bool{}
+	for key := range m {
+		keys[key] = true
+	}
+	return keys
+}
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS round_statuses;
+DROP TABLE IF EXISTS round_contributions;
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS payout_schedules;
+DROP TABLE IF EXISTS payout_approvals;
+DROP TABLE IF EXISTS payout_requests;
+DROP TABLE IF EXISTS admin_nominations;
+DROP TABLE IF EXISTS group_invitations;
+DROP TABLE IF EXISTS contributions;
+DROP TABLE IF EXISTS members;
+DROP TABLE IF EXISTS groups;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,148 @@
+-- Schema as created by GORM AutoMigrate before versioned migrations. Databases it
+-- created already have these tables, which are left alone; columns added since then
+-- come in later migrations.
+
+CREATE TABLE IF NOT EXISTS users (
+    id         text PRIMARY KEY,
+    email      text NOT NULL UNIQUE,
+    name       text NOT NULL,
+    password   text NOT NULL,
+    wallet     text,
+    secret_key text,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS groups (
+    id                     text PRIMARY KEY,
+    name                   text,
+    description            text,
+    wallet                 text,
+    secret_key             text,
+    creator_id             text,
+    contract_id            text,
+    status                 text DEFAULT 'pending',
+    contribution_amount    decimal,
+    contribution_period    bigint,
+    payout_order           text,
+    current_round          bigint DEFAULT 0,
+    max_members            bigint DEFAULT 20,
+    min_members            bigint DEFAULT 3,
+    next_contribution_date timestamptz,
+    is_approved            boolean DEFAULT false,
+    created_at             timestamptz,
+    updated_at             timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS members (
+    id        text PRIMARY KEY,
+    group_id  text,
+    user_id   text,
+    wallet    text,
+    role      text DEFAULT 'member',
+    joined_at timestamptz,
+    status    text DEFAULT 'pending'
+);
+
+CREATE TABLE IF NOT EXISTS contributions (
+    id         text PRIMARY KEY,
+    group_id   text,
+    user_id    text,
+    amount     decimal,
+    round      bigint,
+    status     text DEFAULT 'pending',
+    tx_hash    text,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS group_invitations (
+    id         text PRIMARY KEY,
+    group_id   text,
+    inviter_id text,
+    email      text,
+    user_id    text,
+    status     text DEFAULT 'pending',
+    created_at timestamptz,
+    expires_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS admin_nominations (
+    id           text PRIMARY KEY,
+    group_id     text,
+    nominator_id text,
+    nominee_id   text,
+    status       text DEFAULT 'pending',
+    created_at   timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS payout_requests (
+    id            text PRIMARY KEY,
+    group_id      text,
+    recipient_id  text,
+    amount        decimal,
+    round         bigint,
+    status        text DEFAULT 'pending',
+    created_at    timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS payout_approvals (
+    id                text PRIMARY KEY,
+    payout_request_id text,
+    admin_id          text,
+    approved          boolean,
+    created_at        timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS payout_schedules (
+    id         text PRIMARY KEY,
+    group_id   text,
+    member_id  text,
+    round      bigint,
+    amount     decimal,
+    due_date   timestamptz,
+    status     text DEFAULT 'scheduled',
+    paid_at    timestamptz,
+    tx_hash    text,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id         text PRIMARY KEY,
+    user_id    text,
+    group_id   text,
+    type       text,
+    title      text,
+    data       text,
+    status     text,
+    message    text,
+    read       boolean DEFAULT false,
+    created_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS round_contributions (
+    id            text PRIMARY KEY,
+    group_id      text,
+    member_id     text,
+    round         bigint,
+    amount        decimal,
+    status        text DEFAULT 'pending',
+    tx_hash       text,
+    created_at    timestamptz,
+    updated_at    timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS round_statuses (
+    id                 text PRIMARY KEY,
+    group_id           text,
+    round              bigint,
+    total_required     decimal,
+    total_received     decimal,
+    contributors_count bigint,
+    required_count     bigint,
+    status             text DEFAULT 'collecting',
+    payout_authorized  boolean DEFAULT false,
+    created_at         timestamptz,
+    updated_at         timestamptz
+);
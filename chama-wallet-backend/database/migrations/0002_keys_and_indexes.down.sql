@@ -0,0 +1,31 @@
+-- Merged duplicate rows are not restored
+ALTER TABLE round_statuses DROP CONSTRAINT IF EXISTS fk_round_statuses_group;
+ALTER TABLE round_contributions DROP CONSTRAINT IF EXISTS fk_round_contributions_group, DROP CONSTRAINT IF EXISTS fk_round_contributions_member;
+ALTER TABLE notifications DROP CONSTRAINT IF EXISTS fk_notifications_user;
+ALTER TABLE payout_schedules DROP CONSTRAINT IF EXISTS fk_payout_schedules_group, DROP CONSTRAINT IF EXISTS fk_payout_schedules_member;
+ALTER TABLE payout_approvals DROP CONSTRAINT IF EXISTS fk_payout_approvals_payout_request, DROP CONSTRAINT IF EXISTS fk_payout_approvals_admin;
+ALTER TABLE payout_requests DROP CONSTRAINT IF EXISTS fk_payout_requests_group, DROP CONSTRAINT IF EXISTS fk_payout_requests_recipient;
+ALTER TABLE admin_nominations DROP CONSTRAINT IF EXISTS fk_admin_nominations_group,
+    DROP CONSTRAINT IF EXISTS fk_admin_nominations_nominator, DROP CONSTRAINT IF EXISTS fk_admin_nominations_nominee;
+ALTER TABLE group_invitations DROP CONSTRAINT IF EXISTS fk_group_invitations_group, DROP CONSTRAINT IF EXISTS fk_group_invitations_inviter;
+ALTER TABLE contributions DROP CONSTRAINT IF EXISTS fk_contributions_group, DROP CONSTRAINT IF EXISTS fk_contributions_user;
+ALTER TABLE members DROP CONSTRAINT IF EXISTS fk_members_group, DROP CONSTRAINT IF EXISTS fk_members_user;
+ALTER TABLE groups DROP CONSTRAINT IF EXISTS fk_groups_creator;
+
+DROP INDEX IF EXISTS idx_round_statuses_group_round;
+DROP INDEX IF EXISTS idx_round_contributions_tx_hash;
+DROP INDEX IF EXISTS idx_notifications_user_created;
+DROP INDEX IF EXISTS idx_payout_schedules_group_round;
+DROP INDEX IF EXISTS idx_payout_requests_status;
+DROP INDEX IF EXISTS idx_payout_requests_group_round;
+DROP INDEX IF EXISTS idx_admin_nominations_group;
+DROP INDEX IF EXISTS idx_group_invitations_email;
+DROP INDEX IF EXISTS idx_group_invitations_group;
+DROP INDEX IF EXISTS idx_contributions_user;
+DROP INDEX IF EXISTS idx_contributions_group;
+DROP INDEX IF EXISTS idx_groups_creator;
+DROP INDEX IF EXISTS idx_members_user;
+
+DROP INDEX IF EXISTS idx_payout_approvals_request_admin;
+DROP INDEX IF EXISTS idx_round_contributions_member_round;
+DROP INDEX IF EXISTS idx_members_group_user;
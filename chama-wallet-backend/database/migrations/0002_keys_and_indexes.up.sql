@@ -0,0 +1,106 @@
+-- Unique keys, foreign keys and indexes.
+--
+-- Duplicate members left by concurrent joins are merged into the row that is furthest
+-- along (approved, then pending, then the earliest), with their contributions and
+-- schedule entries moved over. Duplicate round contributions that never reached the
+-- ledger are dropped. Two confirmed contributions for the same member and round are
+-- real payments and stop this migration; resolve them by hand and run it again.
+
+CREATE TEMP TABLE member_duplicates ON COMMIT DROP AS
+SELECT id, first_value(id) OVER (
+           PARTITION BY group_id, user_id
+           ORDER BY CASE status WHEN 'approved' THEN 0 WHEN 'pending' THEN 1 ELSE 2 END, joined_at, id
+       ) AS keep_id
+FROM members;
+
+UPDATE round_contributions rc SET member_id = d.keep_id
+FROM member_duplicates d WHERE rc.member_id = d.id AND d.id <> d.keep_id;
+
+UPDATE payout_schedules ps SET member_id = d.keep_id
+FROM member_duplicates d WHERE ps.member_id = d.id AND d.id <> d.keep_id;
+
+DELETE FROM members m USING member_duplicates d WHERE m.id = d.id AND d.id <> d.keep_id;
+
+DELETE FROM round_contributions WHERE id IN (
+    SELECT id FROM (
+        SELECT id, status, row_number() OVER (
+                   PARTITION BY group_id, member_id, round
+                   ORDER BY CASE status WHEN 'confirmed' THEN 0 WHEN 'pending' THEN 1 WHEN 'awaiting_signature' THEN 2 ELSE 3 END, created_at, id
+               ) AS rank
+        FROM round_contributions
+    ) ranked
+    WHERE rank > 1 AND status <> 'confirmed'
+);
+
+DELETE FROM payout_approvals WHERE id IN (
+    SELECT id FROM (
+        SELECT id, row_number() OVER (PARTITION BY payout_request_id, admin_id ORDER BY created_at, id) AS rank
+        FROM payout_approvals
+    ) ranked
+    WHERE rank > 1
+);
+
+CREATE UNIQUE INDEX idx_members_group_user ON members (group_id, user_id);
+CREATE UNIQUE INDEX idx_round_contributions_member_round ON round_contributions (group_id, member_id, round);
+CREATE UNIQUE INDEX idx_payout_approvals_request_admin ON payout_approvals (payout_request_id, admin_id);
+
+CREATE INDEX idx_members_user ON members (user_id);
+CREATE INDEX idx_groups_creator ON groups (creator_id);
+CREATE INDEX idx_contributions_group ON contributions (group_id);
+CREATE INDEX idx_contributions_user ON contributions (user_id);
+CREATE INDEX idx_group_invitations_group ON group_invitations (group_id);
+CREATE INDEX idx_group_invitations_email ON group_invitations (email);
+CREATE INDEX idx_admin_nominations_group ON admin_nominations (group_id);
+CREATE INDEX idx_payout_requests_group_round ON payout_requests (group_id, round);
+CREATE INDEX idx_payout_requests_status ON payout_requests (status);
+CREATE INDEX idx_payout_schedules_group_round ON payout_schedules (group_id, round);
+CREATE INDEX idx_notifications_user_created ON notifications (user_id, created_at);
+CREATE INDEX idx_round_contributions_tx_hash ON round_contributions (tx_hash);
+CREATE INDEX idx_round_statuses_group_round ON round_statuses (group_id, round);
+
+-- Foreign keys GORM created on databases it migrated are replaced by the named ones below
+ALTER TABLE groups DROP CONSTRAINT IF EXISTS fk_groups_creator;
+ALTER TABLE members DROP CONSTRAINT IF EXISTS fk_groups_members, DROP CONSTRAINT IF EXISTS fk_members_user;
+ALTER TABLE contributions DROP CONSTRAINT IF EXISTS fk_groups_contributions,
+    DROP CONSTRAINT IF EXISTS fk_contributions_group, DROP CONSTRAINT IF EXISTS fk_contributions_user;
+ALTER TABLE group_invitations DROP CONSTRAINT IF EXISTS fk_group_invitations_group,
+    DROP CONSTRAINT IF EXISTS fk_group_invitations_inviter, DROP CONSTRAINT IF EXISTS fk_group_invitations_user;
+ALTER TABLE admin_nominations DROP CONSTRAINT IF EXISTS fk_admin_nominations_group,
+    DROP CONSTRAINT IF EXISTS fk_admin_nominations_nominator, DROP CONSTRAINT IF EXISTS fk_admin_nominations_nominee;
+ALTER TABLE payout_requests DROP CONSTRAINT IF EXISTS fk_payout_requests_group, DROP CONSTRAINT IF EXISTS fk_payout_requests_recipient;
+ALTER TABLE payout_approvals DROP CONSTRAINT IF EXISTS fk_payout_requests_approvals,
+    DROP CONSTRAINT IF EXISTS fk_payout_approvals_payout_request, DROP CONSTRAINT IF EXISTS fk_payout_approvals_admin;
+ALTER TABLE payout_schedules DROP CONSTRAINT IF EXISTS fk_payout_schedules_group, DROP CONSTRAINT IF EXISTS fk_payout_schedules_member;
+ALTER TABLE notifications DROP CONSTRAINT IF EXISTS fk_notifications_user, DROP CONSTRAINT IF EXISTS fk_notifications_group;
+ALTER TABLE round_contributions DROP CONSTRAINT IF EXISTS fk_round_contributions_group, DROP CONSTRAINT IF EXISTS fk_round_contributions_member;
+ALTER TABLE round_statuses DROP CONSTRAINT IF EXISTS fk_round_statuses_group;
+
+-- NOT VALID enforces the keys on new rows without failing on orphans already stored
+ALTER TABLE groups ADD CONSTRAINT fk_groups_creator FOREIGN KEY (creator_id) REFERENCES users (id) NOT VALID;
+ALTER TABLE members
+    ADD CONSTRAINT fk_members_group FOREIGN KEY (group_id) REFERENCES groups (id) NOT VALID,
+    ADD CONSTRAINT fk_members_user FOREIGN KEY (user_id) REFERENCES users (id) NOT VALID;
+ALTER TABLE contributions
+    ADD CONSTRAINT fk_contributions_group FOREIGN KEY (group_id) REFERENCES groups (id) NOT VALID,
+    ADD CONSTRAINT fk_contributions_user FOREIGN KEY (user_id) REFERENCES users (id) NOT VALID;
+ALTER TABLE group_invitations
+    ADD CONSTRAINT fk_group_invitations_group FOREIGN KEY (group_id) REFERENCES groups (id) NOT VALID,
+    ADD CONSTRAINT fk_group_invitations_inviter FOREIGN KEY (inviter_id) REFERENCES users (id) NOT VALID;
+ALTER TABLE admin_nominations
+    ADD CONSTRAINT fk_admin_nominations_group FOREIGN KEY (group_id) REFERENCES groups (id) NOT VALID,
+    ADD CONSTRAINT fk_admin_nominations_nominator FOREIGN KEY (nominator_id) REFERENCES users (id) NOT VALID,
+    ADD CONSTRAINT fk_admin_nominations_nominee FOREIGN KEY (nominee_id) REFERENCES users (id) NOT VALID;
+ALTER TABLE payout_requests
+    ADD CONSTRAINT fk_payout_requests_group FOREIGN KEY (group_id) REFERENCES groups (id) NOT VALID,
+    ADD CONSTRAINT fk_payout_requests_recipient FOREIGN KEY (recipient_id) REFERENCES users (id) NOT VALID;
+ALTER TABLE payout_approvals
+    ADD CONSTRAINT fk_payout_approvals_payout_request FOREIGN KEY (payout_request_id) REFERENCES payout_requests (id) NOT VALID,
+    ADD CONSTRAINT fk_payout_approvals_admin FOREIGN KEY (admin_id) REFERENCES users (id) NOT VALID;
+ALTER TABLE payout_schedules
+    ADD CONSTRAINT fk_payout_schedules_group FOREIGN KEY (group_id) REFERENCES groups (id) NOT VALID,
+    ADD CONSTRAINT fk_payout_schedules_member FOREIGN KEY (member_id) REFERENCES members (id) NOT VALID;
+ALTER TABLE notifications ADD CONSTRAINT fk_notifications_user FOREIGN KEY (user_id) REFERENCES users (id) NOT VALID;
+ALTER TABLE round_contributions
+    ADD CONSTRAINT fk_round_contributions_group FOREIGN KEY (group_id) REFERENCES groups (id) NOT VALID,
+    ADD CONSTRAINT fk_round_contributions_member FOREIGN KEY (member_id) REFERENCES members (id) NOT VALID;
+ALTER TABLE round_statuses ADD CONSTRAINT fk_round_statuses_group FOREIGN KEY (group_id) REFERENCES groups (id) NOT VALID;
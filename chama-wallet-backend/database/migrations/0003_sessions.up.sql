@@ -0,0 +1,18 @@
+-- Signed-in devices and their rotating refresh tokens
+CREATE TABLE sessions (
+    id                    text PRIMARY KEY,
+    user_id               text NOT NULL,
+    refresh_token_hash    text NOT NULL,
+    previous_refresh_hash text,
+    user_agent            text,
+    ip                    text,
+    created_at            timestamptz,
+    last_used_at          timestamptz,
+    expires_at            timestamptz,
+    revoked_at            timestamptz,
+    CONSTRAINT fk_sessions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX idx_sessions_refresh_token_hash ON sessions (refresh_token_hash);
+CREATE INDEX idx_sessions_previous_refresh_hash ON sessions (previous_refresh_hash);
+CREATE INDEX idx_sessions_user_id ON sessions (user_id);
+CREATE INDEX idx_sessions_expires_at ON sessions (expires_at);
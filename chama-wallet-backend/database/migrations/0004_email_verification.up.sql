@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN email_verified_at timestamptz;
+
+-- Accounts that existed before verification are trusted as they are, so members already
+-- in groups keep receiving their payouts
+UPDATE users SET email_verified_at = COALESCE(created_at, now());
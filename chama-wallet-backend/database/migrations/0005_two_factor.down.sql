@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS recovery_codes;
+ALTER TABLE groups DROP COLUMN IF EXISTS require_step_up;
+ALTER TABLE sessions DROP COLUMN IF EXISTS step_up_at;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_last_step;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_enabled_at;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_secret;
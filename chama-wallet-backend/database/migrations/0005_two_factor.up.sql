@@ -0,0 +1,18 @@
+-- TOTP enrolment, recovery codes and second-factor step-up
+ALTER TABLE users ADD COLUMN totp_secret text;
+ALTER TABLE users ADD COLUMN totp_enabled_at timestamptz;
+ALTER TABLE users ADD COLUMN totp_last_step bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE sessions ADD COLUMN step_up_at timestamptz;
+
+ALTER TABLE groups ADD COLUMN require_step_up boolean NOT NULL DEFAULT false;
+
+CREATE TABLE recovery_codes (
+    id         text PRIMARY KEY,
+    user_id    text NOT NULL,
+    code_hash  text NOT NULL,
+    used_at    timestamptz,
+    created_at timestamptz,
+    CONSTRAINT fk_recovery_codes_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes (user_id);
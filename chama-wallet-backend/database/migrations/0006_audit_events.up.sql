@@ -0,0 +1,33 @@
+-- Append-only audit log of financial and governance actions. Each event carries the hash
+-- of the previous event in its group's chain; the trigger rejects edits and deletes.
+CREATE TABLE audit_events (
+    id           bigserial PRIMARY KEY,
+    group_id     text NOT NULL DEFAULT '',
+    actor_id     text NOT NULL,
+    action       text NOT NULL,
+    target_id    text NOT NULL DEFAULT '',
+    before_state text NOT NULL DEFAULT '',
+    after_state  text NOT NULL DEFAULT '',
+    ip           text NOT NULL DEFAULT '',
+    request_id   text NOT NULL DEFAULT '',
+    created_at   timestamptz NOT NULL,
+    prev_hash    text NOT NULL DEFAULT '',
+    hash         text NOT NULL
+);
+CREATE UNIQUE INDEX idx_audit_events_hash ON audit_events (hash);
+CREATE INDEX idx_audit_events_group_created ON audit_events (group_id, created_at);
+CREATE INDEX idx_audit_events_actor_id ON audit_events (actor_id);
+
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TRIGGER audit_events_no_truncate
+    BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,15 @@
+-- Token buckets shared by the server replicas, and failed sign-in counts for lockout
+CREATE TABLE rate_limit_buckets (
+    bucket_key text PRIMARY KEY,
+    tokens     double precision NOT NULL,
+    updated_at timestamptz NOT NULL
+);
+CREATE INDEX idx_rate_limit_buckets_updated_at ON rate_limit_buckets (updated_at);
+
+CREATE TABLE login_throttles (
+    email        text PRIMARY KEY,
+    failures     bigint NOT NULL DEFAULT 0,
+    locked_until timestamptz,
+    updated_at   timestamptz NOT NULL
+);
+CREATE INDEX idx_login_throttles_updated_at ON login_throttles (updated_at);
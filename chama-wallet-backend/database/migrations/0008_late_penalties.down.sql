@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS penalties;
+
+ALTER TABLE groups DROP COLUMN IF EXISTS late_fine_amount;
+ALTER TABLE groups DROP COLUMN IF EXISTS late_fine_kind;
+ALTER TABLE groups DROP COLUMN IF EXISTS grace_period_hours;
@@ -0,0 +1,27 @@
+-- Grace periods and late fines, and the fines members owe for late contributions
+ALTER TABLE groups ADD COLUMN grace_period_hours bigint NOT NULL DEFAULT 0;
+ALTER TABLE groups ADD COLUMN late_fine_kind text NOT NULL DEFAULT 'none';
+ALTER TABLE groups ADD COLUMN late_fine_amount decimal NOT NULL DEFAULT 0;
+
+CREATE TABLE penalties (
+    id              text PRIMARY KEY,
+    group_id        text NOT NULL,
+    member_id       text NOT NULL,
+    round           bigint NOT NULL,
+    contribution_id text,
+    amount          decimal NOT NULL,
+    days_late       bigint NOT NULL DEFAULT 0,
+    status          text NOT NULL DEFAULT 'owed',
+    tx_hash         text,
+    memo            text,
+    submitted_xdr   text,
+    paid_at         timestamptz,
+    waived_by       text,
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    CONSTRAINT fk_penalties_group FOREIGN KEY (group_id) REFERENCES groups (id),
+    CONSTRAINT fk_penalties_member FOREIGN KEY (member_id) REFERENCES members (id)
+);
+CREATE UNIQUE INDEX idx_penalties_member_round ON penalties (group_id, member_id, round);
+CREATE INDEX idx_penalties_tx_hash ON penalties (tx_hash);
+CREATE INDEX idx_penalties_memo ON penalties (memo);
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS loan_repayments;
+DROP TABLE IF EXISTS loan_installments;
+DROP TABLE IF EXISTS loan_guarantors;
+DROP TABLE IF EXISTS loans;
+
+ALTER TABLE payout_requests DROP COLUMN IF EXISTS loan_id;
+
+ALTER TABLE groups DROP COLUMN IF EXISTS loan_max_multiple;
+ALTER TABLE groups DROP COLUMN IF EXISTS loan_guarantors;
+ALTER TABLE groups DROP COLUMN IF EXISTS loan_max_term_months;
+ALTER TABLE groups DROP COLUMN IF EXISTS loan_interest_rate;
+ALTER TABLE groups DROP COLUMN IF EXISTS group_type;
@@ -0,0 +1,76 @@
+-- Savings and credit (ASCA) groups: loan terms, loans, guarantors, schedules and repayments
+ALTER TABLE groups ADD COLUMN group_type text NOT NULL DEFAULT 'rotating';
+ALTER TABLE groups ADD COLUMN loan_interest_rate decimal NOT NULL DEFAULT 0;
+ALTER TABLE groups ADD COLUMN loan_max_term_months bigint NOT NULL DEFAULT 12;
+ALTER TABLE groups ADD COLUMN loan_guarantors bigint NOT NULL DEFAULT 0;
+ALTER TABLE groups ADD COLUMN loan_max_multiple decimal NOT NULL DEFAULT 0;
+
+ALTER TABLE payout_requests ADD COLUMN loan_id text;
+
+CREATE TABLE loans (
+    id                text PRIMARY KEY,
+    group_id          text NOT NULL,
+    member_id         text NOT NULL,
+    principal         decimal NOT NULL,
+    interest_rate     decimal NOT NULL DEFAULT 0,
+    term_months       bigint NOT NULL,
+    total_due         decimal NOT NULL,
+    amount_repaid     decimal NOT NULL DEFAULT 0,
+    purpose           text,
+    status            text NOT NULL DEFAULT 'pending',
+    payout_request_id text,
+    tx_hash           text,
+    disbursed_at      timestamptz,
+    created_at        timestamptz,
+    updated_at        timestamptz,
+    CONSTRAINT fk_loans_group FOREIGN KEY (group_id) REFERENCES groups (id),
+    CONSTRAINT fk_loans_member FOREIGN KEY (member_id) REFERENCES members (id)
+);
+CREATE INDEX idx_loans_group_id ON loans (group_id);
+CREATE INDEX idx_loans_member_id ON loans (member_id);
+CREATE INDEX idx_loans_payout_request_id ON loans (payout_request_id);
+
+CREATE TABLE loan_guarantors (
+    id           text PRIMARY KEY,
+    loan_id      text NOT NULL,
+    member_id    text NOT NULL,
+    status       text NOT NULL DEFAULT 'pending',
+    responded_at timestamptz,
+    created_at   timestamptz,
+    CONSTRAINT fk_loan_guarantors_loan FOREIGN KEY (loan_id) REFERENCES loans (id) ON DELETE CASCADE,
+    CONSTRAINT fk_loan_guarantors_member FOREIGN KEY (member_id) REFERENCES members (id)
+);
+CREATE UNIQUE INDEX idx_loan_guarantors_loan_member ON loan_guarantors (loan_id, member_id);
+
+CREATE TABLE loan_installments (
+    id          text PRIMARY KEY,
+    loan_id     text NOT NULL,
+    number      bigint NOT NULL,
+    due_date    timestamptz NOT NULL,
+    principal   decimal NOT NULL,
+    interest    decimal NOT NULL,
+    amount      decimal NOT NULL,
+    amount_paid decimal NOT NULL DEFAULT 0,
+    status      text NOT NULL DEFAULT 'due',
+    paid_at     timestamptz,
+    CONSTRAINT fk_loan_installments_loan FOREIGN KEY (loan_id) REFERENCES loans (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX idx_loan_installments_loan_number ON loan_installments (loan_id, number);
+
+CREATE TABLE loan_repayments (
+    id            text PRIMARY KEY,
+    loan_id       text NOT NULL,
+    group_id      text NOT NULL,
+    member_id     text NOT NULL,
+    amount        decimal NOT NULL,
+    status        text NOT NULL DEFAULT 'awaiting_signature',
+    tx_hash       text,
+    memo          text,
+    submitted_xdr text,
+    created_at    timestamptz,
+    updated_at    timestamptz,
+    CONSTRAINT fk_loan_repayments_loan FOREIGN KEY (loan_id) REFERENCES loans (id)
+);
+CREATE INDEX idx_loan_repayments_loan_id ON loan_repayments (loan_id);
+CREATE INDEX idx_loan_repayments_tx_hash ON loan_repayments (tx_hash);
+CREATE INDEX idx_loan_repayments_memo ON loan_repayments (memo);
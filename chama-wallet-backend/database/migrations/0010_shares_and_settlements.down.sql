@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS settlement_payouts;
+DROP TABLE IF EXISTS settlements;
+DROP TABLE IF EXISTS profit_entries;
+
+DROP INDEX IF EXISTS idx_payout_requests_settlement_id;
+ALTER TABLE payout_requests DROP COLUMN IF EXISTS settlement_id;
+
+ALTER TABLE round_contributions DROP COLUMN IF EXISTS shares;
+
+ALTER TABLE groups DROP COLUMN IF EXISTS cycle_start_round;
+ALTER TABLE groups DROP COLUMN IF EXISTS cycle;
+ALTER TABLE groups DROP COLUMN IF EXISTS cycle_rounds;
+ALTER TABLE groups DROP COLUMN IF EXISTS share_price;
@@ -0,0 +1,60 @@
+-- Shares bought with savings and credit contributions, group profit and end-of-cycle share-outs
+ALTER TABLE groups ADD COLUMN share_price decimal NOT NULL DEFAULT 1;
+ALTER TABLE groups ADD COLUMN cycle_rounds bigint NOT NULL DEFAULT 12;
+ALTER TABLE groups ADD COLUMN cycle bigint NOT NULL DEFAULT 1;
+ALTER TABLE groups ADD COLUMN cycle_start_round bigint NOT NULL DEFAULT 1;
+
+ALTER TABLE round_contributions ADD COLUMN shares decimal NOT NULL DEFAULT 0;
+
+ALTER TABLE payout_requests ADD COLUMN settlement_id text;
+CREATE INDEX idx_payout_requests_settlement_id ON payout_requests (settlement_id);
+
+CREATE TABLE profit_entries (
+    id            text PRIMARY KEY,
+    group_id      text NOT NULL,
+    source        text NOT NULL,
+    source_id     text NOT NULL,
+    amount        decimal NOT NULL,
+    settlement_id text NOT NULL DEFAULT '',
+    created_at    timestamptz,
+    CONSTRAINT fk_profit_entries_group FOREIGN KEY (group_id) REFERENCES groups (id)
+);
+CREATE INDEX idx_profit_entries_group_id ON profit_entries (group_id);
+CREATE UNIQUE INDEX idx_profit_entries_source ON profit_entries (source, source_id);
+CREATE INDEX idx_profit_entries_settlement_id ON profit_entries (settlement_id);
+
+CREATE TABLE settlements (
+    id           text PRIMARY KEY,
+    group_id     text NOT NULL,
+    cycle        bigint NOT NULL,
+    from_round   bigint NOT NULL,
+    to_round     bigint NOT NULL,
+    total_shares decimal NOT NULL,
+    savings      decimal NOT NULL,
+    profit       decimal NOT NULL,
+    total        decimal NOT NULL,
+    status       text NOT NULL DEFAULT 'approving',
+    completed_at timestamptz,
+    created_at   timestamptz,
+    updated_at   timestamptz,
+    CONSTRAINT fk_settlements_group FOREIGN KEY (group_id) REFERENCES groups (id)
+);
+CREATE INDEX idx_settlements_group_id ON settlements (group_id);
+
+CREATE TABLE settlement_payouts (
+    id                text PRIMARY KEY,
+    settlement_id     text NOT NULL,
+    member_id         text NOT NULL,
+    wallet            text NOT NULL,
+    shares            decimal NOT NULL,
+    contributed       decimal NOT NULL,
+    amount            decimal NOT NULL,
+    batch             bigint NOT NULL,
+    payout_request_id text,
+    status            text NOT NULL DEFAULT 'scheduled',
+    tx_hash           text,
+    CONSTRAINT fk_settlement_payouts_settlement FOREIGN KEY (settlement_id) REFERENCES settlements (id) ON DELETE CASCADE,
+    CONSTRAINT fk_settlement_payouts_member FOREIGN KEY (member_id) REFERENCES members (id)
+);
+CREATE INDEX idx_settlement_payouts_settlement_id ON settlement_payouts (settlement_id);
+CREATE INDEX idx_settlement_payouts_payout_request_id ON settlement_payouts (payout_request_id);
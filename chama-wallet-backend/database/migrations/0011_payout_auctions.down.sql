@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS payout_bids;
+DROP TABLE IF EXISTS bid_windows;
+
+ALTER TABLE payout_schedules DROP COLUMN IF EXISTS discount;
+
+ALTER TABLE groups DROP COLUMN IF EXISTS auction_discount_to;
+ALTER TABLE groups DROP COLUMN IF EXISTS payout_mode;
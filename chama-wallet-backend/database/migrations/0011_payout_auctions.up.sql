@@ -0,0 +1,34 @@
+-- Auctioned payout order: sealed bids for each round's pot
+ALTER TABLE groups ADD COLUMN payout_mode text NOT NULL DEFAULT 'fixed';
+ALTER TABLE groups ADD COLUMN auction_discount_to text NOT NULL DEFAULT 'members';
+
+ALTER TABLE payout_schedules ADD COLUMN discount decimal NOT NULL DEFAULT 0;
+
+CREATE TABLE bid_windows (
+    id          text PRIMARY KEY,
+    group_id    text NOT NULL,
+    round       bigint NOT NULL,
+    pot         decimal NOT NULL,
+    discount_to text NOT NULL,
+    status      text NOT NULL DEFAULT 'open',
+    closes_at   timestamptz NOT NULL,
+    winner_id   text,
+    discount    decimal NOT NULL DEFAULT 0,
+    closed_at   timestamptz,
+    created_at  timestamptz,
+    updated_at  timestamptz,
+    CONSTRAINT fk_bid_windows_group FOREIGN KEY (group_id) REFERENCES groups (id)
+);
+CREATE UNIQUE INDEX idx_bid_windows_group_round ON bid_windows (group_id, round);
+
+CREATE TABLE payout_bids (
+    id         text PRIMARY KEY,
+    window_id  text NOT NULL,
+    member_id  text NOT NULL,
+    discount   decimal NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    CONSTRAINT fk_payout_bids_window FOREIGN KEY (window_id) REFERENCES bid_windows (id) ON DELETE CASCADE,
+    CONSTRAINT fk_payout_bids_member FOREIGN KEY (member_id) REFERENCES members (id)
+);
+CREATE UNIQUE INDEX idx_payout_bids_window_member ON payout_bids (window_id, member_id);
@@ -0,0 +1,7 @@
+ALTER TABLE groups DROP COLUMN IF EXISTS drawn_at;
+ALTER TABLE groups DROP COLUMN IF EXISTS draw_size;
+ALTER TABLE groups DROP COLUMN IF EXISTS draw_seed;
+ALTER TABLE groups DROP COLUMN IF EXISTS draw_ledger_hash;
+ALTER TABLE groups DROP COLUMN IF EXISTS draw_ledger;
+ALTER TABLE groups DROP COLUMN IF EXISTS draw_secret;
+ALTER TABLE groups DROP COLUMN IF EXISTS draw_commitment;
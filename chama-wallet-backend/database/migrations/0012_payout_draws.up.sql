@@ -0,0 +1,8 @@
+-- Drawn payout order: a committed secret combined with a future ledger hash
+ALTER TABLE groups ADD COLUMN draw_commitment text;
+ALTER TABLE groups ADD COLUMN draw_secret text;
+ALTER TABLE groups ADD COLUMN draw_ledger integer NOT NULL DEFAULT 0;
+ALTER TABLE groups ADD COLUMN draw_ledger_hash text;
+ALTER TABLE groups ADD COLUMN draw_seed text;
+ALTER TABLE groups ADD COLUMN draw_size bigint NOT NULL DEFAULT 0;
+ALTER TABLE groups ADD COLUMN drawn_at timestamptz;
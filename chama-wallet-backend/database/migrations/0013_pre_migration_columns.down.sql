@@ -0,0 +1,24 @@
+DROP TABLE IF EXISTS payment_cursors;
+DROP TABLE IF EXISTS idempotency_keys;
+DROP TABLE IF EXISTS scheduled_jobs;
+
+ALTER TABLE round_statuses DROP COLUMN IF EXISTS deadline;
+ALTER TABLE round_contributions
+    DROP COLUMN IF EXISTS memo,
+    DROP COLUMN IF EXISTS submitted_xdr;
+ALTER TABLE payout_approvals DROP COLUMN IF EXISTS signature;
+ALTER TABLE payout_requests
+    DROP COLUMN IF EXISTS envelope_xdr,
+    DROP COLUMN IF EXISTS tx_hash,
+    DROP COLUMN IF EXISTS submitted_xdr,
+    DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE groups
+    DROP COLUMN IF EXISTS multisig,
+    DROP COLUMN IF EXISTS treasury_signers,
+    DROP COLUMN IF EXISTS payout_threshold,
+    DROP COLUMN IF EXISTS signer_threshold,
+    DROP COLUMN IF EXISTS approval_policy,
+    DROP COLUMN IF EXISTS approval_count,
+    DROP COLUMN IF EXISTS approval_percent,
+    DROP COLUMN IF EXISTS approval_expiry_hours,
+    DROP COLUMN IF EXISTS approval_veto;
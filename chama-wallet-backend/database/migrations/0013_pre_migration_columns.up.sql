@@ -0,0 +1,66 @@
+-- Columns and tables added before the schema was versioned. 0001 is the schema GORM
+-- AutoMigrate created, so databases it migrated get these here. Earlier versions of
+-- 0001 created them on new databases, hence IF NOT EXISTS.
+
+-- Multisig treasuries and payout approval policies
+ALTER TABLE groups
+    ADD COLUMN IF NOT EXISTS multisig boolean DEFAULT false,
+    ADD COLUMN IF NOT EXISTS treasury_signers text,
+    ADD COLUMN IF NOT EXISTS payout_threshold bigint DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS signer_threshold bigint DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS approval_policy text DEFAULT 'count',
+    ADD COLUMN IF NOT EXISTS approval_count bigint DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS approval_percent bigint DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS approval_expiry_hours bigint DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS approval_veto boolean DEFAULT false;
+
+-- Signed payout envelopes and their submission
+ALTER TABLE payout_requests
+    ADD COLUMN IF NOT EXISTS envelope_xdr text,
+    ADD COLUMN IF NOT EXISTS tx_hash text,
+    ADD COLUMN IF NOT EXISTS submitted_xdr text,
+    ADD COLUMN IF NOT EXISTS expires_at timestamptz;
+ALTER TABLE payout_approvals ADD COLUMN IF NOT EXISTS signature text;
+
+-- Client-signed contributions, matched by memo
+ALTER TABLE round_contributions
+    ADD COLUMN IF NOT EXISTS memo text,
+    ADD COLUMN IF NOT EXISTS submitted_xdr text;
+ALTER TABLE round_statuses ADD COLUMN IF NOT EXISTS deadline timestamptz;
+
+CREATE TABLE IF NOT EXISTS scheduled_jobs (
+    name         text PRIMARY KEY,
+    schedule     text,
+    next_run_at  timestamptz,
+    last_run_at  timestamptz,
+    last_status  text,
+    last_error   text,
+    last_run_ms  bigint,
+    locked_by    text,
+    locked_until timestamptz,
+    created_at   timestamptz,
+    updated_at   timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_scheduled_jobs_next_run_at ON scheduled_jobs (next_run_at);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    id              text PRIMARY KEY,
+    user_id         text,
+    key             text,
+    method          text,
+    path            text,
+    request_hash    text,
+    status          text DEFAULT 'processing',
+    response_status bigint,
+    response_body   bytea,
+    created_at      timestamptz,
+    expires_at      timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_idempotency_user_key ON idempotency_keys (user_id, key);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
+
+CREATE TABLE IF NOT EXISTS payment_cursors (
+    account    text PRIMARY KEY,
+    cursor     text,
+    updated_at timestamptz
+);
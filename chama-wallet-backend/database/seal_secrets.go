@@ -0,0 +1,49 @@
+package database
+
+import (
+	"log/slog"
+
+	"chama-wallet-backend/keystore"
+	"chama-wallet-backend/logging"
+	"chama-wallet-backend/models"
+)
+
+// SealPlaintextSecrets re-encrypts secret keys that were stored before the
+// keystore existed. It is idempotent: rows that are already sealed are skipped.
+func SealPlaintextSecrets() {
+	slog.Info("sealing plaintext secret keys")
+
+	var users []models.User
+	if err := DB.Where("secret_key <> '' AND secret_key NOT LIKE ?", "ks1:%").Find(&users).Error; err != nil {
+		logging.Fatal("failed to load users for sealing", "error", err)
+	}
+	for _, user := range users {
+		sealed, err := keystore.Default.Seal(user.SecretKey)
+		if err != nil {
+			slog.Warn("skipping user secret key", "user_id", user.ID, "error", err)
+			continue
+		}
+		if err := DB.Model(&models.User{}).Where("id = ? AND secret_key = ?", user.ID, user.SecretKey).
+			Update("secret_key", sealed).Error; err != nil {
+			logging.Fatal("failed to seal user secret key", "user_id", user.ID, "error", err)
+		}
+	}
+
+	var groups []models.Group
+	if err := DB.Where("secret_key <> '' AND secret_key NOT LIKE ?", "ks1:%").Find(&groups).Error; err != nil {
+		logging.Fatal("failed to load groups for sealing", "error", err)
+	}
+	for _, group := range groups {
+		sealed, err := keystore.Default.Seal(group.SecretKey)
+		if err != nil {
+			slog.Warn("skipping group secret key", "group_id", group.ID, "error", err)
+			continue
+		}
+		if err := DB.Model(&models.Group{}).Where("id = ? AND secret_key = ?", group.ID, group.SecretKey).
+			Update("secret_key", sealed).Error; err != nil {
+			logging.Fatal("failed to seal group secret key", "group_id", group.ID, "error", err)
+		}
+	}
+
+	slog.Info("sealed plaintext secret keys", "users", len(users), "groups", len(groups))
+}
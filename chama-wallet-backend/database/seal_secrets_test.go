@@ -0,0 +1,96 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stellar/go/keypair"
+
+	"chama-wallet-backend/keystore"
+	"chama-wallet-backend/models"
+)
+
+func TestSealPlaintextSecrets(t *testing.T) {
+	db, err := Open("sqlite", fmt.Sprintf("file:seal-%s?mode=memory&cache=shared", uuid.NewString()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Group{}); err != nil {
+		t.Fatal(err)
+	}
+	kms, err := keystore.NewEphemeralKMS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousDB, previousVault := DB, keystore.Default
+	DB, keystore.Default = db, keystore.NewVault(kms)
+	t.Cleanup(func() {
+		DB, keystore.Default = previousDB, previousVault
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	plainUser, plainGroup := keypair.MustRandom().Seed(), keypair.MustRandom().Seed()
+	alreadySealed, err := keystore.Default.Seal(keypair.MustRandom().Seed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := []interface{}{
+		&models.User{ID: "plain", Email: "plain@example.com", SecretKey: plainUser},
+		&models.User{ID: "sealed", Email: "sealed@example.com", SecretKey: alreadySealed},
+		&models.User{ID: "none", Email: "none@example.com"},
+		&models.Group{ID: "group", Name: "Group", SecretKey: plainGroup},
+	}
+	for _, row := range rows {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	secrets := func() map[string]string {
+		t.Helper()
+		var users []models.User
+		var groups []models.Group
+		if err := db.Find(&users).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Find(&groups).Error; err != nil {
+			t.Fatal(err)
+		}
+		found := map[string]string{}
+		for _, user := range users {
+			found[user.ID] = user.SecretKey
+		}
+		for _, group := range groups {
+			found[group.ID] = group.SecretKey
+		}
+		return found
+	}
+
+	SealPlaintextSecrets()
+	sealed := secrets()
+	for id, want := range map[string]string{"plain": plainUser, "group": plainGroup} {
+		if !keystore.IsSealed(sealed[id]) {
+			t.Fatalf("%s still holds %q", id, sealed[id])
+		}
+		if seed, err := keystore.Default.Reveal(sealed[id]); err != nil || seed != want {
+			t.Errorf("%s opens to %q, %v", id, seed, err)
+		}
+	}
+	if sealed["sealed"] != alreadySealed {
+		t.Error("an already sealed key was sealed again")
+	}
+	if sealed["none"] != "" {
+		t.Errorf("user without a key now holds %q", sealed["none"])
+	}
+
+	// A second run finds nothing left to seal
+	SealPlaintextSecrets()
+	for id, value := range secrets() {
+		if value != sealed[id] {
+			t.Errorf("%s changed on the second run", id)
+		}
+	}
+}
@@ -13,6 +13,10 @@ DROP TABLE IF EXISTS users CASCADE;
 DROP TABLE IF EXISTS payout_schedules CASCADE;
 DROP TABLE IF EXISTS round_contributions CASCADE;
 DROP TABLE IF EXISTS round_statuses CASCADE;
+DROP TABLE IF EXISTS scheduled_jobs CASCADE;
+DROP TABLE IF EXISTS idempotency_keys CASCADE;
+DROP TABLE IF EXISTS payment_cursors CASCADE;
+DROP TABLE IF EXISTS schema_migrations CASCADE;
 " 
 
 echo "🔄 Setting up database permissions..."
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"chama-wallet-backend/services"
+)
+
+// RequestEmailVerification sends the current user a new verification link
+func RequestEmailVerification(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	user, err := services.GetUserByID(userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	if user.EmailVerifiedAt != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Email address already verified",
+		})
+	}
+
+	if err := services.SendVerificationEmail(user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to send verification email",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Verification email sent",
+	})
+}
+
+// VerifyEmail confirms an email address from the token in a verification link
+func VerifyEmail(c *fiber.Ctx) error {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "token is required",
+		})
+	}
+
+	user, err := services.VerifyEmail(c.UserContext(), req.Token)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	audit(c, services.AuditEntry{
+		ActorID:  user.ID,
+		Action:   services.AuditEmailVerify,
+		TargetID: user.ID,
+		After:    fiber.Map{"email": user.Email},
+	})
+
+	return c.JSON(fiber.Map{
+		"message":           "Email address verified",
+		"email_verified_at": user.EmailVerifiedAt,
+	})
+}
+
+// ForgotPassword mails a password reset link. The response is the same whether or not
+// the email belongs to an account.
+func ForgotPassword(c *fiber.Ctx) error {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "email is required",
+		})
+	}
+
+	if err := services.RequestPasswordReset(req.Email); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to send password reset email",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "If an account uses that email, a reset link has been sent",
+	})
+}
+
+// ResetPassword sets a new password from the token in a reset link
+func ResetPassword(c *fiber.Ctx) error {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Token == "" || req.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "token and password are required",
+		})
+	}
+
+	user, err := services.ResetPassword(c.UserContext(), req.Token, req.Password)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	audit(c, services.AuditEntry{ActorID: user.ID, Action: services.AuditPasswordReset, TargetID: user.ID})
+
+	return c.JSON(fiber.Map{
+		"message": "Password updated, sign in again",
+	})
+}
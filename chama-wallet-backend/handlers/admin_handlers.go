@@ -2,19 +2,22 @@ package handlers
 
 import (
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 
-	"chama-wallet-backend/database"
 	"chama-wallet-backend/models"
+	"chama-wallet-backend/policy"
+	"chama-wallet-backend/repository"
 	"chama-wallet-backend/services"
 )
 
 func NominateAdmin(c *fiber.Ctx) error {
 	groupID := c.Params("id")
 	user := c.Locals("user").(models.User)
+	group := c.Locals("group").(models.Group)
 
 	var payload struct {
 		NomineeID string `json:"nominee_id"`
@@ -24,24 +27,20 @@ func NominateAdmin(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
 	}
 
-	// Check if nominator is a member
-	var nominator models.Member
-	if err := database.DB.Where("group_id = ? AND user_id = ? AND status = ?",
-		groupID, user.ID, "approved").First(&nominator).Error; err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not a group member"})
-	}
-
 	// Check if nominee is a member
-	var nominee models.Member
-	if err := database.DB.Where("group_id = ? AND user_id = ? AND status = ?",
-		groupID, payload.NomineeID, "approved").First(&nominee).Error; err != nil {
+	nominee, err := repository.Default.Members.Approved(groupID, payload.NomineeID)
+	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Nominee is not a group member"})
 	}
 
-	// Check if already nominated
-	var existing models.AdminNomination
-	if database.DB.Where("group_id = ? AND nominee_id = ? AND status = ?",
-		groupID, payload.NomineeID, "pending").First(&existing).Error == nil {
+	// A new admin of a multisig treasury becomes one of its signers, which only the
+	// current signers may approve
+	if group.Multisig && !services.IsTreasurySigner(group, user.Wallet) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only the treasury's signers can nominate admins"})
+	}
+
+	// Check if already nominated by this member; it takes two members to promote
+	if _, err := repository.Default.Members.PendingNomination(groupID, user.ID, payload.NomineeID); err == nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "User already nominated"})
 	}
 
@@ -54,26 +53,38 @@ func NominateAdmin(c *fiber.Ctx) error {
 		CreatedAt:   time.Now(),
 	}
 
-	if err := database.DB.Create(&nomination).Error; err != nil {
+	if err := repository.Default.Members.CreateNomination(&nomination); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	// Check if nominee has 2 nominations, auto-approve as admin
-	var nominationCount int64
-	database.DB.Model(&models.AdminNomination{}).
-		Where("group_id = ? AND nominee_id = ? AND status = ?", groupID, payload.NomineeID, "pending").
-		Count(&nominationCount)
+	audit(c, services.AuditEntry{
+		GroupID:  groupID,
+		Action:   services.AuditAdminNominate,
+		TargetID: payload.NomineeID,
+		After:    fiber.Map{"nomination_id": nomination.ID},
+	})
 
-	if nominationCount >= 2 {
-		// Update member role to admin
-		database.DB.Model(&models.Member{}).
-			Where("group_id = ? AND user_id = ?", groupID, payload.NomineeID).
-			Update("role", "admin")
+	// Check if nominee has enough nominations, auto-approve as admin
+	nominationCount, err := repository.Default.Members.CountPendingNominations(groupID, payload.NomineeID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if nominationCount >= int64(services.NominationsNeeded(group)) {
+		// Make the nominee an admin and a treasury signer, signed by the signers who
+		// nominated them, and approve their nominations. A promotion the treasury
+		// refuses leaves the nominations open for the next one.
+		if err := services.PromoteToAdmin(c.UserContext(), groupID, payload.NomineeID); err != nil {
+			return serviceError(c, err)
+		}
 
-		// Update all nominations to approved
-		database.DB.Model(&models.AdminNomination{}).
-			Where("group_id = ? AND nominee_id = ?", groupID, payload.NomineeID).
-			Update("status", "approved")
+		audit(c, services.AuditEntry{
+			GroupID:  groupID,
+			Action:   services.AuditAdminPromote,
+			TargetID: nominee.ID,
+			Before:   fiber.Map{"role": nominee.Role},
+			After:    fiber.Map{"role": policy.RoleAdmin, "nominations": nominationCount},
+		})
 
 		// Send notification
 		services.CreateNotification(
@@ -90,7 +101,6 @@ func NominateAdmin(c *fiber.Ctx) error {
 
 func ApproveMember(c *fiber.Ctx) error {
 	groupID := c.Params("id")
-	user := c.Locals("user").(models.User)
 
 	var payload struct {
 		MemberID string `json:"member_id"`
@@ -101,11 +111,13 @@ func ApproveMember(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
 	}
 
-	// Check if user is admin/creator
-	var admin models.Member
-	if err := database.DB.Where("group_id = ? AND user_id = ? AND role IN ?",
-		groupID, user.ID, []string{"creator", "admin"}).First(&admin).Error; err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Insufficient permissions"})
+	// Only join requests to this group can be decided here
+	member, err := repository.Default.Members.ByID(payload.MemberID)
+	if err != nil || member.GroupID != groupID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Member not found in this group"})
+	}
+	if member.Status != "pending" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": fmt.Sprintf("Member is already %s", member.Status)})
 	}
 
 	status := "approved"
@@ -113,16 +125,23 @@ func ApproveMember(c *fiber.Ctx) error {
 		status = "rejected"
 	}
 
-	if err := database.DB.Model(&models.Member{}).
-		Where("id = ? AND group_id = ?", payload.MemberID, groupID).
-		Update("status", status).Error; err != nil {
+	if err := repository.Default.Members.SetStatus(groupID, payload.MemberID, status); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	// Send notification to member
-	var member models.Member
-	database.DB.Where("id = ?", payload.MemberID).Preload("User").First(&member)
+	action := services.AuditMemberApprove
+	if status == "rejected" {
+		action = services.AuditMemberReject
+	}
+	audit(c, services.AuditEntry{
+		GroupID:  groupID,
+		Action:   action,
+		TargetID: member.ID,
+		Before:   fiber.Map{"status": member.Status},
+		After:    fiber.Map{"status": status},
+	})
 
+	// Send notification to member
 	notificationType := "membership_approved"
 	title := "Membership Approved"
 	message := "Your group membership has been approved"
@@ -137,11 +156,8 @@ func ApproveMember(c *fiber.Ctx) error {
 
 	// Check if group now meets minimum requirements and can be approved
 	if status == "approved" {
-		var group models.Group
-		database.DB.First(&group, "id = ?", groupID)
-
-		var approvedMemberCount int64
-		database.DB.Model(&models.Member{}).Where("group_id = ? AND status = ?", groupID, "approved").Count(&approvedMemberCount)
+		group, _ := repository.Default.Groups.ByID(groupID)
+		approvedMemberCount, _ := repository.Default.Members.CountApproved(groupID)
 
 		if approvedMemberCount >= int64(group.MinMembers) && !group.IsApproved {
 			// Notify creator that group meets minimum requirements and can be approved
@@ -157,3 +173,55 @@ func ApproveMember(c *fiber.Ctx) error {
 
 	return c.JSON(fiber.Map{"message": "Member status updated successfully"})
 }
+
+// AssignMemberRole makes a member treasurer or secretary, or a plain member again
+func AssignMemberRole(c *fiber.Ctx) error {
+	groupID := c.Params("id")
+
+	var payload struct {
+		Role string `json:"role"`
+	}
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
+	}
+	if !policy.Assignable(payload.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Role must be one of %v", policy.AssignableRoles),
+		})
+	}
+
+	member, err := repository.Default.Members.ByID(c.Params("memberId"))
+	if err != nil || member.GroupID != groupID || member.Status != "approved" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Member not found in this group"})
+	}
+	// Admins sign for the treasury, so they are only made by nomination
+	if !policy.Assignable(member.Role) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "The creator and admins keep their role"})
+	}
+
+	if err := repository.Default.Members.SetRole(groupID, member.ID, payload.Role); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	slog.InfoContext(c.UserContext(), "member role changed", "group_id", groupID, "member_id", member.ID, "role", payload.Role)
+	audit(c, services.AuditEntry{
+		GroupID:  groupID,
+		Action:   services.AuditMemberRole,
+		TargetID: member.ID,
+		Before:   fiber.Map{"role": member.Role},
+		After:    fiber.Map{"role": payload.Role},
+	})
+	services.CreateNotification(
+		member.UserID,
+		groupID,
+		"role_changed",
+		"Role Changed",
+		fmt.Sprintf("Your role in the group is now %s", payload.Role),
+	)
+
+	member.Role = payload.Role
+	return c.JSON(fiber.Map{
+		"message": "Member role updated successfully",
+		"member":  member,
+	})
+}
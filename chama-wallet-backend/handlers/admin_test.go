@@ -0,0 +1,36 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"chama-wallet-backend/repository"
+	"chama-wallet-backend/services"
+)
+
+func TestNominateAdminOfMultisigTreasury(t *testing.T) {
+	e := newEnv(t)
+	group, creator, members := activeGroup(t, e)
+	path := "/group/" + group.ID + "/nominate-admin"
+	nominee := members[0].User
+
+	// Members who do not sign for the treasury cannot add a signer
+	expect(t, e, 403, "POST", path, members[1].Token, map[string]string{"nominee_id": nominee.ID}, nil)
+
+	// The creator is the treasury's only signer, so their nomination promotes
+	expect(t, e, 200, "POST", path, creator.Token, map[string]string{"nominee_id": nominee.ID}, nil)
+
+	member, err := repository.Default.Members.Approved(group.ID, nominee.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if member.Role != "admin" {
+		t.Errorf("role %q, want admin", member.Role)
+	}
+	promoted, err := repository.Default.Groups.ByID(group.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !services.IsTreasurySigner(promoted, nominee.Wallet) {
+		t.Errorf("treasury signers %s, want the nominee among them", promoted.TreasurySigners)
+	}
+}
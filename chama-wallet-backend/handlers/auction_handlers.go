@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
+	"chama-wallet-backend/services"
+)
+
+// GetAuctions lists the group's bid windows, latest round first, with the members still
+// eligible to bid. Bids stay sealed while a window is open: the caller sees only how many
+// bids there are and their own.
+func GetAuctions(c *fiber.Ctx) error {
+	group := c.Locals("group").(models.Group)
+	member := c.Locals("member").(models.Member)
+
+	windows, err := repository.Default.Auctions.ForGroup(group.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	eligible, err := services.EligibleBidders(group.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	auctions := []fiber.Map{}
+	for _, window := range windows {
+		auctions = append(auctions, sealedWindow(window, member))
+	}
+	eligibleIDs := []string{}
+	for _, m := range eligible {
+		eligibleIDs = append(eligibleIDs, m.ID)
+	}
+
+	return c.JSON(fiber.Map{
+		"payout_mode": services.PayoutMode(group),
+		"policy":      services.GroupAuctionPolicy(group),
+		"eligible":    eligibleIDs,
+		"auctions":    auctions,
+	})
+}
+
+// GetAuction returns one of the group's bid windows, sealed while it is open
+func GetAuction(c *fiber.Ctx) error {
+	member := c.Locals("member").(models.Member)
+
+	window, err := repository.Default.Auctions.InGroup(c.Params("auctionId"), c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Bid window not found"})
+	}
+	return c.JSON(sealedWindow(window, member))
+}
+
+// OpenAuction opens bidding for a round's pot, the current round unless round is given
+func OpenAuction(c *fiber.Ctx) error {
+	var payload struct {
+		Round int `json:"round"`
+		Hours int `json:"hours"` // how long bidding stays open, 48 by default
+	}
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
+	}
+
+	window, err := services.OpenBidWindow(c.UserContext(), c.Params("id"), payload.Round, time.Duration(payload.Hours)*time.Hour)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	audit(c, services.AuditEntry{
+		GroupID:  window.GroupID,
+		Action:   services.AuditAuctionOpen,
+		TargetID: window.ID,
+		After:    fiber.Map{"round": window.Round, "pot": window.Pot, "discount_to": window.DiscountTo, "closes_at": window.ClosesAt},
+	})
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Bidding is open",
+		"auction": window,
+	})
+}
+
+// PlaceBid records the caller's sealed bid: the discount in XLM they would take off the
+// pot to be paid this round. Bidding again replaces the earlier bid.
+func PlaceBid(c *fiber.Ctx) error {
+	member := c.Locals("member").(models.Member)
+
+	var payload struct {
+		Discount float64 `json:"discount"`
+	}
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
+	}
+
+	bid, err := services.PlaceBid(c.UserContext(), c.Params("id"), c.Params("auctionId"), member, payload.Discount)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	// The amount stays sealed in the audit log too until the window closes
+	audit(c, services.AuditEntry{
+		GroupID:  member.GroupID,
+		Action:   services.AuditAuctionBid,
+		TargetID: c.Params("auctionId"),
+		After:    fiber.Map{"bid_id": bid.ID},
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "Bid recorded",
+		"bid":     bid,
+	})
+}
+
+// CloseAuction ends bidding and writes the winner into the round's payout schedule. It
+// can be closed before its deadline once every eligible member has bid.
+func CloseAuction(c *fiber.Ctx) error {
+	window, schedule, err := services.CloseBidWindow(c.UserContext(), c.Params("id"), c.Params("auctionId"))
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	slog.InfoContext(c.UserContext(), "payout auctioned", "group_id", window.GroupID, "round", window.Round, "winner_id", window.WinnerID)
+
+	audit(c, services.AuditEntry{
+		GroupID:  window.GroupID,
+		Action:   services.AuditAuctionClose,
+		TargetID: window.ID,
+		After: fiber.Map{
+			"round":       window.Round,
+			"winner_id":   window.WinnerID,
+			"discount":    window.Discount,
+			"amount":      schedule.Amount,
+			"discount_to": window.DiscountTo,
+		},
+	})
+
+	return c.JSON(fiber.Map{
+		"message":  "Bidding closed",
+		"auction":  window,
+		"schedule": schedule,
+	})
+}
+
+// sealedWindow shows a bid window with its bids hidden from everyone but their bidder
+// until it closes
+func sealedWindow(window models.BidWindow, member models.Member) fiber.Map {
+	view := fiber.Map{"auction": window, "bid_count": len(window.Bids)}
+	if window.Status == "open" {
+		for _, bid := range window.Bids {
+			if bid.MemberID == member.ID {
+				view["my_bid"] = bid
+			}
+		}
+		window.Bids = nil
+		view["auction"] = window
+	}
+	return view
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/services"
+)
+
+// audit records an action in the audit log, filling in the caller, their IP and the
+// request ID. The action has already happened by the time it is recorded, so a failure
+// is logged rather than failing the request.
+func audit(c *fiber.Ctx, entry services.AuditEntry) {
+	if entry.ActorID == "" {
+		if user, ok := c.Locals("user").(models.User); ok {
+			entry.ActorID = user.ID
+		}
+	}
+	entry.IP = c.IP()
+	if requestID, ok := c.Locals("requestid").(string); ok {
+		entry.RequestID = requestID
+	}
+
+	if _, err := services.RecordAudit(entry); err != nil {
+		slog.ErrorContext(c.UserContext(), "failed to record audit event",
+			"action", entry.Action, "group_id", entry.GroupID, "error", err)
+	}
+}
+
+// GetGroupAuditLog lists the group's audit events, newest first. Filter with action,
+// actor, from and to (RFC 3339) and limit; format=csv downloads them as a spreadsheet.
+func GetGroupAuditLog(c *fiber.Ctx) error {
+	group := c.Locals("group").(models.Group)
+
+	filter := services.AuditFilter{
+		Action:  c.Query("action"),
+		ActorID: c.Query("actor"),
+		Limit:   c.QueryInt("limit", 100),
+	}
+	for _, bound := range []struct {
+		name   string
+		target **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := c.Query(bound.name)
+		if value == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("%s must be an RFC 3339 time, e.g. 2024-01-31T00:00:00Z", bound.name),
+			})
+		}
+		*bound.target = &at
+	}
+
+	events, err := services.ListAuditEvents(group.ID, filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if c.Query("format") == "csv" {
+		return writeAuditCSV(c, group, events)
+	}
+
+	return c.JSON(fiber.Map{
+		"group_id": group.ID,
+		"events":   events,
+		"count":    len(events),
+	})
+}
+
+// writeAuditCSV sends the events as a CSV attachment
+func writeAuditCSV(c *fiber.Ctx, group models.Group, events []models.AuditEvent) error {
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="audit-%s.csv"`, group.ID))
+
+	writer := csv.NewWriter(c.Response().BodyWriter())
+	writer.Write([]string{"id", "created_at", "actor_id", "action", "target_id", "before", "after", "ip", "request_id", "prev_hash", "hash"})
+	for _, event := range events {
+		writer.Write([]string{
+			strconv.FormatInt(event.ID, 10),
+			event.CreatedAt.UTC().Format(time.RFC3339Nano),
+			event.ActorID,
+			event.Action,
+			event.TargetID,
+			event.Before,
+			event.After,
+			event.IP,
+			event.RequestID,
+			event.PrevHash,
+			event.Hash,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// VerifyGroupAuditLog recomputes the group's audit hash chain and reports whether any
+// event was altered or removed
+func VerifyGroupAuditLog(c *fiber.Ctx) error {
+	group := c.Locals("group").(models.Group)
+
+	verification, err := services.VerifyAuditChain(group.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(verification)
+}
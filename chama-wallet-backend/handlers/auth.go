@@ -1,8 +1,13 @@
 package handlers
 
 import (
+	"errors"
+	"math"
+	"strconv"
+
 	"github.com/gofiber/fiber/v2"
 
+	"chama-wallet-backend/keystore"
 	"chama-wallet-backend/models"
 	"chama-wallet-backend/services"
 )
@@ -30,23 +35,34 @@ func Register(c *fiber.Ctx) error {
 	}
 
 	// Register user
-	authResponse, err := services.RegisterUser(req)
+	authResponse, err := services.RegisterUser(c.UserContext(), req, clientInfo(c))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
+	audit(c, services.AuditEntry{
+		ActorID:  authResponse.User.ID,
+		Action:   services.AuditRegister,
+		TargetID: authResponse.User.ID,
+		After:    fiber.Map{"email": authResponse.User.Email, "wallet": authResponse.User.Wallet},
+	})
+
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": "User created successfully",
 		"user": fiber.Map{
-			"id":         authResponse.User.ID,
-			"name":       authResponse.User.Name,
-			"email":      authResponse.User.Email,
-			"wallet":     authResponse.User.Wallet,
-			"secret_key": authResponse.User.SecretKey, // Include secret key in response
+			"id":     authResponse.User.ID,
+			"name":   authResponse.User.Name,
+			"email":  authResponse.User.Email,
+			"wallet": authResponse.User.Wallet,
+
+			"email_verified_at": authResponse.User.EmailVerifiedAt,
 		},
-		"token": authResponse.Token,
+		"token":         authResponse.Token,
+		"expires_at":    authResponse.ExpiresAt,
+		"refresh_token": authResponse.RefreshToken,
+		"session_id":    authResponse.SessionID,
 	})
 }
 
@@ -67,17 +83,57 @@ func Login(c *fiber.Ctx) error {
 	}
 
 	// Login user
-	authResponse, err := services.LoginUser(req)
+	authResponse, err := services.LoginUser(c.UserContext(), req, clientInfo(c))
+	var locked *services.LoginLockedError
+	if errors.As(err, &locked) {
+		retryAfter := int(math.Ceil(locked.RetryAfter.Seconds()))
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error":       locked.Error(),
+			"retry_after": retryAfter,
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
+	audit(c, services.AuditEntry{
+		ActorID:  authResponse.User.ID,
+		Action:   services.AuditLogin,
+		TargetID: authResponse.SessionID,
+		After:    fiber.Map{"user_agent": c.Get("User-Agent")},
+	})
+
 	return c.JSON(authResponse)
 }
 
-// GetProfile returns the current user's profile including secret key
+// RefreshToken exchanges a refresh token for a new access token and refresh token
+func RefreshToken(c *fiber.Ctx) error {
+	var req models.RefreshRequest
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "refresh_token is required",
+		})
+	}
+
+	authResponse, err := services.RefreshSession(c.UserContext(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to refresh session",
+		})
+	}
+
+	return c.JSON(authResponse)
+}
+
+// GetProfile returns the current user's profile
 func GetProfile(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 
@@ -94,12 +150,39 @@ func GetProfile(c *fiber.Ctx) error {
 			"name":       user.Name,
 			"email":      user.Email,
 			"wallet":     user.Wallet,
-			"secret_key": user.SecretKey, // Add this to show user their secret key
 			"created_at": user.CreatedAt,
+
+			"email_verified_at": user.EmailVerifiedAt,
 		},
 	})
 }
 
+// ExportSecretKey decrypts the current user's secret key for an explicit backup
+func ExportSecretKey(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	user, err := services.GetUserByID(userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	secretKey, err := keystore.Default.Reveal(user.SecretKey)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Secret key not available",
+		})
+	}
+
+	audit(c, services.AuditEntry{Action: services.AuditSecretKeyExport, TargetID: user.Wallet})
+
+	return c.JSON(fiber.Map{
+		"wallet":     user.Wallet,
+		"secret_key": secretKey,
+	})
+}
+
 // UpdateProfile updates the current user's profile
 func UpdateProfile(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
@@ -123,6 +206,7 @@ func UpdateProfile(c *fiber.Ctx) error {
 	}
 
 	// Update name if provided
+	before := fiber.Map{"name": user.Name}
 	if req.Name != "" {
 		user.Name = req.Name
 	}
@@ -134,14 +218,92 @@ func UpdateProfile(c *fiber.Ctx) error {
 		})
 	}
 
+	audit(c, services.AuditEntry{
+		Action:   services.AuditProfileUpdate,
+		TargetID: user.ID,
+		Before:   before,
+		After:    fiber.Map{"name": user.Name},
+	})
+
 	return c.JSON(fiber.Map{
 		"user": user,
 	})
 }
 
-// Logout handles user logout (client-side token removal)
+// Logout revokes the current session, ending its refresh token and access tokens
 func Logout(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	sessionID := c.Locals("sessionID").(string)
+
+	if err := services.RevokeSession(userID, sessionID); err != nil {
+		return serviceError(c, err)
+	}
+
+	audit(c, services.AuditEntry{Action: services.AuditLogout, TargetID: sessionID})
+
 	return c.JSON(fiber.Map{
 		"message": "Logged out successfully",
 	})
 }
+
+// GetSessions lists the devices the current user is signed in on
+func GetSessions(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	sessionID := c.Locals("sessionID").(string)
+
+	sessions, err := services.ListSessions(userID, sessionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(sessions)
+}
+
+// RevokeSession signs one of the current user's devices out
+func RevokeSession(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	if err := services.RevokeSession(userID, c.Params("id")); err != nil {
+		return serviceError(c, err)
+	}
+
+	audit(c, services.AuditEntry{Action: services.AuditSessionRevoke, TargetID: c.Params("id")})
+
+	return c.JSON(fiber.Map{
+		"message": "Session revoked",
+	})
+}
+
+// RevokeOtherSessions signs the current user out on every other device
+func RevokeOtherSessions(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	sessionID := c.Locals("sessionID").(string)
+
+	revoked, err := services.RevokeOtherSessions(userID, sessionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	audit(c, services.AuditEntry{
+		Action:   services.AuditSessionRevoke,
+		TargetID: userID,
+		After:    fiber.Map{"kept_session": sessionID, "revoked": revoked},
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "Other sessions revoked",
+		"revoked": revoked,
+	})
+}
+
+// clientInfo describes the device making the request
+func clientInfo(c *fiber.Ctx) models.ClientInfo {
+	return models.ClientInfo{
+		UserAgent: c.Get("User-Agent"),
+		IP:        c.IP(),
+	}
+}
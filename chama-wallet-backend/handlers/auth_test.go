@@ -0,0 +1,87 @@
+package handlers_test
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+
+	"chama-wallet-backend/models"
+)
+
+var verifyLink = regexp.MustCompile(`\?token=([^\s"&]+)`)
+
+func TestRegisterLoginAndLogout(t *testing.T) {
+	e := newEnv(t)
+
+	var registered models.AuthResponse
+	expect(t, e, 201, "POST", "/auth/register", "",
+		models.RegisterRequest{Name: "Wanjiru", Email: "wanjiru@example.com", Password: "password123"}, &registered)
+	if registered.Token == "" || registered.RefreshToken == "" || registered.User.Wallet == "" {
+		t.Fatalf("register returned %+v, want tokens and a wallet", registered)
+	}
+	expect(t, e, 400, "POST", "/auth/register", "",
+		models.RegisterRequest{Name: "Wanjiru", Email: "wanjiru@example.com", Password: "password123"}, nil)
+
+	expect(t, e, 401, "POST", "/auth/login", "",
+		models.LoginRequest{Email: "wanjiru@example.com", Password: "wrong-password"}, nil)
+	var loggedIn models.AuthResponse
+	expect(t, e, 200, "POST", "/auth/login", "",
+		models.LoginRequest{Email: "wanjiru@example.com", Password: "password123"}, &loggedIn)
+	if loggedIn.User.ID != registered.User.ID {
+		t.Fatalf("login returned user %s, want %s", loggedIn.User.ID, registered.User.ID)
+	}
+
+	var profile struct {
+		User models.User `json:"user"`
+	}
+	expect(t, e, 200, "GET", "/auth/profile", loggedIn.Token, nil, &profile)
+	if profile.User.Email != "wanjiru@example.com" {
+		t.Fatalf("profile email %q", profile.User.Email)
+	}
+	expect(t, e, 401, "GET", "/auth/profile", "", nil, nil)
+
+	var refreshed models.AuthResponse
+	expect(t, e, 200, "POST", "/auth/refresh", "", map[string]string{"refresh_token": loggedIn.RefreshToken}, &refreshed)
+	if refreshed.Token == "" {
+		t.Fatal("refresh returned no token")
+	}
+	expect(t, e, 401, "POST", "/auth/refresh", "", map[string]string{"refresh_token": "not-a-token"}, nil)
+
+	expect(t, e, 200, "POST", "/auth/logout", refreshed.Token, nil, nil)
+	expect(t, e, 401, "GET", "/auth/profile", refreshed.Token, nil, nil)
+
+	// The first session is still signed in
+	expect(t, e, 200, "GET", "/auth/profile", registered.Token, nil, nil)
+}
+
+func TestVerifyEmailWithMailedToken(t *testing.T) {
+	e := newEnv(t)
+
+	var registered models.AuthResponse
+	expect(t, e, 201, "POST", "/auth/register", "",
+		models.RegisterRequest{Name: "Otieno", Email: "otieno@example.com", Password: "password123"}, &registered)
+
+	sent := e.Mail.Sent()
+	if len(sent) != 1 || sent[0].To != "otieno@example.com" {
+		t.Fatalf("sent %+v, want one verification email", sent)
+	}
+	match := verifyLink.FindStringSubmatch(sent[0].Body)
+	if match == nil {
+		t.Fatalf("no verification link in %q", sent[0].Body)
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, e, 400, "POST", "/auth/verify-email", "", map[string]string{"token": "not-a-token"}, nil)
+	expect(t, e, 200, "POST", "/auth/verify-email", "", map[string]string{"token": token}, nil)
+
+	var profile struct {
+		User models.User `json:"user"`
+	}
+	expect(t, e, 200, "GET", "/auth/profile", registered.Token, nil, &profile)
+	if profile.User.EmailVerifiedAt == nil {
+		t.Fatal("email not verified")
+	}
+}
@@ -0,0 +1,32 @@
+package handlers_test
+
+import "testing"
+
+func TestForbiddenRoleGets403(t *testing.T) {
+	e := newEnv(t)
+	creator := register(t, e, "Creator", "creator@example.com")
+	members, err := e.Members(2)
+	if err != nil {
+		t.Fatalf("register members: %v", err)
+	}
+	group, err := e.Group(creator, members...)
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	outsider := register(t, e, "Outsider", "outsider@example.com")
+	path := "/group/" + group.ID + "/secret"
+
+	var refused struct {
+		Role   string `json:"role"`
+		Action string `json:"action"`
+	}
+	expect(t, e, 403, "GET", path, members[0].Token, nil, &refused)
+	if refused.Role != "member" || refused.Action != "view_secret" {
+		t.Errorf("refusal %+v, want the member's role and the action", refused)
+	}
+	expect(t, e, 403, "GET", path, outsider.Token, nil, nil)
+	expect(t, e, 200, "GET", path, creator.Token, nil, nil)
+
+	// Members cannot activate the group either
+	expect(t, e, 403, "POST", "/group/"+group.ID+"/activate", members[1].Token, nil, nil)
+}
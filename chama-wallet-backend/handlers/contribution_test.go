@@ -0,0 +1,156 @@
+package handlers_test
+
+import (
+	"errors"
+	"testing"
+
+	"chama-wallet-backend/ledger"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/services"
+	"chama-wallet-backend/testenv"
+)
+
+// activeGroup registers a creator and two members and activates a group of them that
+// pays members[0] first
+func activeGroup(t *testing.T, e *testenv.Env) (models.Group, models.AuthResponse, []models.AuthResponse) {
+	t.Helper()
+	creator := register(t, e, "Creator", "creator@example.com")
+	members, err := e.Members(2)
+	if err != nil {
+		t.Fatalf("register members: %v", err)
+	}
+	group, err := e.ActiveGroup(creator, members, models.GroupSettings{
+		ContributionAmount: 10,
+		ContributionPeriod: 7,
+		PayoutOrder:        []string{members[0].User.ID, creator.User.ID, members[1].User.ID},
+	})
+	if err != nil {
+		t.Fatalf("activate group: %v", err)
+	}
+	return group, creator, members
+}
+
+type prepared struct {
+	ContributionID string `json:"contribution_id"`
+	UnsignedXDR    string `json:"unsigned_xdr"`
+}
+
+func TestContributeToRound(t *testing.T) {
+	e := newEnv(t)
+	group, creator, members := activeGroup(t, e)
+	path := "/group/" + group.ID + "/contribute-round"
+
+	expect(t, e, 400, "POST", path+"/prepare", members[0].Token, map[string]interface{}{"round": 1, "amount": 5}, nil)
+
+	var first, second prepared
+	expect(t, e, 200, "POST", path+"/prepare", members[0].Token, map[string]interface{}{"round": 1, "amount": 10}, &first)
+	expect(t, e, 200, "POST", path+"/prepare", members[1].Token, map[string]interface{}{"round": 1, "amount": 10}, &second)
+
+	// A transaction paying from someone else's wallet does not settle this contribution
+	signedBySecond, err := e.Sign(members[1].User, second.UnsignedXDR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, e, 400, "POST", path, members[0].Token,
+		map[string]string{"contribution_id": first.ContributionID, "signed_xdr": signedBySecond}, nil)
+	// Nor can a member submit another member's contribution
+	expect(t, e, 404, "POST", path, members[0].Token,
+		map[string]string{"contribution_id": second.ContributionID, "signed_xdr": signedBySecond}, nil)
+
+	signed, err := e.Sign(members[0].User, first.UnsignedXDR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paid struct {
+		Contribution models.RoundContribution `json:"contribution"`
+		TxHash       string                   `json:"tx_hash"`
+	}
+	expect(t, e, 200, "POST", path, members[0].Token,
+		map[string]string{"contribution_id": first.ContributionID, "signed_xdr": signed}, &paid)
+	if paid.Contribution.Status != "confirmed" || paid.TxHash == "" {
+		t.Fatalf("contribution %s with hash %q, want confirmed", paid.Contribution.Status, paid.TxHash)
+	}
+	if got := e.Ledger.Balance(members[0].User.Wallet); got != "9989.9999900" {
+		t.Errorf("member balance %s, want 10,000 less the contribution and its fee", got)
+	}
+
+	expect(t, e, 409, "POST", path+"/prepare", members[0].Token, map[string]interface{}{"round": 1, "amount": 10}, nil)
+	expect(t, e, 409, "POST", path, members[0].Token,
+		map[string]string{"contribution_id": first.ContributionID, "signed_xdr": signed}, nil)
+
+	var status struct {
+		TotalMembers int `json:"total_members"`
+		PaidMembers  int `json:"paid_members"`
+	}
+	expect(t, e, 200, "GET", "/group/"+group.ID+"/round-status?round=1", creator.Token, nil, &status)
+	if status.TotalMembers != 3 || status.PaidMembers != 1 {
+		t.Errorf("round status %+v, want 1 of 3 paid", status)
+	}
+}
+
+func TestPrepareRoundContributionChecksTheRound(t *testing.T) {
+	e := newEnv(t)
+	group, creator, members := activeGroup(t, e)
+	path := "/group/" + group.ID + "/contribute-round/prepare"
+
+	// Three members take three rounds
+	for _, round := range []int{-1, 0, 4} {
+		expect(t, e, 400, "POST", path, members[0].Token, map[string]interface{}{"round": round, "amount": 10}, nil)
+	}
+	expect(t, e, 200, "POST", path, members[0].Token, map[string]interface{}{"round": 3, "amount": 10}, nil)
+
+	// Once round 1 is paid out it takes no more contributions
+	for _, member := range append([]models.AuthResponse{creator}, members...) {
+		if err := e.Contribute(member, group.ID, 1, 10); err != nil {
+			t.Fatalf("contribute: %v", err)
+		}
+	}
+	expect(t, e, 200, "POST", "/group/"+group.ID+"/authorize-payout", creator.Token, map[string]int{"round": 1}, nil)
+	if err := services.ExecuteAuthorizedPayouts(e.Context()); err != nil {
+		t.Fatalf("payout engine: %v", err)
+	}
+	var closed struct {
+		Error string `json:"error"`
+	}
+	expect(t, e, 409, "POST", path, members[1].Token, map[string]interface{}{"round": 1, "amount": 10}, &closed)
+	if closed.Error != "Round 1 is closed" {
+		t.Errorf("error %q, want round 1 closed", closed.Error)
+	}
+	expect(t, e, 200, "POST", path, members[1].Token, map[string]interface{}{"round": 2, "amount": 10}, nil)
+}
+
+func TestContributionRetriedAfterUnknownOutcome(t *testing.T) {
+	e := newEnv(t)
+	group, _, members := activeGroup(t, e)
+	path := "/group/" + group.ID + "/contribute-round"
+
+	var contribution prepared
+	expect(t, e, 200, "POST", path+"/prepare", members[0].Token, map[string]interface{}{"round": 1, "amount": 10}, &contribution)
+	signed, err := e.Sign(members[0].User, contribution.UnsignedXDR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := map[string]string{"contribution_id": contribution.ContributionID, "signed_xdr": signed}
+
+	e.Ledger.FailNext(ledger.MethodSubmit, errors.New("connection reset"))
+	var pending struct {
+		Status string `json:"status"`
+		TxHash string `json:"tx_hash"`
+	}
+	expect(t, e, 202, "POST", path, members[0].Token, body, &pending)
+	if pending.Status != "pending" {
+		t.Fatalf("status %q, want pending", pending.Status)
+	}
+
+	// The retry sends the recorded envelope, so the member pays once
+	var paid struct {
+		TxHash string `json:"tx_hash"`
+	}
+	expect(t, e, 200, "POST", path, members[0].Token, body, &paid)
+	if paid.TxHash != pending.TxHash {
+		t.Errorf("retry confirmed %s, want the recorded %s", paid.TxHash, pending.TxHash)
+	}
+	if got := e.Ledger.Balance(members[0].User.Wallet); got != "9989.9999900" {
+		t.Errorf("member balance %s, want one contribution paid", got)
+	}
+}
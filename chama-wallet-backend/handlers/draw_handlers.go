@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/services"
+)
+
+// GetDraw returns the group's payout order draw: the commitment and ledger it is seeded
+// by, and once it is made the revealed secret, the seed and each member's key, so any
+// member can re-run it
+func GetDraw(c *fiber.Ctx) error {
+	group := c.Locals("group").(models.Group)
+	if services.PayoutMode(group) != services.PayoutDraw {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Group does not draw its payout order"})
+	}
+
+	proof, err := services.GroupDraw(group)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"draw": proof})
+}
+
+// DrawPayoutOrder makes the draw once its ledger has closed, or draws the members who
+// joined since. The draw_payout_order job does the same every minute.
+func DrawPayoutOrder(c *fiber.Ctx) error {
+	group, drawn, err := services.DrawPayoutOrder(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	proof, err := services.GroupDraw(group)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if drawn == 0 {
+		return c.JSON(fiber.Map{
+			"message": "Every member has already been drawn",
+			"draw":    proof,
+		})
+	}
+
+	audit(c, services.AuditEntry{
+		GroupID:  group.ID,
+		Action:   services.AuditPayoutDraw,
+		TargetID: group.ID,
+		After:    fiber.Map{"ledger": proof.Ledger, "ledger_hash": proof.LedgerHash, "seed": proof.Seed, "drawn": drawn, "payout_order": group.PayoutOrder},
+	})
+
+	return c.JSON(fiber.Map{
+		"message": fmt.Sprintf("%d members drawn", drawn),
+		"draw":    proof,
+	})
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+
+	"chama-wallet-backend/services"
+)
+
+// serviceError writes the response for an error returned by a service operation
+func serviceError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrStepUpRequired):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error(), "step_up_required": true})
+	case errors.Is(err, services.ErrInvalid):
+		status = fiber.StatusBadRequest
+	case errors.Is(err, services.ErrForbidden):
+		status = fiber.StatusForbidden
+	case errors.Is(err, services.ErrNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, services.ErrConflict):
+		status = fiber.StatusConflict
+	default:
+		slog.ErrorContext(c.UserContext(), "request failed", "method", c.Method(), "path", c.Path(), "error", err)
+	}
+	return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+}
@@ -2,16 +2,17 @@ package handlers
 
 import (
 	"chama-wallet-backend/utils"
-	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 
-	"chama-wallet-backend/database"
+	"chama-wallet-backend/config"
+	"chama-wallet-backend/keystore"
 	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
 	"chama-wallet-backend/services"
-	"chama-wallet-backend/config"
 )
 
 type CreateGroupRequest struct {
@@ -35,20 +36,16 @@ func CreateGroup(c *fiber.Ctx) error {
 	// Generate wallet for the group
 	wallet, err := utils.GenerateStellarWallet()
 	if err != nil {
-		fmt.Printf("❌ Failed to generate group wallet: %v\n", err)
+		slog.ErrorContext(c.UserContext(), "failed to generate group wallet", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate wallet"})
 	}
 
-	fmt.Printf("✅ Generated group wallet: %s on %s\n", wallet.PublicKey, config.Config.Network)
-
 	// Fund wallet only on testnet
 	if !config.Config.IsMainnet {
-		err = services.FundTestAccount(wallet.PublicKey)
+		err = services.FundTestAccount(c.UserContext(), wallet.PublicKey)
 		if err != nil {
-			fmt.Printf("⚠️ Warning: Failed to fund group wallet: %v\n", err)
+			slog.WarnContext(c.UserContext(), "failed to fund group wallet", "address", wallet.PublicKey, "error", err)
 			// Don't fail the group creation, just log the warning
-		} else {
-			fmt.Printf("✅ Group wallet funded successfully on testnet\n")
 		}
 	}
 
@@ -61,15 +58,23 @@ func CreateGroup(c *fiber.Ctx) error {
 			})
 		} else {
 			// Deploy contract for testnet
-			contractID, err = services.DeployChamaContract()
+			contractID, err = services.DeployChamaContract(c.UserContext())
 			if err != nil {
-				fmt.Printf("❌ Failed to deploy contract: %v\n", err)
+				slog.ErrorContext(c.UserContext(), "failed to deploy contract", "error", err)
 				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to deploy contract"})
 			}
 		}
 	}
 
-	fmt.Printf("✅ Using contract ID: %s on %s\n", contractID, config.Config.Network)
+	slog.InfoContext(c.UserContext(), "group wallet created",
+		"address", wallet.PublicKey, "contract_id", contractID, "network", config.Config.Network)
+
+	// Encrypt the group seed before it touches the database
+	sealedSecret, err := keystore.Default.Seal(wallet.SecretKey)
+	if err != nil {
+		slog.ErrorContext(c.UserContext(), "failed to seal group secret key", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to secure group wallet"})
+	}
 
 	// Save group in DB with the contract ID
 	group := models.Group{
@@ -80,10 +85,10 @@ func CreateGroup(c *fiber.Ctx) error {
 		CreatorID:   user.ID,
 		ContractID:  contractID,
 		Status:      "pending",
-		SecretKey:   wallet.SecretKey,
+		SecretKey:   sealedSecret,
 	}
 
-	if err := database.DB.Create(&group).Error; err != nil {
+	if err := repository.Default.Groups.Create(&group); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -98,12 +103,18 @@ func CreateGroup(c *fiber.Ctx) error {
 		JoinedAt: time.Now(),
 	}
 
-	err = database.DB.Create(&member).Error
-	if err != nil {
-		fmt.Printf("⚠️ Warning: Failed to add creator as member: %v\n", err)
+	if err := repository.Default.Members.Create(&member); err != nil {
+		slog.WarnContext(c.UserContext(), "failed to add creator as member", "group_id", group.ID, "error", err)
 		// Don't fail the group creation
 	}
 
+	audit(c, services.AuditEntry{
+		GroupID:  group.ID,
+		Action:   services.AuditGroupCreate,
+		TargetID: group.ID,
+		After:    fiber.Map{"name": group.Name, "wallet": group.Wallet, "contract_id": contractID, "status": group.Status},
+	})
+
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": "Group created successfully",
 		"group": fiber.Map{
@@ -111,7 +122,6 @@ func CreateGroup(c *fiber.Ctx) error {
 			"name":        group.Name,
 			"description": group.Description,
 			"wallet":      group.Wallet,
-			"secret_key":  group.SecretKey,
 			"status":      group.Status,
 			"contract_id": contractID,
 			"network":     config.Config.Network,
@@ -135,11 +145,16 @@ func AddMember(c *fiber.Ctx) error {
 
 	group, err := services.AddMemberToGroup(groupID, body.UserID, body.Wallet)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return serviceError(c, err)
 	}
 
+	audit(c, services.AuditEntry{
+		GroupID:  group.ID,
+		Action:   services.AuditMemberAdd,
+		TargetID: body.UserID,
+		After:    fiber.Map{"wallet": body.Wallet, "status": "approved"},
+	})
+
 	return c.JSON(group)
 }
 func DepositToGroup(c *fiber.Ctx) error {
@@ -164,8 +179,15 @@ func DepositToGroup(c *fiber.Ctx) error {
 		})
 	}
 
+	signer, err := keystore.SignerFromSeed(body.Secret)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	// Send XLM to group wallet
-	tx, err := services.SendXLM(body.Secret, group.Wallet, body.Amount)
+	tx, err := services.SendXLM(c.UserContext(), signer, group.Wallet, body.Amount)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
@@ -195,7 +217,7 @@ func GetGroupBalance(c *fiber.Ctx) error {
 	}
 
 	// Fetch the balance from Stellar
-	balance, err := services.CheckBalance(group.Wallet)
+	balance, err := services.CheckBalance(c.UserContext(), group.Wallet)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
@@ -226,13 +248,12 @@ func GetAllGroups(c *fiber.Ctx) error {
 	}
 
 	if err != nil {
-		fmt.Printf("❌ Error fetching groups: %v\n", err) // Add debug log
+		slog.ErrorContext(c.UserContext(), "failed to fetch groups", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch groups",
 		})
 	}
 
-	fmt.Printf("✅ Found %d groups\n", len(groups)) // Add debug log
 	return c.JSON(groups)
 }
 
@@ -247,31 +268,30 @@ func GetGroupDetails(c *fiber.Ctx) error {
 	return c.JSON(group)
 }
 
-// GetGroupSecretKey returns the group's secret key (only for creators/admins)
+// GetGroupSecretKey returns the group's secret key (only for roles allowed policy.ViewSecret)
 func GetGroupSecretKey(c *fiber.Ctx) error {
-	groupID := c.Params("id")
-	user := c.Locals("user").(models.User)
+	group := c.Locals("group").(models.Group)
 
-	// Check if user is admin/creator of the group
-	var member models.Member
-	if err := database.DB.Where("group_id = ? AND user_id = ? AND role IN ?", 
-		groupID, user.ID, []string{"creator", "admin"}).First(&member).Error; err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "Only group creators and admins can view the secret key",
+	if group.Multisig {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Group treasury is a multisig account and has no single secret key",
 		})
 	}
 
-	// Get group
-	group, err := services.GetGroupByID(groupID)
+	// Decrypt only for this explicit export
+	secretKey, err := keystore.Default.Reveal(group.SecretKey)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Group not found",
+		slog.ErrorContext(c.UserContext(), "failed to unseal group secret key", "group_id", group.ID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Group secret key not available",
 		})
 	}
 
+	audit(c, services.AuditEntry{GroupID: group.ID, Action: services.AuditGroupSecretView, TargetID: group.Wallet})
+
 	return c.JSON(fiber.Map{
 		"group_id":   group.ID,
 		"wallet":     group.Wallet,
-		"secret_key": group.SecretKey,
+		"secret_key": secretKey,
 	})
 }
@@ -1,71 +1,53 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 
-	"chama-wallet-backend/database"
+	"chama-wallet-backend/config"
 	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
 	"chama-wallet-backend/services"
-	"chama-wallet-backend/config"
 )
 
-func ContributeToGroup(c *fiber.Ctx) error {
+// PrepareGroupContribution builds the unsigned Soroban contribute call for the client to sign
+func PrepareGroupContribution(c *fiber.Ctx) error {
 	groupID := c.Params("id")
 	user := c.Locals("user").(models.User)
 
 	var payload struct {
-		From   string `json:"from"`
-		Secret string `json:"secret"`
 		Amount string `json:"amount"`
 	}
-	
+
 	if err := c.BodyParser(&payload); err != nil {
-		fmt.Printf("❌ Failed to parse request body: %v\n", err)
+		slog.DebugContext(c.UserContext(), "invalid request body", "error", err)
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
 	// Validate required fields
-	if payload.From == "" || payload.Secret == "" || payload.Amount == "" {
+	if payload.Amount == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Missing required fields: from, secret, and amount are required",
+			"error": "Missing required field: amount",
 		})
 	}
 
-	// Validate amount limits for mainnet
-	if config.Config.IsMainnet {
-		amount, err := strconv.ParseFloat(payload.Amount, 64)
-		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Invalid amount format",
-			})
-		}
-		
-		minAmount := 0.0000001 // Minimum XLM amount
-		if amount < minAmount {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": fmt.Sprintf("Amount below minimum of %f XLM", minAmount),
-			})
-		}
-	}
-	// Verify user is a member of the group
-	var member models.Member
-	if err := database.DB.Where("group_id = ? AND user_id = ? AND status = ?",
-		groupID, user.ID, "approved").First(&member).Error; err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "You are not an approved member of this group",
+	// The contract stores whole i128 amounts
+	amount, err := strconv.ParseInt(payload.Amount, 10, 64)
+	if err != nil || amount <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Amount must be a positive whole number",
 		})
 	}
 
 	// Get group details
 	group, err := services.GetGroupByID(groupID)
 	if err != nil {
-		fmt.Printf("❌ Group not found: %v\n", err)
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Group not found"})
 	}
 
@@ -83,57 +65,145 @@ func ContributeToGroup(c *fiber.Ctx) error {
 		})
 	}
 
-	// Validate user's wallet address matches the 'from' field
-	if payload.From != user.Wallet {
+	contribution := models.Contribution{
+		ID:        uuid.NewString(),
+		GroupID:   groupID,
+		UserID:    user.ID,
+		Amount:    float64(amount),
+		Status:    "awaiting_signature",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	tx, err := services.BuildSorobanInvokeTx(c.UserContext(), groupContributionCall(contribution, user, group))
+	if err != nil {
+		slog.ErrorContext(c.UserContext(), "failed to build soroban contribution", "group_id", groupID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to build transaction: %v", err),
+		})
+	}
+
+	envelope, err := tx.Base64()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to encode transaction"})
+	}
+
+	if err := repository.Default.Contributions.Create(&contribution); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"contribution_id":    contribution.ID,
+		"unsigned_xdr":       envelope,
+		"network_passphrase": config.GetNetworkPassphrase(),
+		"contract_id":        group.ContractID,
+		"amount":             payload.Amount,
+	})
+}
+
+// ContributeToGroup verifies a client-signed Soroban contribution and submits it
+func ContributeToGroup(c *fiber.Ctx) error {
+	groupID := c.Params("id")
+	user := c.Locals("user").(models.User)
+
+	var payload struct {
+		ContributionID string `json:"contribution_id"`
+		SignedXDR      string `json:"signed_xdr"`
+	}
+
+	if err := c.BodyParser(&payload); err != nil {
+		slog.DebugContext(c.UserContext(), "invalid request body", "error", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	// Validate required fields
+	if payload.ContributionID == "" || payload.SignedXDR == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Missing required fields: contribution_id and signed_xdr are required",
+		})
+	}
+
+	// Get group details
+	group, err := services.GetGroupByID(groupID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Group not found"})
+	}
+
+	contribution, err := repository.Default.Contributions.ForUser(payload.ContributionID, groupID, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Contribution not found"})
+	}
+
+	if contribution.Status != "awaiting_signature" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fmt.Sprintf("Contribution is already %s", contribution.Status),
+		})
+	}
+
+	// Check the signed envelope is exactly the contract call this contribution records
+	tx, err := services.VerifySignedSorobanInvoke(payload.SignedXDR, groupContributionCall(contribution, user, group))
+	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "From address must match your wallet address",
+			"error": fmt.Sprintf("Signed transaction rejected: %v", err),
 		})
 	}
 
-	fmt.Printf("🔄 Processing contribution: %s XLM from %s to group %s (contract: %s) on %s\n", 
-		payload.Amount, payload.From, group.Name, group.ContractID, config.Config.Network)
+	slog.InfoContext(c.UserContext(), "processing contribution", "group_id", groupID, "contribution_id", contribution.ID,
+		"amount", contribution.Amount, "contract_id", group.ContractID, "network", config.Config.Network)
 
-	// Make authenticated Soroban contract call
-	output, err := services.ContributeWithAuth(group.ContractID, payload.From, payload.Amount, payload.Secret)
+	output, err := services.SubmitSorobanTx(c.UserContext(), tx)
 	if err != nil {
-		fmt.Printf("❌ Soroban contribution failed: %v\n", err)
+		slog.ErrorContext(c.UserContext(), "soroban contribution failed", "contribution_id", contribution.ID, "error", err)
+		repository.Default.Contributions.SetStatus(contribution.ID, "failed")
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": fmt.Sprintf("Blockchain transaction failed: %v", err),
 		})
 	}
 
 	// Record the contribution in the database
-	contribution := models.Contribution{
-		ID:        uuid.NewString(),
-		GroupID:   groupID,
-		UserID:    user.ID,
-		Amount:    parseFloat64(payload.Amount),
-		Status:    "confirmed",
-		TxHash:    output,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	}
+	contribution.Status = "confirmed"
+	contribution.TxHash = output
+	contribution.UpdatedAt = time.Now()
 
-	if err := database.DB.Create(&contribution).Error; err != nil {
-		fmt.Printf("⚠️ Warning: Failed to record contribution in database: %v\n", err)
+	if err := repository.Default.Contributions.Save(&contribution); err != nil {
+		slog.WarnContext(c.UserContext(), "failed to record contribution", "contribution_id", contribution.ID, "error", err)
 		// Don't fail the request since blockchain transaction succeeded
 	}
 
-	fmt.Printf("✅ Contribution successful on %s: %s\n", config.Config.Network, output)
+	slog.InfoContext(c.UserContext(), "contribution confirmed", "contribution_id", contribution.ID, "tx_hash", output)
+
+	audit(c, services.AuditEntry{
+		GroupID:  groupID,
+		Action:   services.AuditContribution,
+		TargetID: contribution.ID,
+		Before:   fiber.Map{"status": "awaiting_signature"},
+		After:    fiber.Map{"status": contribution.Status, "amount": contribution.Amount, "tx_hash": output},
+	})
 
 	return c.JSON(fiber.Map{
 		"message":      "Contribution successful",
 		"group_id":     groupID,
 		"group_name":   group.Name,
-		"from":         payload.From,
+		"from":         user.Wallet,
 		"to":           group.Wallet,
-		"amount":       payload.Amount,
+		"amount":       strconv.FormatFloat(contribution.Amount, 'f', -1, 64),
 		"tx_hash":      output,
 		"network":      config.Config.Network,
 		"contribution": contribution,
 	})
 }
 
+// groupContributionCall is the contract call a group contribution must be made with
+func groupContributionCall(contribution models.Contribution, user models.User, group models.Group) services.SorobanExpectation {
+	return services.SorobanExpectation{
+		Source:     user.Wallet,
+		ContractID: group.ContractID,
+		Function:   "contribute",
+		User:       user.Wallet,
+		Amount:     strconv.FormatFloat(contribution.Amount, 'f', -1, 64),
+	}
+}
+
 func GetUserGroups(c *fiber.Ctx) error {
 	user := c.Locals("user").(models.User)
 
@@ -147,21 +217,9 @@ func GetUserGroups(c *fiber.Ctx) error {
 
 func GetNonGroupMembers(c *fiber.Ctx) error {
 	groupID := c.Params("id")
-	user := c.Locals("user").(models.User)
-
-	// Check if user is admin/creator of the group
-	var admin models.Member
-	if err := database.DB.Where("group_id = ? AND user_id = ? AND role IN ?", 
-		groupID, user.ID, []string{"creator", "admin"}).First(&admin).Error; err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Insufficient permissions"})
-	}
 
 	// Get users who are not members of this group
-	var users []models.User
-	err := database.DB.
-		Where("id NOT IN (SELECT user_id FROM members WHERE group_id = ?)", groupID).
-		Find(&users).Error
-
+	users, err := repository.Default.Users.NotInGroup(groupID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -181,22 +239,14 @@ func InviteToGroup(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
 	}
 
-	// Check if user is admin/creator
-	var admin models.Member
-	if err := database.DB.Where("group_id = ? AND user_id = ? AND role IN ?", 
-		groupID, user.ID, []string{"creator", "admin"}).First(&admin).Error; err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only admins can invite users"})
-	}
-
 	// Check if user exists
-	var invitedUser models.User
-	if err := database.DB.Where("email = ?", payload.Email).First(&invitedUser).Error; err != nil {
+	invitedUser, err := repository.Default.Users.ByEmail(payload.Email)
+	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User with this email not found"})
 	}
 
 	// Check if user is already a member
-	var existingMember models.Member
-	if err := database.DB.Where("group_id = ? AND user_id = ?", groupID, invitedUser.ID).First(&existingMember).Error; err == nil {
+	if _, err := repository.Default.Members.Find(groupID, invitedUser.ID); err == nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "User is already a member of this group"})
 	}
 
@@ -212,13 +262,19 @@ func InviteToGroup(c *fiber.Ctx) error {
 		ExpiresAt: time.Now().Add(7 * 24 * time.Hour), // 7 days
 	}
 
-	if err := database.DB.Create(&invitation).Error; err != nil {
+	if err := repository.Default.Groups.CreateInvitation(&invitation); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	audit(c, services.AuditEntry{
+		GroupID:  groupID,
+		Action:   services.AuditMemberInvite,
+		TargetID: invitedUser.ID,
+		After:    fiber.Map{"invitation_id": invitation.ID, "email": invitation.Email, "expires_at": invitation.ExpiresAt},
+	})
+
 	// Create notification for invited user
-	var group models.Group
-	database.DB.First(&group, "id = ?", groupID)
+	group, _ := repository.Default.Groups.ByID(groupID)
 
 	notification := models.Notification{
 		ID:        uuid.NewString(),
@@ -232,10 +288,8 @@ func InviteToGroup(c *fiber.Ctx) error {
 		CreatedAt: time.Now(),
 	}
 
-	if err := database.DB.Create(&notification).Error; err != nil {
-		fmt.Printf("⚠️ Failed to create notification: %v\n", err)
-	} else {
-		fmt.Printf("✅ Notification created for user %s\n", invitedUser.ID)
+	if err := repository.Default.Notifications.Create(&notification); err != nil {
+		slog.WarnContext(c.UserContext(), "failed to create notification", "user_id", invitedUser.ID, "error", err)
 	}
 
 	return c.JSON(fiber.Map{"message": "Invitation sent successfully"})
@@ -243,17 +297,10 @@ func InviteToGroup(c *fiber.Ctx) error {
 
 func ApproveGroup(c *fiber.Ctx) error {
 	groupID := c.Params("id")
-	user := c.Locals("user").(models.User)
-
-	// Check if user is the creator
-	var group models.Group
-	if err := database.DB.Where("id = ? AND creator_id = ?", groupID, user.ID).First(&group).Error; err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only group creator can approve the group"})
-	}
+	group := c.Locals("group").(models.Group)
 
 	// Check if group has minimum members
-	var memberCount int64
-	database.DB.Model(&models.Member{}).Where("group_id = ? AND status = ?", groupID, "approved").Count(&memberCount)
+	memberCount, _ := repository.Default.Members.CountApproved(groupID)
 	if memberCount < int64(group.MinMembers) {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": fmt.Sprintf("Group needs at least %d members before approval (currently has %d)", group.MinMembers, memberCount),
@@ -261,13 +308,20 @@ func ApproveGroup(c *fiber.Ctx) error {
 	}
 
 	// Update group approval status
-	if err := database.DB.Model(&group).Update("is_approved", true).Error; err != nil {
+	if err := repository.Default.Groups.Update(groupID, map[string]interface{}{"is_approved": true}); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to approve group"})
 	}
 
+	audit(c, services.AuditEntry{
+		GroupID:  groupID,
+		Action:   services.AuditGroupApprove,
+		TargetID: groupID,
+		Before:   fiber.Map{"is_approved": group.IsApproved},
+		After:    fiber.Map{"is_approved": true, "approved_members": memberCount},
+	})
+
 	// Notify all members that group is approved
-	var members []models.Member
-	database.DB.Where("group_id = ? AND status = ?", groupID, "approved").Find(&members)
+	members, _ := repository.Default.Members.ListApproved(groupID)
 
 	for _, member := range members {
 		services.CreateNotification(
@@ -286,109 +340,131 @@ func ActivateGroup(c *fiber.Ctx) error {
 	groupID := c.Params("id")
 	user := c.Locals("user").(models.User)
 
-	var payload struct {
-		ContributionAmount float64  `json:"contribution_amount"`
-		ContributionPeriod int      `json:"contribution_period"`
-		PayoutOrder        []string `json:"payout_order"`
+	var settings models.GroupSettings
+	if err := c.BodyParser(&settings); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
 	}
 
-	if err := c.BodyParser(&payload); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
+	group := c.Locals("group").(models.Group)
+	activated, err := services.ActivateGroup(c.UserContext(), groupID, user, settings)
+	if err != nil {
+		return serviceError(c, err)
 	}
 
-	// Debug logging
-	fmt.Printf("Received payout order: %+v\n", payload.PayoutOrder)
+	audit(c, services.AuditEntry{
+		GroupID:  groupID,
+		Action:   services.AuditGroupActivate,
+		TargetID: groupID,
+		Before:   fiber.Map{"status": group.Status},
+		After:    fiber.Map{"status": activated.Status, "settings": settings},
+	})
 
-	// Check if user is admin/creator
-	var admin models.Member
-	if err := database.DB.Where("group_id = ? AND user_id = ? AND role IN ?",
-		groupID, user.ID, []string{"creator", "admin"}).First(&admin).Error; err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only admins can activate groups"})
-	}
+	return c.JSON(fiber.Map{"message": "Group activated successfully"})
+}
 
-	// Check if group is approved
-	var group models.Group
-	if err := database.DB.First(&group, "id = ?", groupID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Group not found"})
-	}
+// Helper function to parse float64 safely
+// UpdateApprovalPolicy changes how many votes the group's payout requests need. Requests
+// already open are tallied under the new policy.
+func UpdateApprovalPolicy(c *fiber.Ctx) error {
+	groupID := c.Params("id")
 
-	if !group.IsApproved {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Group must be approved before activation"})
+	var policy models.ApprovalPolicy
+	if err := c.BodyParser(&policy); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
 	}
 
-	// Validate payout order
-	if len(payload.PayoutOrder) == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Payout order cannot be empty"})
+	adminCount, err := repository.Default.Members.CountAdmins(groupID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := services.ValidateApprovalPolicy(policy, int(adminCount)); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	// Convert payout order to JSON string
-	payoutOrderJSON, err := json.Marshal(payload.PayoutOrder)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid payout order"})
+	if err := repository.Default.Groups.Update(groupID, services.ApprovalPolicyUpdates(policy)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	fmt.Printf("Payout order JSON: %s\n", string(payoutOrderJSON))
+	slog.InfoContext(c.UserContext(), "approval policy updated", "group_id", groupID, "kind", policy.Kind)
 
-	// Calculate next contribution date
-	nextContributionDate := time.Now().AddDate(0, 0, payload.ContributionPeriod)
+	audit(c, services.AuditEntry{
+		GroupID:  groupID,
+		Action:   services.AuditGroupApprovalRule,
+		TargetID: groupID,
+		Before:   services.GroupApprovalPolicy(c.Locals("group").(models.Group)),
+		After:    policy,
+	})
 
-	// Update group
-	updates := map[string]interface{}{
-		"status":                "active",
-		"contribution_amount":   payload.ContributionAmount,
-		"contribution_period":   payload.ContributionPeriod,
-		"payout_order":         string(payoutOrderJSON),
-		"current_round":        1,
-		"next_contribution_date": nextContributionDate,
+	return c.JSON(fiber.Map{
+		"message": "Approval policy updated successfully",
+		"policy":  policy,
+	})
+}
+
+// UpdateLatePolicy changes the grace period and fine for late round contributions. Fines
+// already assessed keep their amount.
+func UpdateLatePolicy(c *fiber.Ctx) error {
+	groupID := c.Params("id")
+
+	var policy models.LatePolicy
+	if err := c.BodyParser(&policy); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
+	}
+	if err := services.ValidateLatePolicy(policy); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	if err := database.DB.Model(&group).Where("id = ?", groupID).Updates(updates).Error; err != nil {
+	if err := repository.Default.Groups.Update(groupID, services.LatePolicyUpdates(policy)); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	// Create payout schedule entries
-	var members []models.Member
-	database.DB.Where("group_id = ? AND status = ?", groupID, "approved").Find(&members)
+	slog.InfoContext(c.UserContext(), "late fine policy updated", "group_id", groupID, "kind", policy.Kind)
 
-	totalPayout := payload.ContributionAmount * float64(len(members))
-	startDate := time.Now()
+	audit(c, services.AuditEntry{
+		GroupID:  groupID,
+		Action:   services.AuditGroupLatePolicy,
+		TargetID: groupID,
+		Before:   services.GroupLatePolicy(c.Locals("group").(models.Group)),
+		After:    policy,
+	})
 
-	for i, memberID := range payload.PayoutOrder {
-		// Find the member
-		var member models.Member
-		for _, m := range members {
-			if m.UserID == memberID {
-				member = m
-				break
-			}
-		}
-		
-		if member.ID == "" {
-			continue // Skip if member not found
-		}
-		
-		// Calculate due date for this round
-		dueDate := startDate.AddDate(0, 0, i*payload.ContributionPeriod)
-		
-		schedule := models.PayoutSchedule{
-			ID:        uuid.NewString(),
-			GroupID:   groupID,
-			MemberID:  member.ID,
-			Round:     i + 1,
-			Amount:    totalPayout,
-			DueDate:   dueDate,
-			Status:    "scheduled",
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		}
-		
-		database.DB.Create(&schedule)
+	return c.JSON(fiber.Map{
+		"message": "Late fine policy updated successfully",
+		"policy":  policy,
+	})
+}
+
+// UpdateStepUpPolicy sets whether the group's sensitive actions need a fresh second factor
+func UpdateStepUpPolicy(c *fiber.Ctx) error {
+	groupID := c.Params("id")
+	user := c.Locals("user").(models.User)
+	sessionID := c.Locals("sessionID").(string)
+
+	var payload struct {
+		RequireStepUp *bool `json:"require_step_up"`
+	}
+	if err := c.BodyParser(&payload); err != nil || payload.RequireStepUp == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "require_step_up is required"})
 	}
 
-	return c.JSON(fiber.Map{"message": "Group activated successfully"})
+	if err := services.SetGroupStepUp(c.UserContext(), groupID, user, sessionID, *payload.RequireStepUp); err != nil {
+		return serviceError(c, err)
+	}
+
+	audit(c, services.AuditEntry{
+		GroupID:  groupID,
+		Action:   services.AuditGroupSecurity,
+		TargetID: groupID,
+		Before:   fiber.Map{"require_step_up": c.Locals("group").(models.Group).RequireStepUp},
+		After:    fiber.Map{"require_step_up": *payload.RequireStepUp},
+	})
+
+	return c.JSON(fiber.Map{
+		"message":         "Security settings updated successfully",
+		"require_step_up": *payload.RequireStepUp,
+	})
 }
 
-// Helper function to parse float64 safely
 func parseFloat64(s string) float64 {
 	if val, err := strconv.ParseFloat(s, 64); err == nil {
 		return val
@@ -400,22 +476,24 @@ func JoinGroup(c *fiber.Ctx) error {
 	groupID := c.Params("id")
 	user := c.Locals("user").(models.User)
 
+	if err := services.RequireVerifiedEmail(user); err != nil {
+		return serviceError(c, err)
+	}
+
 	// Check if group exists and is active
-	var group models.Group
-	if err := database.DB.First(&group, "id = ?", groupID).Error; err != nil {
+	group, err := repository.Default.Groups.ByID(groupID)
+	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Group not found"})
 	}
 
 	// Check if group is full
-	var memberCount int64
-	database.DB.Model(&models.Member{}).Where("group_id = ? AND status = ?", groupID, "approved").Count(&memberCount)
+	memberCount, _ := repository.Default.Members.CountApproved(groupID)
 	if memberCount >= int64(group.MaxMembers) {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Group is full"})
 	}
 
 	// Check if user is already a member
-	var existingMember models.Member
-	if err := database.DB.Where("group_id = ? AND user_id = ?", groupID, user.ID).First(&existingMember).Error; err == nil {
+	if existingMember, err := repository.Default.Members.Find(groupID, user.ID); err == nil {
 		if existingMember.Status == "pending" {
 			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Join request already pending"})
 		}
@@ -433,14 +511,22 @@ func JoinGroup(c *fiber.Ctx) error {
 		JoinedAt: time.Now(),
 	}
 
-	if err := database.DB.Create(&member).Error; err != nil {
+	if err := repository.Default.Members.Create(&member); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Join request already pending"})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to join group"})
 	}
 
+	audit(c, services.AuditEntry{
+		GroupID:  groupID,
+		Action:   services.AuditMemberJoin,
+		TargetID: member.ID,
+		After:    fiber.Map{"status": member.Status, "role": member.Role},
+	})
+
 	// Create notification for group admins
-	var admins []models.Member
-	database.DB.Where("group_id = ? AND role IN ? AND status = ?",
-		groupID, []string{"creator", "admin"}, "approved").Find(&admins)
+	admins, _ := repository.Default.Members.ListAdmins(groupID)
 
 	for _, admin := range admins {
 		notification := models.Notification{
@@ -454,7 +540,7 @@ func JoinGroup(c *fiber.Ctx) error {
 			Status:    "unread",
 			CreatedAt: time.Now(),
 		}
-		database.DB.Create(&notification)
+		repository.Default.Notifications.Create(&notification)
 	}
 
 	return c.JSON(fiber.Map{
@@ -465,21 +551,8 @@ func JoinGroup(c *fiber.Ctx) error {
 
 func GetPayoutSchedule(c *fiber.Ctx) error {
 	groupID := c.Params("id")
-	user := c.Locals("user").(models.User)
-
-	// Check if user is member of the group
-	var member models.Member
-	if err := database.DB.Where("group_id = ? AND user_id = ? AND status = ?",
-		groupID, user.ID, "approved").First(&member).Error; err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not a group member"})
-	}
-
-	var schedules []models.PayoutSchedule
-	err := database.DB.Where("group_id = ?", groupID).
-		Preload("Member.User").
-		Order("round ASC").
-		Find(&schedules).Error
 
+	schedules, err := repository.Default.Payouts.Schedule(groupID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
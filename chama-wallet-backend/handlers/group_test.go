@@ -0,0 +1,73 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
+)
+
+func TestGroupLifecycle(t *testing.T) {
+	e := newEnv(t)
+	creator := register(t, e, "Creator", "creator@example.com")
+	first := register(t, e, "First", "first@example.com")
+	second := register(t, e, "Second", "second@example.com")
+
+	var created struct {
+		Group models.Group `json:"group"`
+	}
+	expect(t, e, 201, "POST", "/group/create", creator.Token,
+		map[string]string{"name": "Umoja", "description": "Weekly savings"}, &created)
+	groupID := created.Group.ID
+	if groupID == "" || created.Group.Wallet == "" {
+		t.Fatalf("created group %+v, want an id and a wallet", created.Group)
+	}
+	expect(t, e, 401, "POST", "/group/create", "", map[string]string{"name": "Anonymous"}, nil)
+
+	expect(t, e, 200, "POST", "/group/"+groupID+"/join", first.Token, map[string]string{}, nil)
+	expect(t, e, 409, "POST", "/group/"+groupID+"/join", first.Token, map[string]string{}, nil)
+	expect(t, e, 200, "POST", "/group/"+groupID+"/join", second.Token, map[string]string{}, nil)
+
+	// Too few approved members to approve the group yet
+	expect(t, e, 400, "POST", "/group/"+groupID+"/approve", creator.Token, nil, nil)
+
+	for _, member := range []models.AuthResponse{first, second} {
+		pending, err := repository.Default.Members.Find(groupID, member.User.ID)
+		if err != nil {
+			t.Fatalf("pending member: %v", err)
+		}
+		expect(t, e, 200, "POST", "/group/"+groupID+"/approve-member", creator.Token,
+			map[string]string{"member_id": pending.ID, "action": "approve"}, nil)
+	}
+
+	// Members cannot run the group
+	expect(t, e, 403, "POST", "/group/"+groupID+"/approve", first.Token, nil, nil)
+	settings := models.GroupSettings{
+		ContributionAmount: 10,
+		ContributionPeriod: 7,
+		PayoutOrder:        []string{creator.User.ID, first.User.ID, second.User.ID},
+	}
+	expect(t, e, 400, "POST", "/group/"+groupID+"/activate", creator.Token, settings, nil)
+
+	expect(t, e, 200, "POST", "/group/"+groupID+"/approve", creator.Token, nil, nil)
+	expect(t, e, 403, "POST", "/group/"+groupID+"/activate", first.Token, settings, nil)
+	expect(t, e, 200, "POST", "/group/"+groupID+"/activate", creator.Token, settings, nil)
+	expect(t, e, 409, "POST", "/group/"+groupID+"/activate", creator.Token, settings, nil)
+
+	var group models.Group
+	expect(t, e, 200, "GET", "/group/"+groupID, "", nil, &group)
+	if group.Status != "active" || len(group.Members) != 3 {
+		t.Fatalf("group status %q with %d members, want active with 3", group.Status, len(group.Members))
+	}
+
+	var schedule []models.PayoutSchedule
+	expect(t, e, 200, "GET", "/group/"+groupID+"/payout-schedule", second.Token, nil, &schedule)
+	if len(schedule) != 3 {
+		t.Fatalf("payout schedule has %d rounds, want 3", len(schedule))
+	}
+
+	// Joining an active group still needs an admin's approval
+	late := register(t, e, "Late", "late@example.com")
+	expect(t, e, 200, "POST", "/group/"+groupID+"/join", late.Token, map[string]string{}, nil)
+	expect(t, e, 403, "GET", "/group/"+groupID+"/payout-schedule", late.Token, nil, nil)
+}
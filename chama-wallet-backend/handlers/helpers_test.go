@@ -0,0 +1,45 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/testenv"
+)
+
+// newEnv starts a test environment that is closed when the test ends
+func newEnv(t *testing.T) *testenv.Env {
+	t.Helper()
+	e, err := testenv.New()
+	if err != nil {
+		t.Fatalf("testenv: %v", err)
+	}
+	t.Cleanup(func() { e.Close() })
+	return e
+}
+
+// register signs up a verified, funded user
+func register(t *testing.T, e *testenv.Env, name, email string) models.AuthResponse {
+	t.Helper()
+	auth, err := e.Register(name, email)
+	if err != nil {
+		t.Fatalf("register %s: %v", email, err)
+	}
+	return auth
+}
+
+// expect sends a request and fails the test unless the app answers with status
+func expect(t *testing.T, e *testenv.Env, status int, method, path, token string, body, out interface{}) {
+	t.Helper()
+	var raw map[string]interface{}
+	if out == nil {
+		out = &raw
+	}
+	got, err := e.Request(method, path, token, body, out)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	if got != status {
+		t.Fatalf("%s %s: status %d, want %d (%v)", method, path, got, status, out)
+	}
+}
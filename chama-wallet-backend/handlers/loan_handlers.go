@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"chama-wallet-backend/config"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
+	"chama-wallet-backend/services"
+)
+
+// GetLoans lists the group's loans, newest first, with their guarantors and repayment
+// schedules. Filter with ?status= and ?member_id=.
+func GetLoans(c *fiber.Ctx) error {
+	groupID := c.Params("id")
+	status := c.Query("status")
+	memberID := c.Query("member_id")
+
+	loans, err := repository.Default.Loans.ForGroup(groupID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	filtered := []models.Loan{}
+	var outstanding float64
+	for _, loan := range loans {
+		if (status != "" && loan.Status != status) || (memberID != "" && loan.MemberID != memberID) {
+			continue
+		}
+		if loan.Status == "active" {
+			outstanding += services.LoanOutstanding(loan)
+		}
+		filtered = append(filtered, loan)
+	}
+
+	group := c.Locals("group").(models.Group)
+	return c.JSON(fiber.Map{
+		"loans":       filtered,
+		"outstanding": outstanding,
+		"type":        services.GroupType(group),
+		"policy":      services.GroupLoanPolicy(group),
+	})
+}
+
+// GetLoan returns one of the group's loans with its guarantors and repayment schedule
+func GetLoan(c *fiber.Ctx) error {
+	loan, err := repository.Default.Loans.InGroup(c.Params("loanId"), c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Loan not found"})
+	}
+
+	return c.JSON(fiber.Map{
+		"loan":        loan,
+		"outstanding": services.LoanOutstanding(loan),
+	})
+}
+
+// ApplyForLoan records the member's loan application. Guarantors are asked to accept it;
+// once they have, it is disbursed through a payout request the admins approve with
+// POST /payout/:id/approve.
+func ApplyForLoan(c *fiber.Ctx) error {
+	member := c.Locals("member").(models.Member)
+	group := c.Locals("group").(models.Group)
+
+	var application services.LoanApplication
+	if err := c.BodyParser(&application); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
+	}
+
+	// Loans are lent from the savings in the group wallet
+	groupBalance, err := services.CheckBalance(c.UserContext(), group.Wallet)
+	if err != nil {
+		slog.WarnContext(c.UserContext(), "could not check group balance", "group_id", group.ID, "error", err)
+	} else if balance, parseErr := strconv.ParseFloat(groupBalance, 64); parseErr == nil && application.Amount > balance {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Insufficient group savings. Available: %.2f XLM, Requested: %.2f XLM", balance, application.Amount),
+		})
+	}
+
+	loan, err := services.ApplyForLoan(c.UserContext(), group, member, application)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	var guarantors []string
+	for _, guarantor := range loan.Guarantors {
+		guarantors = append(guarantors, guarantor.MemberID)
+	}
+	audit(c, services.AuditEntry{
+		GroupID:  group.ID,
+		Action:   services.AuditLoanApply,
+		TargetID: loan.ID,
+		After: fiber.Map{
+			"status":            loan.Status,
+			"principal":         loan.Principal,
+			"interest_rate":     loan.InterestRate,
+			"term_months":       loan.TermMonths,
+			"total_due":         loan.TotalDue,
+			"guarantors":        guarantors,
+			"payout_request_id": loan.PayoutRequestID,
+		},
+	})
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":  "Loan application submitted successfully",
+		"loan":     loan,
+		"schedule": services.LoanSchedule(loan.Principal, loan.InterestRate, loan.TermMonths, time.Now()),
+	})
+}
+
+// RespondToGuarantee accepts or declines the caller's guarantee of a loan
+func RespondToGuarantee(c *fiber.Ctx) error {
+	member := c.Locals("member").(models.Member)
+	group := c.Locals("group").(models.Group)
+
+	var payload struct {
+		Accept bool `json:"accept"`
+	}
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
+	}
+
+	loan, err := services.RespondToGuarantee(c.UserContext(), group, c.Params("loanId"), member, payload.Accept)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	audit(c, services.AuditEntry{
+		GroupID:  group.ID,
+		Action:   services.AuditLoanGuarantee,
+		TargetID: loan.ID,
+		Before:   fiber.Map{"status": "pending"},
+		After:    fiber.Map{"accepted": payload.Accept, "loan_status": loan.Status, "payout_request_id": loan.PayoutRequestID},
+	})
+
+	message := "Guarantee declined"
+	if payload.Accept {
+		message = "Guarantee accepted"
+	}
+	return c.JSON(fiber.Map{
+		"message": message,
+		"loan":    loan,
+	})
+}
+
+// PrepareLoanRepayment builds the unsigned payment for a repayment of the member's own
+// loan, by default the next installment still due. The client signs the returned XDR and
+// posts it to RepayLoan.
+func PrepareLoanRepayment(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	member := c.Locals("member").(models.Member)
+	group := c.Locals("group").(models.Group)
+
+	var payload struct {
+		Amount float64 `json:"amount"`
+	}
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
+	}
+
+	loan, err := repository.Default.Loans.InGroup(c.Params("loanId"), group.ID)
+	if err != nil || loan.MemberID != member.ID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Loan not found"})
+	}
+	if loan.Status != "active" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": fmt.Sprintf("Loan is %s", loan.Status)})
+	}
+
+	outstanding := services.LoanOutstanding(loan)
+	amount := payload.Amount
+	if amount == 0 {
+		for _, installment := range loan.Installments {
+			if installment.Status == "due" {
+				amount = installment.Amount - installment.AmountPaid
+				break
+			}
+		}
+	}
+	if amount <= 0 || amount > outstanding {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Amount must be between 0 and the %.7f XLM outstanding", outstanding),
+		})
+	}
+
+	repayment := models.LoanRepayment{
+		ID:        uuid.NewString(),
+		LoanID:    loan.ID,
+		GroupID:   group.ID,
+		MemberID:  member.ID,
+		Amount:    amount,
+		Status:    "awaiting_signature",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	repayment.Memo = services.LoanMemo(repayment.ID)
+
+	if err := repository.Default.Loans.CreateRepayment(&repayment); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	tx, err := services.BuildPaymentTx(c.UserContext(), loanRepaymentPayment(repayment, user, group))
+	if err != nil {
+		slog.ErrorContext(c.UserContext(), "failed to build loan repayment", "loan_id", loan.ID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to build transaction: %v", err),
+		})
+	}
+
+	envelope, err := tx.Base64()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to encode transaction"})
+	}
+
+	return c.JSON(fiber.Map{
+		"loan_id":            loan.ID,
+		"repayment_id":       repayment.ID,
+		"outstanding":        outstanding,
+		"unsigned_xdr":       envelope,
+		"network_passphrase": config.GetNetworkPassphrase(),
+		"source":             user.Wallet,
+		"destination":        group.Wallet,
+		"amount":             fmt.Sprintf("%.7f", repayment.Amount),
+		"memo":               repayment.Memo,
+	})
+}
+
+// RepayLoan verifies a client-signed loan repayment and submits it
+func RepayLoan(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	member := c.Locals("member").(models.Member)
+	group := c.Locals("group").(models.Group)
+
+	var payload struct {
+		RepaymentID string `json:"repayment_id"`
+		SignedXDR   string `json:"signed_xdr"`
+	}
+	if err := c.BodyParser(&payload); err != nil || payload.RepaymentID == "" || payload.SignedXDR == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "repayment_id and signed_xdr are required"})
+	}
+
+	repayment, err := repository.Default.Loans.Repayment(payload.RepaymentID, c.Params("loanId"))
+	if err != nil || repayment.GroupID != group.ID || repayment.MemberID != member.ID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Repayment not found"})
+	}
+
+	switch repayment.Status {
+	case "awaiting_signature":
+	case "pending":
+		// A previous attempt may or may not have reached the network; finish that one
+		return finishLoanRepayment(c, repayment)
+	default:
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": fmt.Sprintf("Repayment is already %s", repayment.Status)})
+	}
+
+	tx, err := services.VerifySignedPayment(payload.SignedXDR, loanRepaymentPayment(repayment, user, group))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Signed transaction rejected: %v", err),
+		})
+	}
+
+	envelope, txHash, err := services.EnvelopeHash(tx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Record the exact transaction before it is submitted, so the repayment is made once
+	claimed, err := repository.Default.Loans.TransitionRepayment(repayment.ID, "awaiting_signature", map[string]interface{}{
+		"status":        "pending",
+		"tx_hash":       txHash,
+		"submitted_xdr": envelope,
+		"updated_at":    time.Now(),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !claimed {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Repayment is already being paid"})
+	}
+
+	repayment.Status = "pending"
+	repayment.TxHash = txHash
+	repayment.SubmittedXDR = envelope
+	return finishLoanRepayment(c, repayment)
+}
+
+// finishLoanRepayment submits a pending repayment's recorded transaction, or finds it on
+// the ledger if an earlier attempt got through, and records the outcome
+func finishLoanRepayment(c *fiber.Ctx, repayment models.LoanRepayment) error {
+	resp, state, err := services.SubmitOnce(c.UserContext(), repayment.SubmittedXDR, repayment.TxHash)
+
+	switch state {
+	case services.SubmissionConfirmed:
+		if err := services.ConfirmLoanRepayment(c.UserContext(), repayment.ID, resp.Hash); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		loan, _ := repository.Default.Loans.InGroup(repayment.LoanID, repayment.GroupID)
+		audit(c, services.AuditEntry{
+			GroupID:  repayment.GroupID,
+			Action:   services.AuditLoanRepay,
+			TargetID: repayment.LoanID,
+			Before:   fiber.Map{"status": "pending"},
+			After: fiber.Map{
+				"repayment_id":  repayment.ID,
+				"amount":        repayment.Amount,
+				"amount_repaid": loan.AmountRepaid,
+				"loan_status":   loan.Status,
+				"tx_hash":       resp.Hash,
+			},
+		})
+		return c.JSON(fiber.Map{
+			"message":      "Loan repayment made successfully",
+			"repayment_id": repayment.ID,
+			"tx_hash":      resp.Hash,
+			"loan":         loan,
+			"outstanding":  services.LoanOutstanding(loan),
+		})
+
+	case services.SubmissionRejected:
+		// The transaction will never apply; let the member sign a new one
+		slog.WarnContext(c.UserContext(), "loan repayment rejected", "repayment_id", repayment.ID, "error", err)
+		repository.Default.Loans.TransitionRepayment(repayment.ID, "pending", map[string]interface{}{
+			"status":        "awaiting_signature",
+			"tx_hash":       "",
+			"submitted_xdr": "",
+			"updated_at":    time.Now(),
+		})
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to transfer funds: %v", err),
+		})
+
+	default:
+		// Outcome unknown: the repayment stays pending and a retry resends the same envelope
+		slog.WarnContext(c.UserContext(), "loan repayment outcome unknown", "repayment_id", repayment.ID, "error", err)
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message":      "Loan repayment submitted, confirmation pending",
+			"repayment_id": repayment.ID,
+			"status":       "pending",
+			"tx_hash":      repayment.TxHash,
+		})
+	}
+}
+
+// UpdateLoanPolicy changes the terms of the group's future loans. Loans already applied
+// for keep the terms they were made on.
+func UpdateLoanPolicy(c *fiber.Ctx) error {
+	groupID := c.Params("id")
+	group := c.Locals("group").(models.Group)
+
+	if services.GroupType(group) != services.GroupASCA {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Only savings and credit groups lend to members"})
+	}
+
+	var policy models.LoanPolicy
+	if err := c.BodyParser(&policy); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
+	}
+
+	members, err := repository.Default.Members.CountApproved(groupID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := services.ValidateLoanPolicy(policy, int(members)); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := repository.Default.Groups.Update(groupID, services.LoanPolicyUpdates(policy)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	slog.InfoContext(c.UserContext(), "loan policy updated", "group_id", groupID, "interest_rate", policy.InterestRate)
+
+	audit(c, services.AuditEntry{
+		GroupID:  groupID,
+		Action:   services.AuditGroupLoanPolicy,
+		TargetID: groupID,
+		Before:   services.GroupLoanPolicy(group),
+		After:    policy,
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "Loan policy updated successfully",
+		"policy":  policy,
+	})
+}
+
+// loanRepaymentPayment is the payment a loan repayment must be made with
+func loanRepaymentPayment(repayment models.LoanRepayment, user models.User, group models.Group) services.PaymentExpectation {
+	return services.PaymentExpectation{
+		Source:      user.Wallet,
+		Destination: group.Wallet,
+		Amount:      fmt.Sprintf("%.7f", repayment.Amount),
+		Memo:        repayment.Memo,
+	}
+}
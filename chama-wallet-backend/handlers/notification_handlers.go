@@ -1,28 +1,24 @@
 package handlers
 
 import (
-	"fmt"
-	"time"
+	"log/slog"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/google/uuid"
 
-	"chama-wallet-backend/database"
 	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
 	"chama-wallet-backend/services"
 )
 
 func GetNotifications(c *fiber.Ctx) error {
 	user := c.Locals("user").(models.User)
-	fmt.Printf("🔍 Getting notifications for user: %s\n", user.ID)
 
 	notifications, err := services.GetUserNotifications(user.ID)
 	if err != nil {
-		fmt.Printf("❌ Error getting notifications: %v\n", err)
+		slog.ErrorContext(c.UserContext(), "failed to get notifications", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	fmt.Printf("✅ Found %d notifications for user %s\n", len(notifications), user.ID)
 	return c.JSON(notifications)
 }
 
@@ -31,8 +27,7 @@ func MarkNotificationRead(c *fiber.Ctx) error {
 	user := c.Locals("user").(models.User)
 
 	// Verify notification belongs to user
-	var notification models.Notification
-	if err := database.DB.Where("id = ? AND user_id = ?", notificationID, user.ID).First(&notification).Error; err != nil {
+	if _, err := repository.Default.Notifications.Find(notificationID, user.ID); err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Notification not found"})
 	}
 
@@ -45,20 +40,18 @@ func MarkNotificationRead(c *fiber.Ctx) error {
 
 func GetUserInvitations(c *fiber.Ctx) error {
 	user := c.Locals("user").(models.User)
-	fmt.Printf("🔍 Getting invitations for user: %s (email: %s)\n", user.ID, user.Email)
 
-	var invitations []models.GroupInvitation
-	err := database.DB.Where("email = ? AND status = ?", user.Email, "pending").
-		Preload("Group").
-		Preload("Inviter").
-		Find(&invitations).Error
+	// Invitations are matched by email, so only show them once the address is confirmed
+	if err := services.RequireVerifiedEmail(user); err != nil {
+		return serviceError(c, err)
+	}
 
+	invitations, err := repository.Default.Groups.PendingInvitations(user.Email)
 	if err != nil {
-		fmt.Printf("❌ Error getting invitations: %v\n", err)
+		slog.ErrorContext(c.UserContext(), "failed to get invitations", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	fmt.Printf("✅ Found %d invitations for user %s\n", len(invitations), user.Email)
 	return c.JSON(invitations)
 }
 
@@ -68,12 +61,11 @@ func DeleteNotification(c *fiber.Ctx) error {
 	user := c.Locals("user").(models.User)
 
 	// Verify notification belongs to user
-	var notification models.Notification
-	if err := database.DB.Where("id = ? AND user_id = ?", notificationID, user.ID).First(&notification).Error; err != nil {
+	if _, err := repository.Default.Notifications.Find(notificationID, user.ID); err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Notification not found"})
 	}
 
-	if err := database.DB.Delete(&notification).Error; err != nil {
+	if err := repository.Default.Notifications.Delete(notificationID); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -83,63 +75,18 @@ func AcceptInvitation(c *fiber.Ctx) error {
 	invitationID := c.Params("id")
 	user := c.Locals("user").(models.User)
 
-	var invitation models.GroupInvitation
-	if err := database.DB.Where("id = ? AND email = ?", invitationID, user.Email).First(&invitation).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Invitation not found"})
-	}
-
-	if invitation.Status != "pending" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invitation already processed"})
-	}
-
-	if time.Now().After(invitation.ExpiresAt) {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invitation has expired"})
+	invitation, err := services.AcceptInvitation(invitationID, user)
+	if err != nil {
+		return serviceError(c, err)
 	}
 
-	// Update invitation status
-	database.DB.Model(&invitation).Updates(map[string]interface{}{
-		"status":  "accepted",
-		"user_id": user.ID,
-	})
-
-	// Add user as member with approved status (since they were invited)
-	member := models.Member{
-		ID:       uuid.NewString(),
+	audit(c, services.AuditEntry{
 		GroupID:  invitation.GroupID,
-		UserID:   user.ID,
-		Wallet:   user.Wallet,
-		Role:     "member",
-		Status:   "approved", // Auto-approve invited users
-		JoinedAt: time.Now(),
-	}
-
-	if err := database.DB.Create(&member).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
-	}
-
-	// Notify group admins about new member (not request)
-	var admins []models.Member
-	database.DB.Where("group_id = ? AND role IN ? AND status = ?",
-		invitation.GroupID, []string{"creator", "admin"}, "approved").Find(&admins)
-
-	for _, admin := range admins {
-		services.CreateNotification(
-			admin.UserID,
-			invitation.GroupID,
-			"new_member_joined",
-			"New Member Joined",
-			user.Name+" has joined the group",
-		)
-	}
-
-	// Notify the user that they successfully joined
-	services.CreateNotification(
-		user.ID,
-		invitation.GroupID,
-		"membership_approved",
-		"Welcome to the Group",
-		"You have successfully joined the group",
-	)
+		Action:   services.AuditInvitationAccept,
+		TargetID: invitation.ID,
+		Before:   fiber.Map{"status": "pending"},
+		After:    fiber.Map{"status": "accepted"},
+	})
 
 	return c.JSON(fiber.Map{"message": "Invitation accepted successfully"})
 }
@@ -148,8 +95,8 @@ func RejectInvitation(c *fiber.Ctx) error {
 	invitationID := c.Params("id")
 	user := c.Locals("user").(models.User)
 
-	var invitation models.GroupInvitation
-	if err := database.DB.Where("id = ? AND email = ?", invitationID, user.Email).First(&invitation).Error; err != nil {
+	invitation, err := repository.Default.Groups.Invitation(invitationID, user.Email)
+	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Invitation not found"})
 	}
 
@@ -158,7 +105,17 @@ func RejectInvitation(c *fiber.Ctx) error {
 	}
 
 	// Update invitation status
-	database.DB.Model(&invitation).Update("status", "rejected")
+	if err := repository.Default.Groups.SetInvitationStatus(invitation.ID, "rejected"); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	audit(c, services.AuditEntry{
+		GroupID:  invitation.GroupID,
+		Action:   services.AuditInvitationReject,
+		TargetID: invitation.ID,
+		Before:   fiber.Map{"status": invitation.Status},
+		After:    fiber.Map{"status": "rejected"},
+	})
 
 	return c.JSON(fiber.Map{"message": "Invitation rejected"})
 }
@@ -0,0 +1,75 @@
+package handlers_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"chama-wallet-backend/config"
+	"chama-wallet-backend/models"
+)
+
+func TestPasswordReset(t *testing.T) {
+	e := newEnv(t)
+	registered := register(t, e, "Wanjiru", "wanjiru@example.com")
+	var second models.AuthResponse
+	expect(t, e, 200, "POST", "/auth/login", "",
+		models.LoginRequest{Email: "wanjiru@example.com", Password: "password123"}, &second)
+
+	// Unknown and known emails get the same answer, and only a known one gets mail
+	before := len(e.Mail.Sent()) // the verification email
+	var unknown, known map[string]interface{}
+	expect(t, e, 200, "POST", "/auth/password/forgot", "", map[string]string{"email": "nobody@example.com"}, &unknown)
+	if sent := e.Mail.Sent()[before:]; len(sent) != 0 {
+		t.Fatalf("sent %+v for an unknown email", sent)
+	}
+	expect(t, e, 200, "POST", "/auth/password/forgot", "", map[string]string{"email": "wanjiru@example.com"}, &known)
+	if unknown["message"] != known["message"] || len(unknown) != len(known) {
+		t.Errorf("answers differ: %v for an unknown email, %v for a known one", unknown, known)
+	}
+	sent := e.Mail.Sent()[before:]
+	if len(sent) != 1 || sent[0].To != "wanjiru@example.com" {
+		t.Fatalf("sent %+v, want one reset email", sent)
+	}
+	match := verifyLink.FindStringSubmatch(sent[0].Body)
+	if match == nil {
+		t.Fatalf("no reset link in %q", sent[0].Body)
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same token, re-signed to have expired a minute ago
+	claims := jwt.MapClaims{}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	expired := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	expired.Header["kid"] = parsed.Header["kid"]
+	expiredToken, err := expired.SignedString(config.Auth.SigningKeys[parsed.Header["kid"].(string)])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, e, 400, "POST", "/auth/password/reset", "", map[string]string{"token": expiredToken, "password": "new-password"}, nil)
+
+	expect(t, e, 200, "POST", "/auth/password/reset", "", map[string]string{"token": token, "password": "new-password"}, nil)
+
+	// Every session is signed out
+	for _, session := range []models.AuthResponse{registered, second} {
+		expect(t, e, 401, "GET", "/auth/profile", session.Token, nil, nil)
+		expect(t, e, 401, "POST", "/auth/refresh", "", map[string]string{"refresh_token": session.RefreshToken}, nil)
+	}
+
+	// The link works once
+	expect(t, e, 400, "POST", "/auth/password/reset", "", map[string]string{"token": token, "password": "another-password"}, nil)
+
+	expect(t, e, 401, "POST", "/auth/login", "",
+		models.LoginRequest{Email: "wanjiru@example.com", Password: "password123"}, nil)
+	expect(t, e, 200, "POST", "/auth/login", "",
+		models.LoginRequest{Email: "wanjiru@example.com", Password: "new-password"}, nil)
+}
@@ -1,15 +1,17 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 
-	"chama-wallet-backend/database"
 	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
 	"chama-wallet-backend/services"
 )
 
@@ -24,7 +26,7 @@ func CreatePayoutRequest(c *fiber.Ctx) error {
 	}
 
 	if err := c.BodyParser(&payload); err != nil {
-		fmt.Printf("❌ Failed to parse payout request: %v\n", err)
+		slog.DebugContext(c.UserContext(), "invalid request body", "error", err)
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
 	}
 
@@ -35,46 +37,34 @@ func CreatePayoutRequest(c *fiber.Ctx) error {
 		})
 	}
 
-	// Get group details
-	var group models.Group
-	if err := database.DB.First(&group, "id = ?", groupID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Group not found"})
-	}
-
 	// Validate group is active
+	group := c.Locals("group").(models.Group)
 	if group.Status != "active" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Group must be active to create payout requests",
 		})
 	}
 
-	// Check if user is admin/creator
-	var admin models.Member
-	if err := database.DB.Where("group_id = ? AND user_id = ? AND role IN ?",
-		groupID, user.ID, []string{"creator", "admin"}).First(&admin).Error; err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only admins can create payout requests"})
-	}
-
 	// Verify recipient is group member
-	var recipient models.Member
-	if err := database.DB.Where("group_id = ? AND user_id = ? AND status = ?",
-		groupID, payload.RecipientID, "approved").First(&recipient).Error; err != nil {
+	recipient, err := repository.Default.Members.Approved(groupID, payload.RecipientID)
+	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Recipient is not a group member"})
 	}
+	if services.RequireVerifiedEmail(recipient.User) != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Recipient has not verified their email address"})
+	}
 
 	// Check if payout request already exists for this round
-	var existingRequest models.PayoutRequest
-	if err := database.DB.Where("group_id = ? AND round = ? AND status IN ?",
-		groupID, payload.Round, []string{"pending", "approved"}).First(&existingRequest).Error; err == nil {
+	if _, err := repository.Default.Payouts.OpenForRound(groupID, payload.Round); err == nil {
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
 			"error": "Payout request already exists for this round",
 		})
 	}
 
 	// Validate payout amount against group balance
-	groupBalance, err := services.CheckBalance(group.Wallet)
+	groupBalance, err := services.CheckBalance(c.UserContext(), group.Wallet)
 	if err != nil {
-		fmt.Printf("⚠️ Warning: Could not check group balance: %v\n", err)
+		slog.WarnContext(c.UserContext(), "could not check group balance", "group_id", groupID, "error", err)
 	} else {
 		if balance, parseErr := strconv.ParseFloat(groupBalance, 64); parseErr == nil {
 			if payload.Amount > balance {
@@ -94,18 +84,33 @@ func CreatePayoutRequest(c *fiber.Ctx) error {
 		Status:      "pending",
 		CreatedAt:   time.Now(),
 	}
+	payoutRequest.ExpiresAt = services.PayoutExpiry(group, payoutRequest.CreatedAt)
+
+	// Multisig treasuries need a fixed envelope that each signer approves
+	if group.Multisig {
+		envelope, err := services.BuildGroupPayoutTx(c.UserContext(), group, recipient.User.Wallet, fmt.Sprintf("%.7f", payload.Amount))
+		if err != nil {
+			slog.ErrorContext(c.UserContext(), "failed to build payout envelope", "group_id", groupID, "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to build payout transaction"})
+		}
+		payoutRequest.EnvelopeXDR = envelope
+	}
 
-	if err := database.DB.Create(&payoutRequest).Error; err != nil {
-		fmt.Printf("❌ Failed to create payout request: %v\n", err)
+	if err := repository.Default.Payouts.Create(&payoutRequest); err != nil {
+		slog.ErrorContext(c.UserContext(), "failed to create payout request", "group_id", groupID, "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	fmt.Printf("✅ Payout request created: %s\n", payoutRequest.ID)
+	slog.InfoContext(c.UserContext(), "payout request created", "group_id", groupID, "payout_id", payoutRequest.ID)
+	audit(c, services.AuditEntry{
+		GroupID:  groupID,
+		Action:   services.AuditPayoutRequest,
+		TargetID: payoutRequest.ID,
+		After:    fiber.Map{"recipient_id": payoutRequest.RecipientID, "amount": payoutRequest.Amount, "round": payoutRequest.Round},
+	})
 
 	// Notify all admins about the payout request (excluding the creator)
-	var admins []models.Member
-	database.DB.Where("group_id = ? AND role IN ? AND status = ?",
-		groupID, []string{"creator", "admin"}, "approved").Find(&admins)
+	admins, _ := repository.Default.Members.ListAdmins(groupID)
 
 	for _, admin := range admins {
 		if admin.UserID != user.ID {
@@ -130,202 +135,124 @@ func ApprovePayoutRequest(c *fiber.Ctx) error {
 	user := c.Locals("user").(models.User)
 
 	var payload struct {
-		Approved bool `json:"approved"`
+		Approved  bool   `json:"approved"`
+		SignedXDR string `json:"signed_xdr,omitempty"` // payout envelope signed by the admin's own wallet
 	}
 
 	if err := c.BodyParser(&payload); err != nil {
-		fmt.Printf("❌ Failed to parse approval request: %v\n", err)
+		slog.DebugContext(c.UserContext(), "invalid request body", "error", err)
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
 	}
 
-	// Get payout request
-	var payoutRequest models.PayoutRequest
-	if err := database.DB.Where("id = ?", payoutID).Preload("Group").First(&payoutRequest).Error; err != nil {
-		fmt.Printf("❌ Payout request not found: %v\n", err)
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Payout request not found"})
-	}
-
-	// Check if payout is still pending
-	if payoutRequest.Status != "pending" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": fmt.Sprintf("Payout request is already %s", payoutRequest.Status),
-		})
-	}
-
-	// Check if user is admin/creator of the group
-	var admin models.Member
-	if err := database.DB.Where("group_id = ? AND user_id = ? AND role IN ?",
-		payoutRequest.GroupID, user.ID, []string{"creator", "admin"}).First(&admin).Error; err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Insufficient permissions"})
-	}
-
-	// Check if already approved by this admin
-	var existingApproval models.PayoutApproval
-	if database.DB.Where("payout_request_id = ? AND admin_id = ?",
-		payoutID, user.ID).First(&existingApproval).Error == nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Already voted on this request"})
-	}
-
-	// Create approval record
-	approval := models.PayoutApproval{
-		ID:              uuid.NewString(),
-		PayoutRequestID: payoutID,
-		AdminID:         user.ID,
-		Approved:        payload.Approved,
-		CreatedAt:       time.Now(),
-	}
-
-	if err := database.DB.Create(&approval).Error; err != nil {
-		fmt.Printf("❌ Failed to create approval record: %v\n", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	payoutRequest, tally, err := services.VoteOnPayout(c.UserContext(), payoutID, user, payload.Approved, payload.SignedXDR)
+	if err != nil {
+		return serviceError(c, err)
 	}
 
-	fmt.Printf("✅ Approval recorded: %s by %s\n", payoutID, user.Name)
-
-	// Count approvals and rejections
-	var approvalCount int64
-	database.DB.Model(&models.PayoutApproval{}).
-		Where("payout_request_id = ? AND approved = ?", payoutID, true).
-		Count(&approvalCount)
-
-	var rejectionCount int64
-	database.DB.Model(&models.PayoutApproval{}).
-		Where("payout_request_id = ? AND approved = ?", payoutID, false).
-		Count(&rejectionCount)
-
-	fmt.Printf("📊 Payout %s - Approvals: %d, Rejections: %d\n", payoutID, approvalCount, rejectionCount)
-
-	// Process payout if we have enough approvals (1 admins) or any rejection
-	if approvalCount >= 1 {
-		fmt.Printf("✅ Payout approved with %d approvals, processing...\n", approvalCount)
-		
-		// Update payout status to approved
-		database.DB.Model(&models.PayoutRequest{}).
-			Where("id = ?", payoutID).
-			Update("status", "approved")
-
-		// Execute the actual payout using Soroban contract
-		if err := executePayout(payoutRequest); err != nil {
-			fmt.Printf("❌ Payout execution failed: %v\n", err)
-			// Update status to failed
-			database.DB.Model(&models.PayoutRequest{}).
-				Where("id = ?", payoutID).
-				Update("status", "failed")
-			
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": fmt.Sprintf("Payout execution failed: %v", err),
-			})
-		}
-
-		// Update status to completed
-		database.DB.Model(&models.PayoutRequest{}).
-			Where("id = ?", payoutID).
-			Update("status", "completed")
-
-		// Fetch group details again to get the latest CurrentRound and ContributionPeriod
-		var currentGroup models.Group
-		if err := database.DB.First(&currentGroup, "id = ?", payoutRequest.GroupID).Error; err != nil {
-			fmt.Printf("❌ Failed to fetch group details for round update: %v\n", err)
-		} else {
-			// Increment current round and update next contribution date
-			database.DB.Model(&models.Group{}).
-				Where("id = ?", payoutRequest.GroupID).
-				Update("current_round", currentGroup.CurrentRound + 1).
-				Update("next_contribution_date", time.Now().AddDate(0, 0, currentGroup.ContributionPeriod))
-		}
-
-		// Notify all members about successful payout
-		var members []models.Member
-		database.DB.Where("group_id = ? AND status = ?",
-			payoutRequest.GroupID,
-			"approved").Find(&members)
-
-		for _, member := range members {
-			services.CreateNotification(
-				member.UserID,
-				payoutRequest.GroupID,
-				"payout_approved",
-				"Payout Approved",
-				fmt.Sprintf("Payout of %.2f XLM has been approved and processed", payoutRequest.Amount),
-			)
-		}
-
-		return c.JSON(fiber.Map{
-			"message": "Payout request approved and executed successfully",
-			"status":  "completed",
-		})
-	} else if rejectionCount >= 1 {
-		fmt.Printf("❌ Payout rejected with %d rejections\n", rejectionCount)
-		
-		database.DB.Model(&models.PayoutRequest{}).
-			Where("id = ?", payoutID).
-			Update("status", "rejected")
+	audit(c, services.AuditEntry{
+		GroupID:  payoutRequest.GroupID,
+		Action:   services.AuditPayoutVote,
+		TargetID: payoutRequest.ID,
+		After:    fiber.Map{"approved": payload.Approved, "signed": payload.SignedXDR != "", "outcome": tally.Outcome},
+	})
 
+	switch tally.Outcome {
+	case "approved":
+		slog.InfoContext(c.UserContext(), "payout approved, executing", "payout_id", payoutRequest.ID, "approvals", tally.Approvals)
+		return executePayout(c, payoutRequest)
+	case "rejected", "expired":
 		return c.JSON(fiber.Map{
-			"message": "Payout request rejected",
-			"status":  "rejected",
+			"message": fmt.Sprintf("Payout request %s", tally.Outcome),
+			"status":  tally.Outcome,
+			"tally":   tally,
 		})
 	}
 
 	return c.JSON(fiber.Map{
-		"message": fmt.Sprintf("Approval recorded, waiting for more approvals (%d/1)", approvalCount),
+		"message": fmt.Sprintf("Approval recorded, waiting for more approvals (%d/%d)", tally.Approvals, tally.Required),
 		"status":  "pending",
+		"tally":   tally,
 	})
 }
 
-// executePayout performs the actual blockchain payout transaction
-func executePayout(payoutRequest models.PayoutRequest) error {
-	fmt.Printf("🔄 Executing payout: %.2f XLM to recipient %s\n", payoutRequest.Amount, payoutRequest.RecipientID)
-	
-	// Get group details
-	var group models.Group
-	if err := database.DB.First(&group, "id = ?", payoutRequest.GroupID).Error; err != nil {
-		return fmt.Errorf("failed to get group: %w", err)
+// executePayout sends the payout, or finishes an earlier attempt, and reports the outcome
+func executePayout(c *fiber.Ctx, payoutRequest models.PayoutRequest) error {
+	resp, state, err := services.ExecutePayout(c.UserContext(), payoutRequest.ID)
+	// Record the payout once, when this call settles it
+	if payoutRequest.Status != "completed" && (state == services.SubmissionConfirmed || state == services.SubmissionRejected) {
+		after := fiber.Map{"status": "completed", "tx_hash": resp.Hash}
+		if state == services.SubmissionRejected {
+			after = fiber.Map{"status": "failed", "error": fmt.Sprint(err)}
+		}
+		audit(c, services.AuditEntry{
+			GroupID:  payoutRequest.GroupID,
+			Action:   services.AuditPayoutExecute,
+			TargetID: payoutRequest.ID,
+			After:    after,
+		})
 	}
 
-	// Get recipient details
-	var recipient models.User
-	if err := database.DB.First(&recipient, "id = ?", payoutRequest.RecipientID).Error; err != nil {
-		return fmt.Errorf("failed to get recipient: %w", err)
-	}
+	switch state {
+	case services.SubmissionConfirmed:
+		return c.JSON(fiber.Map{
+			"message": "Payout request approved and executed successfully",
+			"status":  "completed",
+			"tx_hash": resp.Hash,
+		})
 
-	// Validate group has secret key for transactions
-	if group.SecretKey == "" {
-		return fmt.Errorf("group secret key not available")
-	}
+	case services.SubmissionRejected:
+		slog.ErrorContext(c.UserContext(), "payout execution failed", "payout_id", payoutRequest.ID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Payout execution failed: %v", err),
+		})
 
-	// Send actual XLM from group wallet to recipient
-	_, err := services.SendXLM(group.SecretKey, recipient.Wallet, fmt.Sprintf("%.7f", payoutRequest.Amount))
-	if err != nil {
-		fmt.Printf("⚠️ Warning: XLM transfer failed but contract withdrawal succeeded: %v\n", err)
-		return fmt.Errorf("soroban withdrawal failed: %w", err)
+	default:
+		if errors.Is(err, services.ErrPayoutInProgress) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Payout is already being processed"})
+		}
+		if errors.Is(err, services.ErrRecipientUnverified) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "The recipient must verify their email address before the payout can be sent"})
+		}
+		if errors.Is(err, services.ErrRecipientOwesFines) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "The recipient must pay their outstanding late fines before the payout can be sent"})
+		}
+		if errors.Is(err, services.ErrPayoutNeedsSignatures) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "The payout was rebuilt after another transaction from the group wallet, treasury signers must approve it again"})
+		}
+		if latest, err := repository.Default.Payouts.ByID(payoutRequest.ID); err == nil {
+			payoutRequest = latest
+		}
+		if payoutRequest.SubmittedXDR == "" {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": fmt.Sprintf("Payout execution failed: %v", err),
+			})
+		}
+		// Outcome unknown: the payout stays approved and a retry resends the same envelope
+		slog.WarnContext(c.UserContext(), "payout submission outcome unknown", "payout_id", payoutRequest.ID, "error", err)
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message": "Payout submitted, confirmation pending",
+			"status":  "approved",
+			"tx_hash": payoutRequest.TxHash,
+		})
 	}
-
-	fmt.Printf("✅ Payout executed successfully")
-	return nil
 }
 
 func GetPayoutRequests(c *fiber.Ctx) error {
 	groupID := c.Params("id")
-	user := c.Locals("user").(models.User)
-
-	// Check if user is member of the group
-	var member models.Member
-	if err := database.DB.Where("group_id = ? AND user_id = ? AND status = ?",
-		groupID, user.ID, "approved").First(&member).Error; err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not a group member"})
-	}
-
-	var payoutRequests []models.PayoutRequest
-	err := database.DB.Where("group_id = ?", groupID).
-		Preload("Recipient").
-		Preload("Approvals.Admin").
-		Order("created_at DESC").
-		Find(&payoutRequests).Error
 
+	payoutRequests, err := repository.Default.Payouts.ForGroup(groupID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	// Show where each request stands under the group's approval policy
+	if group, ok := c.Locals("group").(models.Group); ok {
+		for i := range payoutRequests {
+			if tally, err := services.TallyPayout(group, payoutRequests[i]); err == nil {
+				payoutRequests[i].Tally = &tally
+			}
+		}
+	}
+
 	return c.JSON(payoutRequests)
 }
@@ -0,0 +1,82 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/services"
+)
+
+func TestAuthorizeRoundPayout(t *testing.T) {
+	e := newEnv(t)
+	group, creator, members := activeGroup(t, e)
+	path := "/group/" + group.ID + "/authorize-payout"
+
+	// The round is not funded yet
+	expect(t, e, 400, "POST", path, creator.Token, map[string]int{"round": 1}, nil)
+
+	for _, member := range append([]models.AuthResponse{creator}, members...) {
+		if err := e.Contribute(member, group.ID, 1, 10); err != nil {
+			t.Fatalf("contribute: %v", err)
+		}
+	}
+
+	expect(t, e, 403, "POST", path, members[1].Token, map[string]int{"round": 1}, nil)
+	var authorized struct {
+		Authorized      bool    `json:"authorized"`
+		Amount          float64 `json:"amount"`
+		PayoutRequestID string  `json:"payout_request_id"`
+	}
+	expect(t, e, 200, "POST", path, creator.Token, map[string]int{"round": 1}, &authorized)
+	if !authorized.Authorized || authorized.Amount != 30 {
+		t.Fatalf("authorization %+v, want the 30 XLM pot authorized", authorized)
+	}
+
+	// The payout engine sends authorized rounds
+	if err := services.ExecuteAuthorizedPayouts(e.Context()); err != nil {
+		t.Fatalf("payout engine: %v", err)
+	}
+	if got := e.Ledger.Balance(members[0].User.Wallet); got != "10019.9999900" {
+		t.Errorf("recipient balance %s, want the 30 XLM pot added", got)
+	}
+
+	var requests []models.PayoutRequest
+	expect(t, e, 200, "GET", "/group/"+group.ID+"/payout-requests", members[0].Token, nil, &requests)
+	if len(requests) != 1 || requests[0].ID != authorized.PayoutRequestID || requests[0].Status != "completed" {
+		t.Errorf("payout requests %+v, want the round's payout completed", requests)
+	}
+}
+
+func TestApprovePayoutRequest(t *testing.T) {
+	e := newEnv(t)
+	group, creator, members := activeGroup(t, e)
+	path := "/group/" + group.ID + "/payout-request"
+
+	expect(t, e, 400, "POST", path, creator.Token,
+		map[string]interface{}{"recipient_id": members[0].User.ID, "amount": 20000, "round": 1}, nil)
+	expect(t, e, 403, "POST", path, members[0].Token,
+		map[string]interface{}{"recipient_id": members[0].User.ID, "amount": 5, "round": 1}, nil)
+
+	var created struct {
+		Request models.PayoutRequest `json:"request"`
+	}
+	expect(t, e, 200, "POST", path, creator.Token,
+		map[string]interface{}{"recipient_id": members[0].User.ID, "amount": 5, "round": 1}, &created)
+	expect(t, e, 409, "POST", path, creator.Token,
+		map[string]interface{}{"recipient_id": members[1].User.ID, "amount": 5, "round": 1}, nil)
+
+	approve := "/payout/" + created.Request.ID + "/approve"
+	expect(t, e, 403, "POST", approve, members[1].Token, map[string]bool{"approved": true}, nil)
+
+	var executed struct {
+		Status string `json:"status"`
+		TxHash string `json:"tx_hash"`
+	}
+	expect(t, e, 200, "POST", approve, creator.Token, map[string]bool{"approved": true}, &executed)
+	if executed.Status != "completed" || executed.TxHash == "" {
+		t.Fatalf("approval %+v, want the payout executed", executed)
+	}
+	if got := e.Ledger.Balance(members[0].User.Wallet); got != "10005.0000000" {
+		t.Errorf("recipient balance %s, want 5 XLM added", got)
+	}
+}
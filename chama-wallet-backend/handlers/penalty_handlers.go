@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"chama-wallet-backend/config"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
+	"chama-wallet-backend/services"
+)
+
+// GetPenalties lists the group's late fines, newest first. Filter with ?status= and
+// ?member_id=.
+func GetPenalties(c *fiber.Ctx) error {
+	groupID := c.Params("id")
+	status := c.Query("status")
+	memberID := c.Query("member_id")
+
+	penalties, err := repository.Default.Penalties.ForGroup(groupID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	filtered := []models.Penalty{}
+	var outstanding float64
+	for _, penalty := range penalties {
+		if (status != "" && penalty.Status != status) || (memberID != "" && penalty.MemberID != memberID) {
+			continue
+		}
+		if penalty.Status == "owed" || penalty.Status == "pending" {
+			outstanding += penalty.Amount
+		}
+		filtered = append(filtered, penalty)
+	}
+
+	return c.JSON(fiber.Map{
+		"penalties":   filtered,
+		"outstanding": outstanding,
+		"policy":      services.GroupLatePolicy(c.Locals("group").(models.Group)),
+	})
+}
+
+// PreparePenaltyPayment builds the unsigned payment for one of the member's own fines.
+// The client signs the returned XDR and posts it to PayPenalty.
+func PreparePenaltyPayment(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	member := c.Locals("member").(models.Member)
+	group := c.Locals("group").(models.Group)
+
+	penalty, err := repository.Default.Penalties.InGroup(c.Params("penaltyId"), group.ID)
+	if err != nil || penalty.MemberID != member.ID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Fine not found"})
+	}
+	if penalty.Status != "owed" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": fmt.Sprintf("Fine is already %s", penalty.Status)})
+	}
+
+	tx, err := services.BuildPaymentTx(c.UserContext(), penaltyPayment(penalty, user, group))
+	if err != nil {
+		slog.ErrorContext(c.UserContext(), "failed to build fine payment", "penalty_id", penalty.ID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to build transaction: %v", err),
+		})
+	}
+
+	envelope, err := tx.Base64()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to encode transaction"})
+	}
+
+	return c.JSON(fiber.Map{
+		"penalty_id":         penalty.ID,
+		"unsigned_xdr":       envelope,
+		"network_passphrase": config.GetNetworkPassphrase(),
+		"source":             user.Wallet,
+		"destination":        group.Wallet,
+		"amount":             fmt.Sprintf("%.7f", penalty.Amount),
+		"memo":               penalty.Memo,
+	})
+}
+
+// PayPenalty verifies a client-signed fine payment and submits it
+func PayPenalty(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	member := c.Locals("member").(models.Member)
+	group := c.Locals("group").(models.Group)
+
+	var payload struct {
+		SignedXDR string `json:"signed_xdr"`
+	}
+	if err := c.BodyParser(&payload); err != nil || payload.SignedXDR == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "signed_xdr is required"})
+	}
+
+	penalty, err := repository.Default.Penalties.InGroup(c.Params("penaltyId"), group.ID)
+	if err != nil || penalty.MemberID != member.ID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Fine not found"})
+	}
+
+	switch penalty.Status {
+	case "owed":
+	case "pending":
+		// A previous attempt may or may not have reached the network; finish that one
+		return finishPenaltyPayment(c, penalty)
+	default:
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": fmt.Sprintf("Fine is already %s", penalty.Status)})
+	}
+
+	tx, err := services.VerifySignedPayment(payload.SignedXDR, penaltyPayment(penalty, user, group))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Signed transaction rejected: %v", err),
+		})
+	}
+
+	envelope, txHash, err := services.EnvelopeHash(tx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Record the exact transaction before it is submitted, so the fine is paid once
+	claimed, err := repository.Default.Penalties.Transition(penalty.ID, "owed", map[string]interface{}{
+		"status":        "pending",
+		"tx_hash":       txHash,
+		"submitted_xdr": envelope,
+		"updated_at":    time.Now(),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !claimed {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Fine is already being paid"})
+	}
+
+	penalty.Status = "pending"
+	penalty.TxHash = txHash
+	penalty.SubmittedXDR = envelope
+	return finishPenaltyPayment(c, penalty)
+}
+
+// finishPenaltyPayment submits a pending fine payment's recorded transaction, or finds it
+// on the ledger if an earlier attempt got through, and records the outcome
+func finishPenaltyPayment(c *fiber.Ctx, penalty models.Penalty) error {
+	resp, state, err := services.SubmitOnce(c.UserContext(), penalty.SubmittedXDR, penalty.TxHash)
+
+	switch state {
+	case services.SubmissionConfirmed:
+		if err := services.ConfirmPenaltyPayment(c.UserContext(), penalty.ID, resp.Hash); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		audit(c, services.AuditEntry{
+			GroupID:  penalty.GroupID,
+			Action:   services.AuditPenaltyPay,
+			TargetID: penalty.ID,
+			Before:   fiber.Map{"status": "pending"},
+			After:    fiber.Map{"status": "paid", "round": penalty.Round, "amount": penalty.Amount, "tx_hash": resp.Hash},
+		})
+		return c.JSON(fiber.Map{
+			"message":    "Fine paid successfully",
+			"penalty_id": penalty.ID,
+			"tx_hash":    resp.Hash,
+		})
+
+	case services.SubmissionRejected:
+		// The transaction will never apply; let the member sign a new one
+		slog.WarnContext(c.UserContext(), "fine payment rejected", "penalty_id", penalty.ID, "error", err)
+		repository.Default.Penalties.Transition(penalty.ID, "pending", map[string]interface{}{
+			"status":        "owed",
+			"tx_hash":       "",
+			"submitted_xdr": "",
+			"updated_at":    time.Now(),
+		})
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to transfer funds: %v", err),
+		})
+
+	default:
+		// Outcome unknown: the fine stays pending and a retry resends the same envelope
+		slog.WarnContext(c.UserContext(), "fine payment outcome unknown", "penalty_id", penalty.ID, "error", err)
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message":    "Fine payment submitted, confirmation pending",
+			"penalty_id": penalty.ID,
+			"status":     "pending",
+			"tx_hash":    penalty.TxHash,
+		})
+	}
+}
+
+// WaivePenalty cancels a member's unpaid fine
+func WaivePenalty(c *fiber.Ctx) error {
+	groupID := c.Params("id")
+	user := c.Locals("user").(models.User)
+
+	penalty, err := services.WaivePenalty(c.UserContext(), groupID, c.Params("penaltyId"), user)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	audit(c, services.AuditEntry{
+		GroupID:  groupID,
+		Action:   services.AuditPenaltyWaive,
+		TargetID: penalty.ID,
+		Before:   fiber.Map{"status": "owed", "amount": penalty.Amount},
+		After:    fiber.Map{"status": penalty.Status, "member_id": penalty.MemberID, "round": penalty.Round},
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "Fine waived successfully",
+		"penalty": penalty,
+	})
+}
+
+// penaltyPayment is the payment a fine must be paid with
+func penaltyPayment(penalty models.Penalty, user models.User, group models.Group) services.PaymentExpectation {
+	return services.PaymentExpectation{
+		Source:      user.Wallet,
+		Destination: group.Wallet,
+		Amount:      fmt.Sprintf("%.7f", penalty.Amount),
+		Memo:        penalty.Memo,
+	}
+}
@@ -1,293 +1,411 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	"github.com/stellar/go/keypair"
 
-	"chama-wallet-backend/database"
+	"chama-wallet-backend/config"
 	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
 	"chama-wallet-backend/services"
 )
 
-func ContributeToRound(c *fiber.Ctx) error {
+// PrepareRoundContribution builds the unsigned payment for a member's round contribution.
+// The client signs the returned XDR and posts it to ContributeToRound.
+func PrepareRoundContribution(c *fiber.Ctx) error {
 	groupID := c.Params("id")
 	user := c.Locals("user").(models.User)
 
 	var payload struct {
 		Round  int     `json:"round"`
 		Amount float64 `json:"amount"`
-		Secret string  `json:"secret"`
 	}
 
 	if err := c.BodyParser(&payload); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
 	}
 
-	// ✅ Validate the secret key belongs to the user
-	kp, err := keypair.ParseFull(payload.Secret)
+	member := c.Locals("member").(models.Member)
+
+	group := c.Locals("group").(models.Group)
+
+	if group.Status != "active" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Group is not active"})
+	}
+
+	// Validate amount matches expected contribution
+	if payload.Amount != group.ContributionAmount {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Amount must be %.2f XLM", group.ContributionAmount),
+		})
+	}
+
+	totalRounds, err := services.TotalRounds(group)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid secret key format",
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if payload.Round < 1 || payload.Round > totalRounds {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Round must be between 1 and %d", totalRounds),
 		})
 	}
 
-	if kp.Address() != user.Wallet {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Secret key does not match your wallet address",
+	// Rounds already paid out take no more contributions
+	roundStatus, err := repository.Default.Contributions.RoundStatus(groupID, payload.Round)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if payload.Round < group.CurrentRound || roundStatus.Status == "completed" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fmt.Sprintf("Round %d is closed", payload.Round),
 		})
 	}
 
-	// Verify user is a member of the group
-	var member models.Member
-	if err := database.DB.Where("group_id = ? AND user_id = ? AND status = ?",
-		groupID, user.ID, "approved").First(&member).Error; err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not a member of this group"})
+	// Reuse an unsigned contribution for this round if the member asked before
+	contribution, err := repository.Default.Contributions.Round(groupID, member.ID, payload.Round)
+	if err == nil && contribution.Status != "awaiting_signature" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Already contributed for this round"})
 	}
 
-	// Get group details
-	var group models.Group
-	if err := database.DB.First(&group, "id = ?", groupID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Group not found"})
+	if err != nil {
+		contribution = models.RoundContribution{
+			ID:        uuid.NewString(),
+			GroupID:   groupID,
+			MemberID:  member.ID,
+			Round:     payload.Round,
+			Amount:    payload.Amount,
+			Status:    "awaiting_signature",
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}
+		contribution.Memo = services.ContributionMemo(contribution.ID)
+
+		if err := repository.Default.Contributions.CreateRound(&contribution); err != nil {
+			if !errors.Is(err, repository.ErrDuplicate) {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			}
+			// A concurrent request prepared this round's contribution first
+			contribution, err = repository.Default.Contributions.Round(groupID, member.ID, payload.Round)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			}
+			if contribution.Status != "awaiting_signature" {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Already contributed for this round"})
+			}
+		}
 	}
 
-	if group.Status != "active" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Group is not active"})
+	tx, err := services.BuildPaymentTx(c.UserContext(), roundContributionPayment(contribution, user, group))
+	if err != nil {
+		slog.ErrorContext(c.UserContext(), "failed to build contribution transaction", "group_id", group.ID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to build transaction: %v", err),
+		})
 	}
 
-	// Validate amount matches expected contribution
-	if payload.Amount != group.ContributionAmount {
+	envelope, err := tx.Base64()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to encode transaction"})
+	}
+
+	// Tell the member what paying now would cost them on top of the contribution
+	deadline := services.RoundDeadline(group, contribution.Round)
+	daysLate, fine := services.LateFine(group, deadline, time.Now())
+
+	return c.JSON(fiber.Map{
+		"deadline":           deadline,
+		"days_late":          daysLate,
+		"late_fine":          fine,
+		"contribution_id":    contribution.ID,
+		"unsigned_xdr":       envelope,
+		"network_passphrase": config.GetNetworkPassphrase(),
+		"source":             user.Wallet,
+		"destination":        group.Wallet,
+		"amount":             fmt.Sprintf("%.7f", contribution.Amount),
+		"memo":               contribution.Memo,
+	})
+}
+
+// ContributeToRound verifies a client-signed contribution payment and submits it
+func ContributeToRound(c *fiber.Ctx) error {
+	groupID := c.Params("id")
+	user := c.Locals("user").(models.User)
+
+	var payload struct {
+		ContributionID string `json:"contribution_id"`
+		SignedXDR      string `json:"signed_xdr"`
+	}
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
+	}
+
+	if payload.ContributionID == "" || payload.SignedXDR == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": fmt.Sprintf("Amount must be %.2f XLM", group.ContributionAmount),
+			"error": "Missing required fields: contribution_id and signed_xdr are required",
 		})
 	}
 
-	// Check if user already contributed for this round
-	var existingContribution models.RoundContribution
-	if err := database.DB.Where("group_id = ? AND member_id = ? AND round = ?",
-		groupID, member.ID, payload.Round).First(&existingContribution).Error; err == nil {
+	member := c.Locals("member").(models.Member)
+
+	group := c.Locals("group").(models.Group)
+
+	contribution, err := repository.Default.Contributions.MemberRound(payload.ContributionID, groupID, member.ID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Contribution not found"})
+	}
+
+	switch contribution.Status {
+	case "awaiting_signature":
+	case "pending":
+		// A previous attempt may or may not have reached the network; finish that one
+		// instead of sending the newly signed envelope
+		return finishRoundContribution(c, contribution)
+	default:
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Already contributed for this round"})
 	}
 
-	// Perform direct XLM transfer from user to group wallet
-	tx, err := services.SendXLM(payload.Secret, group.Wallet, fmt.Sprintf("%.7f", payload.Amount))
+	// Check the signed envelope pays exactly what this contribution records
+	tx, err := services.VerifySignedPayment(payload.SignedXDR, roundContributionPayment(contribution, user, group))
 	if err != nil {
-		fmt.Printf("❌ Failed to send XLM: %v\n", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": fmt.Sprintf("Failed to transfer funds: %v", err),
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Signed transaction rejected: %v", err),
 		})
 	}
-	output := tx.Hash // Use the transaction hash as output
-	fmt.Printf("✅ XLM transferred successfully. Transaction Hash: %s\n", output)
-
-	// Note: If the smart contract still needs to track contributions,
-	// you might need to call an unauthenticated 'record_contribution'
-	// function on the smart contract here, passing the user's public key
-	// and the amount. However, this would require modifying the smart contract
-	// to have such a function and ensuring proper authorization for it.
-	// For now, we are only performing the direct transfer.
-
-	// Record the contribution
-	contribution := models.RoundContribution{
-		ID:        uuid.NewString(),
-		GroupID:   groupID,
-		MemberID:  member.ID,
-		Round:     payload.Round,
-		Amount:    payload.Amount,
-		Status:    "confirmed",
-		TxHash:    output,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+
+	envelope, txHash, err := services.EnvelopeHash(tx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	if err := database.DB.Create(&contribution).Error; err != nil {
+	// Record the exact transaction as pending before it is submitted. Only one request
+	// can move the contribution out of awaiting_signature.
+	claimed, err := repository.Default.Contributions.TransitionRound(contribution.ID, "awaiting_signature", map[string]interface{}{
+		"status":        "pending",
+		"tx_hash":       txHash,
+		"submitted_xdr": envelope,
+		"updated_at":    time.Now(),
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
+	if !claimed {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Contribution is already being submitted"})
+	}
 
-	// Update or create round status
-	if err := updateRoundStatus(groupID, payload.Round); err != nil {
-		fmt.Printf("Warning: Failed to update round status: %v\n", err)
+	contribution.Status = "pending"
+	contribution.TxHash = txHash
+	contribution.SubmittedXDR = envelope
+	return finishRoundContribution(c, contribution)
+}
+
+// finishRoundContribution submits a pending contribution's recorded transaction, or finds
+// it on the ledger if an earlier attempt got through, and records the outcome
+func finishRoundContribution(c *fiber.Ctx, contribution models.RoundContribution) error {
+	resp, state, err := services.SubmitOnce(c.UserContext(), contribution.SubmittedXDR, contribution.TxHash)
+
+	switch state {
+	case services.SubmissionConfirmed:
+		slog.InfoContext(c.UserContext(), "round contribution transferred", "contribution_id", contribution.ID, "tx_hash", resp.Hash)
+		if err := services.ConfirmRoundContribution(c.UserContext(), contribution.ID, resp.Hash); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if latest, err := repository.Default.Contributions.RoundByID(contribution.ID); err == nil {
+			contribution = latest
+		}
+		audit(c, services.AuditEntry{
+			GroupID:  contribution.GroupID,
+			Action:   services.AuditRoundContribution,
+			TargetID: contribution.ID,
+			Before:   fiber.Map{"status": "pending"},
+			After:    fiber.Map{"status": contribution.Status, "round": contribution.Round, "amount": contribution.Amount, "tx_hash": resp.Hash},
+		})
+		return c.JSON(fiber.Map{
+			"message":      "Contribution successful",
+			"contribution": contribution,
+			"tx_hash":      resp.Hash,
+		})
+
+	case services.SubmissionRejected:
+		// The transaction will never apply; let the member sign a new one
+		slog.WarnContext(c.UserContext(), "round contribution rejected", "contribution_id", contribution.ID, "error", err)
+		repository.Default.Contributions.TransitionRound(contribution.ID, "pending", map[string]interface{}{
+			"status":        "awaiting_signature",
+			"tx_hash":       "",
+			"submitted_xdr": "",
+			"updated_at":    time.Now(),
+		})
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to transfer funds: %v", err),
+		})
+
+	default:
+		// Outcome unknown: the contribution stays pending and a retry resends the same envelope
+		slog.WarnContext(c.UserContext(), "round contribution outcome unknown", "contribution_id", contribution.ID, "error", err)
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message":         "Contribution submitted, confirmation pending",
+			"contribution_id": contribution.ID,
+			"status":          "pending",
+			"tx_hash":         contribution.TxHash,
+		})
 	}
+}
 
-	return c.JSON(fiber.Map{
-		"message":      "Contribution successful",
-		"contribution": contribution,
-		"tx_hash":      output,
-	})
+// roundContributionPayment is the payment a round contribution must be made with
+func roundContributionPayment(contribution models.RoundContribution, user models.User, group models.Group) services.PaymentExpectation {
+	return services.PaymentExpectation{
+		Source:      user.Wallet,
+		Destination: group.Wallet,
+		Amount:      fmt.Sprintf("%.7f", contribution.Amount),
+		Memo:        contribution.Memo,
+	}
 }
 
+// GetRoundStatus shows who has paid into a round, who is late and what each member has
+// been fined, or would be fined if they paid now
 func GetRoundStatus(c *fiber.Ctx) error {
 	groupID := c.Params("id")
 	round := c.QueryInt("round", 1)
+	group := c.Locals("group").(models.Group)
 
 	// Get round contributions
-	var contributions []models.RoundContribution
-	database.DB.Where("group_id = ? AND round = ?", groupID, round).
-		Preload("Member").
-		Preload("Member.User").
-		Find(&contributions)
+	contributions, _ := repository.Default.Contributions.ListRound(groupID, round)
 
 	// Get round status
-	var roundStatus models.RoundStatus
-	database.DB.Where("group_id = ? AND round = ?", groupID, round).First(&roundStatus)
+	roundStatus, _ := repository.Default.Contributions.RoundStatus(groupID, round)
 
 	// Get all approved members for this group
-	var allMembers []models.Member
-	database.DB.Where("group_id = ? AND status = ?", groupID, "approved").
-		Preload("User").
-		Find(&allMembers)
+	allMembers, _ := repository.Default.Members.ListApproved(groupID)
+
+	// Fines assessed for this round
+	penalties, _ := repository.Default.Penalties.ForRound(groupID, round)
 
 	// Create contribution map for easy lookup
 	contributionMap := make(map[string]models.RoundContribution)
 	for _, contrib := range contributions {
 		contributionMap[contrib.MemberID] = contrib
 	}
+	penaltyMap := make(map[string]models.Penalty)
+	for _, penalty := range penalties {
+		penaltyMap[penalty.MemberID] = penalty
+	}
+
+	deadline := services.RoundDeadline(group, round)
+	graceEnd := services.GraceEnd(group, deadline)
 
 	// Build response with member contribution status
 	type MemberContributionStatus struct {
 		Member       models.Member             `json:"member"`
 		HasPaid      bool                      `json:"has_paid"`
 		Contribution *models.RoundContribution `json:"contribution,omitempty"`
+		Late         bool                      `json:"late"`
+		DaysLate     int                       `json:"days_late"`
+		Fine         *models.Penalty           `json:"fine,omitempty"`
+		FineDue      float64                   `json:"fine_due"` // fine an unpaid member would owe if they paid now
 	}
 
 	var memberStatuses []MemberContributionStatus
+	paidMembers, lateMembers, finedMembers := 0, 0, 0
 	for _, member := range allMembers {
-		contrib, hasPaid := contributionMap[member.ID]
+		contrib, found := contributionMap[member.ID]
 		status := MemberContributionStatus{
 			Member:  member,
-			HasPaid: hasPaid,
+			HasPaid: found && contrib.Status == "confirmed",
 		}
-		if hasPaid {
+		if found {
 			status.Contribution = &contrib
 		}
+		if penalty, fined := penaltyMap[member.ID]; fined {
+			status.Fine = &penalty
+			status.Late = true
+			status.DaysLate = penalty.DaysLate
+			finedMembers++
+		} else if status.HasPaid {
+			// Paid late under a policy without fines, or before one was set
+			status.DaysLate, _ = services.LateFine(group, deadline, contrib.UpdatedAt)
+			status.Late = !deadline.IsZero() && contrib.UpdatedAt.After(graceEnd)
+		} else {
+			status.DaysLate, status.FineDue = services.LateFine(group, deadline, time.Now())
+			status.Late = !deadline.IsZero() && time.Now().After(graceEnd)
+		}
+		if status.HasPaid {
+			paidMembers++
+		}
+		if status.Late {
+			lateMembers++
+		}
 		memberStatuses = append(memberStatuses, status)
 	}
 
 	return c.JSON(fiber.Map{
-		"round":         round,
-		"round_status":  roundStatus,
-		"member_status": memberStatuses,
-		"total_members": len(allMembers),
-		"paid_members":  len(contributions),
+		"round":             round,
+		"round_status":      roundStatus,
+		"member_status":     memberStatuses,
+		"total_members":     len(allMembers),
+		"paid_members":      paidMembers,
+		"late_members":      lateMembers,
+		"fined_members":     finedMembers,
+		"deadline":          deadline,
+		"grace_period_ends": graceEnd,
+		"late_policy":       services.GroupLatePolicy(group),
 	})
 }
 
+// AuthorizeRoundPayout records an admin's authorization of a fully funded round's
+// payout to its scheduled recipient. The payout engine sends the pot once the round is
+// authorized.
 func AuthorizeRoundPayout(c *fiber.Ctx) error {
 	groupID := c.Params("id")
 	user := c.Locals("user").(models.User)
 
 	var payload struct {
-		Round int `json:"round"`
+		Round     int    `json:"round"`
+		SignedXDR string `json:"signed_xdr,omitempty"` // payout envelope signed by the admin's own wallet
 	}
 
 	if err := c.BodyParser(&payload); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
 	}
 
-	// Check if user is admin/creator
-	var admin models.Member
-	if err := database.DB.Where("group_id = ? AND user_id = ? AND role IN ?",
-		groupID, user.ID, []string{"creator", "admin"}).First(&admin).Error; err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only admins can authorize payouts"})
-	}
-
-	// Check if all members have contributed
-	var group models.Group
-	database.DB.First(&group, "id = ?", groupID)
-
-	var totalMembers int64
-	database.DB.Model(&models.Member{}).Where("group_id = ? AND status = ?", groupID, "approved").Count(&totalMembers)
-
-	var contributionsCount int64
-	database.DB.Model(&models.RoundContribution{}).Where("group_id = ? AND round = ? AND status = ?",
-		groupID, payload.Round, "confirmed").Count(&contributionsCount)
-
-	if contributionsCount < totalMembers {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": fmt.Sprintf("Not all members have contributed. %d/%d paid", contributionsCount, totalMembers),
-		})
+	authorization, err := services.AuthorizeRoundPayout(c.UserContext(), groupID, user, payload.Round, payload.SignedXDR)
+	if err != nil {
+		return serviceError(c, err)
 	}
 
-	// Update round status to authorized
-	database.DB.Model(&models.RoundStatus{}).
-		Where("group_id = ? AND round = ?", groupID, payload.Round).
-		Updates(map[string]interface{}{
-			"payout_authorized": true,
-			"status":            "ready_for_payout",
+	tally := authorization.Tally
+	audit(c, services.AuditEntry{
+		GroupID:  groupID,
+		Action:   services.AuditRoundAuthorize,
+		TargetID: authorization.PayoutRequest.ID,
+		After:    fiber.Map{"round": payload.Round, "signed": payload.SignedXDR != "", "outcome": tally.Outcome},
+	})
+	if tally.Outcome != "approved" {
+		message := fmt.Sprintf("Authorization recorded, waiting for more approvals (%d/%d)", tally.Approvals, tally.Required)
+		if tally.Outcome != "pending" {
+			message = fmt.Sprintf("Round payout was %s", tally.Outcome)
+		} else if tally.Approvals >= tally.Required {
+			message = fmt.Sprintf("Authorization recorded, waiting for more signers (%d/%d)", tally.Signatures, tally.SignaturesRequired)
+		}
+		return c.JSON(fiber.Map{
+			"message":           message,
+			"round":             payload.Round,
+			"payout_request_id": authorization.PayoutRequest.ID,
+			"authorized":        false,
+			"tally":             tally,
 		})
-
-	// Get the recipient for this round from payout schedule
-	var payoutSchedule models.PayoutSchedule
-	if err := database.DB.Where("group_id = ? AND round = ?", groupID, payload.Round).
-		Preload("Member").
-		Preload("Member.User").
-		First(&payoutSchedule).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Payout schedule not found"})
-	}
-
-	// Notify all members about authorized payout
-	var members []models.Member
-	database.DB.Where("group_id = ? AND status = ?", groupID, "approved").Find(&members)
-
-	for _, member := range members {
-		services.CreateNotification(
-			member.UserID,
-			groupID,
-			"round_payout_authorized",
-			"Round Payout Authorized",
-			fmt.Sprintf("Round %d payout has been authorized for %s", payload.Round, payoutSchedule.Member.User.Name),
-		)
 	}
 
 	return c.JSON(fiber.Map{
-		"message":   "Round payout authorized successfully",
-		"round":     payload.Round,
-		"recipient": payoutSchedule.Member.User.Name,
-		"amount":    payoutSchedule.Amount,
+		"message":           "Round payout authorized successfully",
+		"round":             payload.Round,
+		"recipient":         authorization.Schedule.Member.User.Name,
+		"amount":            authorization.Schedule.Amount,
+		"payout_request_id": authorization.PayoutRequest.ID,
+		"authorized":        true,
 	})
 }
-
-func updateRoundStatus(groupID string, round int) error {
-	// Get total required amount and member count
-	var group models.Group
-	database.DB.First(&group, "id = ?", groupID)
-
-	var totalMembers int64
-	database.DB.Model(&models.Member{}).Where("group_id = ? AND status = ?", groupID, "approved").Count(&totalMembers)
-
-	// Get current contributions for this round
-	var contributionsCount int64
-	var totalReceived float64
-	database.DB.Model(&models.RoundContribution{}).
-		Where("group_id = ? AND round = ? AND status = ?", groupID, round, "confirmed").
-		Count(&contributionsCount)
-
-	database.DB.Model(&models.RoundContribution{}).
-		Where("group_id = ? AND round = ? AND status = ?", groupID, round, "confirmed").
-		Select("COALESCE(SUM(amount), 0)").
-		Scan(&totalReceived)
-
-	totalRequired := group.ContributionAmount * float64(totalMembers)
-
-	// Update or create round status
-	roundStatus := models.RoundStatus{
-		GroupID:           groupID,
-		Round:             round,
-		TotalRequired:     totalRequired,
-		TotalReceived:     totalReceived,
-		ContributorsCount: int(contributionsCount),
-		RequiredCount:     int(totalMembers),
-		Status:            "collecting",
-	}
-
-	if contributionsCount >= totalMembers {
-		roundStatus.Status = "ready_for_payout"
-	}
-
-	return database.DB.Where("group_id = ? AND round = ?", groupID, round).
-		Assign(roundStatus).
-		FirstOrCreate(&roundStatus).Error
-}
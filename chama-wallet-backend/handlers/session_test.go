@@ -0,0 +1,53 @@
+package handlers_test
+
+import (
+	"testing"
+	"time"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+)
+
+func TestRefreshRotatesAndReuseRevokesTheSession(t *testing.T) {
+	e := newEnv(t)
+	first := register(t, e, "Wanjiru", "wanjiru@example.com")
+	other := register(t, e, "Achieng", "achieng@example.com")
+
+	var rotated models.AuthResponse
+	expect(t, e, 200, "POST", "/auth/refresh", "", map[string]string{"refresh_token": first.RefreshToken}, &rotated)
+	if rotated.RefreshToken == first.RefreshToken || rotated.SessionID != first.SessionID {
+		t.Fatalf("refresh returned session %s with token %q, want a new token for session %s", rotated.SessionID, rotated.RefreshToken, first.SessionID)
+	}
+	expect(t, e, 200, "GET", "/auth/profile", rotated.Token, nil, nil)
+
+	// The rotated-out token was copied: presenting it signs the whole session out
+	expect(t, e, 401, "POST", "/auth/refresh", "", map[string]string{"refresh_token": first.RefreshToken}, nil)
+	expect(t, e, 401, "POST", "/auth/refresh", "", map[string]string{"refresh_token": rotated.RefreshToken}, nil)
+	expect(t, e, 401, "GET", "/auth/profile", rotated.Token, nil, nil)
+	expect(t, e, 401, "GET", "/auth/profile", first.Token, nil, nil)
+
+	// Other users' sessions are untouched
+	expect(t, e, 200, "GET", "/auth/profile", other.Token, nil, nil)
+}
+
+func TestAuthRejectsEndedSessions(t *testing.T) {
+	e := newEnv(t)
+	registered := register(t, e, "Wanjiru", "wanjiru@example.com")
+	var second models.AuthResponse
+	expect(t, e, 200, "POST", "/auth/login", "",
+		models.LoginRequest{Email: "wanjiru@example.com", Password: "password123"}, &second)
+
+	// A session revoked from another device
+	expect(t, e, 200, "DELETE", "/auth/sessions/"+registered.SessionID, second.Token, nil, nil)
+	expect(t, e, 401, "GET", "/auth/profile", registered.Token, nil, nil)
+	expect(t, e, 401, "POST", "/auth/refresh", "", map[string]string{"refresh_token": registered.RefreshToken}, nil)
+
+	// An expired session
+	expect(t, e, 200, "GET", "/auth/profile", second.Token, nil, nil)
+	if err := database.DB.Model(&models.Session{}).Where("id = ?", second.SessionID).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	expect(t, e, 401, "GET", "/auth/profile", second.Token, nil, nil)
+	expect(t, e, 401, "POST", "/auth/refresh", "", map[string]string{"refresh_token": second.RefreshToken}, nil)
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
+	"chama-wallet-backend/services"
+)
+
+// GetShares returns the shares each member has bought in the current cycle, the profit
+// the group has earned and what each member would be paid if it were shared out now
+func GetShares(c *fiber.Ctx) error {
+	group := c.Locals("group").(models.Group)
+	if services.GroupType(group) != services.GroupASCA {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Only savings and credit groups buy shares"})
+	}
+
+	cycle, err := services.CurrentCycle(group)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"cycle":  cycle,
+		"policy": services.GroupSharePolicy(group),
+	})
+}
+
+// GetSettlements lists the group's share-outs, newest first, with each member's payout
+func GetSettlements(c *fiber.Ctx) error {
+	settlements, err := repository.Default.Settlements.ForGroup(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"settlements": settlements})
+}
+
+// GetSettlement returns one of the group's share-outs with each member's payout
+func GetSettlement(c *fiber.Ctx) error {
+	settlement, err := repository.Default.Settlements.InGroup(c.Params("settlementId"), c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Share-out not found"})
+	}
+	return c.JSON(fiber.Map{"settlement": settlement})
+}
+
+// PrepareSettlement computes the share-out of the group's ended cycle for the admins to
+// approve. The settle_share_out job does this once a cycle ends; this prepares it again
+// after the admins rejected it or it expired.
+func PrepareSettlement(c *fiber.Ctx) error {
+	settlement, err := services.PrepareSettlement(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	audit(c, services.AuditEntry{
+		GroupID:  settlement.GroupID,
+		Action:   services.AuditSettlementPrepare,
+		TargetID: settlement.ID,
+		After:    services.SettlementAudit(settlement),
+	})
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":    "Share-out prepared and waiting for approval",
+		"settlement": settlement,
+	})
+}
+
+// ApproveSettlement records the admin's vote on every open batch of a share-out, and
+// pays the batches the vote approves. On multisig treasuries signed_xdrs maps each
+// batch's payout request ID to its envelope signed by the admin's own wallet.
+func ApproveSettlement(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var payload struct {
+		Approved   bool              `json:"approved"`
+		SignedXDRs map[string]string `json:"signed_xdrs,omitempty"`
+	}
+	if err := c.BodyParser(&payload); err != nil {
+		slog.DebugContext(c.UserContext(), "invalid request body", "error", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
+	}
+
+	settlement, batches, err := services.VoteOnSettlement(c.UserContext(), c.Params("id"), c.Params("settlementId"), user, payload.Approved, payload.SignedXDRs)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	audit(c, services.AuditEntry{
+		GroupID:  settlement.GroupID,
+		Action:   services.AuditSettlementVote,
+		TargetID: settlement.ID,
+		After:    fiber.Map{"approved": payload.Approved, "signed": len(payload.SignedXDRs), "status": settlement.Status, "batches": batches},
+	})
+
+	message := fmt.Sprintf("Vote recorded, share-out is %s", settlement.Status)
+	if settlement.Status == "completed" {
+		message = "Share-out approved and paid"
+	}
+	return c.JSON(fiber.Map{
+		"message":    message,
+		"status":     settlement.Status,
+		"settlement": settlement,
+		"batches":    batches,
+	})
+}
+
+// ReissueSettlement raises the unpaid batches of an incomplete share-out for approval again
+func ReissueSettlement(c *fiber.Ctx) error {
+	settlement, err := services.ReissueSettlement(c.UserContext(), c.Params("id"), c.Params("settlementId"))
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	audit(c, services.AuditEntry{
+		GroupID:  settlement.GroupID,
+		Action:   services.AuditSettlementReissue,
+		TargetID: settlement.ID,
+		After:    fiber.Map{"status": settlement.Status},
+	})
+
+	return c.JSON(fiber.Map{
+		"message":    "Unpaid share-out batches raised for approval again",
+		"settlement": settlement,
+	})
+}
+
+// UpdateSharePolicy changes the share price and cycle length. Shares already bought keep
+// the price they were bought at.
+func UpdateSharePolicy(c *fiber.Ctx) error {
+	groupID := c.Params("id")
+	group := c.Locals("group").(models.Group)
+
+	if services.GroupType(group) != services.GroupASCA {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Only savings and credit groups buy shares"})
+	}
+
+	var policy models.SharePolicy
+	if err := c.BodyParser(&policy); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
+	}
+	if err := services.ValidateSharePolicy(policy); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := repository.Default.Groups.Update(groupID, services.SharePolicyUpdates(policy)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	slog.InfoContext(c.UserContext(), "share policy updated", "group_id", groupID,
+		"share_price", policy.SharePrice, "cycle_rounds", policy.CycleRounds)
+
+	audit(c, services.AuditEntry{
+		GroupID:  groupID,
+		Action:   services.AuditGroupSharePolicy,
+		TargetID: groupID,
+		Before:   services.GroupSharePolicy(group),
+		After:    policy,
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "Share policy updated successfully",
+		"policy":  policy,
+	})
+}
@@ -1,14 +1,16 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 
-	"chama-wallet-backend/services"
 	"chama-wallet-backend/config"
+	"chama-wallet-backend/services"
 )
 
 // ContributeHandler handles direct Soroban contributions
@@ -17,12 +19,12 @@ func ContributeHandler(c *fiber.Ctx) error {
 		ContractID  string `json:"contract_id"`
 		UserAddress string `json:"user_address"`
 		Amount      string `json:"amount"`
-		SecretKey   string `json:"secret_key,omitempty"`
+		SignedXDR   string `json:"signed_xdr,omitempty"`
 	}
 
 	var body RequestBody
 	if err := c.BodyParser(&body); err != nil {
-		fmt.Printf("❌ Failed to parse contribute request: %v\n", err)
+		slog.DebugContext(c.UserContext(), "invalid request body", "error", err)
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
@@ -51,26 +53,32 @@ func ContributeHandler(c *fiber.Ctx) error {
 		}
 	}
 
-	fmt.Printf("🔄 Processing direct Soroban contribution: %s XLM from %s to contract %s on %s\n",
-		body.Amount, body.UserAddress, body.ContractID, config.Config.Network)
+	slog.InfoContext(c.UserContext(), "processing direct soroban contribution",
+		"contract_id", body.ContractID, "address", body.UserAddress, "amount", body.Amount, "network", config.Config.Network)
 	args := []string{body.UserAddress, body.Amount}
 	var result string
 
-	// Use authenticated call if secret key provided, otherwise use regular call
-	if body.SecretKey != "" {
-		result, err = services.CallSorobanFunctionWithAuth(body.ContractID, "contribute", body.SecretKey, args)
+	// Submit the user's signed call if provided, otherwise use regular call
+	if body.SignedXDR != "" {
+		result, err = submitSignedSorobanCall(c.UserContext(), body.SignedXDR, services.SorobanExpectation{
+			Source:     body.UserAddress,
+			ContractID: body.ContractID,
+			Function:   "contribute",
+			User:       body.UserAddress,
+			Amount:     body.Amount,
+		})
 	} else {
-		result, err = services.CallSorobanFunction(body.ContractID, "contribute", args)
+		result, err = services.CallSorobanFunction(c.UserContext(), body.ContractID, "contribute", args)
 	}
 
 	if err != nil {
-		fmt.Printf("❌ Soroban contribution failed: %v\n", err)
+		slog.ErrorContext(c.UserContext(), "soroban contribution failed", "contract_id", body.ContractID, "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": fmt.Sprintf("Blockchain transaction failed: %v", err),
 		})
 	}
 
-	fmt.Printf("✅ Direct Soroban contribution successful on %s: %s\n", config.Config.Network, result)
+	slog.InfoContext(c.UserContext(), "direct soroban contribution submitted", "contract_id", body.ContractID, "tx_hash", result)
 
 	return c.JSON(fiber.Map{
 		"message":     "Contribution successful",
@@ -101,7 +109,7 @@ func BalanceHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	result, err := services.GetBalance(body.ContractID, body.UserAddress)
+	result, err := services.GetBalance(c.UserContext(), body.ContractID, body.UserAddress)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": fmt.Sprintf("Failed to get balance: %v", err),
@@ -122,7 +130,7 @@ func WithdrawHandler(c *fiber.Ctx) error {
 		ContractID  string `json:"contract_id"`
 		UserAddress string `json:"user_address"`
 		Amount      string `json:"amount"`
-		SecretKey   string `json:"secret_key"`
+		SignedXDR   string `json:"signed_xdr"`
 	}
 
 	var body RequestBody
@@ -130,9 +138,9 @@ func WithdrawHandler(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	if body.ContractID == "" || body.UserAddress == "" || body.Amount == "" || body.SecretKey == "" {
+	if body.ContractID == "" || body.UserAddress == "" || body.Amount == "" || body.SignedXDR == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Missing required fields: contract_id, user_address, amount, and secret_key are required",
+			"error": "Missing required fields: contract_id, user_address, amount, and signed_xdr are required",
 		})
 	}
 
@@ -153,8 +161,13 @@ func WithdrawHandler(c *fiber.Ctx) error {
 			})
 		}
 	}
-	args := []string{body.UserAddress, body.Amount}
-	result, err := services.CallSorobanFunctionWithAuth(body.ContractID, "withdraw", body.SecretKey, args)
+	result, err := submitSignedSorobanCall(c.UserContext(), body.SignedXDR, services.SorobanExpectation{
+		Source:     body.UserAddress,
+		ContractID: body.ContractID,
+		Function:   "withdraw",
+		User:       body.UserAddress,
+		Amount:     body.Amount,
+	})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": fmt.Sprintf("Withdrawal failed: %v", err),
@@ -189,7 +202,7 @@ func HistoryHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	result, err := services.GetContributionHistory(body.ContractID, body.UserAddress)
+	result, err := services.GetContributionHistory(c.UserContext(), body.ContractID, body.UserAddress)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": fmt.Sprintf("Failed to get history: %v", err),
@@ -203,3 +216,76 @@ func HistoryHandler(c *fiber.Ctx) error {
 		"network":     config.Config.Network,
 	})
 }
+
+// PrepareContributeHandler builds an unsigned contribute call for the client to sign
+func PrepareContributeHandler(c *fiber.Ctx) error {
+	return prepareSorobanCall(c, "contribute")
+}
+
+// PrepareWithdrawHandler builds an unsigned withdraw call for the client to sign
+func PrepareWithdrawHandler(c *fiber.Ctx) error {
+	return prepareSorobanCall(c, "withdraw")
+}
+
+func prepareSorobanCall(c *fiber.Ctx, function string) error {
+	type RequestBody struct {
+		ContractID  string `json:"contract_id"`
+		UserAddress string `json:"user_address"`
+		Amount      string `json:"amount"`
+	}
+
+	var body RequestBody
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if body.ContractID == "" || body.UserAddress == "" || body.Amount == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Missing required fields: contract_id, user_address, and amount are required",
+		})
+	}
+
+	// The contract stores whole i128 amounts
+	if amount, err := strconv.ParseInt(body.Amount, 10, 64); err != nil || amount <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Amount must be a positive whole number",
+		})
+	}
+
+	tx, err := services.BuildSorobanInvokeTx(c.UserContext(), services.SorobanExpectation{
+		Source:     body.UserAddress,
+		ContractID: body.ContractID,
+		Function:   function,
+		User:       body.UserAddress,
+		Amount:     body.Amount,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to build transaction: %v", err),
+		})
+	}
+
+	envelope, err := tx.Base64()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to encode transaction"})
+	}
+
+	return c.JSON(fiber.Map{
+		"unsigned_xdr":       envelope,
+		"network_passphrase": config.GetNetworkPassphrase(),
+		"contract_id":        body.ContractID,
+		"function":           function,
+		"user":               body.UserAddress,
+		"amount":             body.Amount,
+	})
+}
+
+// submitSignedSorobanCall verifies a client-signed contract call and submits it
+func submitSignedSorobanCall(ctx context.Context, signedXDR string, expected services.SorobanExpectation) (string, error) {
+	tx, err := services.VerifySignedSorobanInvoke(signedXDR, expected)
+	if err != nil {
+		return "", fmt.Errorf("signed transaction rejected: %w", err)
+	}
+
+	return services.SubmitSorobanTx(ctx, tx)
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/services"
+)
+
+// twoFactorCode reads the code field used by the two-factor endpoints
+func twoFactorCode(c *fiber.Ctx) (string, bool) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return "", false
+	}
+	return req.Code, true
+}
+
+// GetTwoFactorStatus reports whether the current user has TOTP enabled
+func GetTwoFactorStatus(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	status, err := services.GetTwoFactorStatus(user)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(status)
+}
+
+// EnrollTOTP starts TOTP enrolment and returns the secret and provisioning URI
+func EnrollTOTP(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	enrollment, err := services.BeginTOTPEnrollment(user)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(enrollment)
+}
+
+// ConfirmTOTP finishes enrolment with a code from the authenticator app
+func ConfirmTOTP(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	code, ok := twoFactorCode(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "code is required"})
+	}
+
+	recoveryCodes, err := services.ConfirmTOTPEnrollment(c.UserContext(), user, code)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	audit(c, services.AuditEntry{Action: services.AuditTwoFactorEnable, TargetID: user.ID})
+
+	return c.JSON(fiber.Map{
+		"message":        "Two-factor authentication enabled. Store the recovery codes somewhere safe, they are shown once.",
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// DisableTOTP turns two-factor authentication off
+func DisableTOTP(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	code, ok := twoFactorCode(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "code is required"})
+	}
+
+	if err := services.DisableTOTP(c.UserContext(), user, code); err != nil {
+		return serviceError(c, err)
+	}
+
+	audit(c, services.AuditEntry{Action: services.AuditTwoFactorDisable, TargetID: user.ID})
+
+	return c.JSON(fiber.Map{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes
+func RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	code, ok := twoFactorCode(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "code is required"})
+	}
+
+	recoveryCodes, err := services.RegenerateRecoveryCodes(c.UserContext(), user, code)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	audit(c, services.AuditEntry{Action: services.AuditRecoveryCodesRenew, TargetID: user.ID})
+
+	return c.JSON(fiber.Map{"recovery_codes": recoveryCodes})
+}
+
+// StepUp confirms a second factor for the current session ahead of a sensitive action
+func StepUp(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	sessionID := c.Locals("sessionID").(string)
+
+	code, ok := twoFactorCode(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "code is required"})
+	}
+
+	expiresAt, err := services.StepUp(c.UserContext(), user, sessionID, code)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	audit(c, services.AuditEntry{Action: services.AuditStepUp, TargetID: sessionID})
+
+	return c.JSON(fiber.Map{
+		"message":            "Second factor confirmed",
+		"step_up_expires_at": expiresAt,
+	})
+}
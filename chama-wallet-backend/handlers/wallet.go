@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"strconv"
 	"strings"
@@ -13,6 +14,8 @@ import (
 	"github.com/stellar/go/txnbuild"
 
 	"chama-wallet-backend/config"
+	"chama-wallet-backend/ledger"
+	"chama-wallet-backend/models"
 	"chama-wallet-backend/services"
 )
 
@@ -30,7 +33,7 @@ func CreateWallet(c *fiber.Ctx) error {
 func GetBalance(c *fiber.Ctx) error {
 	address := c.Params("address")
 
-	client := config.GetHorizonClient()
+	client := services.LedgerFrom(c.UserContext())
 	accountRequest := horizonclient.AccountRequest{AccountID: address}
 	account, err := client.AccountDetail(accountRequest)
 	if err != nil {
@@ -62,87 +65,105 @@ func GetBalance(c *fiber.Ctx) error {
 }
 
 type TransferRequest struct {
-	FromSeed  string `json:"from_seed"`
 	ToAddress string `json:"to_address"`
 	Amount    string `json:"amount"`
 	AssetType string `json:"asset_type,omitempty"` // "XLM" or "USDC"
+	SignedXDR string `json:"signed_xdr,omitempty"`
 }
 
-func TransferFunds(c *fiber.Ctx) error {
-	var req TransferRequest
-	if err := c.BodyParser(&req); err != nil {
-		fmt.Printf("❌ Failed to parse transfer request: %v\n", err)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
-	}
-
+// validateTransfer checks a transfer request and returns the payment it describes
+func validateTransfer(req TransferRequest, source string) (services.PaymentExpectation, error) {
 	// Validate required fields
-	if req.FromSeed == "" || req.ToAddress == "" || req.Amount == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Missing required fields: from_seed, to_address, and amount are required",
-		})
+	if req.ToAddress == "" || req.Amount == "" {
+		return services.PaymentExpectation{}, fmt.Errorf("Missing required fields: to_address and amount are required")
 	}
 
 	// Validate amount is positive
-	if amount, err := strconv.ParseFloat(req.Amount, 64); err != nil || amount <= 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Amount must be a positive number",
-		})
+	amount, err := strconv.ParseFloat(req.Amount, 64)
+	if err != nil || amount <= 0 {
+		return services.PaymentExpectation{}, fmt.Errorf("Amount must be a positive number")
 	}
 
 	// Validate transfer limits for mainnet
 	if config.Config.IsMainnet {
-		amount, _ := strconv.ParseFloat(req.Amount, 64)
 		minAmount, _ := strconv.ParseFloat(os.Getenv("MIN_TRANSFER_AMOUNT"), 64)
 		maxAmount, _ := strconv.ParseFloat(os.Getenv("MAX_TRANSFER_AMOUNT"), 64)
 
 		if minAmount > 0 && amount < minAmount {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": fmt.Sprintf("Amount below minimum transfer limit of %f", minAmount),
-			})
+			return services.PaymentExpectation{}, fmt.Errorf("Amount below minimum transfer limit of %f", minAmount)
 		}
 
 		if maxAmount > 0 && amount > maxAmount {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": fmt.Sprintf("Amount exceeds maximum transfer limit of %f", maxAmount),
-			})
+			return services.PaymentExpectation{}, fmt.Errorf("Amount exceeds maximum transfer limit of %f", maxAmount)
 		}
 	}
 
+	// Validate destination address format
+	if len(req.ToAddress) != 56 || !strings.HasPrefix(req.ToAddress, "G") {
+		return services.PaymentExpectation{}, fmt.Errorf("Invalid destination address format")
+	}
+
 	assetType := req.AssetType
 	if assetType == "" {
 		assetType = "XLM" // Default to XLM
 	}
 
-	fmt.Printf("🔄 Processing %s transfer: %s to %s on %s\n", assetType, req.Amount, req.ToAddress, config.Config.Network)
-	sourceKP, err := keypair.ParseFull(req.FromSeed)
-	if err != nil {
-		fmt.Printf("❌ Invalid secret key: %v\n", err)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid secret key"})
+	// Determine asset type
+	var asset txnbuild.Asset
+	if assetType == "USDC" && config.Config.IsMainnet {
+		// USDC payment (mainnet only)
+		asset = txnbuild.CreditAsset{
+			Code:   config.Config.USDCAssetCode,
+			Issuer: config.Config.USDCAssetIssuer,
+		}
+	} else {
+		// XLM payment (default)
+		asset = txnbuild.NativeAsset{}
 	}
 
-	// Validate destination address format
-	if len(req.ToAddress) != 56 || !strings.HasPrefix(req.ToAddress, "G") {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid destination address format",
-		})
+	// Add memo for mainnet compliance
+	var memo string
+	if config.Config.IsMainnet {
+		memo = fmt.Sprintf("Chama Wallet %s Transfer", assetType)
+	}
+
+	return services.PaymentExpectation{
+		Source:      source,
+		Destination: req.ToAddress,
+		Amount:      req.Amount,
+		Asset:       asset,
+		Memo:        memo,
+	}, nil
+}
+
+// PrepareTransfer builds an unsigned transfer from the user's wallet for the client to sign
+func PrepareTransfer(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var req TransferRequest
+	if err := c.BodyParser(&req); err != nil {
+		slog.DebugContext(c.UserContext(), "invalid request body", "error", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
 	}
 
-	client := config.GetHorizonClient()
-	ar := horizonclient.AccountRequest{AccountID: sourceKP.Address()}
-	sourceAccount, err := client.AccountDetail(ar)
+	payment, err := validateTransfer(req, user.Wallet)
 	if err != nil {
-		fmt.Printf("❌ Cannot load source account: %v\n", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
 
+	client := services.LedgerFrom(c.UserContext())
+	ar := horizonclient.AccountRequest{AccountID: user.Wallet}
+	if _, err := client.AccountDetail(ar); err != nil {
 		// Check if account doesn't exist and try to fund it
-		if horizonError, ok := err.(*horizonclient.Error); ok && horizonError.Problem.Status == 404 {
+		if ledger.IsNotFound(err) {
 			if config.Config.IsMainnet {
 				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 					"error": "Source account not found on mainnet. Please fund the account with real XLM first.",
 				})
 			}
 
-			fmt.Printf("🔄 Source account not found, attempting to fund: %s\n", sourceKP.Address())
-			if fundErr := services.FundTestAccount(sourceKP.Address()); fundErr != nil {
+			slog.WarnContext(c.UserContext(), "source account not found, funding it", "address", user.Wallet)
+			if fundErr := services.FundTestAccount(c.UserContext(), user.Wallet); fundErr != nil {
 				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 					"error": "Source account not found and funding failed",
 				})
@@ -150,14 +171,6 @@ func TransferFunds(c *fiber.Ctx) error {
 
 			// Wait for funding to process
 			time.Sleep(3 * time.Second)
-
-			// Try to load account again
-			sourceAccount, err = client.AccountDetail(ar)
-			if err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"error": "Cannot load source account after funding",
-				})
-			}
 		} else {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Cannot load source account",
@@ -169,14 +182,14 @@ func TransferFunds(c *fiber.Ctx) error {
 	destAccountRequest := horizonclient.AccountRequest{AccountID: req.ToAddress}
 	_, err = client.AccountDetail(destAccountRequest)
 	if err != nil {
-		if horizonError, ok := err.(*horizonclient.Error); ok && horizonError.Problem.Status == 404 {
+		if ledger.IsNotFound(err) {
 			if config.Config.IsMainnet {
-				fmt.Printf("⚠️ Destination account not found on mainnet: %s\n", req.ToAddress)
+				slog.InfoContext(c.UserContext(), "destination account not found", "address", req.ToAddress)
 				// On mainnet, we can still send to non-existent accounts (they'll be created)
 			} else {
-				fmt.Printf("🔄 Destination account not found, attempting to fund: %s\n", req.ToAddress)
-				if fundErr := services.FundTestAccount(req.ToAddress); fundErr != nil {
-					fmt.Printf("⚠️ Warning: Could not fund destination account: %v\n", fundErr)
+				slog.InfoContext(c.UserContext(), "destination account not found, funding it", "address", req.ToAddress)
+				if fundErr := services.FundTestAccount(c.UserContext(), req.ToAddress); fundErr != nil {
+					slog.WarnContext(c.UserContext(), "could not fund destination account", "address", req.ToAddress, "error", fundErr)
 					// Continue with transfer anyway - account will be created
 				} else {
 					// Wait for funding to process
@@ -186,70 +199,78 @@ func TransferFunds(c *fiber.Ctx) error {
 		}
 	}
 
-	// Determine asset type and create appropriate payment operation
-	var asset txnbuild.Asset
-	var op txnbuild.Operation
-
-	if assetType == "USDC" && config.Config.IsMainnet {
-		// USDC payment (mainnet only)
-		asset = txnbuild.CreditAsset{
-			Code:   config.Config.USDCAssetCode,
-			Issuer: config.Config.USDCAssetIssuer,
-		}
-	} else {
-		// XLM payment (default)
-		asset = txnbuild.NativeAsset{}
+	tx, err := services.BuildPaymentTx(c.UserContext(), payment)
+	if err != nil {
+		slog.ErrorContext(c.UserContext(), "failed to build transfer transaction", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to build transaction"})
 	}
 
-	op = &txnbuild.Payment{
-		Destination: req.ToAddress,
-		Amount:      req.Amount,
-		Asset:       asset,
+	envelope, err := tx.Base64()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to encode transaction"})
 	}
 
-	// Add memo for mainnet compliance
-	var memo txnbuild.Memo
-	if config.Config.IsMainnet {
-		memo = txnbuild.MemoText(fmt.Sprintf("Chama Wallet %s Transfer", assetType))
-	}
+	return c.JSON(fiber.Map{
+		"unsigned_xdr":       envelope,
+		"network_passphrase": config.GetNetworkPassphrase(),
+		"from":               user.Wallet,
+		"to":                 req.ToAddress,
+		"amount":             req.Amount,
+		"memo":               payment.Memo,
+		"network":            config.Config.Network,
+	})
+}
+
+// TransferFunds verifies a client-signed transfer and submits it
+func TransferFunds(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
 
-	txParams := txnbuild.TransactionParams{
-		SourceAccount:        &sourceAccount,
-		IncrementSequenceNum: true,
-		BaseFee:              txnbuild.MinBaseFee,
-		Memo:                 memo,
-		Preconditions: txnbuild.Preconditions{
-			TimeBounds: txnbuild.NewTimeout(300), // 5 minute timeout
-		},
-		Operations: []txnbuild.Operation{op},
+	var req TransferRequest
+	if err := c.BodyParser(&req); err != nil {
+		slog.DebugContext(c.UserContext(), "invalid request body", "error", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
 	}
 
-	tx, err := txnbuild.NewTransaction(txParams)
+	payment, err := validateTransfer(req, user.Wallet)
 	if err != nil {
-		fmt.Printf("❌ Failed to build transaction: %v\n", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to build transaction"})
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	assetType := req.AssetType
+	if assetType == "" {
+		assetType = "XLM"
 	}
 
-	signedTx, err := tx.Sign(config.GetNetworkPassphrase(), sourceKP)
+	slog.InfoContext(c.UserContext(), "processing transfer",
+		"asset_type", assetType, "amount", req.Amount, "to", req.ToAddress, "network", config.Config.Network)
+
+	// Check the signed envelope is exactly the transfer that was requested
+	signedTx, err := services.VerifySignedPayment(req.SignedXDR, payment)
 	if err != nil {
-		fmt.Printf("❌ Failed to sign transaction: %v\n", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to sign transaction"})
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Signed transaction rejected: %v", err),
+		})
 	}
 
-	resp, err := client.SubmitTransaction(signedTx)
+	resp, err := services.SubmitSignedTx(c.UserContext(), signedTx)
 	if err != nil {
-		fmt.Printf("❌ Failed to submit transaction: %v\n", err)
+		slog.ErrorContext(c.UserContext(), "failed to submit transfer", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": fmt.Sprintf("Transaction submission failed: %v", err),
 		})
 	}
 
-	fmt.Printf("✅ %s transfer successful on %s: %s\n", assetType, config.Config.Network, resp.Hash)
+	slog.InfoContext(c.UserContext(), "transfer submitted", "asset_type", assetType, "tx_hash", resp.Hash)
+	audit(c, services.AuditEntry{
+		Action:   services.AuditTransfer,
+		TargetID: resp.Hash,
+		After:    fiber.Map{"from": user.Wallet, "to": req.ToAddress, "amount": req.Amount, "asset_type": assetType},
+	})
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message":          "Transfer completed successfully",
 		"transaction_hash": resp.Hash,
-		"from":             sourceKP.Address(),
+		"from":             user.Wallet,
 		"to":               req.ToAddress,
 		"amount":           req.Amount,
 		"asset_type":       assetType,
@@ -285,7 +306,7 @@ func FundAccount(c *fiber.Ctx) error {
 			"network": config.Config.Network,
 		})
 	}
-	err := services.FundTestAccount(address)
+	err := services.FundTestAccount(c.UserContext(), address)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -304,7 +325,7 @@ func GetTransactionHistory(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Address is required"})
 	}
 
-	client := config.GetHorizonClient()
+	client := services.LedgerFrom(c.UserContext())
 	txRequest := horizonclient.TransactionRequest{
 		ForAccount: address,
 		Limit:      10,
@@ -0,0 +1,163 @@
+// Package keystore encrypts Stellar secret seeds at rest using envelope
+// encryption: every record gets its own data key, and the data key is wrapped
+// by a master key held in the environment or a KMS.
+package keystore
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/stellar/go/keypair"
+
+	"chama-wallet-backend/config"
+)
+
+const sealedPrefix = "ks1"
+
+// Vault seals seeds for storage and hands out signers for sealed seeds
+type Vault struct {
+	kms KeyEncrypter
+}
+
+// Default is the vault used by the application, set up by InitKeystore
+var Default *Vault
+
+func NewVault(kms KeyEncrypter) *Vault {
+	return &Vault{kms: kms}
+}
+
+// InitKeystore configures the default vault. Mainnet requires a master key in
+// KEYSTORE_MASTER_KEY; testnet falls back to the local KMS stand-in.
+func InitKeystore() error {
+	var kms KeyEncrypter
+	var err error
+
+	if os.Getenv("KEYSTORE_MASTER_KEY") != "" || config.Config.IsMainnet {
+		kms, err = NewEnvKMS("KEYSTORE_MASTER_KEY")
+	} else {
+		path := os.Getenv("KEYSTORE_LOCAL_KEY_PATH")
+		if path == "" {
+			path = ".keystore/master.key"
+		}
+		kms, err = NewLocalKMS(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	Default = NewVault(kms)
+	slog.Info("keystore initialized", "kms", kms.ID())
+
+	return nil
+}
+
+// IsSealed reports whether a stored value was produced by Seal
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix+":")
+}
+
+// Seal encrypts a secret seed for storage
+func (v *Vault) Seal(seed string) (string, error) {
+	if _, err := keypair.ParseFull(seed); err != nil {
+		return "", fmt.Errorf("refusing to seal invalid secret key: %w", err)
+	}
+	return v.SealValue(seed)
+}
+
+// SealValue encrypts any other secret, such as a TOTP key, for storage
+func (v *Vault) SealValue(value string) (string, error) {
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	aed, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(aed, []byte(value), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+
+	wrappedKey, err := v.kms.WrapKey(dataKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	return strings.Join([]string{
+		sealedPrefix,
+		v.kms.ID(),
+		base64.RawStdEncoding.EncodeToString(wrappedKey),
+		base64.RawStdEncoding.EncodeToString(ciphertext),
+	}, ":"), nil
+}
+
+// open decrypts a sealed value back into a keypair
+func (v *Vault) open(sealed string) (*keypair.Full, error) {
+	seed, err := v.OpenValue(sealed)
+	if err != nil {
+		return nil, err
+	}
+	return keypair.ParseFull(seed)
+}
+
+// OpenValue decrypts a value sealed by SealValue
+func (v *Vault) OpenValue(sealed string) (string, error) {
+	parts := strings.Split(sealed, ":")
+	if len(parts) != 4 || parts[0] != sealedPrefix {
+		return "", errors.New("value is not a sealed secret")
+	}
+	if parts[1] != v.kms.ID() {
+		return "", fmt.Errorf("secret was sealed with the %q master key, vault uses %q", parts[1], v.kms.ID())
+	}
+
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("malformed data key: %w", err)
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return "", fmt.Errorf("malformed ciphertext: %w", err)
+	}
+
+	dataKey, err := v.kms.UnwrapKey(wrappedKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	aed, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	value, err := open(aed, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+
+	return string(value), nil
+}
+
+// Signer returns a signer backed by a sealed seed
+func (v *Vault) Signer(sealed string) (Signer, error) {
+	kp, err := v.open(sealed)
+	if err != nil {
+		return nil, err
+	}
+	return &keypairSigner{kp: kp}, nil
+}
+
+// Reveal decrypts a sealed seed for an explicit, user-initiated export.
+// Signing paths must use Signer instead.
+func (v *Vault) Reveal(sealed string) (string, error) {
+	kp, err := v.open(sealed)
+	if err != nil {
+		return "", err
+	}
+	return kp.Seed(), nil
+}
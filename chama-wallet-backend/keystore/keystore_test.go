@@ -0,0 +1,110 @@
+package keystore
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stellar/go/keypair"
+)
+
+func newTestVault(t *testing.T) *Vault {
+	t.Helper()
+	kms, err := NewEphemeralKMS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewVault(kms)
+}
+
+func TestSealAndOpen(t *testing.T) {
+	vault := newTestVault(t)
+	kp := keypair.MustRandom()
+
+	sealed, err := vault.Seal(kp.Seed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSealed(sealed) || strings.Contains(sealed, kp.Seed()) {
+		t.Fatalf("sealed value %q", sealed)
+	}
+	if again, _ := vault.Seal(kp.Seed()); again == sealed {
+		t.Error("sealing the same seed twice gave the same value")
+	}
+
+	seed, err := vault.Reveal(sealed)
+	if err != nil || seed != kp.Seed() {
+		t.Errorf("reveal: %q, %v", seed, err)
+	}
+	signer, err := vault.Signer(sealed)
+	if err != nil || signer.Address() != kp.Address() {
+		t.Errorf("signer: %v", err)
+	}
+
+	value, err := vault.SealValue("JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened, err := vault.OpenValue(value); err != nil || opened != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("open value: %q, %v", opened, err)
+	}
+
+	if _, err := vault.Seal("not a seed"); err == nil {
+		t.Error("sealed an invalid seed")
+	}
+}
+
+func TestOpenRefusesTamperedValues(t *testing.T) {
+	vault := newTestVault(t)
+	sealed, err := vault.Seal(keypair.MustRandom().Seed())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// flip changes one byte of the sealed value's given part
+	flip := func(part int) string {
+		parts := strings.Split(sealed, ":")
+		raw, err := base64.RawStdEncoding.DecodeString(parts[part])
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw[len(raw)-1] ^= 0x01
+		parts[part] = base64.RawStdEncoding.EncodeToString(raw)
+		return strings.Join(parts, ":")
+	}
+
+	other := newTestVault(t)
+	otherSealed, err := other.Seal(keypair.MustRandom().Seed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	swapped := strings.Split(sealed, ":")
+	swapped[2] = strings.Split(otherSealed, ":")[2]
+
+	tests := []struct {
+		name   string
+		sealed string
+	}{
+		{"tampered wrapped key", flip(2)},
+		{"tampered ciphertext", flip(3)},
+		{"wrapped key from another master key", strings.Join(swapped, ":")},
+		{"plaintext", keypair.MustRandom().Seed()},
+		{"truncated", strings.Join(strings.Split(sealed, ":")[:3], ":")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := vault.Reveal(tt.sealed); err == nil {
+				t.Error("opened")
+			}
+		})
+	}
+
+	// The same master key under another name is refused before anything is decrypted
+	if _, err := other.Reveal(sealed); err == nil {
+		t.Error("another ephemeral master key opened the value")
+	}
+	renamed := NewVault(&masterKeyKMS{id: "env", aed: vault.kms.(*masterKeyKMS).aed})
+	if _, err := renamed.Reveal(sealed); err == nil || !strings.Contains(err.Error(), `"ephemeral" master key`) {
+		t.Errorf("vault with another kms ID: %v, want it refused", err)
+	}
+}
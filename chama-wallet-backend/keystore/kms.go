@@ -0,0 +1,122 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// KeyEncrypter wraps and unwraps per-record data keys with a master key.
+// It is the seam where a cloud KMS would plug in.
+type KeyEncrypter interface {
+	ID() string
+	WrapKey(dataKey []byte) ([]byte, error)
+	UnwrapKey(wrapped []byte) ([]byte, error)
+}
+
+// masterKeyKMS wraps data keys locally with an AES-256 master key
+type masterKeyKMS struct {
+	id  string
+	aed cipher.AEAD
+}
+
+func newMasterKeyKMS(id string, masterKey []byte) (*masterKeyKMS, error) {
+	if len(masterKey) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes, got %d", len(masterKey))
+	}
+	aed, err := newGCM(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return &masterKeyKMS{id: id, aed: aed}, nil
+}
+
+func (k *masterKeyKMS) ID() string {
+	return k.id
+}
+
+func (k *masterKeyKMS) WrapKey(dataKey []byte) ([]byte, error) {
+	return seal(k.aed, dataKey, []byte(k.id))
+}
+
+func (k *masterKeyKMS) UnwrapKey(wrapped []byte) ([]byte, error) {
+	return open(k.aed, wrapped, []byte(k.id))
+}
+
+// NewEnvKMS loads a base64 encoded 32 byte master key from the given environment variable
+func NewEnvKMS(envVar string) (KeyEncrypter, error) {
+	raw := strings.TrimSpace(os.Getenv(envVar))
+	if raw == "" {
+		return nil, fmt.Errorf("%s is not set", envVar)
+	}
+	masterKey, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be base64 encoded: %w", envVar, err)
+	}
+	return newMasterKeyKMS("env", masterKey)
+}
+
+// NewLocalKMS is a development stand-in for a real KMS. The master key lives in
+// a file next to the app and is generated on first use.
+func NewLocalKMS(path string) (KeyEncrypter, error) {
+	masterKey, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		masterKey = make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, masterKey); err != nil {
+			return nil, fmt.Errorf("failed to generate local master key: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create keystore directory: %w", err)
+		}
+		if err := os.WriteFile(path, masterKey, 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write local master key: %w", err)
+		}
+		slog.Info("generated local KMS master key", "path", path)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read local master key: %w", err)
+	}
+	return newMasterKeyKMS("local", masterKey)
+}
+
+// NewEphemeralKMS holds a random master key in memory only. Anything it seals is
+// unreadable once the process exits, so it is only fit for tests.
+func NewEphemeralKMS() (KeyEncrypter, error) {
+	masterKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, masterKey); err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral master key: %w", err)
+	}
+	return newMasterKeyKMS("ephemeral", masterKey)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext and prefixes the random nonce to the ciphertext
+func seal(aed cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aed.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aed.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(aed cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aed.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aed.NonceSize()], sealed[aed.NonceSize():]
+	return aed.Open(nil, nonce, ciphertext, additionalData)
+}
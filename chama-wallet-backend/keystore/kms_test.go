@@ -0,0 +1,71 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnvKMS(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	t.Setenv("TEST_MASTER_KEY", base64.StdEncoding.EncodeToString(key))
+	kms, err := NewEnvKMS("TEST_MASTER_KEY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kms.ID() != "env" {
+		t.Errorf("ID %q, want env", kms.ID())
+	}
+	dataKey := []byte("0123456789abcdef0123456789abcdef")
+	wrapped, err := kms.WrapKey(dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unwrapped, err := kms.UnwrapKey(wrapped); err != nil || !bytes.Equal(unwrapped, dataKey) {
+		t.Errorf("unwrap: %v", err)
+	}
+
+	for name, value := range map[string]string{
+		"unset":      "",
+		"not base64": "not base64!",
+		"short key":  base64.StdEncoding.EncodeToString(key[:16]),
+	} {
+		t.Setenv("TEST_MASTER_KEY", value)
+		if _, err := NewEnvKMS("TEST_MASTER_KEY"); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestLocalKMSKeepsItsKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore", "master.key")
+
+	first, err := NewLocalKMS(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("master key file mode %v, want 0600", info.Mode().Perm())
+	}
+
+	sealed, err := NewVault(first).SealValue("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewLocalKMS(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened, err := NewVault(second).OpenValue(sealed); err != nil || opened != "secret" {
+		t.Errorf("reopened with the stored key: %q, %v", opened, err)
+	}
+}
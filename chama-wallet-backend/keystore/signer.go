@@ -0,0 +1,37 @@
+package keystore
+
+import (
+	"fmt"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+
+	"chama-wallet-backend/config"
+)
+
+// Signer signs Stellar transactions without exposing the underlying seed
+type Signer interface {
+	Address() string
+	SignTransaction(tx *txnbuild.Transaction) (*txnbuild.Transaction, error)
+}
+
+type keypairSigner struct {
+	kp *keypair.Full
+}
+
+func (s *keypairSigner) Address() string {
+	return s.kp.Address()
+}
+
+func (s *keypairSigner) SignTransaction(tx *txnbuild.Transaction) (*txnbuild.Transaction, error) {
+	return tx.Sign(config.GetNetworkPassphrase(), s.kp)
+}
+
+// SignerFromSeed wraps a seed supplied by the caller, e.g. one typed in by the user
+func SignerFromSeed(seed string) (Signer, error) {
+	kp, err := keypair.ParseFull(seed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key: %w", err)
+	}
+	return &keypairSigner{kp: kp}, nil
+}
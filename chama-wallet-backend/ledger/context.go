@@ -0,0 +1,23 @@
+package ledger
+
+import "context"
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying l. The server puts its ledger on every
+// request's and job's context; tests put a Fake there instead.
+func NewContext(ctx context.Context, l Ledger) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the ledger carried by ctx, or nil if it has none
+func FromContext(ctx context.Context) Ledger {
+	if ctx == nil {
+		return nil
+	}
+	l, _ := ctx.Value(contextKey{}).(Ledger)
+	return l
+}
@@ -0,0 +1,930 @@
+package ledger
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/protocols/horizon/base"
+	"github.com/stellar/go/protocols/horizon/operations"
+	"github.com/stellar/go/support/render/problem"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+)
+
+const (
+	// DefaultBaseReserve is the network base reserve of 0.5 XLM, in stroops
+	DefaultBaseReserve = 5_000_000
+	// DefaultBaseFee is the fee per operation, in stroops
+	DefaultBaseFee = 100
+
+	friendbotStartingBalance = 10_000 * 10_000_000
+)
+
+// Method names accepted by Fake.FailNext
+const (
+	MethodAccountDetail     = "AccountDetail"
+	MethodSubmit            = "Submit"
+	MethodTransactionDetail = "TransactionDetail"
+	MethodTransactions      = "Transactions"
+	MethodPayments          = "Payments"
+	MethodFund              = "Fund"
+	MethodLedgerDetail      = "LedgerDetail"
+	MethodRoot              = "Root"
+)
+
+type fakeAccount struct {
+	id           string
+	sequence     int64
+	native       int64
+	trustlines   map[string]int64 // "CODE:ISSUER" -> balance
+	signers      map[string]int32
+	masterWeight int32
+	thresholds   horizon.AccountThresholds
+}
+
+func (a *fakeAccount) clone() *fakeAccount {
+	c := *a
+	c.trustlines = make(map[string]int64, len(a.trustlines))
+	for k, v := range a.trustlines {
+		c.trustlines[k] = v
+	}
+	c.signers = make(map[string]int32, len(a.signers))
+	for k, v := range a.signers {
+		c.signers[k] = v
+	}
+	return &c
+}
+
+func (a *fakeAccount) subentries() int64 {
+	return int64(len(a.trustlines) + len(a.signers))
+}
+
+// fakeOperation is a recorded payment or account creation
+type fakeOperation struct {
+	token    int64
+	txHash   string
+	accounts []string
+	op       operations.Operation
+}
+
+type fakeTransaction struct {
+	token    int64
+	accounts []string
+	tx       horizon.Transaction
+}
+
+// Fake is an in-memory ledger for tests and offline development. It keeps native
+// and credit balances, sequence numbers, signers and thresholds, enforces base
+// reserves and fees, and can be told to fail the next call of any method.
+type Fake struct {
+	BaseReserve int64
+	BaseFee     int64
+
+	mu                sync.Mutex
+	networkPassphrase string
+	friendbot         string
+	accounts          map[string]*fakeAccount
+	transactions      []fakeTransaction
+	operations        []fakeOperation
+	failures          map[string][]error
+	ledgerSeq         int32
+	nextToken         int64
+	changed           chan struct{} // closed and replaced whenever operations are recorded
+}
+
+var _ Ledger = (*Fake)(nil)
+
+func NewFake(networkPassphrase string) *Fake {
+	return &Fake{
+		BaseReserve:       DefaultBaseReserve,
+		BaseFee:           DefaultBaseFee,
+		networkPassphrase: networkPassphrase,
+		friendbot:         keypair.MustRandom().Address(),
+		accounts:          map[string]*fakeAccount{},
+		failures:          map[string][]error{},
+		ledgerSeq:         1,
+		changed:           make(chan struct{}),
+	}
+}
+
+// FailNext makes the next call of method return err
+func (f *Fake) FailNext(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[method] = append(f.failures[method], err)
+}
+
+func (f *Fake) takeFailure(method string) error {
+	queue := f.failures[method]
+	if len(queue) == 0 {
+		return nil
+	}
+	f.failures[method] = queue[1:]
+	return queue[0]
+}
+
+// CreateAccount adds a funded account with the given XLM balance
+func (f *Fake) CreateAccount(address, startingBalance string) error {
+	if _, err := keypair.ParseAddress(address); err != nil {
+		return err
+	}
+	balance, err := amount.ParseInt64(startingBalance)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, exists := f.accounts[address]; exists {
+		return fmt.Errorf("account %s already exists", address)
+	}
+	f.accounts[address] = f.newAccount(address, balance)
+	return nil
+}
+
+// Balance returns the native balance of an account, or "0" if it does not exist
+func (f *Fake) Balance(address string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if account, ok := f.accounts[address]; ok {
+		return amount.StringFromInt64(account.native)
+	}
+	return "0"
+}
+
+// AssetBalance returns the balance of a credit asset held by an account
+func (f *Fake) AssetBalance(address, code, issuer string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if account, ok := f.accounts[address]; ok {
+		return amount.StringFromInt64(account.trustlines[code+":"+issuer])
+	}
+	return "0"
+}
+
+func (f *Fake) newAccount(address string, balance int64) *fakeAccount {
+	return &fakeAccount{
+		id:           address,
+		sequence:     int64(f.ledgerSeq) << 32,
+		native:       balance,
+		trustlines:   map[string]int64{},
+		signers:      map[string]int32{},
+		masterWeight: 1,
+	}
+}
+
+func (f *Fake) minBalance(account *fakeAccount) int64 {
+	return (2 + account.subentries()) * f.BaseReserve
+}
+
+func (f *Fake) AccountDetail(request horizonclient.AccountRequest) (horizon.Account, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.takeFailure(MethodAccountDetail); err != nil {
+		return horizon.Account{}, err
+	}
+
+	account, ok := f.accounts[request.AccountID]
+	if !ok {
+		return horizon.Account{}, notFound()
+	}
+
+	result := horizon.Account{
+		ID:            account.id,
+		AccountID:     account.id,
+		Sequence:      account.sequence,
+		SubentryCount: int32(account.subentries()),
+		Thresholds:    account.thresholds,
+		PT:            account.id,
+	}
+	for key, balance := range account.trustlines {
+		code, issuer := splitAssetKey(key)
+		assetType := "credit_alphanum4"
+		if len(code) > 4 {
+			assetType = "credit_alphanum12"
+		}
+		result.Balances = append(result.Balances, horizon.Balance{
+			Balance: amount.StringFromInt64(balance),
+			Asset:   base.Asset{Type: assetType, Code: code, Issuer: issuer},
+		})
+	}
+	sort.Slice(result.Balances, func(i, j int) bool { return result.Balances[i].Code < result.Balances[j].Code })
+	result.Balances = append(result.Balances, horizon.Balance{
+		Balance: amount.StringFromInt64(account.native),
+		Asset:   base.Asset{Type: "native"},
+	})
+
+	for key, weight := range account.signers {
+		result.Signers = append(result.Signers, horizon.Signer{Key: key, Weight: weight, Type: "ed25519_public_key"})
+	}
+	sort.Slice(result.Signers, func(i, j int) bool { return result.Signers[i].Key < result.Signers[j].Key })
+	result.Signers = append(result.Signers, horizon.Signer{Key: account.id, Weight: account.masterWeight, Type: "ed25519_public_key"})
+
+	return result, nil
+}
+
+func (f *Fake) SubmitTransaction(tx *txnbuild.Transaction) (horizon.Transaction, error) {
+	envelope, err := tx.Base64()
+	if err != nil {
+		return horizon.Transaction{}, err
+	}
+	return f.submit(tx, envelope)
+}
+
+func (f *Fake) SubmitTransactionXDR(envelopeXDR string) (horizon.Transaction, error) {
+	generic, err := txnbuild.TransactionFromXDR(envelopeXDR)
+	if err != nil {
+		return horizon.Transaction{}, txFailed("tx_malformed", nil, envelopeXDR)
+	}
+	tx, ok := generic.Transaction()
+	if !ok {
+		return horizon.Transaction{}, txFailed("tx_not_supported", nil, envelopeXDR)
+	}
+	return f.submit(tx, envelopeXDR)
+}
+
+func (f *Fake) submit(tx *txnbuild.Transaction, envelope string) (horizon.Transaction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.takeFailure(MethodSubmit); err != nil {
+		return horizon.Transaction{}, err
+	}
+
+	hash, err := tx.HashHex(f.networkPassphrase)
+	if err != nil {
+		return horizon.Transaction{}, err
+	}
+	for _, recorded := range f.transactions {
+		if recorded.tx.Hash == hash && recorded.tx.Successful {
+			return recorded.tx, nil
+		}
+	}
+
+	sourceID := tx.SourceAccount().AccountID
+	source, ok := f.accounts[sourceID]
+	if !ok {
+		return horizon.Transaction{}, txFailed("tx_no_source_account", nil, envelope)
+	}
+
+	now := time.Now().Unix()
+	bounds := tx.Timebounds()
+	if bounds.MaxTime != 0 && now > bounds.MaxTime {
+		return horizon.Transaction{}, txFailed("tx_too_late", nil, envelope)
+	}
+	if bounds.MinTime != 0 && now < bounds.MinTime {
+		return horizon.Transaction{}, txFailed("tx_too_early", nil, envelope)
+	}
+	if tx.SequenceNumber() != source.sequence+1 {
+		return horizon.Transaction{}, txFailed("tx_bad_seq", nil, envelope)
+	}
+
+	ops := tx.Operations()
+	if len(ops) == 0 {
+		return horizon.Transaction{}, txFailed("tx_missing_operation", nil, envelope)
+	}
+	fee := f.BaseFee * int64(len(ops))
+	if tx.MaxFee() < fee {
+		return horizon.Transaction{}, txFailed("tx_insufficient_fee", nil, envelope)
+	}
+	if source.native < fee {
+		return horizon.Transaction{}, txFailed("tx_insufficient_balance", nil, envelope)
+	}
+
+	rawHash, err := tx.Hash(f.networkPassphrase)
+	if err != nil {
+		return horizon.Transaction{}, err
+	}
+	if !f.authorized(rawHash, tx.Signatures(), source, source.thresholds.LowThreshold) {
+		return horizon.Transaction{}, txFailed("tx_bad_auth", nil, envelope)
+	}
+	for _, op := range ops {
+		opSource := f.accounts[operationSource(op, sourceID)]
+		if opSource == nil || !f.authorized(rawHash, tx.Signatures(), opSource, operationThreshold(op, opSource)) {
+			return horizon.Transaction{}, txFailed("tx_bad_auth", nil, envelope)
+		}
+	}
+
+	// Fees and the sequence bump apply even when an operation fails
+	source.native -= fee
+	source.sequence = tx.SequenceNumber()
+	f.ledgerSeq++
+
+	record := horizon.Transaction{
+		ID:              hash,
+		Hash:            hash,
+		Ledger:          f.ledgerSeq,
+		LedgerCloseTime: time.Now().UTC(),
+		Account:         sourceID,
+		AccountSequence: tx.SequenceNumber(),
+		FeeAccount:      sourceID,
+		FeeCharged:      fee,
+		MaxFee:          tx.MaxFee(),
+		OperationCount:  int32(len(ops)),
+		EnvelopeXdr:     envelope,
+	}
+	record.MemoType, record.Memo = memoFields(tx.Memo())
+	for _, sig := range tx.Signatures() {
+		record.Signatures = append(record.Signatures, base64.StdEncoding.EncodeToString(sig.Signature))
+	}
+
+	staged := map[string]*fakeAccount{}
+	var recorded []fakeOperation
+	codes := make([]string, len(ops))
+	for i, op := range ops {
+		opRecord, code := f.apply(staged, op, sourceID)
+		codes[i] = code
+		if code != "op_success" {
+			record.Successful = false
+			f.recordTransaction(record, []string{sourceID})
+			return horizon.Transaction{}, txFailed("tx_failed", codes[:i+1], envelope)
+		}
+		if opRecord != nil {
+			recorded = append(recorded, *opRecord)
+		}
+	}
+
+	for id, account := range staged {
+		f.accounts[id] = account
+	}
+
+	record.Successful = true
+	involved := []string{sourceID}
+	for _, op := range recorded {
+		involved = append(involved, op.accounts...)
+	}
+	f.recordTransaction(record, involved)
+	f.recordOperations(record, recorded)
+
+	return record, nil
+}
+
+// staged returns a working copy of an account for the transaction being applied
+func (f *Fake) staged(staged map[string]*fakeAccount, id string) *fakeAccount {
+	if account, ok := staged[id]; ok {
+		return account
+	}
+	account, ok := f.accounts[id]
+	if !ok {
+		return nil
+	}
+	staged[id] = account.clone()
+	return staged[id]
+}
+
+// apply executes one operation against the staged accounts and returns its result code
+func (f *Fake) apply(staged map[string]*fakeAccount, op txnbuild.Operation, txSource string) (*fakeOperation, string) {
+	sourceID := operationSource(op, txSource)
+	source := f.staged(staged, sourceID)
+	if source == nil {
+		return nil, "op_no_source_account"
+	}
+
+	switch o := op.(type) {
+	case *txnbuild.Payment:
+		amt, err := amount.ParseInt64(o.Amount)
+		if err != nil || amt <= 0 {
+			return nil, "op_malformed"
+		}
+		destination := f.staged(staged, o.Destination)
+		if destination == nil {
+			return nil, "op_no_destination"
+		}
+
+		asset := base.Asset{Type: "native"}
+		if o.Asset.IsNative() {
+			if source.native-amt < f.minBalance(source) {
+				return nil, "op_underfunded"
+			}
+			source.native -= amt
+			destination.native += amt
+		} else {
+			key := o.Asset.GetCode() + ":" + o.Asset.GetIssuer()
+			if sourceID != o.Asset.GetIssuer() {
+				balance, ok := source.trustlines[key]
+				if !ok {
+					return nil, "op_src_no_trust"
+				}
+				if balance < amt {
+					return nil, "op_underfunded"
+				}
+				source.trustlines[key] = balance - amt
+			}
+			if o.Destination != o.Asset.GetIssuer() {
+				if _, ok := destination.trustlines[key]; !ok {
+					return nil, "op_no_trust"
+				}
+				destination.trustlines[key] += amt
+			}
+			asset = base.Asset{Type: "credit_alphanum4", Code: o.Asset.GetCode(), Issuer: o.Asset.GetIssuer()}
+			if len(asset.Code) > 4 {
+				asset.Type = "credit_alphanum12"
+			}
+		}
+
+		return &fakeOperation{
+			accounts: []string{sourceID, o.Destination},
+			op: operations.Payment{
+				Base:   operations.Base{SourceAccount: sourceID, Type: "payment", TypeI: int32(xdr.OperationTypePayment)},
+				Asset:  asset,
+				From:   sourceID,
+				To:     o.Destination,
+				Amount: amount.StringFromInt64(amt),
+			},
+		}, "op_success"
+
+	case *txnbuild.CreateAccount:
+		amt, err := amount.ParseInt64(o.Amount)
+		if err != nil || amt < 0 {
+			return nil, "op_malformed"
+		}
+		if _, err := keypair.ParseAddress(o.Destination); err != nil {
+			return nil, "op_malformed"
+		}
+		if f.staged(staged, o.Destination) != nil {
+			return nil, "op_already_exists"
+		}
+		if amt < 2*f.BaseReserve {
+			return nil, "op_low_reserve"
+		}
+		if source.native-amt < f.minBalance(source) {
+			return nil, "op_underfunded"
+		}
+		source.native -= amt
+		staged[o.Destination] = f.newAccount(o.Destination, amt)
+
+		return &fakeOperation{
+			accounts: []string{sourceID, o.Destination},
+			op: operations.CreateAccount{
+				Base:            operations.Base{SourceAccount: sourceID, Type: "create_account", TypeI: int32(xdr.OperationTypeCreateAccount)},
+				StartingBalance: amount.StringFromInt64(amt),
+				Funder:          sourceID,
+				Account:         o.Destination,
+			},
+		}, "op_success"
+
+	case *txnbuild.SetOptions:
+		if o.MasterWeight != nil {
+			source.masterWeight = int32(*o.MasterWeight)
+		}
+		if o.LowThreshold != nil {
+			source.thresholds.LowThreshold = byte(*o.LowThreshold)
+		}
+		if o.MediumThreshold != nil {
+			source.thresholds.MedThreshold = byte(*o.MediumThreshold)
+		}
+		if o.HighThreshold != nil {
+			source.thresholds.HighThreshold = byte(*o.HighThreshold)
+		}
+		if o.Signer != nil {
+			if o.Signer.Address == sourceID {
+				return nil, "op_bad_signer"
+			}
+			if o.Signer.Weight == 0 {
+				delete(source.signers, o.Signer.Address)
+			} else {
+				_, existing := source.signers[o.Signer.Address]
+				source.signers[o.Signer.Address] = int32(o.Signer.Weight)
+				if !existing && source.native < f.minBalance(source) {
+					return nil, "op_low_reserve"
+				}
+			}
+		}
+		return nil, "op_success"
+
+	case *txnbuild.ChangeTrust:
+		key := o.Line.GetCode() + ":" + o.Line.GetIssuer()
+		limit, err := amount.ParseInt64(o.Limit)
+		if o.Limit == "" {
+			limit, err = 1, nil
+		}
+		if err != nil {
+			return nil, "op_malformed"
+		}
+		balance, existing := source.trustlines[key]
+		if limit == 0 {
+			if existing && balance > 0 {
+				return nil, "op_invalid_limit"
+			}
+			delete(source.trustlines, key)
+			return nil, "op_success"
+		}
+		if !existing {
+			if f.staged(staged, o.Line.GetIssuer()) == nil {
+				return nil, "op_no_issuer"
+			}
+			source.trustlines[key] = 0
+			if source.native < f.minBalance(source) {
+				return nil, "op_low_reserve"
+			}
+		}
+		return nil, "op_success"
+
+	case *txnbuild.InvokeHostFunction:
+		// Contract calls are executed through Soroban RPC, not this ledger
+		return nil, "op_success"
+	}
+
+	return nil, "op_not_supported"
+}
+
+// authorized checks the signatures on a transaction reach threshold for account
+func (f *Fake) authorized(hash [32]byte, signatures []xdr.DecoratedSignature, account *fakeAccount, threshold byte) bool {
+	weights := map[string]int32{account.id: account.masterWeight}
+	for key, weight := range account.signers {
+		weights[key] = weight
+	}
+
+	var total int32
+	for key, weight := range weights {
+		if weight == 0 {
+			continue
+		}
+		kp, err := keypair.ParseAddress(key)
+		if err != nil {
+			continue
+		}
+		for _, sig := range signatures {
+			if sig.Hint == xdr.SignatureHint(kp.Hint()) && kp.Verify(hash[:], sig.Signature) == nil {
+				total += weight
+				break
+			}
+		}
+	}
+	if total > 255 {
+		total = 255
+	}
+	return total > 0 && total >= int32(threshold)
+}
+
+func (f *Fake) recordTransaction(record horizon.Transaction, accounts []string) {
+	f.nextToken++
+	record.PT = strconv.FormatInt(f.nextToken, 10)
+	f.transactions = append(f.transactions, fakeTransaction{token: f.nextToken, accounts: accounts, tx: record})
+}
+
+func (f *Fake) recordOperations(record horizon.Transaction, ops []fakeOperation) {
+	for _, op := range ops {
+		f.nextToken++
+		op.token = f.nextToken
+		op.txHash = record.Hash
+
+		token := strconv.FormatInt(op.token, 10)
+		switch o := op.op.(type) {
+		case operations.Payment:
+			o.ID, o.PT, o.TransactionHash, o.TransactionSuccessful, o.LedgerCloseTime = token, token, record.Hash, true, record.LedgerCloseTime
+			op.op = o
+		case operations.CreateAccount:
+			o.ID, o.PT, o.TransactionHash, o.TransactionSuccessful, o.LedgerCloseTime = token, token, record.Hash, true, record.LedgerCloseTime
+			op.op = o
+		}
+		f.operations = append(f.operations, op)
+	}
+
+	if len(ops) > 0 {
+		close(f.changed)
+		f.changed = make(chan struct{})
+	}
+}
+
+func (f *Fake) TransactionDetail(txHash string) (horizon.Transaction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.takeFailure(MethodTransactionDetail); err != nil {
+		return horizon.Transaction{}, err
+	}
+
+	// A hash can be recorded more than once when earlier attempts failed; prefer the success
+	var found *horizon.Transaction
+	for i := range f.transactions {
+		if f.transactions[i].tx.Hash != txHash {
+			continue
+		}
+		found = &f.transactions[i].tx
+		if found.Successful {
+			break
+		}
+	}
+	if found == nil {
+		return horizon.Transaction{}, notFound()
+	}
+	return *found, nil
+}
+
+func (f *Fake) Transactions(request horizonclient.TransactionRequest) (horizon.TransactionsPage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var page horizon.TransactionsPage
+	if err := f.takeFailure(MethodTransactions); err != nil {
+		return page, err
+	}
+
+	cursor, err := parseCursor(request.Cursor, f.nextToken)
+	if err != nil {
+		return page, err
+	}
+	desc := request.Order == horizonclient.OrderDesc
+
+	for _, i := range orderedIndexes(len(f.transactions), desc) {
+		recorded := f.transactions[i]
+		if !afterCursor(recorded.token, cursor, desc) {
+			continue
+		}
+		if !recorded.tx.Successful && !request.IncludeFailed {
+			continue
+		}
+		if request.ForAccount != "" && !contains(recorded.accounts, request.ForAccount) {
+			continue
+		}
+		page.Embedded.Records = append(page.Embedded.Records, recorded.tx)
+		if len(page.Embedded.Records) == pageLimit(request.Limit) {
+			break
+		}
+	}
+	return page, nil
+}
+
+func (f *Fake) Payments(request horizonclient.OperationRequest) (operations.OperationsPage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.takeFailure(MethodPayments); err != nil {
+		return operations.OperationsPage{}, err
+	}
+	return f.paymentsPage(request)
+}
+
+func (f *Fake) paymentsPage(request horizonclient.OperationRequest) (operations.OperationsPage, error) {
+	var page operations.OperationsPage
+	cursor, err := parseCursor(request.Cursor, f.nextToken)
+	if err != nil {
+		return page, err
+	}
+	desc := request.Order == horizonclient.OrderDesc
+
+	for _, i := range orderedIndexes(len(f.operations), desc) {
+		recorded := f.operations[i]
+		if !afterCursor(recorded.token, cursor, desc) {
+			continue
+		}
+		if request.ForAccount != "" && !contains(recorded.accounts, request.ForAccount) {
+			continue
+		}
+		if request.ForTransaction != "" && recorded.txHash != request.ForTransaction {
+			continue
+		}
+		page.Embedded.Records = append(page.Embedded.Records, recorded.op)
+		if len(page.Embedded.Records) == pageLimit(request.Limit) {
+			break
+		}
+	}
+	return page, nil
+}
+
+// StreamPayments delivers matching payments after the cursor, then new ones as they
+// are recorded, until ctx is cancelled
+func (f *Fake) StreamPayments(ctx context.Context, request horizonclient.OperationRequest, handler horizonclient.OperationHandler) error {
+	request.Order = horizonclient.OrderAsc
+	request.Limit = 200
+
+	f.mu.Lock()
+	if request.Cursor == "now" {
+		request.Cursor = strconv.FormatInt(f.nextToken, 10)
+	}
+	f.mu.Unlock()
+
+	for {
+		f.mu.Lock()
+		page, err := f.paymentsPage(request)
+		changed := f.changed
+		f.mu.Unlock()
+		if err != nil {
+			return err
+		}
+
+		for _, op := range page.Embedded.Records {
+			handler(op)
+			request.Cursor = op.PagingToken()
+		}
+		if len(page.Embedded.Records) == int(request.Limit) {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		}
+	}
+}
+
+// Fund simulates Friendbot, creating the account with 10,000 XLM
+func (f *Fake) Fund(address string) (horizon.Transaction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.takeFailure(MethodFund); err != nil {
+		return horizon.Transaction{}, err
+	}
+	if _, err := keypair.ParseAddress(address); err != nil {
+		return horizon.Transaction{}, &horizonclient.Error{Problem: problem.P{Title: "Bad Request", Status: 400, Detail: err.Error()}}
+	}
+	if _, exists := f.accounts[address]; exists {
+		return horizon.Transaction{}, txFailed("tx_failed", []string{"op_already_exists"}, "")
+	}
+
+	f.accounts[address] = f.newAccount(address, friendbotStartingBalance)
+	f.ledgerSeq++
+
+	hash := fmt.Sprintf("%064x", f.nextToken+1)
+	record := horizon.Transaction{
+		ID:              hash,
+		Hash:            hash,
+		Successful:      true,
+		Ledger:          f.ledgerSeq,
+		LedgerCloseTime: time.Now().UTC(),
+		Account:         f.friendbot,
+		FeeAccount:      f.friendbot,
+		OperationCount:  1,
+		MemoType:        "none",
+	}
+	f.recordTransaction(record, []string{f.friendbot, address})
+	f.recordOperations(record, []fakeOperation{{
+		accounts: []string{f.friendbot, address},
+		op: operations.CreateAccount{
+			Base:            operations.Base{SourceAccount: f.friendbot, Type: "create_account", TypeI: int32(xdr.OperationTypeCreateAccount)},
+			StartingBalance: amount.StringFromInt64(friendbotStartingBalance),
+			Funder:          f.friendbot,
+			Account:         address,
+		},
+	}})
+	return record, nil
+}
+
+// CloseLedgers closes n ledgers with no transactions in them
+func (f *Fake) CloseLedgers(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ledgerSeq += int32(n)
+}
+
+// LedgerDetail returns a closed ledger. Its hash is derived from the sequence number, so
+// the same ledger always has the same hash.
+func (f *Fake) LedgerDetail(sequence uint32) (horizon.Ledger, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.takeFailure(MethodLedgerDetail); err != nil {
+		return horizon.Ledger{}, err
+	}
+	if sequence == 0 || int32(sequence) > f.ledgerSeq {
+		return horizon.Ledger{}, notFound()
+	}
+	return horizon.Ledger{
+		ID:       fakeLedgerHash(sequence),
+		Hash:     fakeLedgerHash(sequence),
+		Sequence: int32(sequence),
+		ClosedAt: time.Now().UTC(),
+	}, nil
+}
+
+// Root reports the latest closed ledger
+func (f *Fake) Root() (horizon.Root, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.takeFailure(MethodRoot); err != nil {
+		return horizon.Root{}, err
+	}
+	return horizon.Root{
+		HorizonSequence:   f.ledgerSeq,
+		CoreSequence:      f.ledgerSeq,
+		NetworkPassphrase: f.networkPassphrase,
+	}, nil
+}
+
+func fakeLedgerHash(sequence uint32) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("fake ledger %d", sequence)))
+	return hex.EncodeToString(hash[:])
+}
+
+func notFound() error {
+	return &horizonclient.Error{Problem: problem.P{
+		Type:   "https://stellar.org/horizon-errors/not_found",
+		Title:  "Resource Missing",
+		Status: 404,
+		Detail: "The resource at the url requested was not found.",
+	}}
+}
+
+func txFailed(code string, opCodes []string, envelope string) error {
+	return &horizonclient.Error{Problem: problem.P{
+		Type:   "https://stellar.org/horizon-errors/transaction_failed",
+		Title:  "Transaction Failed",
+		Status: 400,
+		Detail: "The transaction failed when submitted to the stellar network.",
+		Extras: map[string]interface{}{
+			"envelope_xdr": envelope,
+			"result_codes": map[string]interface{}{
+				"transaction": code,
+				"operations":  opCodes,
+			},
+		},
+	}}
+}
+
+// operationSource returns the account an operation acts on
+func operationSource(op txnbuild.Operation, txSource string) string {
+	if source := op.GetSourceAccount(); source != "" {
+		return source
+	}
+	return txSource
+}
+
+// operationThreshold is the signing weight an operation needs, as on the real network
+func operationThreshold(op txnbuild.Operation, account *fakeAccount) byte {
+	if o, ok := op.(*txnbuild.SetOptions); ok {
+		if o.MasterWeight != nil || o.LowThreshold != nil || o.MediumThreshold != nil || o.HighThreshold != nil || o.Signer != nil {
+			return account.thresholds.HighThreshold
+		}
+	}
+	return account.thresholds.MedThreshold
+}
+
+func memoFields(memo txnbuild.Memo) (string, string) {
+	switch m := memo.(type) {
+	case txnbuild.MemoText:
+		return "text", string(m)
+	case txnbuild.MemoID:
+		return "id", strconv.FormatUint(uint64(m), 10)
+	case txnbuild.MemoHash:
+		return "hash", base64.StdEncoding.EncodeToString(m[:])
+	case txnbuild.MemoReturn:
+		return "return", base64.StdEncoding.EncodeToString(m[:])
+	}
+	return "none", ""
+}
+
+func parseCursor(cursor string, latest int64) (int64, error) {
+	switch cursor {
+	case "":
+		return -1, nil
+	case "now":
+		return latest, nil
+	}
+	token, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil {
+		return 0, &horizonclient.Error{Problem: problem.P{Title: "Bad Request", Status: 400, Detail: "invalid cursor"}}
+	}
+	return token, nil
+}
+
+func afterCursor(token, cursor int64, desc bool) bool {
+	if cursor < 0 {
+		return true
+	}
+	if desc {
+		return token < cursor
+	}
+	return token > cursor
+}
+
+func orderedIndexes(n int, desc bool) []int {
+	indexes := make([]int, n)
+	for i := range indexes {
+		if desc {
+			indexes[i] = n - 1 - i
+		} else {
+			indexes[i] = i
+		}
+	}
+	return indexes
+}
+
+func pageLimit(limit uint) int {
+	if limit == 0 {
+		return 10
+	}
+	return int(limit)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func splitAssetKey(key string) (string, string) {
+	code, issuer, _ := strings.Cut(key, ":")
+	return code, issuer
+}
@@ -0,0 +1,227 @@
+package ledger
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/txnbuild"
+)
+
+// payment builds a signed payment of amount XLM from source to destination
+func payment(t *testing.T, f *Fake, source *keypair.Full, destination, amount string, signers ...*keypair.Full) *txnbuild.Transaction {
+	t.Helper()
+	account, err := f.AccountDetail(horizonclient.AccountRequest{AccountID: source.Address()})
+	if err != nil {
+		t.Fatalf("account: %v", err)
+	}
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        &account,
+		IncrementSequenceNum: true,
+		BaseFee:              txnbuild.MinBaseFee,
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewInfiniteTimeout()},
+		Operations:           []txnbuild.Operation{&txnbuild.Payment{Destination: destination, Amount: amount, Asset: txnbuild.NativeAsset{}}},
+	})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if len(signers) == 0 {
+		signers = []*keypair.Full{source}
+	}
+	if tx, err = tx.Sign(network.TestNetworkPassphrase, signers...); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return tx
+}
+
+func fundedPair(t *testing.T, f *Fake, balance string) (*keypair.Full, *keypair.Full) {
+	t.Helper()
+	a, b := keypair.MustRandom(), keypair.MustRandom()
+	if err := f.CreateAccount(a.Address(), balance); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.CreateAccount(b.Address(), balance); err != nil {
+		t.Fatal(err)
+	}
+	return a, b
+}
+
+func resultCode(t *testing.T, err error) string {
+	t.Helper()
+	codes := ResultCodes(err)
+	if codes == nil {
+		t.Fatalf("error %v has no result codes", err)
+	}
+	if codes.TransactionCode == "tx_failed" && len(codes.OperationCodes) > 0 {
+		return codes.OperationCodes[len(codes.OperationCodes)-1]
+	}
+	return codes.TransactionCode
+}
+
+func TestFakePayment(t *testing.T) {
+	f := NewFake(network.TestNetworkPassphrase)
+	a, b := fundedPair(t, f, "100")
+
+	resp, err := f.SubmitTransaction(payment(t, f, a, b.Address(), "25"))
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if !resp.Successful || resp.FeeCharged != DefaultBaseFee {
+		t.Errorf("transaction successful %v fee %d", resp.Successful, resp.FeeCharged)
+	}
+	if got := f.Balance(a.Address()); got != "74.9999900" {
+		t.Errorf("source balance %s, want 100 less the payment and fee", got)
+	}
+	if got := f.Balance(b.Address()); got != "125.0000000" {
+		t.Errorf("destination balance %s", got)
+	}
+
+	found, err := f.TransactionDetail(resp.Hash)
+	if err != nil || found.Hash != resp.Hash {
+		t.Errorf("transaction detail %v, %v", found.Hash, err)
+	}
+	page, err := f.Payments(horizonclient.OperationRequest{ForAccount: b.Address()})
+	if err != nil || len(page.Embedded.Records) != 1 {
+		t.Errorf("%d payments to the destination, err %v", len(page.Embedded.Records), err)
+	}
+}
+
+func TestFakeResubmitIsIdempotent(t *testing.T) {
+	f := NewFake(network.TestNetworkPassphrase)
+	a, b := fundedPair(t, f, "100")
+	tx := payment(t, f, a, b.Address(), "10")
+
+	first, err := f.SubmitTransaction(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := f.SubmitTransaction(tx)
+	if err != nil || second.Hash != first.Hash {
+		t.Fatalf("resubmit: %v, %v", second.Hash, err)
+	}
+	if got := f.Balance(b.Address()); got != "110.0000000" {
+		t.Errorf("destination balance %s, want paid once", got)
+	}
+}
+
+func TestFakeInsufficientBalance(t *testing.T) {
+	f := NewFake(network.TestNetworkPassphrase)
+	a, b := fundedPair(t, f, "10")
+
+	// The base reserve of 1 XLM stays locked in the account
+	_, err := f.SubmitTransaction(payment(t, f, a, b.Address(), "9.5"))
+	if code := resultCode(t, err); code != "op_underfunded" {
+		t.Fatalf("result %s, want op_underfunded", code)
+	}
+	if got := f.Balance(a.Address()); got != "9.9999900" {
+		t.Errorf("source balance %s, want only the fee charged", got)
+	}
+	if got := f.Balance(b.Address()); got != "10.0000000" {
+		t.Errorf("destination balance %s, want unchanged", got)
+	}
+}
+
+func TestFakeBadSequence(t *testing.T) {
+	f := NewFake(network.TestNetworkPassphrase)
+	a, b := fundedPair(t, f, "100")
+
+	// Two transactions built on the same sequence number: only the first applies
+	first := payment(t, f, a, b.Address(), "1")
+	second := payment(t, f, a, b.Address(), "2")
+	if _, err := f.SubmitTransaction(first); err != nil {
+		t.Fatal(err)
+	}
+	_, err := f.SubmitTransaction(second)
+	if code := resultCode(t, err); code != "tx_bad_seq" {
+		t.Fatalf("result %s, want tx_bad_seq", code)
+	}
+	if got := f.Balance(b.Address()); got != "101.0000000" {
+		t.Errorf("destination balance %s", got)
+	}
+}
+
+func TestFakeBadAuth(t *testing.T) {
+	f := NewFake(network.TestNetworkPassphrase)
+	a, b := fundedPair(t, f, "100")
+
+	_, err := f.SubmitTransaction(payment(t, f, a, b.Address(), "1", b))
+	if code := resultCode(t, err); code != "tx_bad_auth" {
+		t.Fatalf("result %s, want tx_bad_auth", code)
+	}
+}
+
+func TestFakeMultisigThreshold(t *testing.T) {
+	f := NewFake(network.TestNetworkPassphrase)
+	treasury, dest := fundedPair(t, f, "100")
+	s1, s2 := keypair.MustRandom(), keypair.MustRandom()
+
+	// Two signers and a zero-weight master key, two signatures for payments
+	account, _ := f.AccountDetail(horizonclient.AccountRequest{AccountID: treasury.Address()})
+	zero, two := txnbuild.Threshold(0), txnbuild.Threshold(2)
+	setup, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        &account,
+		IncrementSequenceNum: true,
+		BaseFee:              txnbuild.MinBaseFee,
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewInfiniteTimeout()},
+		Operations: []txnbuild.Operation{
+			&txnbuild.SetOptions{Signer: &txnbuild.Signer{Address: s1.Address(), Weight: 1}},
+			&txnbuild.SetOptions{Signer: &txnbuild.Signer{Address: s2.Address(), Weight: 1}},
+			&txnbuild.SetOptions{MasterWeight: &zero, MediumThreshold: &two, HighThreshold: &two},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setup, _ = setup.Sign(network.TestNetworkPassphrase, treasury)
+	if _, err := f.SubmitTransaction(setup); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+
+	_, err = f.SubmitTransaction(payment(t, f, treasury, dest.Address(), "1", s1))
+	if code := resultCode(t, err); code != "tx_bad_auth" {
+		t.Fatalf("one signature: result %s, want tx_bad_auth", code)
+	}
+	if _, err := f.SubmitTransaction(payment(t, f, treasury, dest.Address(), "1", s1, s2)); err != nil {
+		t.Fatalf("two signatures: %v", err)
+	}
+}
+
+func TestFakeFailNext(t *testing.T) {
+	f := NewFake(network.TestNetworkPassphrase)
+	a, b := fundedPair(t, f, "100")
+	unavailable := errors.New("horizon unavailable")
+
+	f.FailNext(MethodSubmit, unavailable)
+	tx := payment(t, f, a, b.Address(), "1")
+	if _, err := f.SubmitTransaction(tx); !errors.Is(err, unavailable) {
+		t.Fatalf("submit: %v, want the injected failure", err)
+	}
+	if got := f.Balance(b.Address()); got != "100.0000000" {
+		t.Errorf("destination balance %s, want unchanged", got)
+	}
+
+	// The failure is used up; the same transaction goes through on retry
+	if _, err := f.SubmitTransaction(tx); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+}
+
+func TestFakeNotFound(t *testing.T) {
+	f := NewFake(network.TestNetworkPassphrase)
+
+	if _, err := f.AccountDetail(horizonclient.AccountRequest{AccountID: keypair.MustRandom().Address()}); !IsNotFound(err) {
+		t.Errorf("missing account: %v", err)
+	}
+	if _, err := f.TransactionDetail("00"); !IsNotFound(err) {
+		t.Errorf("missing transaction: %v", err)
+	}
+	if _, err := f.LedgerDetail(100); !IsNotFound(err) {
+		t.Errorf("unclosed ledger: %v", err)
+	}
+	f.CloseLedgers(100)
+	if _, err := f.LedgerDetail(100); err != nil {
+		t.Errorf("closed ledger: %v", err)
+	}
+}
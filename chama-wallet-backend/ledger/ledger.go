@@ -0,0 +1,53 @@
+// Package ledger hides Horizon behind an interface so the app can run against
+// the real network or against the in-memory Fake.
+package ledger
+
+import (
+	"context"
+	"errors"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/protocols/horizon/operations"
+	"github.com/stellar/go/txnbuild"
+)
+
+// Ledger is the part of the Horizon API the app uses
+type Ledger interface {
+	AccountDetail(request horizonclient.AccountRequest) (horizon.Account, error)
+	SubmitTransaction(tx *txnbuild.Transaction) (horizon.Transaction, error)
+	SubmitTransactionXDR(envelopeXDR string) (horizon.Transaction, error)
+	TransactionDetail(txHash string) (horizon.Transaction, error)
+	Transactions(request horizonclient.TransactionRequest) (horizon.TransactionsPage, error)
+	Payments(request horizonclient.OperationRequest) (operations.OperationsPage, error)
+	StreamPayments(ctx context.Context, request horizonclient.OperationRequest, handler horizonclient.OperationHandler) error
+	Fund(address string) (horizon.Transaction, error)
+	LedgerDetail(sequence uint32) (horizon.Ledger, error)
+	Root() (horizon.Root, error)
+}
+
+var _ Ledger = (*horizonclient.Client)(nil)
+
+// NewHorizon wraps a Horizon client. The client already has the right method set.
+func NewHorizon(client *horizonclient.Client) Ledger {
+	return client
+}
+
+// IsNotFound reports whether err is Horizon's 404 for a missing resource, e.g. an unfunded account
+func IsNotFound(err error) bool {
+	var horizonError *horizonclient.Error
+	return errors.As(err, &horizonError) && horizonError.Problem.Status == 404
+}
+
+// ResultCodes returns the transaction result codes of a failed submission, if any
+func ResultCodes(err error) *horizon.TransactionResultCodes {
+	var horizonError *horizonclient.Error
+	if !errors.As(err, &horizonError) {
+		return nil
+	}
+	codes, codesErr := horizonError.ResultCodes()
+	if codesErr != nil {
+		return nil
+	}
+	return codes
+}
@@ -0,0 +1,101 @@
+// Package logging sets up the process-wide structured logger. Records go through
+// slog to stdout as JSON (or text for local runs), pick up request and job
+// attributes carried in the context, and are scrubbed of secrets on the way out.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// Init installs the default logger from LOG_LEVEL (debug, info, warn or error;
+// default info) and LOG_FORMAT (json or text; default json). The standard library's
+// log package writes through it too.
+func Init() error {
+	level, err := ParseLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		return err
+	}
+	format := strings.ToLower(os.Getenv("LOG_FORMAT"))
+	if format != "" && format != "json" && format != "text" {
+		return fmt.Errorf("LOG_FORMAT must be json or text, got %q", format)
+	}
+
+	slog.SetDefault(New(os.Stdout, level, format))
+	return nil
+}
+
+// New builds a redacting logger that writes records at or above level to w
+func New(w io.Writer, level slog.Leveler, format string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	if strings.ToLower(format) == "text" {
+		handler = slog.NewTextHandler(w, opts)
+	} else {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(NewRedactingHandler(handler))
+}
+
+// ParseLevel reads a level name; empty means info
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("LOG_LEVEL must be debug, info, warn or error, got %q", name)
+}
+
+// Fatal logs msg at error level and exits, for startup failures
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx whose log records carry the given attributes, in
+// the key-value form slog takes, e.g. NewContext(ctx, "request_id", id). Use the
+// *Context logging functions (slog.InfoContext and so on) for them to be added.
+func NewContext(ctx context.Context, args ...any) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	attrs := append(attrsFrom(ctx), argsToAttrs(args)...)
+	return context.WithValue(ctx, contextKey{}, attrs)
+}
+
+// attrsFrom returns the attributes stored on ctx
+func attrsFrom(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(contextKey{}).([]slog.Attr)
+	// Callers append to the result; never let them write into the parent's slice
+	return attrs[:len(attrs):len(attrs)]
+}
+
+// argsToAttrs converts slog's alternating key-value arguments to attributes
+func argsToAttrs(args []any) []slog.Attr {
+	record := slog.NewRecord(time.Time{}, 0, "", 0)
+	record.Add(args...)
+
+	attrs := make([]slog.Attr, 0, record.NumAttrs())
+	record.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return attrs
+}
@@ -0,0 +1,59 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Log writes messages to a file, or stdout, instead of sending them. It is meant for
+// local development, where the links in the messages are copied from the log.
+type Log struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewLog appends messages to the file at path, or writes them to stdout if path is empty
+func NewLog(path string) (*Log, error) {
+	if path == "" {
+		return &Log{w: os.Stdout}, nil
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mail log: %w", err)
+	}
+	return &Log{w: file}, nil
+}
+
+func (m *Log) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := fmt.Fprintf(m.w, "📧 %s\nTo: %s\nSubject: %s\n\n%s\n\n", time.Now().Format(time.RFC3339), msg.To, msg.Subject, msg.Body)
+	return err
+}
+
+// Memory keeps sent messages in memory so tests can read them
+type Memory struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// Sent returns the messages sent so far, oldest first
+func (m *Memory) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.sent...)
+}
@@ -0,0 +1,66 @@
+// Package mailer sends the app's transactional email. Production sends through SMTP;
+// local development writes messages to a log instead.
+package mailer
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"chama-wallet-backend/config"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Default is the mailer used by the application, set up by InitMailer
+var Default Mailer
+
+// InitMailer configures the default mailer from MAILER ("smtp" or "log"). Mainnet must
+// send real mail.
+func InitMailer() error {
+	kind := os.Getenv("MAILER")
+	if kind == "" {
+		kind = "log"
+		if os.Getenv("SMTP_HOST") != "" {
+			kind = "smtp"
+		}
+	}
+
+	switch kind {
+	case "smtp":
+		smtp, err := NewSMTPFromEnv()
+		if err != nil {
+			return err
+		}
+		Default = smtp
+		slog.Info("mailer configured", "mailer", "smtp", "addr", smtp.Addr)
+
+	case "log":
+		if config.Config != nil && config.Config.IsMainnet {
+			return fmt.Errorf("MAILER=log is not allowed on mainnet, configure SMTP_HOST")
+		}
+		path := os.Getenv("MAIL_LOG_PATH")
+		log, err := NewLog(path)
+		if err != nil {
+			return err
+		}
+		Default = log
+		if path == "" {
+			path = "stdout"
+		}
+		slog.Info("mailer configured", "mailer", "log", "path", path)
+	default:
+		return fmt.Errorf("unknown MAILER %q", kind)
+	}
+	return nil
+}
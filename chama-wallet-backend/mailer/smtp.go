@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// SMTP sends mail through an SMTP server, authenticating with PLAIN auth when a
+// username is set
+type SMTP struct {
+	Addr     string // host:port
+	From     string
+	Username string
+	Password string
+}
+
+// NewSMTPFromEnv reads SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD and MAIL_FROM
+func NewSMTPFromEnv() (*SMTP, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return nil, fmt.Errorf("SMTP_HOST is not set")
+	}
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		return nil, fmt.Errorf("MAIL_FROM is not set")
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	return &SMTP{
+		Addr:     net.JoinHostPort(host, port),
+		From:     from,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+	}, nil
+}
+
+func (m *SMTP) Send(msg Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return fmt.Errorf("mail headers cannot contain line breaks")
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := net.SplitHostPort(m.Addr)
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	body := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		m.From, msg.To, msg.Subject, strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, []byte(body))
+}
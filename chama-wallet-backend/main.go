@@ -1,26 +1,45 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"time"
 
-	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/joho/godotenv"
 	"gorm.io/gorm"
 
 	"chama-wallet-backend/config"
 	"chama-wallet-backend/database"
+	"chama-wallet-backend/keystore"
+	"chama-wallet-backend/ledger"
+	"chama-wallet-backend/logging"
+	"chama-wallet-backend/mailer"
+	"chama-wallet-backend/ratelimit"
+	"chama-wallet-backend/repository"
 	"chama-wallet-backend/routes"
+	"chama-wallet-backend/scheduler"
+	"chama-wallet-backend/services"
+	"chama-wallet-backend/sorobanrpc"
 )
 
 var DB *gorm.DB
 
 func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		fmt.Printf("Warning: Error loading .env file: %v\n", err)
+	// Load environment variables, then set up structured logging from them
+	envErr := godotenv.Load()
+	if err := logging.Init(); err != nil {
+		logging.Fatal("logging configuration failed", "error", err)
+	}
+	if envErr != nil {
+		slog.Warn("failed to load .env file", "error", envErr)
+	}
+
+	// "migrate up|down|status" manages the schema without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrateCommand(os.Args[2:])
+		return
 	}
 
 	// Initialize Stellar configuration
@@ -28,29 +47,79 @@ func main() {
 
 	// Validate mainnet configuration if needed
 	if err := config.ValidateMainnetConfig(); err != nil {
-		log.Fatalf("❌ Configuration validation failed: %v", err)
+		logging.Fatal("configuration validation failed", "error", err)
+	}
+
+	// Load the access token signing keys
+	if err := config.InitAuthConfig(); err != nil {
+		logging.Fatal("auth configuration failed", "error", err)
+	}
+
+	// Wire up the ledger and Soroban RPC. Offline mode runs against in-memory fakes.
+	// Requests and jobs find the ledger on their context.
+	var stellarLedger ledger.Ledger
+	if os.Getenv("STELLAR_OFFLINE") == "true" {
+		fakeRPC := sorobanrpc.NewFakeServer(config.GetNetworkPassphrase())
+		defer fakeRPC.Close()
+		stellarLedger = ledger.NewFake(config.GetNetworkPassphrase())
+		services.SetSorobanRPC(fakeRPC.Client())
+		slog.Warn("offline mode: using an in-memory ledger and Soroban RPC")
+	} else {
+		stellarLedger = ledger.NewHorizon(config.GetHorizonClient())
+		services.SetSorobanRPC(sorobanrpc.NewClient(config.Config.SorobanRPCURL))
+	}
+
+	// Set up outgoing email for verification and password reset links
+	if err := mailer.InitMailer(); err != nil {
+		logging.Fatal("mailer configuration failed", "error", err)
 	}
 
-	// Connect to database and run migrations
+	// Initialize the keystore used to encrypt secret keys at rest
+	if err := keystore.InitKeystore(); err != nil {
+		logging.Fatal("keystore initialization failed", "error", err)
+	}
+
+	// Connect to database and apply pending migrations, unless they are run separately
 	database.ConnectDB()
-	database.RunMigrations()
+	if os.Getenv("AUTO_MIGRATE") != "false" {
+		database.RunMigrations()
+	}
+	repository.Init(database.DB)
+	database.SealPlaintextSecrets()
 
-	// Create Fiber app
-	app := fiber.New()
+	// Rate limit buckets live in memory, or in the database when replicas share them
+	if err := ratelimit.Init(database.DB); err != nil {
+		logging.Fatal("rate limit configuration failed", "error", err)
+	}
 
-	// Add CORS middleware
-	app.Use(cors.New(cors.Config{
-		AllowOrigins:     "http://localhost:5173,https://community-wallet-for-women-s-savings-6wpp.onrender.com,http://127.0.0.1:5173,https://community-wallet-for-women-s-saving-ten.vercel.app",
-		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders:     "Origin,Content-Type,Accept,Authorization",
-		AllowCredentials: true,
-	}))
+	// Start background jobs. Each run is leased in the database so only one replica runs it.
+	if os.Getenv("DISABLE_SCHEDULER") != "true" {
+		jobs := scheduler.New(database.DB, 30*time.Second)
+		must := func(err error) {
+			if err != nil {
+				logging.Fatal("scheduler setup failed", "error", err)
+			}
+		}
+		must(jobs.Register("contribution_reminders", "0 8 * * *", 10*time.Minute, func(ctx context.Context) error {
+			return services.SendContributionReminders()
+		}))
+		must(jobs.Register("overdue_contributions", "@hourly", 10*time.Minute, services.DetectOverdueContributions))
+		must(jobs.Register("close_expired_rounds", "@every 15m", 5*time.Minute, services.CloseExpiredRounds))
+		must(jobs.Register("ingest_payments", "@every 30s", 5*time.Minute, services.IngestGroupPayments))
+		must(jobs.Register("execute_round_payouts", "@every 1m", 5*time.Minute, services.ExecuteAuthorizedPayouts))
+		must(jobs.Register("draw_payout_order", "@every 1m", 5*time.Minute, services.DrawPayoutOrders))
+		must(jobs.Register("close_bid_windows", "@every 1m", 5*time.Minute, services.CloseBidWindows))
+		must(jobs.Register("expire_payout_requests", "@hourly", 5*time.Minute, services.ExpirePayoutRequests))
+		must(jobs.Register("settle_share_out", "0 6 * * *", 10*time.Minute, services.SettleCycles))
+		must(jobs.Register("purge_idempotency_keys", "@daily", 5*time.Minute, services.PurgeExpiredIdempotencyKeys))
+		must(jobs.Register("purge_sessions", "@daily", 5*time.Minute, services.PurgeEndedSessions))
+		must(jobs.Register("purge_login_throttles", "@daily", 5*time.Minute, services.PurgeLoginThrottles))
+		must(jobs.Register("purge_rate_limits", "@hourly", 5*time.Minute, ratelimit.PurgeIdleBuckets))
+		must(jobs.Start(ledger.NewContext(context.Background(), stellarLedger)))
+	}
 
-	// Setup routes
-	routes.Setup(app)
-	routes.SetupSorobanRoutes(app)
-	routes.GroupRoutes(app)
-	routes.AuthRoutes(app)
+	// Create Fiber app with every route registered
+	app := routes.NewApp(stellarLedger)
 
 	// Get port from environment or use default
 	port := os.Getenv("PORT")
@@ -58,20 +127,19 @@ func main() {
 		port = "3000"
 	}
 
-	// Print startup information
-	fmt.Printf("🚀 Chama Wallet API starting on port %s\n", port)
-	fmt.Printf("🌐 Network: %s\n", config.Config.Network)
-	fmt.Printf("🔗 Horizon: %s\n", config.Config.HorizonURL)
-	fmt.Printf("📡 Soroban RPC: %s\n", config.Config.SorobanRPCURL)
-	if config.Config.ContractID != "" {
-		fmt.Printf("📋 Contract ID: %s\n", config.Config.ContractID)
-	}
-
+	// Log startup information
+	slog.Info("chama wallet API starting",
+		"port", port,
+		"network", config.Config.Network,
+		"horizon", config.Config.HorizonURL,
+		"soroban_rpc", config.Config.SorobanRPCURL,
+		"contract_id", config.Config.ContractID,
+	)
 	if config.Config.IsMainnet {
-		fmt.Println("⚠️  MAINNET MODE: Real funds will be used!")
-	} else {
-		fmt.Println("🧪 TESTNET MODE: Using test funds")
+		slog.Warn("mainnet mode: real funds will be used")
 	}
 
-	log.Fatal(app.Listen(fmt.Sprintf(":%s", port)))
+	if err := app.Listen(fmt.Sprintf(":%s", port)); err != nil {
+		logging.Fatal("server stopped", "error", err)
+	}
 }
@@ -5,6 +5,7 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 
+	"chama-wallet-backend/logging"
 	"chama-wallet-backend/services"
 )
 
@@ -38,6 +39,13 @@ func AuthMiddleware() fiber.Handler {
 			})
 		}
 
+		// Signing out revokes the session, which ends its access tokens too
+		if !services.SessionActive(claims.SessionID, claims.UserID) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Session expired or revoked",
+			})
+		}
+
 		user, err := services.GetUserByID(claims.UserID)
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -45,8 +53,14 @@ func AuthMiddleware() fiber.Handler {
 			})
 		}
 
+		if limited, err := limitUser(c, user.ID); limited {
+			return err
+		}
+
 		c.Locals("user", user)
 		c.Locals("userID", claims.UserID)
+		c.Locals("sessionID", claims.SessionID)
+		c.SetUserContext(logging.NewContext(c.UserContext(), "user_id", user.ID))
 
 		return c.Next()
 	}
@@ -60,7 +74,7 @@ func OptionalAuthMiddleware() fiber.Handler {
 			token := strings.TrimPrefix(authHeader, "Bearer ")
 			if token != "" {
 				claims, err := services.ValidateJWT(token)
-				if err == nil {
+				if err == nil && services.SessionActive(claims.SessionID, claims.UserID) {
 					user, err := services.GetUserByID(claims.UserID)
 					if err == nil {
 						c.Locals("user", user)
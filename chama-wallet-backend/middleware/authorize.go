@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/policy"
+	"chama-wallet-backend/repository"
+)
+
+// Authorize checks the user's role in the group allows the action. It resolves the group
+// and the user's membership once and leaves them in Locals as "group" and "member" for
+// the handler. It must run after AuthMiddleware.
+func Authorize(action policy.Action, groupOf GroupResolver) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		groupID, err := groupOf(c)
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Not found"})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		group, err := repository.Default.Groups.ByID(groupID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Group not found"})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		user := c.Locals("user").(models.User)
+		member, err := repository.Default.Members.Approved(group.ID, user.ID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not a group member"})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		if !policy.Allows(group, member, action) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":  "Your role in this group does not allow this action",
+				"role":   member.Role,
+				"action": action,
+			})
+		}
+
+		c.Locals("group", group)
+		c.Locals("member", member)
+		return c.Next()
+	}
+}
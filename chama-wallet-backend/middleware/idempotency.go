@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+
+	"chama-wallet-backend/services"
+)
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header
+const maxIdempotencyKeyLength = 255
+
+// Idempotency replays the stored response when a request is retried with the same
+// Idempotency-Key header. It must run after AuthMiddleware; keys are scoped per user.
+// Requests without the header are processed normally.
+func Idempotency() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get("Idempotency-Key")
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength),
+			})
+		}
+
+		userID, _ := c.Locals("userID").(string)
+
+		sum := sha256.New()
+		sum.Write([]byte(c.Method() + " " + c.Path() + "\n"))
+		sum.Write(c.Body())
+		requestHash := hex.EncodeToString(sum.Sum(nil))
+
+		record, replay, err := services.BeginIdempotentRequest(userID, key, c.Method(), c.Path(), requestHash)
+		switch {
+		case errors.Is(err, services.ErrIdempotencyKeyReused):
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "Idempotency-Key was already used for a different request"})
+		case errors.Is(err, services.ErrIdempotencyKeyInFlight):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "A request with this Idempotency-Key is still being processed"})
+		case err != nil:
+			slog.ErrorContext(c.UserContext(), "failed to claim idempotency key", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to process Idempotency-Key"})
+		}
+
+		if replay {
+			c.Set("Idempotent-Replayed", "true")
+			c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			return c.Status(record.ResponseStatus).Send(record.ResponseBody)
+		}
+
+		err = c.Next()
+
+		// Only final answers are replayed. Accepted (still in flight) and server errors
+		// release the key so a retry runs the handler again, which resumes any pending submission.
+		status := c.Response().StatusCode()
+		if err != nil || status == fiber.StatusAccepted || status >= fiber.StatusInternalServerError {
+			if releaseErr := services.ReleaseIdempotentRequest(record.ID); releaseErr != nil {
+				slog.ErrorContext(c.UserContext(), "failed to release idempotency key", "error", releaseErr)
+			}
+			return err
+		}
+
+		body := append([]byte(nil), c.Response().Body()...)
+		if err := services.CompleteIdempotentRequest(record.ID, status, body); err != nil {
+			slog.ErrorContext(c.UserContext(), "failed to store idempotent response", "error", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+)
+
+// idempotentApp serves POST /pay behind Idempotency as user-1. handle answers each
+// request that reaches the handler; calls counts them.
+func idempotentApp(t *testing.T, handle func(c *fiber.Ctx) error) (*fiber.App, *int32) {
+	t.Helper()
+	db, err := database.Open("sqlite", fmt.Sprintf("file:idempotency-%s?mode=memory&cache=shared", uuid.NewString()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.IdempotencyKey{}); err != nil {
+		t.Fatal(err)
+	}
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	var calls int32
+	app := fiber.New()
+	app.Post("/pay", func(c *fiber.Ctx) error {
+		c.Locals("userID", "user-1")
+		return c.Next()
+	}, Idempotency(), func(c *fiber.Ctx) error {
+		atomic.AddInt32(&calls, 1)
+		return handle(c)
+	})
+	return app, &calls
+}
+
+func pay(t *testing.T, app *fiber.App, key, body string) (int, string, string) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/pay", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(raw), resp.Header.Get("Idempotent-Replayed")
+}
+
+func TestIdempotencyReplaysResponse(t *testing.T) {
+	app, calls := idempotentApp(t, func(c *fiber.Ctx) error {
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{"id": uuid.NewString()})
+	})
+
+	status, first, replayed := pay(t, app, "key-1", `{"amount":10}`)
+	if status != fiber.StatusCreated || replayed != "" {
+		t.Fatalf("first request: %d replayed %q", status, replayed)
+	}
+	status, second, replayed := pay(t, app, "key-1", `{"amount":10}`)
+	if status != fiber.StatusCreated || second != first || replayed != "true" {
+		t.Errorf("retry: %d %s replayed %q, want the first response %s replayed", status, second, replayed, first)
+	}
+	if *calls != 1 {
+		t.Errorf("handler ran %d times, want once", *calls)
+	}
+
+	// Another key, or none, is a new request
+	pay(t, app, "key-2", `{"amount":10}`)
+	pay(t, app, "", `{"amount":10}`)
+	if *calls != 3 {
+		t.Errorf("handler ran %d times, want 3", *calls)
+	}
+}
+
+func TestIdempotencyKeyReusedForDifferentBody(t *testing.T) {
+	app, calls := idempotentApp(t, func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"ok": true})
+	})
+
+	pay(t, app, "key-1", `{"amount":10}`)
+	status, _, _ := pay(t, app, "key-1", `{"amount":99}`)
+	if status != fiber.StatusUnprocessableEntity {
+		t.Errorf("different body: status %d, want 422", status)
+	}
+	if *calls != 1 {
+		t.Errorf("handler ran %d times, want once", *calls)
+	}
+}
+
+func TestIdempotencyInFlightAndLockTakeover(t *testing.T) {
+	release := make(chan struct{})
+	app, calls := idempotentApp(t, func(c *fiber.Ctx) error {
+		if c.Get("X-Block") != "" {
+			<-release
+		}
+		return c.JSON(fiber.Map{"ok": true})
+	})
+
+	// The first request holds the key while its handler runs
+	done := make(chan int)
+	go func() {
+		req := httptest.NewRequest("POST", "/pay", strings.NewReader(`{"amount":10}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "key-1")
+		req.Header.Set("X-Block", "1")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			done <- 0
+			return
+		}
+		done <- resp.StatusCode
+	}()
+	for atomic.LoadInt32(calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	status, _, _ := pay(t, app, "key-1", `{"amount":10}`)
+	if status != fiber.StatusConflict {
+		t.Errorf("retry while in flight: status %d, want 409", status)
+	}
+
+	// After two minutes the holder is presumed dead and a retry takes the key over
+	database.DB.Model(&models.IdempotencyKey{}).Where("key = ?", "key-1").
+		Update("created_at", time.Now().Add(-3*time.Minute))
+	status, _, replayed := pay(t, app, "key-1", `{"amount":10}`)
+	if status != fiber.StatusOK || replayed != "" {
+		t.Errorf("retry after the lock timeout: status %d replayed %q, want the handler run", status, replayed)
+	}
+	if *calls != 2 {
+		t.Errorf("handler ran %d times, want 2", *calls)
+	}
+
+	close(release)
+	<-done
+}
+
+func TestIdempotencyReleasedOnServerError(t *testing.T) {
+	var fail int32 = 1
+	app, calls := idempotentApp(t, func(c *fiber.Ctx) error {
+		if atomic.CompareAndSwapInt32(&fail, 1, 0) {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "ledger unavailable"})
+		}
+		return c.JSON(fiber.Map{"ok": true})
+	})
+
+	status, _, _ := pay(t, app, "key-1", `{"amount":10}`)
+	if status != fiber.StatusBadGateway {
+		t.Fatalf("first request: status %d", status)
+	}
+	status, _, replayed := pay(t, app, "key-1", `{"amount":10}`)
+	if status != fiber.StatusOK || replayed != "" {
+		t.Errorf("retry: status %d replayed %q, want the handler run again", status, replayed)
+	}
+	if *calls != 2 {
+		t.Errorf("handler ran %d times, want 2", *calls)
+	}
+
+	var stored models.IdempotencyKey
+	if err := database.DB.First(&stored, "key = ?", "key-1").Error; err != nil || stored.Status != "completed" {
+		t.Errorf("stored key %+v, %v; want the successful response kept", stored.Status, err)
+	}
+}
@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"chama-wallet-backend/ledger"
+)
+
+// Ledger puts l on the request's context, where the services look for the ledger
+// they read accounts from and submit transactions to
+func Ledger(l ledger.Ledger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.SetUserContext(ledger.NewContext(c.UserContext(), l))
+		return c.Next()
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"chama-wallet-backend/ratelimit"
+)
+
+// RateLimit takes a token from the caller's bucket for the route class, keyed by IP.
+// Requests over the limit get 429 with Retry-After.
+func RateLimit(class ratelimit.Class) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if limited, err := takeToken(c, class, "ip:"+c.IP()); limited {
+			return err
+		}
+		return c.Next()
+	}
+}
+
+// limitUser takes a token from the signed-in user's API bucket, so one account cannot
+// get round the per-IP limit by spreading its requests over many addresses
+func limitUser(c *fiber.Ctx, userID string) (bool, error) {
+	return takeToken(c, ratelimit.API, "user:"+userID)
+}
+
+// takeToken reports whether the request was limited, having written the 429 if it was.
+// A store that fails lets the request through rather than taking the API down with it.
+func takeToken(c *fiber.Ctx, class ratelimit.Class, key string) (bool, error) {
+	if ratelimit.Default == nil {
+		return false, nil
+	}
+	rate := ratelimit.Rates[class]
+
+	result, err := ratelimit.Default.Take(c.UserContext(), string(class)+":"+key, rate)
+	if err != nil {
+		slog.WarnContext(c.UserContext(), "rate limit store failed, allowing request", "error", err)
+		return false, nil
+	}
+
+	c.Set("X-RateLimit-Limit", strconv.Itoa(rate.Limit))
+	c.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	if result.Allowed {
+		return false, nil
+	}
+	return true, tooManyRequests(c, result.RetryAfter)
+}
+
+// tooManyRequests answers 429 with the whole seconds until the client may try again
+func tooManyRequests(c *fiber.Ctx, retryAfter time.Duration) error {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error":       fmt.Sprintf("Too many requests, try again in %d seconds", seconds),
+		"retry_after": seconds,
+	})
+}
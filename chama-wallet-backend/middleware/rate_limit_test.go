@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"chama-wallet-backend/ratelimit"
+)
+
+func TestRateLimitAnswers429WithRetryAfter(t *testing.T) {
+	previousStore, previousRate := ratelimit.Default, ratelimit.Rates[ratelimit.Auth]
+	t.Cleanup(func() {
+		ratelimit.Default = previousStore
+		ratelimit.Rates[ratelimit.Auth] = previousRate
+	})
+	ratelimit.Default = ratelimit.NewMemory()
+	ratelimit.Rates[ratelimit.Auth] = ratelimit.Rate{Limit: 2, Period: time.Minute}
+
+	app := fiber.New()
+	app.Post("/auth/login", RateLimit(ratelimit.Auth), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	for i, want := range []int{fiber.StatusNoContent, fiber.StatusNoContent, fiber.StatusTooManyRequests} {
+		resp, err := app.Test(httptest.NewRequest("POST", "/auth/login", nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != want {
+			t.Fatalf("request %d: status %d, want %d", i+1, resp.StatusCode, want)
+		}
+		if got := resp.Header.Get("X-RateLimit-Remaining"); got != strconv.Itoa(max(1-i, 0)) {
+			t.Errorf("request %d: remaining %s, want %d", i+1, got, max(1-i, 0))
+		}
+		if want != fiber.StatusTooManyRequests {
+			continue
+		}
+		// A token comes back every 30 seconds
+		if got := resp.Header.Get(fiber.HeaderRetryAfter); got != "30" {
+			t.Errorf("Retry-After %q, want 30", got)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"chama-wallet-backend/logging"
+)
+
+// RequestLogger puts the request ID on the request's context, so everything logged
+// while serving it carries the ID, and logs each request when it completes. It must
+// run after the requestid middleware.
+func RequestLogger() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requestID, _ := c.Locals("requestid").(string)
+		c.SetUserContext(logging.NewContext(c.UserContext(), "request_id", requestID))
+
+		started := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) {
+				status = fiberErr.Code
+			}
+		}
+
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		// AuthMiddleware adds the user to the context, so it is only there once the
+		// handler chain has run
+		slog.Log(c.UserContext(), level, "request",
+			"method", c.Method(),
+			"path", c.Path(),
+			"status", status,
+			"duration_ms", time.Since(started).Milliseconds(),
+			"ip", c.IP(),
+		)
+		return err
+	}
+}
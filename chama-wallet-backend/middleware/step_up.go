@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
+	"chama-wallet-backend/services"
+)
+
+// GroupResolver finds the group a request acts on. A nil resolver means the request acts
+// on the user's own wallet.
+type GroupResolver func(c *fiber.Ctx) (string, error)
+
+// GroupParam is the group named by the :id route param
+func GroupParam(c *fiber.Ctx) (string, error) {
+	return c.Params("id"), nil
+}
+
+// PayoutGroup is the group of the payout request named by the :id route param
+func PayoutGroup(c *fiber.Ctx) (string, error) {
+	payoutRequest, err := repository.Default.Payouts.ByID(c.Params("id"))
+	return payoutRequest.GroupID, err
+}
+
+// StepUp guards a sensitive action with a recent second-factor check when the group, or
+// the user, requires one. It must run after AuthMiddleware and before Idempotency, so a
+// refusal is not stored as the request's answer.
+func StepUp(groupOf GroupResolver) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var groupID string
+		if group, ok := c.Locals("group").(models.Group); ok && groupOf != nil {
+			// Already resolved by Authorize
+			groupID = group.ID
+		} else if groupOf != nil {
+			id, err := groupOf(c)
+			if errors.Is(err, repository.ErrNotFound) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Not found"})
+			}
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			}
+			groupID = id
+		}
+
+		user := c.Locals("user").(models.User)
+		sessionID, _ := c.Locals("sessionID").(string)
+
+		err := services.RequireStepUp(user, sessionID, groupID)
+		switch {
+		case err == nil:
+			return c.Next()
+		case errors.Is(err, services.ErrStepUpRequired):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error(), "step_up_required": true})
+		case errors.Is(err, services.ErrNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package middleware_test
+
+import (
+	"testing"
+	"time"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/testenv"
+	"chama-wallet-backend/totp"
+)
+
+func TestStepUpGuardsSensitiveRoutes(t *testing.T) {
+	e, err := testenv.New()
+	if err != nil {
+		t.Fatalf("testenv: %v", err)
+	}
+	t.Cleanup(func() { e.Close() })
+
+	auth, err := e.Register("Akinyi", "akinyi@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func(status int, method, path string, body, out interface{}) {
+		t.Helper()
+		var raw map[string]interface{}
+		if out == nil {
+			out = &raw
+		}
+		got, err := e.Request(method, path, auth.Token, body, out)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		if got != status {
+			t.Fatalf("%s %s: status %d, want %d (%v)", method, path, got, status, out)
+		}
+	}
+
+	// Before enrolling, exporting the wallet's key needs no second factor
+	request(200, "GET", "/auth/secret-key", nil, nil)
+
+	var enrollment struct {
+		Secret string `json:"secret"`
+	}
+	request(200, "POST", "/auth/2fa/enroll", nil, &enrollment)
+	now := totp.Step(time.Now())
+	code := func(step int64) map[string]string {
+		t.Helper()
+		code, err := totp.Code(enrollment.Secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return map[string]string{"code": code}
+	}
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	request(200, "POST", "/auth/2fa/confirm", code(now), &confirmed)
+
+	var refused struct {
+		StepUpRequired bool `json:"step_up_required"`
+	}
+	request(403, "GET", "/auth/secret-key", nil, &refused)
+	if !refused.StepUpRequired {
+		t.Error("refusal does not say a step-up is required")
+	}
+
+	request(200, "POST", "/auth/2fa/step-up", code(now+1), nil)
+	request(200, "GET", "/auth/secret-key", nil, nil)
+
+	// A step-up older than the window no longer covers the session
+	stale := time.Now().Add(-time.Hour)
+	if err := database.DB.Model(&models.Session{}).Where("user_id = ?", auth.User.ID).
+		Update("step_up_at", stale).Error; err != nil {
+		t.Fatal(err)
+	}
+	request(403, "GET", "/auth/secret-key", nil, nil)
+
+	// A group that requires a step-up asks its creator for a fresh one too
+	members, err := e.Members(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group, err := e.Group(auth, members...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Model(&models.Group{}).Where("id = ?", group.ID).
+		Update("require_step_up", true).Error; err != nil {
+		t.Fatal(err)
+	}
+	request(403, "GET", "/group/"+group.ID+"/secret", nil, nil)
+	request(200, "POST", "/auth/2fa/step-up", map[string]string{"code": confirmed.RecoveryCodes[0]}, nil)
+	request(200, "GET", "/group/"+group.ID+"/secret", nil, nil)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/logging"
+)
+
+const migrateUsage = `usage: chama-wallet-backend migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [N]    revert the last N migrations (default 1)
+  status      list migrations and when they were applied`
+
+// runMigrateCommand handles "migrate up|down|status" and exits
+func runMigrateCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Println(migrateUsage)
+		os.Exit(2)
+	}
+
+	database.ConnectDB()
+	if database.IsSQLite(database.DB) {
+		logging.Fatal("versioned migrations are Postgres only; SQLite builds its schema at startup")
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := database.MigrateUp(database.DB)
+		if err != nil {
+			logging.Fatal("migrate up failed", "error", err)
+		}
+		fmt.Printf("✅ %d migrations applied\n", applied)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				logging.Fatal("invalid step count", "steps", args[1])
+			}
+			steps = n
+		}
+		reverted, err := database.MigrateDown(database.DB, steps)
+		if err != nil {
+			logging.Fatal("migrate down failed", "error", err)
+		}
+		fmt.Printf("✅ %d migrations reverted\n", reverted)
+
+	case "status":
+		states, err := database.MigrationStatus(database.DB)
+		if err != nil {
+			logging.Fatal("migrate status failed", "error", err)
+		}
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-30s %s\n", state.Version, state.Name, applied)
+		}
+
+	default:
+		fmt.Println(migrateUsage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// AuctionPolicy sets where the discount on an auctioned payout goes
+type AuctionPolicy struct {
+	DiscountTo string `json:"discount_to"` // members (split among the other members) or group (kept as group profit)
+}
+
+// BidWindow is the sealed-bid auction of one round's pot in a group that auctions its
+// payout order. Members not yet paid bid the discount they would take off the pot; the
+// highest discount wins the round.
+type BidWindow struct {
+	ID         string      `gorm:"primaryKey"`
+	GroupID    string      `gorm:"uniqueIndex:idx_bid_windows_group_round"`
+	Round      int         `gorm:"uniqueIndex:idx_bid_windows_group_round"`
+	Pot        float64     // the round's contributions
+	DiscountTo string      `gorm:"column:discount_to"` // members, group
+	Status     string      `gorm:"default:open"`       // open, closed
+	ClosesAt   time.Time   `gorm:"column:closes_at"`
+	WinnerID   string      `gorm:"column:winner_id"` // the member paid the round
+	Discount   float64     `gorm:"default:0"`        // the winning bid
+	Bids       []PayoutBid `gorm:"foreignKey:WindowID"`
+	ClosedAt   *time.Time  `gorm:"column:closed_at"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// PayoutBid is a member's sealed bid for a round's pot. Other members see it only once
+// the window closes.
+type PayoutBid struct {
+	ID        string  `gorm:"primaryKey"`
+	WindowID  string  `gorm:"uniqueIndex:idx_payout_bids_window_member"`
+	MemberID  string  `gorm:"uniqueIndex:idx_payout_bids_window_member"`
+	Member    Member  `gorm:"foreignKey:MemberID"`
+	Discount  float64 // XLM taken off the pot
+	CreatedAt time.Time
+	UpdatedAt time.Time // when the bid was last changed; earlier bids win ties
+}
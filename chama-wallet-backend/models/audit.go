@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// AuditEvent records who did what to a group or account. Events are append-only: each
+// one carries the hash of the previous event in its group's chain, so editing or
+// removing a row breaks every hash after it.
+type AuditEvent struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	GroupID   string    `gorm:"column:group_id;index:idx_audit_events_group_created,priority:1" json:"group_id,omitempty"` // empty for account events
+	ActorID   string    `gorm:"column:actor_id;index" json:"actor_id"`                                                     // user ID, or "system" for background jobs
+	Action    string    `gorm:"column:action" json:"action"`
+	TargetID  string    `gorm:"column:target_id" json:"target_id,omitempty"`
+	Before    string    `gorm:"column:before_state" json:"before,omitempty"` // JSON
+	After     string    `gorm:"column:after_state" json:"after,omitempty"`   // JSON
+	IP        string    `gorm:"column:ip" json:"ip,omitempty"`
+	RequestID string    `gorm:"column:request_id" json:"request_id,omitempty"`
+	CreatedAt time.Time `gorm:"index:idx_audit_events_group_created,priority:2" json:"created_at"`
+	PrevHash  string    `gorm:"column:prev_hash" json:"prev_hash"`
+	Hash      string    `gorm:"column:hash;uniqueIndex" json:"hash"`
+}
@@ -3,33 +3,64 @@ package models
 import "time"
 
 type Group struct {
-	ID                 string `gorm:"primaryKey"`
-	Name               string
-	Description        string
-	Wallet             string
-	SecretKey          string `gorm:"column:secret_key"`
-	CreatorID          string `gorm:"column:creator_id"`
-	Creator            User   `gorm:"foreignKey:CreatorID"`
-	Members            []Member       `gorm:"foreignKey:GroupID"`
-	Contributions      []Contribution `gorm:"foreignKey:GroupID"`
-	ContractID         string         `gorm:"column:contract_id"`
-	Status             string         `gorm:"default:pending"` // pending, active, completed
-	ContributionAmount float64        `gorm:"column:contribution_amount"`
-	ContributionPeriod int            `gorm:"column:contribution_period"` // days
-	PayoutOrder        string         `gorm:"column:payout_order"` // JSON array of member IDs
-	CurrentRound       int            `gorm:"column:current_round;default:0"`
-	MaxMembers         int            `gorm:"column:max_members;default:20"`
-	MinMembers         int            `gorm:"column:min_members;default:3"`
-	NextContributionDate time.Time `gorm:"column:next_contribution_date"`
-	IsApproved         bool          `gorm:"column:is_approved;default:false"`
-	CreatedAt          time.Time
-	UpdatedAt          time.Time
+	ID                   string `gorm:"primaryKey"`
+	Name                 string
+	Description          string
+	Wallet               string
+	SecretKey            string         `gorm:"column:secret_key" json:"-"` // sealed by the keystore
+	CreatorID            string         `gorm:"column:creator_id"`
+	Creator              User           `gorm:"foreignKey:CreatorID"`
+	Members              []Member       `gorm:"foreignKey:GroupID"`
+	Contributions        []Contribution `gorm:"foreignKey:GroupID"`
+	ContractID           string         `gorm:"column:contract_id"`
+	Status               string         `gorm:"default:pending"` // pending, active, completed
+	ContributionAmount   float64        `gorm:"column:contribution_amount"`
+	ContributionPeriod   int            `gorm:"column:contribution_period"` // days
+	PayoutOrder          string         `gorm:"column:payout_order"`        // JSON array of member IDs
+	CurrentRound         int            `gorm:"column:current_round;default:0"`
+	MaxMembers           int            `gorm:"column:max_members;default:20"`
+	MinMembers           int            `gorm:"column:min_members;default:3"`
+	NextContributionDate time.Time      `gorm:"column:next_contribution_date"`
+	IsApproved           bool           `gorm:"column:is_approved;default:false"`
+	Multisig             bool           `gorm:"column:multisig;default:false"`          // wallet is a multisig treasury
+	TreasurySigners      string         `gorm:"column:treasury_signers"`                // JSON array of signer addresses
+	PayoutThreshold      int            `gorm:"column:payout_threshold;default:0"`      // signatures needed for a payout
+	SignerThreshold      int            `gorm:"column:signer_threshold;default:0"`      // signatures needed to change signers
+	ApprovalPolicy       string         `gorm:"column:approval_policy;default:count"`   // count, percent_admins, majority_members
+	ApprovalCount        int            `gorm:"column:approval_count;default:1"`        // approvals needed under the count policy
+	ApprovalPercent      int            `gorm:"column:approval_percent;default:0"`      // percent of admins under the percent_admins policy
+	ApprovalExpiryHours  int            `gorm:"column:approval_expiry_hours;default:0"` // 0 means payout requests never expire
+	ApprovalVeto         bool           `gorm:"column:approval_veto;default:false"`     // a single rejection rejects the request
+	RequireStepUp        bool           `gorm:"column:require_step_up;default:false"`   // sensitive actions need a fresh second-factor check
+	GracePeriodHours     int            `gorm:"column:grace_period_hours;default:0"`    // contributions this late after the deadline are not fined
+	LateFineKind         string         `gorm:"column:late_fine_kind;default:none"`     // none, flat, percent
+	LateFineAmount       float64        `gorm:"column:late_fine_amount;default:0"`      // XLM, or percent of the contribution, per day late
+	Type                 string         `gorm:"column:group_type;default:rotating"`     // rotating (merry-go-round) or asca (savings and loans)
+	LoanInterestRate     float64        `gorm:"column:loan_interest_rate;default:0"`    // percent of the principal per month
+	LoanMaxTermMonths    int            `gorm:"column:loan_max_term_months;default:12"`
+	LoanGuarantors       int            `gorm:"column:loan_guarantors;default:0"`   // members who must guarantee each loan
+	LoanMaxMultiple      float64        `gorm:"column:loan_max_multiple;default:0"` // largest loan as a multiple of the borrower's savings, 0 for no limit
+	SharePrice           float64        `gorm:"column:share_price;default:1"`       // XLM a share costs
+	CycleRounds          int            `gorm:"column:cycle_rounds;default:12"`     // rounds before the savings are shared out
+	Cycle                int            `gorm:"column:cycle;default:1"`
+	CycleStartRound      int            `gorm:"column:cycle_start_round;default:1"`         // first round of the current cycle
+	PayoutMode           string         `gorm:"column:payout_mode;default:fixed"`           // fixed (payout_order), auction or draw
+	AuctionDiscountTo    string         `gorm:"column:auction_discount_to;default:members"` // members or group
+	DrawCommitment       string         `gorm:"column:draw_commitment"`                     // SHA-256 of the draw secret, published on activation
+	DrawSecret           string         `gorm:"column:draw_secret" json:"-"`                // revealed once the order is drawn
+	DrawLedger           int32          `gorm:"column:draw_ledger;default:0"`               // the future ledger whose hash seeds the draw
+	DrawLedgerHash       string         `gorm:"column:draw_ledger_hash"`
+	DrawSeed             string         `gorm:"column:draw_seed"`           // SHA-256 of the secret and the ledger hash
+	DrawSize             int            `gorm:"column:draw_size;default:0"` // members in the first draw; later joiners follow them
+	DrawnAt              *time.Time     `gorm:"column:drawn_at"`
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
 }
 
 type Member struct {
 	ID       string `gorm:"primaryKey"`
-	GroupID  string
-	UserID   string
+	GroupID  string `gorm:"uniqueIndex:idx_members_group_user"`
+	UserID   string `gorm:"uniqueIndex:idx_members_group_user"`
 	User     User   `gorm:"foreignKey:UserID"`
 	Wallet   string
 	Role     string `gorm:"default:member"` // member, admin, creator
@@ -40,9 +71,9 @@ type Member struct {
 type GroupInvitation struct {
 	ID        string `gorm:"primaryKey"`
 	GroupID   string
-	Group     Group  `gorm:"foreignKey:GroupID"`
+	Group     Group `gorm:"foreignKey:GroupID"`
 	InviterID string
-	Inviter   User   `gorm:"foreignKey:InviterID"`
+	Inviter   User `gorm:"foreignKey:InviterID"`
 	Email     string
 	UserID    string // if user exists
 	User      User   `gorm:"foreignKey:UserID"`
@@ -54,9 +85,9 @@ type GroupInvitation struct {
 type AdminNomination struct {
 	ID          string `gorm:"primaryKey"`
 	GroupID     string
-	Group       Group  `gorm:"foreignKey:GroupID"`
+	Group       Group `gorm:"foreignKey:GroupID"`
 	NominatorID string
-	Nominator   User   `gorm:"foreignKey:NominatorID"`
+	Nominator   User `gorm:"foreignKey:NominatorID"`
 	NomineeID   string
 	Nominee     User   `gorm:"foreignKey:NomineeID"`
 	Status      string `gorm:"default:pending"` // pending, approved, rejected
@@ -64,32 +95,54 @@ type AdminNomination struct {
 }
 
 type PayoutRequest struct {
-	ID            string `gorm:"primaryKey"`
-	GroupID       string
-	Group         Group  `gorm:"foreignKey:GroupID"`
-	RecipientID   string
-	Recipient     User   `gorm:"foreignKey:RecipientID"`
-	Amount        float64
-	Round         int
-	Status        string `gorm:"default:pending"` // pending, approved, rejected, completed
-	Approvals     []PayoutApproval `gorm:"foreignKey:PayoutRequestID"`
-	CreatedAt     time.Time
+	ID           string `gorm:"primaryKey"`
+	GroupID      string
+	Group        Group `gorm:"foreignKey:GroupID"`
+	RecipientID  string
+	Recipient    User `gorm:"foreignKey:RecipientID"`
+	Amount       float64
+	Round        int
+	Status       string           `gorm:"default:pending"` // pending, approved (paying out), rejected, expired, completed, failed
+	Approvals    []PayoutApproval `gorm:"foreignKey:PayoutRequestID"`
+	EnvelopeXDR  string           `gorm:"column:envelope_xdr"` // unsigned multisig payout awaiting signatures
+	TxHash       string           `gorm:"column:tx_hash"`
+	SubmittedXDR string           `gorm:"column:submitted_xdr" json:"-"` // exact envelope sent, resent on retry
+	ExpiresAt    *time.Time       `gorm:"column:expires_at"`
+	LoanID       string           `gorm:"column:loan_id"`       // set when the payout disburses a loan
+	SettlementID string           `gorm:"column:settlement_id"` // set when the payout is a batch of a share-out, with no single recipient
+	Tally        *PayoutTally     `gorm:"-" json:"tally,omitempty"`
+	CreatedAt    time.Time
+}
+
+// PayoutTally is the state of the vote on a payout request under its group's approval policy
+type PayoutTally struct {
+	Policy             string     `json:"policy"`
+	Approvals          int        `json:"approvals"`
+	Rejections         int        `json:"rejections"`
+	Required           int        `json:"required"`
+	Eligible           int        `json:"eligible"`
+	Signatures         int        `json:"signatures"`
+	SignaturesRequired int        `json:"signatures_required"`
+	Veto               bool       `json:"veto"`
+	ExpiresAt          *time.Time `json:"expires_at,omitempty"`
+	Outcome            string     `json:"outcome"` // pending, approved, rejected, expired
 }
 
 type PayoutApproval struct {
-	ID              string `gorm:"primaryKey"`
-	PayoutRequestID string
+	ID              string        `gorm:"primaryKey"`
+	PayoutRequestID string        `gorm:"uniqueIndex:idx_payout_approvals_request_admin"`
 	PayoutRequest   PayoutRequest `gorm:"foreignKey:PayoutRequestID"`
-	AdminID         string
+	AdminID         string        `gorm:"uniqueIndex:idx_payout_approvals_request_admin"`
 	Admin           User          `gorm:"foreignKey:AdminID"`
 	Approved        bool
+	Signature       string `gorm:"column:signature"` // base64 decorated signature on the payout envelope
 	CreatedAt       time.Time
 }
 
 type Notification struct {
 	ID        string `gorm:"primaryKey"`
 	UserID    string
-	User      User   `gorm:"foreignKey:UserID"`
+	User      User `gorm:"foreignKey:UserID"`
 	GroupID   string
 	Group     Group  `gorm:"foreignKey:GroupID"`
 	Type      string // contribution_reminder, payout_approved, invitation, etc.
@@ -97,40 +150,66 @@ type Notification struct {
 	Data      string
 	Status    string
 	Message   string
-	Read      bool   `gorm:"default:false"`
+	Read      bool `gorm:"default:false"`
 	CreatedAt time.Time
 }
 
 type Contribution struct {
-	ID        string    `gorm:"primaryKey"`
+	ID        string `gorm:"primaryKey"`
 	GroupID   string
-	Group     Group     `gorm:"foreignKey:GroupID"`
+	Group     Group `gorm:"foreignKey:GroupID"`
 	UserID    string
-	User      User      `gorm:"foreignKey:UserID"`
+	User      User `gorm:"foreignKey:UserID"`
 	Amount    float64
 	Round     int
-	Status    string    `gorm:"default:pending"` // pending, confirmed, failed
-	TxHash    string    `gorm:"column:tx_hash"`
+	Status    string `gorm:"default:pending"` // awaiting_signature, pending, confirmed, failed
+	TxHash    string `gorm:"column:tx_hash"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
 type GroupSettings struct {
-	ContributionAmount float64  `json:"contribution_amount"`
-	ContributionPeriod int      `json:"contribution_period"`
-	PayoutOrder        []string `json:"payout_order"`
+	ContributionAmount float64         `json:"contribution_amount"`
+	ContributionPeriod int             `json:"contribution_period"`
+	PayoutOrder        []string        `json:"payout_order"`
+	PayoutThreshold    int             `json:"payout_threshold"`
+	SignerThreshold    int             `json:"signer_threshold"`
+	ApprovalPolicy     *ApprovalPolicy `json:"approval_policy,omitempty"`
+	LatePolicy         *LatePolicy     `json:"late_policy,omitempty"`
+	Type               string          `json:"type"` // rotating (default) or asca
+	LoanPolicy         *LoanPolicy     `json:"loan_policy,omitempty"`
+	SharePolicy        *SharePolicy    `json:"share_policy,omitempty"`
+	PayoutMode         string          `json:"payout_mode"` // fixed (default), auction or draw
+	AuctionPolicy      *AuctionPolicy  `json:"auction_policy,omitempty"`
+}
+
+// ApprovalPolicy decides how many votes a payout request needs
+type ApprovalPolicy struct {
+	Kind        string `json:"kind"`         // count, percent_admins, majority_members
+	Count       int    `json:"count"`        // approvals needed under count
+	Percent     int    `json:"percent"`      // percent of admins under percent_admins
+	ExpiryHours int    `json:"expiry_hours"` // 0 means requests never expire
+	Veto        bool   `json:"veto"`         // a single rejection rejects the request
+}
+
+// LatePolicy decides what a member is fined for contributing after a round's deadline
+type LatePolicy struct {
+	GraceHours int     `json:"grace_hours"` // hours after the deadline before a fine applies
+	Kind       string  `json:"kind"`        // none, flat, percent
+	Amount     float64 `json:"amount"`      // XLM per day under flat, percent of the contribution per day under percent
 }
 
 type PayoutSchedule struct {
-	ID        string    `gorm:"primaryKey"`
+	ID        string `gorm:"primaryKey"`
 	GroupID   string
-	Group     Group     `gorm:"foreignKey:GroupID"`
+	Group     Group `gorm:"foreignKey:GroupID"`
 	MemberID  string
-	Member    Member    `gorm:"foreignKey:MemberID"`
+	Member    Member `gorm:"foreignKey:MemberID"`
 	Round     int
 	Amount    float64
-	DueDate   time.Time `gorm:"column:due_date"`
-	Status    string    `gorm:"default:scheduled"` // scheduled, paid, pending
+	Discount  float64    `gorm:"default:0"` // taken off the pot by the winning bid in auction groups
+	DueDate   time.Time  `gorm:"column:due_date"`
+	Status    string     `gorm:"default:scheduled"` // scheduled, pending, paid, failed
 	PaidAt    *time.Time `gorm:"column:paid_at"`
 	TxHash    string     `gorm:"column:tx_hash"`
 	CreatedAt time.Time
@@ -138,30 +217,34 @@ type PayoutSchedule struct {
 }
 
 type RoundContribution struct {
-	ID        string    `gorm:"primaryKey"`
-	GroupID   string
-	Group     Group     `gorm:"foreignKey:GroupID"`
-	MemberID  string
-	Member    Member    `gorm:"foreignKey:MemberID"`
-	Round     int
-	Amount    float64
-	Status    string    `gorm:"default:pending"` // pending, confirmed, failed
-	TxHash    string    `gorm:"column:tx_hash"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID           string `gorm:"primaryKey"`
+	GroupID      string `gorm:"uniqueIndex:idx_round_contributions_member_round"`
+	Group        Group  `gorm:"foreignKey:GroupID"`
+	MemberID     string `gorm:"uniqueIndex:idx_round_contributions_member_round"`
+	Member       Member `gorm:"foreignKey:MemberID"`
+	Round        int    `gorm:"uniqueIndex:idx_round_contributions_member_round"`
+	Amount       float64
+	Status       string  `gorm:"default:pending"` // awaiting_signature, pending, confirmed, failed
+	TxHash       string  `gorm:"column:tx_hash"`
+	Memo         string  `gorm:"column:memo"`                   // memo the signed payment must carry
+	Shares       float64 `gorm:"column:shares;default:0"`       // bought in savings and credit groups once confirmed
+	SubmittedXDR string  `gorm:"column:submitted_xdr" json:"-"` // exact envelope sent, resent on retry
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
 }
 
 type RoundStatus struct {
-	ID                string    `gorm:"primaryKey"`
+	ID                string `gorm:"primaryKey"`
 	GroupID           string
-	Group             Group     `gorm:"foreignKey:GroupID"`
+	Group             Group `gorm:"foreignKey:GroupID"`
 	Round             int
 	TotalRequired     float64   `gorm:"column:total_required"`
 	TotalReceived     float64   `gorm:"column:total_received"`
 	ContributorsCount int       `gorm:"column:contributors_count"`
 	RequiredCount     int       `gorm:"column:required_count"`
-	Status            string    `gorm:"default:collecting"` // collecting, ready_for_payout, completed
+	Status            string    `gorm:"default:collecting"` // collecting, ready_for_payout, closed, completed
 	PayoutAuthorized  bool      `gorm:"column:payout_authorized;default:false"`
+	Deadline          time.Time `gorm:"column:deadline"` // contributions close at this time
 	CreatedAt         time.Time
 	UpdatedAt         time.Time
 }
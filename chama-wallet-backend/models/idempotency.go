@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// IdempotencyKey records a client's Idempotency-Key so a retried request gets the
+// original response instead of being processed again
+type IdempotencyKey struct {
+	ID             string `gorm:"primaryKey"`
+	UserID         string `gorm:"column:user_id;uniqueIndex:idx_idempotency_user_key"`
+	Key            string `gorm:"column:key;uniqueIndex:idx_idempotency_user_key"`
+	Method         string
+	Path           string
+	RequestHash    string `gorm:"column:request_hash"`
+	Status         string `gorm:"default:processing"` // processing, completed
+	ResponseStatus int    `gorm:"column:response_status"`
+	ResponseBody   []byte `gorm:"column:response_body"`
+	CreatedAt      time.Time
+	ExpiresAt      time.Time `gorm:"column:expires_at;index"`
+}
@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// LoanPolicy sets the terms members of a savings and credit group borrow on
+type LoanPolicy struct {
+	InterestRate  float64 `json:"interest_rate"`   // flat percent of the principal per month
+	MaxTermMonths int     `json:"max_term_months"` // longest repayment term
+	Guarantors    int     `json:"guarantors"`      // members who must guarantee each loan
+	MaxMultiple   float64 `json:"max_multiple"`    // largest loan as a multiple of the borrower's savings, 0 for no limit
+}
+
+// Loan is money lent to a member from a savings and credit group's pooled savings. It is
+// disbursed by a payout request voted on like any other, then repaid in monthly
+// installments.
+type Loan struct {
+	ID              string `gorm:"primaryKey"`
+	GroupID         string `gorm:"index"`
+	MemberID        string `gorm:"index"`
+	Member          Member `gorm:"foreignKey:MemberID"`
+	Principal       float64
+	InterestRate    float64 `gorm:"column:interest_rate"` // percent of the principal per month
+	TermMonths      int     `gorm:"column:term_months"`
+	TotalDue        float64 `gorm:"column:total_due"` // principal plus interest
+	AmountRepaid    float64 `gorm:"column:amount_repaid;default:0"`
+	Purpose         string
+	Status          string            `gorm:"default:pending"`          // pending (guarantors), approving, active, repaid, declined, rejected, expired, failed
+	PayoutRequestID string            `gorm:"column:payout_request_id"` // the disbursement the admins vote on
+	TxHash          string            `gorm:"column:tx_hash"`           // disbursement transaction
+	DisbursedAt     *time.Time        `gorm:"column:disbursed_at"`
+	Guarantors      []LoanGuarantor   `gorm:"foreignKey:LoanID"`
+	Installments    []LoanInstallment `gorm:"foreignKey:LoanID"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// LoanGuarantor is a member asked to stand behind a loan
+type LoanGuarantor struct {
+	ID          string     `gorm:"primaryKey"`
+	LoanID      string     `gorm:"uniqueIndex:idx_loan_guarantors_loan_member"`
+	MemberID    string     `gorm:"uniqueIndex:idx_loan_guarantors_loan_member"`
+	Member      Member     `gorm:"foreignKey:MemberID"`
+	Status      string     `gorm:"default:pending"` // pending, accepted, declined
+	RespondedAt *time.Time `gorm:"column:responded_at"`
+	CreatedAt   time.Time
+}
+
+// LoanInstallment is one scheduled repayment of a loan
+type LoanInstallment struct {
+	ID         string    `gorm:"primaryKey"`
+	LoanID     string    `gorm:"uniqueIndex:idx_loan_installments_loan_number"`
+	Number     int       `gorm:"uniqueIndex:idx_loan_installments_loan_number"`
+	DueDate    time.Time `gorm:"column:due_date"`
+	Principal  float64
+	Interest   float64
+	Amount     float64    // principal plus interest
+	AmountPaid float64    `gorm:"column:amount_paid;default:0"`
+	Status     string     `gorm:"default:due"` // due, paid
+	PaidAt     *time.Time `gorm:"column:paid_at"`
+}
+
+// LoanRepayment is a payment made towards a loan
+type LoanRepayment struct {
+	ID           string `gorm:"primaryKey"`
+	LoanID       string `gorm:"index"`
+	GroupID      string
+	MemberID     string
+	Amount       float64
+	Status       string `gorm:"default:awaiting_signature"` // awaiting_signature, pending, confirmed
+	TxHash       string `gorm:"column:tx_hash;index"`
+	Memo         string `gorm:"column:memo;index"`             // memo the payment must carry
+	SubmittedXDR string `gorm:"column:submitted_xdr" json:"-"` // exact envelope sent, resent on retry
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
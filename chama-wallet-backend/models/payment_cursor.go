@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// PaymentCursor is the Horizon paging token up to which an account's payments
+// have been ingested
+type PaymentCursor struct {
+	Account   string `gorm:"primaryKey"`
+	Cursor    string
+	UpdatedAt time.Time
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Penalty is a fine a member owes their group for a late round contribution. A member
+// with an outstanding fine is not paid out until it is paid or waived.
+type Penalty struct {
+	ID             string `gorm:"primaryKey"`
+	GroupID        string `gorm:"uniqueIndex:idx_penalties_member_round"`
+	MemberID       string `gorm:"uniqueIndex:idx_penalties_member_round"`
+	Member         Member `gorm:"foreignKey:MemberID"`
+	Round          int    `gorm:"uniqueIndex:idx_penalties_member_round"`
+	ContributionID string `gorm:"column:contribution_id"` // the late round contribution
+	Amount         float64
+	DaysLate       int        `gorm:"column:days_late"`
+	Status         string     `gorm:"default:owed"` // owed, pending, paid, waived
+	TxHash         string     `gorm:"column:tx_hash;index"`
+	Memo           string     `gorm:"column:memo;index"`             // memo the payment must carry
+	SubmittedXDR   string     `gorm:"column:submitted_xdr" json:"-"` // exact envelope sent, resent on retry
+	PaidAt         *time.Time `gorm:"column:paid_at"`
+	WaivedBy       string     `gorm:"column:waived_by"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
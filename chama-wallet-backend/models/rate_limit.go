@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// RateLimitBucket is a token bucket shared by the server replicas
+type RateLimitBucket struct {
+	Key       string    `gorm:"column:bucket_key;primaryKey"`
+	Tokens    float64   `gorm:"column:tokens"`
+	UpdatedAt time.Time `gorm:"column:updated_at;index"`
+}
+
+// LoginThrottle counts an account's failed sign-ins and how long it is locked out for.
+// It is keyed by the email tried, whether or not an account uses it, so a lockout does
+// not reveal which addresses are registered.
+type LoginThrottle struct {
+	Email       string     `gorm:"primaryKey"`
+	Failures    int        `gorm:"column:failures"`
+	LockedUntil *time.Time `gorm:"column:locked_until"`
+	UpdatedAt   time.Time  `gorm:"column:updated_at;index"`
+}
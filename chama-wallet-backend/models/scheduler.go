@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// ScheduledJob holds the run state of a background job. The lock columns form a
+// lease so only one server replica runs a job at a time.
+type ScheduledJob struct {
+	Name        string     `gorm:"primaryKey" json:"name"`
+	Schedule    string     `json:"schedule"`
+	NextRunAt   time.Time  `gorm:"column:next_run_at;index" json:"next_run_at"`
+	LastRunAt   *time.Time `gorm:"column:last_run_at" json:"last_run_at,omitempty"`
+	LastStatus  string     `gorm:"column:last_status" json:"last_status"` // succeeded, failed
+	LastError   string     `gorm:"column:last_error" json:"last_error,omitempty"`
+	LastRunMs   int64      `gorm:"column:last_run_ms" json:"last_run_ms"`
+	LockedBy    string     `gorm:"column:locked_by" json:"locked_by,omitempty"`
+	LockedUntil *time.Time `gorm:"column:locked_until" json:"locked_until,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
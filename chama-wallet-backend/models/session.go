@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Session is a signed-in device. It holds the hash of the device's current refresh token,
+// which is replaced every time the token is used.
+type Session struct {
+	ID                  string     `gorm:"primaryKey" json:"id"`
+	UserID              string     `gorm:"column:user_id;index" json:"-"`
+	RefreshTokenHash    string     `gorm:"column:refresh_token_hash;uniqueIndex" json:"-"`
+	PreviousRefreshHash string     `gorm:"column:previous_refresh_hash;index" json:"-"` // the token replaced last, kept to detect reuse
+	UserAgent           string     `gorm:"column:user_agent" json:"user_agent"`
+	IP                  string     `gorm:"column:ip" json:"ip"`
+	CreatedAt           time.Time  `json:"created_at"`
+	LastUsedAt          time.Time  `gorm:"column:last_used_at" json:"last_used_at"`
+	ExpiresAt           time.Time  `gorm:"column:expires_at;index" json:"expires_at"`
+	RevokedAt           *time.Time `gorm:"column:revoked_at" json:"revoked_at,omitempty"`
+	StepUpAt            *time.Time `gorm:"column:step_up_at" json:"step_up_at,omitempty"` // last second-factor check
+	Current             bool       `gorm:"-" json:"current"`                              // the session making the request
+}
+
+// ClientInfo identifies the device a request comes from
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// SharePolicy sets what a share costs in a savings and credit group and how many rounds a
+// cycle runs before its savings and profit are shared out
+type SharePolicy struct {
+	SharePrice  float64 `json:"share_price"`  // XLM per share
+	CycleRounds int     `json:"cycle_rounds"` // contribution rounds in a cycle
+}
+
+// ProfitEntry is income a savings and credit group earned for its members: the interest
+// part of a loan repayment or a paid late fine. It is shared out with the cycle's
+// settlement.
+type ProfitEntry struct {
+	ID           string `gorm:"primaryKey"`
+	GroupID      string `gorm:"index"`
+	Source       string `gorm:"uniqueIndex:idx_profit_entries_source"` // loan_interest, fine
+	SourceID     string `gorm:"uniqueIndex:idx_profit_entries_source"` // the loan repayment or penalty
+	Amount       float64
+	SettlementID string `gorm:"column:settlement_id;index"` // empty until shared out
+	CreatedAt    time.Time
+}
+
+// Settlement is the end-of-cycle share-out of a savings and credit group: each member's
+// part of the cycle's savings and profit, in proportion to their shares. It is paid in
+// batches, each a payout request voted on like any other.
+type Settlement struct {
+	ID          string `gorm:"primaryKey"`
+	GroupID     string `gorm:"index"`
+	Cycle       int
+	FromRound   int                `gorm:"column:from_round"`
+	ToRound     int                `gorm:"column:to_round"`
+	TotalShares float64            `gorm:"column:total_shares"`
+	Savings     float64            // the cycle's confirmed contributions
+	Profit      float64            // loan interest and fines
+	Total       float64            // what is paid out, savings plus profit less rounding
+	Status      string             `gorm:"default:approving"` // approving, completed, incomplete (a batch failed after others were paid), rejected, expired, failed
+	Payouts     []SettlementPayout `gorm:"foreignKey:SettlementID"`
+	CompletedAt *time.Time         `gorm:"column:completed_at"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// SettlementPayout is one member's share-out in a settlement
+type SettlementPayout struct {
+	ID              string `gorm:"primaryKey"`
+	SettlementID    string `gorm:"index"`
+	MemberID        string
+	Member          Member `gorm:"foreignKey:MemberID"`
+	Wallet          string
+	Shares          float64
+	Contributed     float64 // the member's savings this cycle
+	Amount          float64
+	Batch           int
+	PayoutRequestID string `gorm:"column:payout_request_id;index"` // the batch payment
+	Status          string `gorm:"default:scheduled"`              // scheduled, paid
+	TxHash          string `gorm:"column:tx_hash"`
+}
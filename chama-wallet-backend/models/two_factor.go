@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// RecoveryCode is a one-time code that stands in for a TOTP code when the user has lost
+// their authenticator. Only its hash is stored.
+type RecoveryCode struct {
+	ID        string     `gorm:"primaryKey" json:"-"`
+	UserID    string     `gorm:"column:user_id;index" json:"-"`
+	CodeHash  string     `gorm:"column:code_hash" json:"-"`
+	UsedAt    *time.Time `gorm:"column:used_at" json:"-"`
+	CreatedAt time.Time  `json:"-"`
+}
@@ -5,14 +5,18 @@ import (
 )
 
 type User struct {
-	ID        string    `gorm:"primaryKey" json:"id"`
-	Email     string    `gorm:"unique;not null" json:"email"`
-	Name      string    `gorm:"not null" json:"name"`
-	Password  string    `gorm:"not null" json:"-"` // Don't include in JSON responses
-	Wallet    string    `json:"wallet"`
-	SecretKey string    `json:"secret_key,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              string     `gorm:"primaryKey" json:"id"`
+	Email           string     `gorm:"unique;not null" json:"email"`
+	Name            string     `gorm:"not null" json:"name"`
+	Password        string     `gorm:"not null" json:"-"` // Don't include in JSON responses
+	Wallet          string     `json:"wallet"`
+	SecretKey       string     `json:"-"` // sealed by the keystore, never serialized
+	EmailVerifiedAt *time.Time `gorm:"column:email_verified_at" json:"email_verified_at"`
+	TOTPSecret      string     `gorm:"column:totp_secret" json:"-"`                   // sealed by the keystore
+	TOTPEnabledAt   *time.Time `gorm:"column:totp_enabled_at" json:"totp_enabled_at"` // nil until enrolment is confirmed
+	TOTPLastStep    int64      `gorm:"column:totp_last_step;default:0" json:"-"`      // last accepted time step, so a code works once
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
 type LoginRequest struct {
@@ -27,6 +31,13 @@ type RegisterRequest struct {
 }
 
 type AuthResponse struct {
-	User  User   `json:"user"`
-	Token string `json:"token"`
+	User         User      `json:"user"`
+	Token        string    `json:"token"` // short-lived access token
+	ExpiresAt    time.Time `json:"expires_at"`
+	RefreshToken string    `json:"refresh_token"`
+	SessionID    string    `json:"session_id"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
@@ -0,0 +1,116 @@
+// Package policy decides which group members may take which actions. Routes declare the
+// action they perform and middleware.Authorize checks it here, so the rules live in one
+// table instead of in each handler.
+package policy
+
+import "chama-wallet-backend/models"
+
+// Member roles
+const (
+	RoleCreator   = "creator"
+	RoleAdmin     = "admin"
+	RoleTreasurer = "treasurer" // raises payout requests and follows the group's money
+	RoleSecretary = "secretary" // handles invitations and membership
+	RoleMember    = "member"
+)
+
+// Action is something a member does in a group
+type Action string
+
+// Group actions
+const (
+	ViewGroup      Action = "view_group"      // payout requests and schedule
+	ViewBalances   Action = "view_balances"   // the treasury balance and round contributions
+	Contribute     Action = "contribute"      // pay into the group and its rounds
+	Borrow         Action = "borrow"          // apply for loans, repay them and guarantee other members'
+	Bid            Action = "bid"             // bid for a round's pot in an auction group
+	NominateAdmin  Action = "nominate_admin"  // propose a member as admin
+	Invite         Action = "invite"          // invite users and list who can be invited
+	ApproveMember  Action = "approve_member"  // accept or reject join requests
+	AssignRole     Action = "assign_role"     // make members treasurer or secretary
+	ManageSettings Action = "manage_settings" // approval, late fine and security settings
+	WaiveFine      Action = "waive_fine"      // cancel a member's late fine
+	ApproveGroup   Action = "approve_group"   // mark the group ready for activation
+	ActivateGroup  Action = "activate_group"  // start the contribution rounds
+	CreatePayout   Action = "create_payout"   // raise a payout request
+	RunAuction     Action = "run_auction"     // open and close payout auctions
+	RunDraw        Action = "run_draw"        // make the payout order draw once its ledger closes
+	ApprovePayout  Action = "approve_payout"  // vote on a payout request
+	AuthorizeRound Action = "authorize_round" // authorize a funded round's payout
+	ViewSecret     Action = "view_secret"     // export the treasury's secret key
+	ViewAudit      Action = "view_audit"      // read and export the audit log
+)
+
+// AdminRoles are the roles that administer a group and sign for its treasury
+var AdminRoles = []string{RoleCreator, RoleAdmin}
+
+// AssignableRoles are the roles AssignRole can give or take away. Admins are made by
+// nomination because they also become treasury signers.
+var AssignableRoles = []string{RoleTreasurer, RoleSecretary, RoleMember}
+
+var (
+	everyone = []string{RoleCreator, RoleAdmin, RoleTreasurer, RoleSecretary, RoleMember}
+
+	grants = map[Action][]string{
+		ViewGroup:      everyone,
+		ViewBalances:   everyone,
+		Contribute:     everyone,
+		Borrow:         everyone,
+		Bid:            everyone,
+		NominateAdmin:  everyone,
+		Invite:         {RoleCreator, RoleAdmin, RoleSecretary},
+		ApproveMember:  {RoleCreator, RoleAdmin, RoleSecretary},
+		AssignRole:     AdminRoles,
+		ManageSettings: AdminRoles,
+		WaiveFine:      {RoleCreator, RoleAdmin, RoleTreasurer},
+		ApproveGroup:   {RoleCreator},
+		ActivateGroup:  AdminRoles,
+		CreatePayout:   {RoleCreator, RoleAdmin, RoleTreasurer},
+		RunAuction:     {RoleCreator, RoleAdmin, RoleTreasurer},
+		RunDraw:        {RoleCreator, RoleAdmin, RoleTreasurer},
+		ApprovePayout:  AdminRoles,
+		AuthorizeRound: AdminRoles,
+		ViewSecret:     AdminRoles,
+		ViewAudit:      {RoleCreator, RoleAdmin, RoleTreasurer, RoleSecretary},
+	}
+)
+
+// majorityMembers is the approval policy under which every member votes on payouts
+const majorityMembers = "majority_members"
+
+// Allows reports whether the member may take the action in the group. Only approved
+// members act; under the majority_members approval policy every member votes on payouts.
+func Allows(group models.Group, member models.Member, action Action) bool {
+	if member.Status != "approved" || member.GroupID != group.ID {
+		return false
+	}
+	if (action == ApprovePayout || action == AuthorizeRound) && group.ApprovalPolicy == majorityMembers {
+		return true
+	}
+	return HasRole(member.Role, action)
+}
+
+// HasRole reports whether the role is granted the action, whatever the group's settings
+func HasRole(role string, action Action) bool {
+	for _, granted := range grants[action] {
+		if granted == role {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdmin reports whether the role administers the group
+func IsAdmin(role string) bool {
+	return role == RoleCreator || role == RoleAdmin
+}
+
+// Assignable reports whether AssignRole may set a member to the role
+func Assignable(role string) bool {
+	for _, assignable := range AssignableRoles {
+		if assignable == role {
+			return true
+		}
+	}
+	return false
+}
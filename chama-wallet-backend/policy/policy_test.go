@@ -0,0 +1,83 @@
+package policy_test
+
+import (
+	"testing"
+
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/policy"
+)
+
+func TestAllowsMatrix(t *testing.T) {
+	group := models.Group{ID: "group", ApprovalPolicy: "count"}
+
+	tests := []struct {
+		action                 policy.Action
+		member, admin, creator bool
+		treasurer, secretary   bool
+	}{
+		{policy.ViewGroup, true, true, true, true, true},
+		{policy.ViewBalances, true, true, true, true, true},
+		{policy.Contribute, true, true, true, true, true},
+		{policy.Borrow, true, true, true, true, true},
+		{policy.Bid, true, true, true, true, true},
+		{policy.NominateAdmin, true, true, true, true, true},
+		{policy.Invite, false, true, true, false, true},
+		{policy.ApproveMember, false, true, true, false, true},
+		{policy.AssignRole, false, true, true, false, false},
+		{policy.ManageSettings, false, true, true, false, false},
+		{policy.WaiveFine, false, true, true, true, false},
+		{policy.ApproveGroup, false, false, true, false, false},
+		{policy.ActivateGroup, false, true, true, false, false},
+		{policy.CreatePayout, false, true, true, true, false},
+		{policy.RunAuction, false, true, true, true, false},
+		{policy.RunDraw, false, true, true, true, false},
+		{policy.ApprovePayout, false, true, true, false, false},
+		{policy.AuthorizeRound, false, true, true, false, false},
+		{policy.ViewSecret, false, true, true, false, false},
+		{policy.ViewAudit, false, true, true, true, true},
+	}
+	for _, tt := range tests {
+		for role, want := range map[string]bool{
+			policy.RoleMember:    tt.member,
+			policy.RoleAdmin:     tt.admin,
+			policy.RoleCreator:   tt.creator,
+			policy.RoleTreasurer: tt.treasurer,
+			policy.RoleSecretary: tt.secretary,
+		} {
+			member := models.Member{GroupID: group.ID, Role: role, Status: "approved"}
+			if got := policy.Allows(group, member, tt.action); got != want {
+				t.Errorf("%s may %s: %v, want %v", role, tt.action, got, want)
+			}
+		}
+	}
+}
+
+func TestAllowsChecksMembership(t *testing.T) {
+	group := models.Group{ID: "group"}
+	creator := models.Member{GroupID: group.ID, Role: policy.RoleCreator, Status: "approved"}
+
+	pending := creator
+	pending.Status = "pending"
+	if policy.Allows(group, pending, policy.ViewGroup) {
+		t.Error("a pending member may act")
+	}
+	elsewhere := creator
+	elsewhere.GroupID = "other"
+	if policy.Allows(group, elsewhere, policy.ViewGroup) {
+		t.Error("a member of another group may act")
+	}
+}
+
+func TestMajorityMembersVoteOnPayouts(t *testing.T) {
+	group := models.Group{ID: "group", ApprovalPolicy: "majority_members"}
+	member := models.Member{GroupID: group.ID, Role: policy.RoleMember, Status: "approved"}
+
+	for _, action := range []policy.Action{policy.ApprovePayout, policy.AuthorizeRound} {
+		if !policy.Allows(group, member, action) {
+			t.Errorf("member may not %s under majority_members", action)
+		}
+	}
+	if policy.Allows(group, member, policy.ViewSecret) {
+		t.Error("majority_members lets members view the secret")
+	}
+}
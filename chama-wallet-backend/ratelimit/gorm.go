@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+)
+
+// Gorm keeps buckets in the database so every replica draws from the same ones
+type Gorm struct {
+	db *gorm.DB
+}
+
+// NewGorm returns a store on the rate_limit_buckets table
+func NewGorm(db *gorm.DB) Gorm {
+	return Gorm{db: db}
+}
+
+func (s Gorm) Take(ctx context.Context, key string, rate Rate) (Result, error) {
+	var result Result
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		// A key seen for the first time starts with a full bucket
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.RateLimitBucket{Key: key, Tokens: float64(rate.Limit), UpdatedAt: now}).Error
+		if err != nil {
+			return err
+		}
+
+		var bucket models.RateLimitBucket
+		if err := database.ForUpdate(tx).First(&bucket, "bucket_key = ?", key).Error; err != nil {
+			return err
+		}
+
+		var tokens float64
+		tokens, result = take(refill(bucket.Tokens, bucket.UpdatedAt, now, rate), rate)
+		return tx.Model(&models.RateLimitBucket{}).Where("bucket_key = ?", key).
+			Updates(map[string]interface{}{"tokens": tokens, "updated_at": now}).Error
+	})
+	return result, err
+}
+
+func (s Gorm) PurgeIdle(ctx context.Context, cutoff time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Where("updated_at < ?", cutoff).Delete(&models.RateLimitBucket{})
+	return result.RowsAffected, result.Error
+}
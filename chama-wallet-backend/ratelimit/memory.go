@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepEvery is how many takes pass between sweeps of full buckets
+const sweepEvery = 10000
+
+// Memory keeps buckets in the process. Each replica limits on its own.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	takes   int
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	period  time.Duration
+}
+
+// NewMemory returns an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*memoryBucket{}}
+}
+
+func (m *Memory) Take(_ context.Context, key string, rate Rate) (Result, error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.takes++
+	if m.takes%sweepEvery == 0 {
+		m.sweep(now)
+	}
+
+	bucket, ok := m.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: float64(rate.Limit), updated: now}
+		m.buckets[key] = bucket
+	}
+
+	var result Result
+	bucket.tokens, result = take(refill(bucket.tokens, bucket.updated, now, rate), rate)
+	bucket.updated = now
+	bucket.period = rate.Period
+	return result, nil
+}
+
+func (m *Memory) PurgeIdle(_ context.Context, cutoff time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged int64
+	for key, bucket := range m.buckets {
+		if bucket.updated.Before(cutoff) {
+			delete(m.buckets, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// sweep drops buckets that have had a whole period to refill
+func (m *Memory) sweep(now time.Time) {
+	for key, bucket := range m.buckets {
+		if now.Sub(bucket.updated) >= bucket.period {
+			delete(m.buckets, key)
+		}
+	}
+}
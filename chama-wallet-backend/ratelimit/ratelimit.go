@@ -0,0 +1,145 @@
+// Package ratelimit throttles requests with token buckets. Each bucket holds up to a
+// rate's limit of tokens, refills continuously over its period and gives one token per
+// request. Buckets live in memory, or in the database so replicas share them.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Rate allows Limit requests per Period, in a burst or spread out
+type Rate struct {
+	Limit  int
+	Period time.Duration
+}
+
+// ParseRate reads a rate written as limit/period, e.g. "10/1m"
+func ParseRate(value string) (Rate, error) {
+	limit, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("rate %q must look like 10/1m", value)
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n <= 0 {
+		return Rate{}, fmt.Errorf("rate %q: limit must be a positive number", value)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Rate{}, fmt.Errorf("rate %q: period must be a positive duration", value)
+	}
+	return Rate{Limit: n, Period: d}, nil
+}
+
+func (r Rate) String() string {
+	return fmt.Sprintf("%d/%s", r.Limit, r.Period)
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration // until a token is available, when not allowed
+}
+
+// Store keeps the buckets
+type Store interface {
+	// Take removes a token from the key's bucket if it has one
+	Take(ctx context.Context, key string, rate Rate) (Result, error)
+	// PurgeIdle drops buckets untouched since the cutoff; they would be full again anyway
+	PurgeIdle(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// Class groups routes that share a limit
+type Class string
+
+// Route classes
+const (
+	Auth   Class = "auth"   // sign in, sign up and account recovery, per IP
+	Faucet Class = "faucet" // wallet creation and friendbot funding, per IP
+	API    Class = "api"    // every request, per IP and per signed-in user
+)
+
+// Rates are the limits for each class, set by Init
+var Rates = map[Class]Rate{
+	Auth:   {Limit: 10, Period: time.Minute},
+	Faucet: {Limit: 5, Period: time.Hour},
+	API:    {Limit: 300, Period: time.Minute},
+}
+
+// Default is the store the rate limiting middleware uses. Requests are not limited
+// while it is nil.
+var Default Store
+
+// Init sets up the default store from RATE_LIMIT_STORE ("memory" or "database") and
+// the class limits from RATE_LIMIT_AUTH, RATE_LIMIT_FAUCET and RATE_LIMIT_API. Use the
+// database store when several replicas serve the API.
+func Init(db *gorm.DB) error {
+	for class, env := range map[Class]string{Auth: "RATE_LIMIT_AUTH", Faucet: "RATE_LIMIT_FAUCET", API: "RATE_LIMIT_API"} {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		rate, err := ParseRate(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", env, err)
+		}
+		Rates[class] = rate
+	}
+
+	switch kind := os.Getenv("RATE_LIMIT_STORE"); kind {
+	case "", "memory":
+		Default = NewMemory()
+	case "database":
+		Default = NewGorm(db)
+	default:
+		return fmt.Errorf("unsupported RATE_LIMIT_STORE %q", kind)
+	}
+
+	slog.Info("rate limits configured",
+		"auth", Rates[Auth].String(), "faucet", Rates[Faucet].String(), "api", Rates[API].String())
+	return nil
+}
+
+// PurgeIdleBuckets drops the default store's buckets that have refilled completely
+func PurgeIdleBuckets(ctx context.Context) error {
+	if Default == nil {
+		return nil
+	}
+	var longest time.Duration
+	for _, rate := range Rates {
+		if rate.Period > longest {
+			longest = rate.Period
+		}
+	}
+	purged, err := Default.PurgeIdle(ctx, time.Now().Add(-longest))
+	if purged > 0 {
+		slog.InfoContext(ctx, "purged idle rate limit buckets", "count", purged)
+	}
+	return err
+}
+
+// refill adds the tokens earned since the bucket was last updated
+func refill(tokens float64, updated, now time.Time, rate Rate) float64 {
+	tokens += now.Sub(updated).Seconds() * float64(rate.Limit) / rate.Period.Seconds()
+	if tokens > float64(rate.Limit) {
+		tokens = float64(rate.Limit)
+	}
+	return tokens
+}
+
+// take spends a token if there is one and returns what is left
+func take(tokens float64, rate Rate) (float64, Result) {
+	if tokens >= 1 {
+		return tokens - 1, Result{Allowed: true, Remaining: int(tokens - 1)}
+	}
+	perToken := rate.Period.Seconds() / float64(rate.Limit)
+	return tokens, Result{RetryAfter: time.Duration((1 - tokens) * perToken * float64(time.Second))}
+}
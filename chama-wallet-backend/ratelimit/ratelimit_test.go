@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+)
+
+func TestRefillAndTake(t *testing.T) {
+	rate := Rate{Limit: 4, Period: time.Second}
+	start := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name      string
+		tokens    float64
+		elapsed   time.Duration
+		allowed   bool
+		remaining int
+		retry     time.Duration
+	}{
+		{"full bucket", 4, 0, true, 3, 0},
+		{"last token", 1, 0, true, 0, 0},
+		{"empty bucket", 0, 0, false, 0, 250 * time.Millisecond},
+		{"half a token", 0, 125 * time.Millisecond, false, 0, 125 * time.Millisecond},
+		{"refilled a token", 0, 250 * time.Millisecond, true, 0, 0},
+		{"refill stops at the limit", 2, time.Hour, true, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, result := take(refill(tt.tokens, start, start.Add(tt.elapsed), rate), rate)
+			if result.Allowed != tt.allowed || result.Remaining != tt.remaining || result.RetryAfter != tt.retry {
+				t.Errorf("result %+v, want allowed %v, remaining %d, retry after %s", result, tt.allowed, tt.remaining, tt.retry)
+			}
+		})
+	}
+}
+
+func TestStoresLimitAndRefill(t *testing.T) {
+	db, err := database.Open("sqlite", fmt.Sprintf("file:ratelimit-%s?mode=memory&cache=shared", uuid.NewString()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.RateLimitBucket{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	stores := map[string]Store{"memory": NewMemory(), "database": NewGorm(db)}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			rate := Rate{Limit: 2, Period: 200 * time.Millisecond}
+
+			for i := 0; i < rate.Limit; i++ {
+				if result, err := store.Take(ctx, "ip:a", rate); err != nil || !result.Allowed {
+					t.Fatalf("take %d: %+v, %v", i, result, err)
+				}
+			}
+			result, err := store.Take(ctx, "ip:a", rate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Allowed || result.RetryAfter <= 0 || result.RetryAfter > 100*time.Millisecond {
+				t.Fatalf("take over the limit: %+v, want refused for up to 100ms", result)
+			}
+
+			// Buckets are per key
+			if result, _ := store.Take(ctx, "ip:b", rate); !result.Allowed {
+				t.Error("another key was limited")
+			}
+
+			time.Sleep(result.RetryAfter + 10*time.Millisecond)
+			if result, _ := store.Take(ctx, "ip:a", rate); !result.Allowed {
+				t.Errorf("take after the refill: %+v, want allowed", result)
+			}
+		})
+	}
+}
@@ -0,0 +1,583 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chama-wallet-backend/models"
+)
+
+// NewGorm returns a store backed by a GORM connection. The same code serves Postgres in
+// production and SQLite in tests.
+func NewGorm(db *gorm.DB) *Store {
+	return &Store{
+		Users:         gormUsers{db},
+		Sessions:      gormSessions{db},
+		Groups:        gormGroups{db},
+		Members:       gormMembers{db},
+		Contributions: gormContributions{db},
+		Payouts:       gormPayouts{db},
+		Penalties:     gormPenalties{db},
+		Loans:         gormLoans{db},
+		Settlements:   gormSettlements{db},
+		Auctions:      gormAuctions{db},
+		Notifications: gormNotifications{db},
+	}
+}
+
+// Init sets the default store to one backed by db
+func Init(db *gorm.DB) {
+	Default = NewGorm(db)
+}
+
+// translate maps GORM errors onto the repository's own
+func translate(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return ErrDuplicate
+	}
+	return err
+}
+
+type gormUsers struct{ db *gorm.DB }
+
+func (r gormUsers) ByID(id string) (models.User, error) {
+	var user models.User
+	err := r.db.Where("id = ?", id).First(&user).Error
+	return user, translate(err)
+}
+
+func (r gormUsers) ByEmail(email string) (models.User, error) {
+	var user models.User
+	err := r.db.Where("email = ?", email).First(&user).Error
+	return user, translate(err)
+}
+
+func (r gormUsers) Create(user *models.User) error {
+	return translate(r.db.Create(user).Error)
+}
+
+func (r gormUsers) Save(user *models.User) error {
+	return translate(r.db.Save(user).Error)
+}
+
+func (r gormUsers) NotInGroup(groupID string) ([]models.User, error) {
+	var users []models.User
+	err := r.db.Where("id NOT IN (SELECT user_id FROM members WHERE group_id = ?)", groupID).
+		Find(&users).Error
+	return users, err
+}
+
+func (r gormUsers) AdvanceTOTPStep(userID string, step int64) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", userID, step).
+		Update("totp_last_step", step)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r gormUsers) ReplaceRecoveryCodes(userID string, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(codeHashes) == 0 {
+			return nil
+		}
+		now := time.Now()
+		codes := make([]models.RecoveryCode, len(codeHashes))
+		for i, hash := range codeHashes {
+			codes[i] = models.RecoveryCode{ID: uuid.NewString(), UserID: userID, CodeHash: hash, CreatedAt: now}
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+func (r gormUsers) UseRecoveryCode(userID, codeHash string) (bool, error) {
+	result := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r gormUsers) CountRecoveryCodes(userID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+type gormSessions struct{ db *gorm.DB }
+
+func (r gormSessions) Create(session *models.Session) error {
+	return translate(r.db.Create(session).Error)
+}
+
+func (r gormSessions) ByID(id string) (models.Session, error) {
+	var session models.Session
+	err := r.db.First(&session, "id = ?", id).Error
+	return session, translate(err)
+}
+
+func (r gormSessions) ByRefreshHash(hash string) (models.Session, error) {
+	var session models.Session
+	err := r.db.Where("refresh_token_hash = ?", hash).First(&session).Error
+	return session, translate(err)
+}
+
+func (r gormSessions) ByPreviousHash(hash string) (models.Session, error) {
+	var session models.Session
+	err := r.db.Where("previous_refresh_hash = ?", hash).First(&session).Error
+	return session, translate(err)
+}
+
+func (r gormSessions) Rotate(id, currentHash, newHash string, expiresAt time.Time) (bool, error) {
+	result := r.db.Model(&models.Session{}).
+		Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", id, currentHash).
+		Updates(map[string]interface{}{
+			"refresh_token_hash":    newHash,
+			"previous_refresh_hash": currentHash,
+			"last_used_at":          time.Now(),
+			"expires_at":            expiresAt,
+		})
+	return result.RowsAffected > 0, translate(result.Error)
+}
+
+func (r gormSessions) Revoke(id string) error {
+	return r.db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r gormSessions) RevokeForUser(userID, keepID string) (int64, error) {
+	result := r.db.Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+func (r gormSessions) ListActive(userID string) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (r gormSessions) StepUp(id string, at time.Time) error {
+	return r.db.Model(&models.Session{}).Where("id = ?", id).Update("step_up_at", at).Error
+}
+
+func (r gormSessions) PurgeEnded(cutoff time.Time) (int64, error) {
+	result := r.db.Where("expires_at < ? OR revoked_at < ?", cutoff, cutoff).Delete(&models.Session{})
+	return result.RowsAffected, result.Error
+}
+
+type gormGroups struct{ db *gorm.DB }
+
+func (r gormGroups) ByID(id string) (models.Group, error) {
+	var group models.Group
+	err := r.db.First(&group, "id = ?", id).Error
+	return group, translate(err)
+}
+
+func (r gormGroups) WithMembers(id string) (models.Group, error) {
+	var group models.Group
+	err := r.db.Preload("Members.User").Preload("Creator").First(&group, "id = ?", id).Error
+	return group, translate(err)
+}
+
+func (r gormGroups) ByCreator(id, creatorID string) (models.Group, error) {
+	var group models.Group
+	err := r.db.Where("id = ? AND creator_id = ?", id, creatorID).First(&group).Error
+	return group, translate(err)
+}
+
+func (r gormGroups) ForUser(userID string) ([]models.Group, error) {
+	var groups []models.Group
+	err := r.db.
+		Joins("INNER JOIN members ON groups.id = members.group_id").
+		Where("members.user_id = ? AND members.status = ?", userID, "approved").
+		Preload("Members.User").
+		Preload("Creator").
+		Distinct().
+		Find(&groups).Error
+	return groups, err
+}
+
+func (r gormGroups) RequiresStepUp(userID string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Group{}).
+		Joins("INNER JOIN members ON groups.id = members.group_id").
+		Where("members.user_id = ? AND members.status = ? AND groups.require_step_up = ?", userID, "approved", true).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r gormGroups) Create(group *models.Group) error {
+	return translate(r.db.Create(group).Error)
+}
+
+func (r gormGroups) Update(id string, updates map[string]interface{}) error {
+	return r.db.Model(&models.Group{}).Where("id = ?", id).Updates(updates).Error
+}
+
+func (r gormGroups) CreateInvitation(invitation *models.GroupInvitation) error {
+	return translate(r.db.Create(invitation).Error)
+}
+
+func (r gormGroups) Invitation(id, email string) (models.GroupInvitation, error) {
+	var invitation models.GroupInvitation
+	err := r.db.Where("id = ? AND email = ?", id, email).First(&invitation).Error
+	return invitation, translate(err)
+}
+
+func (r gormGroups) PendingInvitations(email string) ([]models.GroupInvitation, error) {
+	var invitations []models.GroupInvitation
+	err := r.db.Where("email = ? AND status = ?", email, "pending").
+		Preload("Group").
+		Preload("Inviter").
+		Find(&invitations).Error
+	return invitations, err
+}
+
+func (r gormGroups) SetInvitationStatus(id, status string) error {
+	return r.db.Model(&models.GroupInvitation{}).Where("id = ?", id).Update("status", status).Error
+}
+
+type gormMembers struct{ db *gorm.DB }
+
+func (r gormMembers) Find(groupID, userID string) (models.Member, error) {
+	var member models.Member
+	err := r.db.Where("group_id = ? AND user_id = ?", groupID, userID).First(&member).Error
+	return member, translate(err)
+}
+
+func (r gormMembers) Approved(groupID, userID string) (models.Member, error) {
+	var member models.Member
+	err := r.db.Where("group_id = ? AND user_id = ? AND status = ?", groupID, userID, "approved").
+		Preload("User").
+		First(&member).Error
+	return member, translate(err)
+}
+
+func (r gormMembers) ByID(id string) (models.Member, error) {
+	var member models.Member
+	err := r.db.Where("id = ?", id).Preload("User").First(&member).Error
+	return member, translate(err)
+}
+
+func (r gormMembers) ListApproved(groupID string) ([]models.Member, error) {
+	var members []models.Member
+	err := r.db.Where("group_id = ? AND status = ?", groupID, "approved").
+		Preload("User").
+		Find(&members).Error
+	return members, err
+}
+
+func (r gormMembers) ListAdmins(groupID string) ([]models.Member, error) {
+	var members []models.Member
+	err := r.db.Where("group_id = ? AND role IN ? AND status = ?", groupID, AdminRoles, "approved").
+		Find(&members).Error
+	return members, err
+}
+
+func (r gormMembers) CountApproved(groupID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Member{}).
+		Where("group_id = ? AND status = ?", groupID, "approved").
+		Count(&count).Error
+	return count, err
+}
+
+func (r gormMembers) CountAdmins(groupID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Member{}).
+		Where("group_id = ? AND role IN ? AND status = ?", groupID, AdminRoles, "approved").
+		Count(&count).Error
+	return count, err
+}
+
+func (r gormMembers) Create(member *models.Member) error {
+	return translate(r.db.Create(member).Error)
+}
+
+func (r gormMembers) SetStatus(groupID, memberID, status string) error {
+	return r.db.Model(&models.Member{}).
+		Where("id = ? AND group_id = ?", memberID, groupID).
+		Update("status", status).Error
+}
+
+func (r gormMembers) SetRole(groupID, memberID, role string) error {
+	return r.db.Model(&models.Member{}).
+		Where("id = ? AND group_id = ?", memberID, groupID).
+		Update("role", role).Error
+}
+
+func (r gormMembers) CreateNomination(nomination *models.AdminNomination) error {
+	return translate(r.db.Create(nomination).Error)
+}
+
+func (r gormMembers) PendingNomination(groupID, nominatorID, nomineeID string) (models.AdminNomination, error) {
+	var nomination models.AdminNomination
+	err := r.db.Where("group_id = ? AND nominator_id = ? AND nominee_id = ? AND status = ?", groupID, nominatorID, nomineeID, "pending").
+		First(&nomination).Error
+	return nomination, translate(err)
+}
+
+func (r gormMembers) CountPendingNominations(groupID, nomineeID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.AdminNomination{}).
+		Where("group_id = ? AND nominee_id = ? AND status = ?", groupID, nomineeID, "pending").
+		Count(&count).Error
+	return count, err
+}
+
+type gormContributions struct{ db *gorm.DB }
+
+func (r gormContributions) Create(contribution *models.Contribution) error {
+	return translate(r.db.Create(contribution).Error)
+}
+
+func (r gormContributions) ForUser(id, groupID, userID string) (models.Contribution, error) {
+	var contribution models.Contribution
+	err := r.db.Where("id = ? AND group_id = ? AND user_id = ?", id, groupID, userID).
+		First(&contribution).Error
+	return contribution, translate(err)
+}
+
+func (r gormContributions) Save(contribution *models.Contribution) error {
+	return translate(r.db.Save(contribution).Error)
+}
+
+func (r gormContributions) SetStatus(id, status string) error {
+	return r.db.Model(&models.Contribution{}).Where("id = ?", id).Update("status", status).Error
+}
+
+func (r gormContributions) Round(groupID, memberID string, round int) (models.RoundContribution, error) {
+	var contribution models.RoundContribution
+	err := r.db.Where("group_id = ? AND member_id = ? AND round = ?", groupID, memberID, round).
+		First(&contribution).Error
+	return contribution, translate(err)
+}
+
+func (r gormContributions) RoundByID(id string) (models.RoundContribution, error) {
+	var contribution models.RoundContribution
+	err := r.db.First(&contribution, "id = ?", id).Error
+	return contribution, translate(err)
+}
+
+func (r gormContributions) MemberRound(id, groupID, memberID string) (models.RoundContribution, error) {
+	var contribution models.RoundContribution
+	err := r.db.Where("id = ? AND group_id = ? AND member_id = ?", id, groupID, memberID).
+		First(&contribution).Error
+	return contribution, translate(err)
+}
+
+func (r gormContributions) CreateRound(contribution *models.RoundContribution) error {
+	return translate(r.db.Create(contribution).Error)
+}
+
+func (r gormContributions) TransitionRound(id, from string, updates map[string]interface{}) (bool, error) {
+	result := r.db.Model(&models.RoundContribution{}).
+		Where("id = ? AND status = ?", id, from).
+		Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r gormContributions) ListRound(groupID string, round int) ([]models.RoundContribution, error) {
+	var contributions []models.RoundContribution
+	err := r.db.Where("group_id = ? AND round = ?", groupID, round).
+		Preload("Member").
+		Preload("Member.User").
+		Find(&contributions).Error
+	return contributions, err
+}
+
+func (r gormContributions) RoundStatus(groupID string, round int) (models.RoundStatus, error) {
+	var status models.RoundStatus
+	err := r.db.Where("group_id = ? AND round = ?", groupID, round).First(&status).Error
+	return status, translate(err)
+}
+
+type gormPayouts struct{ db *gorm.DB }
+
+func (r gormPayouts) ByID(id string) (models.PayoutRequest, error) {
+	var request models.PayoutRequest
+	err := r.db.First(&request, "id = ?", id).Error
+	return request, translate(err)
+}
+
+func (r gormPayouts) OpenForRound(groupID string, round int) (models.PayoutRequest, error) {
+	var request models.PayoutRequest
+	err := r.db.Where("group_id = ? AND round = ? AND status IN ?", groupID, round, []string{"pending", "approved"}).
+		First(&request).Error
+	return request, translate(err)
+}
+
+func (r gormPayouts) Create(request *models.PayoutRequest) error {
+	return translate(r.db.Create(request).Error)
+}
+
+func (r gormPayouts) ForGroup(groupID string) ([]models.PayoutRequest, error) {
+	var requests []models.PayoutRequest
+	err := r.db.Where("group_id = ?", groupID).
+		Preload("Recipient").
+		Preload("Approvals.Admin").
+		Order("created_at DESC").
+		Find(&requests).Error
+	return requests, err
+}
+
+func (r gormPayouts) Schedule(groupID string) ([]models.PayoutSchedule, error) {
+	var schedules []models.PayoutSchedule
+	err := r.db.Where("group_id = ?", groupID).
+		Preload("Member.User").
+		Order("round ASC").
+		Find(&schedules).Error
+	return schedules, err
+}
+
+type gormPenalties struct{ db *gorm.DB }
+
+func (r gormPenalties) InGroup(id, groupID string) (models.Penalty, error) {
+	var penalty models.Penalty
+	err := r.db.Where("id = ? AND group_id = ?", id, groupID).First(&penalty).Error
+	return penalty, translate(err)
+}
+
+func (r gormPenalties) ForGroup(groupID string) ([]models.Penalty, error) {
+	var penalties []models.Penalty
+	err := r.db.Where("group_id = ?", groupID).
+		Preload("Member.User").
+		Order("created_at DESC").
+		Find(&penalties).Error
+	return penalties, err
+}
+
+func (r gormPenalties) ForRound(groupID string, round int) ([]models.Penalty, error) {
+	var penalties []models.Penalty
+	err := r.db.Where("group_id = ? AND round = ?", groupID, round).Find(&penalties).Error
+	return penalties, err
+}
+
+func (r gormPenalties) Transition(id, from string, updates map[string]interface{}) (bool, error) {
+	result := r.db.Model(&models.Penalty{}).
+		Where("id = ? AND status = ?", id, from).
+		Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+type gormLoans struct{ db *gorm.DB }
+
+func (r gormLoans) InGroup(id, groupID string) (models.Loan, error) {
+	var loan models.Loan
+	err := r.db.Where("id = ? AND group_id = ?", id, groupID).
+		Preload("Guarantors").
+		Preload("Installments", func(db *gorm.DB) *gorm.DB { return db.Order("number ASC") }).
+		First(&loan).Error
+	return loan, translate(err)
+}
+
+func (r gormLoans) ForGroup(groupID string) ([]models.Loan, error) {
+	var loans []models.Loan
+	err := r.db.Where("group_id = ?", groupID).
+		Preload("Member.User").
+		Preload("Guarantors").
+		Preload("Installments", func(db *gorm.DB) *gorm.DB { return db.Order("number ASC") }).
+		Order("created_at DESC").
+		Find(&loans).Error
+	return loans, err
+}
+
+func (r gormLoans) CreateRepayment(repayment *models.LoanRepayment) error {
+	return translate(r.db.Create(repayment).Error)
+}
+
+func (r gormLoans) Repayment(id, loanID string) (models.LoanRepayment, error) {
+	var repayment models.LoanRepayment
+	err := r.db.Where("id = ? AND loan_id = ?", id, loanID).First(&repayment).Error
+	return repayment, translate(err)
+}
+
+func (r gormLoans) TransitionRepayment(id, from string, updates map[string]interface{}) (bool, error) {
+	result := r.db.Model(&models.LoanRepayment{}).
+		Where("id = ? AND status = ?", id, from).
+		Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+type gormSettlements struct{ db *gorm.DB }
+
+func (r gormSettlements) InGroup(id, groupID string) (models.Settlement, error) {
+	var settlement models.Settlement
+	err := r.db.Where("id = ? AND group_id = ?", id, groupID).
+		Preload("Payouts", func(db *gorm.DB) *gorm.DB { return db.Order("batch ASC") }).
+		Preload("Payouts.Member.User").
+		First(&settlement).Error
+	return settlement, translate(err)
+}
+
+func (r gormSettlements) ForGroup(groupID string) ([]models.Settlement, error) {
+	var settlements []models.Settlement
+	err := r.db.Where("group_id = ?", groupID).
+		Preload("Payouts", func(db *gorm.DB) *gorm.DB { return db.Order("batch ASC") }).
+		Preload("Payouts.Member.User").
+		Order("created_at DESC").
+		Find(&settlements).Error
+	return settlements, err
+}
+
+type gormAuctions struct{ db *gorm.DB }
+
+func (r gormAuctions) InGroup(id, groupID string) (models.BidWindow, error) {
+	var window models.BidWindow
+	err := r.db.Where("id = ? AND group_id = ?", id, groupID).
+		Preload("Bids", func(db *gorm.DB) *gorm.DB { return db.Order("discount DESC, updated_at ASC") }).
+		First(&window).Error
+	return window, translate(err)
+}
+
+func (r gormAuctions) ForGroup(groupID string) ([]models.BidWindow, error) {
+	var windows []models.BidWindow
+	err := r.db.Where("group_id = ?", groupID).
+		Preload("Bids", func(db *gorm.DB) *gorm.DB { return db.Order("discount DESC, updated_at ASC") }).
+		Order("round DESC").
+		Find(&windows).Error
+	return windows, err
+}
+
+type gormNotifications struct{ db *gorm.DB }
+
+func (r gormNotifications) Create(notification *models.Notification) error {
+	return translate(r.db.Create(notification).Error)
+}
+
+func (r gormNotifications) ForUser(userID string) ([]models.Notification, error) {
+	var notifications []models.Notification
+	err := r.db.Where("user_id = ?", userID).
+		Preload("Group").
+		Preload("User").
+		Order("created_at DESC").
+		Find(&notifications).Error
+	return notifications, err
+}
+
+func (r gormNotifications) Find(id, userID string) (models.Notification, error) {
+	var notification models.Notification
+	err := r.db.Where("id = ? AND user_id = ?", id, userID).First(&notification).Error
+	return notification, translate(err)
+}
+
+func (r gormNotifications) MarkRead(id string) error {
+	return r.db.Model(&models.Notification{}).Where("id = ?", id).Update("read", true).Error
+}
+
+func (r gormNotifications) Delete(id string) error {
+	return r.db.Delete(&models.Notification{}, "id = ?", id).Error
+}
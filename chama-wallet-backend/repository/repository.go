@@ -0,0 +1,205 @@
+// Package repository is the data access layer used by handlers and services. Each
+// aggregate has an interface so the app can run on Postgres in production and on SQLite
+// in tests without the callers knowing which.
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/policy"
+)
+
+var (
+	// ErrNotFound is returned when a lookup matches no row
+	ErrNotFound = errors.New("record not found")
+	// ErrDuplicate is returned when a write violates a unique key
+	ErrDuplicate = errors.New("duplicate record")
+)
+
+// AdminRoles are the member roles that can administer a group
+var AdminRoles = policy.AdminRoles
+
+// Users stores user accounts
+type Users interface {
+	ByID(id string) (models.User, error)
+	ByEmail(email string) (models.User, error)
+	Create(user *models.User) error
+	Save(user *models.User) error
+	// NotInGroup lists users with no membership, in any status, in the group
+	NotInGroup(groupID string) ([]models.User, error)
+
+	// AdvanceTOTPStep records step as the user's last accepted TOTP step if it is later
+	// than the recorded one, and reports whether it was
+	AdvanceTOTPStep(userID string, step int64) (bool, error)
+	// ReplaceRecoveryCodes drops the user's recovery codes and stores new ones
+	ReplaceRecoveryCodes(userID string, codeHashes []string) error
+	// UseRecoveryCode marks an unused code spent and reports whether there was one
+	UseRecoveryCode(userID, codeHash string) (bool, error)
+	CountRecoveryCodes(userID string) (int64, error)
+}
+
+// Sessions stores signed-in devices and their refresh tokens
+type Sessions interface {
+	Create(session *models.Session) error
+	ByID(id string) (models.Session, error)
+	ByRefreshHash(hash string) (models.Session, error)
+	// ByPreviousHash finds the session whose last replaced refresh token had this hash
+	ByPreviousHash(hash string) (models.Session, error)
+	// Rotate replaces the refresh token of a live session if it is still currentHash, and
+	// reports whether it was
+	Rotate(id, currentHash, newHash string, expiresAt time.Time) (bool, error)
+	Revoke(id string) error
+	// RevokeForUser revokes all of the user's live sessions except keepID
+	RevokeForUser(userID, keepID string) (int64, error)
+	ListActive(userID string) ([]models.Session, error)
+	// StepUp records a second-factor check on the session
+	StepUp(id string, at time.Time) error
+	// PurgeEnded deletes sessions that expired or were revoked before the cutoff
+	PurgeEnded(cutoff time.Time) (int64, error)
+}
+
+// Groups stores groups and the invitations to join them
+type Groups interface {
+	ByID(id string) (models.Group, error)
+	// WithMembers loads the group with its members, their users and the creator
+	WithMembers(id string) (models.Group, error)
+	ByCreator(id, creatorID string) (models.Group, error)
+	// ForUser lists the groups the user is an approved member of
+	ForUser(userID string) ([]models.Group, error)
+	// RequiresStepUp reports whether any group the user is an approved member of
+	// requires second-factor step-up
+	RequiresStepUp(userID string) (bool, error)
+	Create(group *models.Group) error
+	Update(id string, updates map[string]interface{}) error
+
+	CreateInvitation(invitation *models.GroupInvitation) error
+	// Invitation finds an invitation addressed to email
+	Invitation(id, email string) (models.GroupInvitation, error)
+	PendingInvitations(email string) ([]models.GroupInvitation, error)
+	SetInvitationStatus(id, status string) error
+}
+
+// Members stores group memberships and admin nominations
+type Members interface {
+	// Find returns the user's membership in the group whatever its status
+	Find(groupID, userID string) (models.Member, error)
+	Approved(groupID, userID string) (models.Member, error)
+	ByID(id string) (models.Member, error)
+	ListApproved(groupID string) ([]models.Member, error)
+	ListAdmins(groupID string) ([]models.Member, error)
+	CountApproved(groupID string) (int64, error)
+	CountAdmins(groupID string) (int64, error)
+	Create(member *models.Member) error
+	SetStatus(groupID, memberID, status string) error
+	SetRole(groupID, memberID, role string) error
+
+	CreateNomination(nomination *models.AdminNomination) error
+	// PendingNomination finds the nominator's open nomination of the nominee
+	PendingNomination(groupID, nominatorID, nomineeID string) (models.AdminNomination, error)
+	CountPendingNominations(groupID, nomineeID string) (int64, error)
+}
+
+// Contributions stores direct group contributions and round contributions
+type Contributions interface {
+	Create(contribution *models.Contribution) error
+	// ForUser finds a direct contribution made by the user to the group
+	ForUser(id, groupID, userID string) (models.Contribution, error)
+	Save(contribution *models.Contribution) error
+	SetStatus(id, status string) error
+
+	// Round finds the member's contribution for a round
+	Round(groupID, memberID string, round int) (models.RoundContribution, error)
+	RoundByID(id string) (models.RoundContribution, error)
+	// MemberRound finds a round contribution belonging to the member
+	MemberRound(id, groupID, memberID string) (models.RoundContribution, error)
+	CreateRound(contribution *models.RoundContribution) error
+	// TransitionRound applies updates only if the contribution is still in status from,
+	// and reports whether it was
+	TransitionRound(id, from string, updates map[string]interface{}) (bool, error)
+	ListRound(groupID string, round int) ([]models.RoundContribution, error)
+	RoundStatus(groupID string, round int) (models.RoundStatus, error)
+}
+
+// Payouts stores payout requests and the payout schedule
+type Payouts interface {
+	ByID(id string) (models.PayoutRequest, error)
+	// OpenForRound finds a pending or approved request for the round
+	OpenForRound(groupID string, round int) (models.PayoutRequest, error)
+	Create(request *models.PayoutRequest) error
+	// ForGroup lists the group's requests, newest first, with recipients and votes
+	ForGroup(groupID string) ([]models.PayoutRequest, error)
+	Schedule(groupID string) ([]models.PayoutSchedule, error)
+}
+
+// Penalties stores the late fines members owe their groups
+type Penalties interface {
+	// InGroup finds a penalty belonging to the group
+	InGroup(id, groupID string) (models.Penalty, error)
+	// ForGroup lists the group's penalties, newest first, with their members
+	ForGroup(groupID string) ([]models.Penalty, error)
+	ForRound(groupID string, round int) ([]models.Penalty, error)
+	// Transition applies updates only if the penalty is still in status from, and
+	// reports whether it was
+	Transition(id, from string, updates map[string]interface{}) (bool, error)
+}
+
+// Loans stores member loans in savings and credit groups and the repayments made on them
+type Loans interface {
+	// InGroup finds a loan belonging to the group with its guarantors and installments
+	InGroup(id, groupID string) (models.Loan, error)
+	// ForGroup lists the group's loans, newest first, with borrowers, guarantors and
+	// installments
+	ForGroup(groupID string) ([]models.Loan, error)
+	CreateRepayment(repayment *models.LoanRepayment) error
+	// Repayment finds a repayment made on the loan
+	Repayment(id, loanID string) (models.LoanRepayment, error)
+	// TransitionRepayment applies updates only if the repayment is still in status from,
+	// and reports whether it was
+	TransitionRepayment(id, from string, updates map[string]interface{}) (bool, error)
+}
+
+// Settlements stores the end-of-cycle share-outs of savings and credit groups
+type Settlements interface {
+	// InGroup finds a share-out belonging to the group with its payouts
+	InGroup(id, groupID string) (models.Settlement, error)
+	// ForGroup lists the group's share-outs, newest first, with their payouts
+	ForGroup(groupID string) ([]models.Settlement, error)
+}
+
+// Auctions stores the bid windows of groups that auction their payout order
+type Auctions interface {
+	// InGroup finds a bid window belonging to the group with its bids
+	InGroup(id, groupID string) (models.BidWindow, error)
+	// ForGroup lists the group's bid windows, latest round first, with their bids
+	ForGroup(groupID string) ([]models.BidWindow, error)
+}
+
+// Notifications stores in-app notifications
+type Notifications interface {
+	Create(notification *models.Notification) error
+	ForUser(userID string) ([]models.Notification, error)
+	// Find returns the notification if it belongs to the user
+	Find(id, userID string) (models.Notification, error)
+	MarkRead(id string) error
+	Delete(id string) error
+}
+
+// Store groups the repositories the app runs on
+type Store struct {
+	Users         Users
+	Sessions      Sessions
+	Groups        Groups
+	Members       Members
+	Contributions Contributions
+	Payouts       Payouts
+	Penalties     Penalties
+	Loans         Loans
+	Settlements   Settlements
+	Auctions      Auctions
+	Notifications Notifications
+}
+
+// Default is the store used by the handlers, set once the database is connected
+var Default *Store
@@ -0,0 +1,55 @@
+package routes
+
+import (
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+
+	"chama-wallet-backend/ledger"
+	"chama-wallet-backend/middleware"
+	"chama-wallet-backend/ratelimit"
+)
+
+// NewApp builds the Fiber app with CORS, request IDs, rate limits and every route
+// registered, serving requests against l. The database, repositories and keystore
+// must be set up first.
+func NewApp(l ledger.Ledger) *fiber.App {
+	// Behind a load balancer the client address comes from a header it sets, e.g.
+	// X-Forwarded-For. Rate limits and the audit log are keyed on it.
+	app := fiber.New(fiber.Config{
+		ProxyHeader:        os.Getenv("PROXY_HEADER"),
+		EnableIPValidation: true,
+	})
+
+	// Add CORS middleware
+	app.Use(cors.New(cors.Config{
+		AllowOrigins:     "http://localhost:5173,https://community-wallet-for-women-s-savings-6wpp.onrender.com,http://127.0.0.1:5173,https://community-wallet-for-women-s-saving-ten.vercel.app",
+		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
+		AllowHeaders:     "Origin,Content-Type,Accept,Authorization,Idempotency-Key,X-Request-ID",
+		AllowCredentials: true,
+		ExposeHeaders:    "X-Request-ID,Retry-After,X-RateLimit-Limit,X-RateLimit-Remaining",
+	}))
+
+	// Tag every request with an ID (the client's X-Request-ID if it sent one) that is
+	// echoed in the response and recorded in the audit log
+	app.Use(requestid.New())
+
+	// Services read and submit to the ledger on the request's context
+	app.Use(middleware.Ledger(l))
+
+	// Carry the request ID into everything logged for the request, and log it when done
+	app.Use(middleware.RequestLogger())
+
+	// Every request draws from its IP's API bucket; AuthMiddleware adds the user's
+	app.Use(middleware.RateLimit(ratelimit.API))
+
+	// Setup routes
+	Setup(app)
+	SetupSorobanRoutes(app)
+	GroupRoutes(app)
+	AuthRoutes(app)
+
+	return app
+}
@@ -5,17 +5,34 @@ import (
 
 	"chama-wallet-backend/handlers"
 	"chama-wallet-backend/middleware"
+	"chama-wallet-backend/ratelimit"
 )
 
 // AuthRoutes sets up authentication routes
 func AuthRoutes(app *fiber.App) {
-	// Public routes
-	app.Post("/auth/register", handlers.Register)
-	app.Post("/auth/login", handlers.Login)
-	app.Post("/auth/logout", handlers.Logout)
+	// Public routes, throttled per IP against credential stuffing
+	limit := middleware.RateLimit(ratelimit.Auth)
+	app.Post("/auth/register", limit, handlers.Register)
+	app.Post("/auth/login", limit, handlers.Login)
+	app.Post("/auth/refresh", limit, handlers.RefreshToken)
+	app.Post("/auth/verify-email", limit, handlers.VerifyEmail)
+	app.Post("/auth/password/forgot", limit, handlers.ForgotPassword)
+	app.Post("/auth/password/reset", limit, handlers.ResetPassword)
 
 	// Protected routes
 	auth := app.Group("/auth", middleware.AuthMiddleware())
 	auth.Get("/profile", handlers.GetProfile)
 	auth.Put("/profile", handlers.UpdateProfile)
-}
\ No newline at end of file
+	auth.Get("/secret-key", middleware.StepUp(nil), handlers.ExportSecretKey)
+	auth.Post("/logout", handlers.Logout)
+	auth.Get("/sessions", handlers.GetSessions)
+	auth.Delete("/sessions", handlers.RevokeOtherSessions)
+	auth.Delete("/sessions/:id", handlers.RevokeSession)
+	auth.Post("/verify-email/request", handlers.RequestEmailVerification)
+	auth.Get("/2fa", handlers.GetTwoFactorStatus)
+	auth.Post("/2fa/enroll", handlers.EnrollTOTP)
+	auth.Post("/2fa/confirm", handlers.ConfirmTOTP)
+	auth.Post("/2fa/disable", handlers.DisableTOTP)
+	auth.Post("/2fa/recovery-codes", handlers.RegenerateRecoveryCodes)
+	auth.Post("/2fa/step-up", handlers.StepUp)
+}
@@ -6,6 +6,7 @@ import (
 
 	"chama-wallet-backend/handlers"
 	"chama-wallet-backend/middleware"
+	"chama-wallet-backend/policy"
 )
 
 func GroupRoutes(app *fiber.App) {
@@ -13,28 +14,40 @@ func GroupRoutes(app *fiber.App) {
 		return c.SendString("pong")
 	})
 
+	// Group actions declare their policy.Action; middleware.Authorize checks the caller's
+	// role in the group before the handler runs
+
 	// Public routes (can be accessed without authentication)
 	app.Get("/groups", middleware.AuthMiddleware(), handlers.GetAllGroups)
 	app.Get("/group/:id", middleware.OptionalAuthMiddleware(), handlers.GetGroupDetails)
-	app.Get("/group/:id/balance", middleware.OptionalAuthMiddleware(), handlers.GetGroupBalance)
 
 	// Protected routes (require authentication)
 	app.Post("/group/create", middleware.AuthMiddleware(), handlers.CreateGroup)
 	app.Get("/user/groups", middleware.AuthMiddleware(), handlers.GetUserGroups)
-	app.Post("/group/:id/contribute", middleware.AuthMiddleware(), handlers.ContributeToGroup)
+	app.Post("/group/:id/contribute/prepare", middleware.AuthMiddleware(), middleware.Authorize(policy.Contribute, middleware.GroupParam), handlers.PrepareGroupContribution)
+	app.Post("/group/:id/contribute", middleware.AuthMiddleware(), middleware.Authorize(policy.Contribute, middleware.GroupParam), handlers.ContributeToGroup)
 	app.Post("/group/:id/join", middleware.AuthMiddleware(), handlers.JoinGroup)
+	app.Get("/group/:id/balance", middleware.AuthMiddleware(), middleware.Authorize(policy.ViewBalances, middleware.GroupParam), handlers.GetGroupBalance)
 
 	// New routes
-	app.Post("/group/:id/invite", middleware.AuthMiddleware(), handlers.InviteToGroup)
-	app.Get("/group/:id/non-members", middleware.AuthMiddleware(), handlers.GetNonGroupMembers)
-	app.Post("/group/:id/approve", middleware.AuthMiddleware(), handlers.ApproveGroup)
-	app.Post("/group/:id/activate", middleware.AuthMiddleware(), handlers.ActivateGroup)
-	app.Post("/group/:id/nominate-admin", middleware.AuthMiddleware(), handlers.NominateAdmin)
-	app.Post("/group/:id/approve-member", middleware.AuthMiddleware(), handlers.ApproveMember)
-	app.Post("/group/:id/payout-request", middleware.AuthMiddleware(), handlers.CreatePayoutRequest)
-	app.Post("/payout/:id/approve", middleware.AuthMiddleware(), handlers.ApprovePayoutRequest)
-	app.Get("/group/:id/payout-requests", middleware.AuthMiddleware(), handlers.GetPayoutRequests)
-	app.Get("/group/:id/payout-schedule", middleware.AuthMiddleware(), handlers.GetPayoutSchedule)
+	app.Post("/group/:id/invite", middleware.AuthMiddleware(), middleware.Authorize(policy.Invite, middleware.GroupParam), handlers.InviteToGroup)
+	app.Get("/group/:id/non-members", middleware.AuthMiddleware(), middleware.Authorize(policy.Invite, middleware.GroupParam), handlers.GetNonGroupMembers)
+	app.Post("/group/:id/approve", middleware.AuthMiddleware(), middleware.Authorize(policy.ApproveGroup, middleware.GroupParam), handlers.ApproveGroup)
+	app.Post("/group/:id/activate", middleware.AuthMiddleware(), middleware.Authorize(policy.ActivateGroup, middleware.GroupParam), handlers.ActivateGroup)
+	app.Put("/group/:id/approval-policy", middleware.AuthMiddleware(), middleware.Authorize(policy.ManageSettings, middleware.GroupParam), handlers.UpdateApprovalPolicy)
+	app.Put("/group/:id/late-policy", middleware.AuthMiddleware(), middleware.Authorize(policy.ManageSettings, middleware.GroupParam), handlers.UpdateLatePolicy)
+	app.Put("/group/:id/loan-policy", middleware.AuthMiddleware(), middleware.Authorize(policy.ManageSettings, middleware.GroupParam), handlers.UpdateLoanPolicy)
+	app.Put("/group/:id/share-policy", middleware.AuthMiddleware(), middleware.Authorize(policy.ManageSettings, middleware.GroupParam), handlers.UpdateSharePolicy)
+	app.Put("/group/:id/security", middleware.AuthMiddleware(), middleware.Authorize(policy.ManageSettings, middleware.GroupParam), handlers.UpdateStepUpPolicy)
+	app.Put("/group/:id/members/:memberId/role", middleware.AuthMiddleware(), middleware.Authorize(policy.AssignRole, middleware.GroupParam), middleware.StepUp(middleware.GroupParam), handlers.AssignMemberRole)
+	app.Post("/group/:id/nominate-admin", middleware.AuthMiddleware(), middleware.Authorize(policy.NominateAdmin, middleware.GroupParam), middleware.StepUp(middleware.GroupParam), handlers.NominateAdmin)
+	app.Post("/group/:id/approve-member", middleware.AuthMiddleware(), middleware.Authorize(policy.ApproveMember, middleware.GroupParam), handlers.ApproveMember)
+	app.Post("/group/:id/payout-request", middleware.AuthMiddleware(), middleware.Authorize(policy.CreatePayout, middleware.GroupParam), handlers.CreatePayoutRequest)
+	app.Post("/payout/:id/approve", middleware.AuthMiddleware(), middleware.Authorize(policy.ApprovePayout, middleware.PayoutGroup), middleware.StepUp(middleware.PayoutGroup), middleware.Idempotency(), handlers.ApprovePayoutRequest)
+	app.Get("/group/:id/payout-requests", middleware.AuthMiddleware(), middleware.Authorize(policy.ViewGroup, middleware.GroupParam), handlers.GetPayoutRequests)
+	app.Get("/group/:id/audit", middleware.AuthMiddleware(), middleware.Authorize(policy.ViewAudit, middleware.GroupParam), handlers.GetGroupAuditLog)
+	app.Get("/group/:id/audit/verify", middleware.AuthMiddleware(), middleware.Authorize(policy.ViewAudit, middleware.GroupParam), handlers.VerifyGroupAuditLog)
+	app.Get("/group/:id/payout-schedule", middleware.AuthMiddleware(), middleware.Authorize(policy.ViewGroup, middleware.GroupParam), handlers.GetPayoutSchedule)
 
 	// Notification routes
 	app.Get("/notifications", middleware.AuthMiddleware(), handlers.GetNotifications)
@@ -45,10 +58,40 @@ func GroupRoutes(app *fiber.App) {
 	app.Post("/invitations/:id/reject", middleware.AuthMiddleware(), handlers.RejectInvitation)
 
 	// Contribution round routes
-	app.Post("/group/:id/contribute-round", middleware.AuthMiddleware(), handlers.ContributeToRound)
-	app.Get("/group/:id/round-status", middleware.AuthMiddleware(), handlers.GetRoundStatus)
-	app.Post("/group/:id/authorize-payout", middleware.AuthMiddleware(), handlers.AuthorizeRoundPayout)
+	app.Post("/group/:id/contribute-round/prepare", middleware.AuthMiddleware(), middleware.Authorize(policy.Contribute, middleware.GroupParam), handlers.PrepareRoundContribution)
+	app.Post("/group/:id/contribute-round", middleware.AuthMiddleware(), middleware.Authorize(policy.Contribute, middleware.GroupParam), middleware.Idempotency(), handlers.ContributeToRound)
+	app.Get("/group/:id/round-status", middleware.AuthMiddleware(), middleware.Authorize(policy.ViewBalances, middleware.GroupParam), handlers.GetRoundStatus)
+	app.Get("/group/:id/penalties", middleware.AuthMiddleware(), middleware.Authorize(policy.ViewBalances, middleware.GroupParam), handlers.GetPenalties)
+	app.Post("/group/:id/penalties/:penaltyId/prepare", middleware.AuthMiddleware(), middleware.Authorize(policy.Contribute, middleware.GroupParam), handlers.PreparePenaltyPayment)
+	app.Post("/group/:id/penalties/:penaltyId/pay", middleware.AuthMiddleware(), middleware.Authorize(policy.Contribute, middleware.GroupParam), middleware.Idempotency(), handlers.PayPenalty)
+	app.Post("/group/:id/penalties/:penaltyId/waive", middleware.AuthMiddleware(), middleware.Authorize(policy.WaiveFine, middleware.GroupParam), middleware.StepUp(middleware.GroupParam), handlers.WaivePenalty)
+	app.Get("/group/:id/loans", middleware.AuthMiddleware(), middleware.Authorize(policy.ViewBalances, middleware.GroupParam), handlers.GetLoans)
+	app.Get("/group/:id/loans/:loanId", middleware.AuthMiddleware(), middleware.Authorize(policy.ViewBalances, middleware.GroupParam), handlers.GetLoan)
+	app.Post("/group/:id/loans", middleware.AuthMiddleware(), middleware.Authorize(policy.Borrow, middleware.GroupParam), middleware.Idempotency(), handlers.ApplyForLoan)
+	app.Post("/group/:id/loans/:loanId/guarantee", middleware.AuthMiddleware(), middleware.Authorize(policy.Borrow, middleware.GroupParam), handlers.RespondToGuarantee)
+	app.Post("/group/:id/loans/:loanId/repay/prepare", middleware.AuthMiddleware(), middleware.Authorize(policy.Borrow, middleware.GroupParam), handlers.PrepareLoanRepayment)
+	app.Post("/group/:id/loans/:loanId/repay", middleware.AuthMiddleware(), middleware.Authorize(policy.Borrow, middleware.GroupParam), middleware.Idempotency(), handlers.RepayLoan)
+
+	// Shares and end-of-cycle share-outs
+	app.Get("/group/:id/shares", middleware.AuthMiddleware(), middleware.Authorize(policy.ViewBalances, middleware.GroupParam), handlers.GetShares)
+	app.Get("/group/:id/settlements", middleware.AuthMiddleware(), middleware.Authorize(policy.ViewBalances, middleware.GroupParam), handlers.GetSettlements)
+	app.Get("/group/:id/settlements/:settlementId", middleware.AuthMiddleware(), middleware.Authorize(policy.ViewBalances, middleware.GroupParam), handlers.GetSettlement)
+	app.Post("/group/:id/settlements", middleware.AuthMiddleware(), middleware.Authorize(policy.CreatePayout, middleware.GroupParam), handlers.PrepareSettlement)
+	app.Post("/group/:id/settlements/:settlementId/approve", middleware.AuthMiddleware(), middleware.Authorize(policy.ApprovePayout, middleware.GroupParam), middleware.StepUp(middleware.GroupParam), middleware.Idempotency(), handlers.ApproveSettlement)
+	app.Post("/group/:id/settlements/:settlementId/reissue", middleware.AuthMiddleware(), middleware.Authorize(policy.CreatePayout, middleware.GroupParam), handlers.ReissueSettlement)
+
+	// Payout auctions
+	app.Get("/group/:id/auctions", middleware.AuthMiddleware(), middleware.Authorize(policy.ViewGroup, middleware.GroupParam), handlers.GetAuctions)
+	app.Get("/group/:id/auctions/:auctionId", middleware.AuthMiddleware(), middleware.Authorize(policy.ViewGroup, middleware.GroupParam), handlers.GetAuction)
+	app.Post("/group/:id/auctions", middleware.AuthMiddleware(), middleware.Authorize(policy.RunAuction, middleware.GroupParam), handlers.OpenAuction)
+	app.Post("/group/:id/auctions/:auctionId/bids", middleware.AuthMiddleware(), middleware.Authorize(policy.Bid, middleware.GroupParam), handlers.PlaceBid)
+	app.Post("/group/:id/auctions/:auctionId/close", middleware.AuthMiddleware(), middleware.Authorize(policy.RunAuction, middleware.GroupParam), handlers.CloseAuction)
+
+	// Payout order draws
+	app.Get("/group/:id/draw", middleware.AuthMiddleware(), middleware.Authorize(policy.ViewGroup, middleware.GroupParam), handlers.GetDraw)
+	app.Post("/group/:id/draw", middleware.AuthMiddleware(), middleware.Authorize(policy.RunDraw, middleware.GroupParam), handlers.DrawPayoutOrder)
+	app.Post("/group/:id/authorize-payout", middleware.AuthMiddleware(), middleware.Authorize(policy.AuthorizeRound, middleware.GroupParam), middleware.StepUp(middleware.GroupParam), handlers.AuthorizeRoundPayout)
 
 	// Add this route for group secret key access
-	app.Get("/group/:id/secret", middleware.AuthMiddleware(), handlers.GetGroupSecretKey)
+	app.Get("/group/:id/secret", middleware.AuthMiddleware(), middleware.Authorize(policy.ViewSecret, middleware.GroupParam), middleware.StepUp(middleware.GroupParam), handlers.GetGroupSecretKey)
 }
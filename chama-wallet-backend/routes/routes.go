@@ -3,9 +3,10 @@ package routes
 import (
 	"github.com/gofiber/fiber/v2"
 
+	"chama-wallet-backend/config"
 	"chama-wallet-backend/handlers"
 	"chama-wallet-backend/middleware"
-	"chama-wallet-backend/config"
+	"chama-wallet-backend/ratelimit"
 )
 
 func Setup(app *fiber.App) {
@@ -29,14 +30,17 @@ func Setup(app *fiber.App) {
 			"supported_assets":   config.GetAssetInfo(),
 		})
 	})
-	// Public wallet routes
-	app.Post("/create-wallet", handlers.CreateWallet)
+	// Public wallet routes. Creating and funding wallets calls friendbot, so those are
+	// throttled harder.
+	faucet := middleware.RateLimit(ratelimit.Faucet)
+	app.Post("/create-wallet", faucet, handlers.CreateWallet)
 	app.Get("/balance/:address", middleware.OptionalAuthMiddleware(), handlers.GetBalance)
-	app.Get("/generate-keypair", handlers.GenerateKeypair)
-	app.Post("/fund/:address", middleware.OptionalAuthMiddleware(), handlers.FundAccount)
+	app.Get("/generate-keypair", faucet, handlers.GenerateKeypair)
+	app.Post("/fund/:address", faucet, middleware.OptionalAuthMiddleware(), handlers.FundAccount)
 	app.Get("/transactions/:address", middleware.OptionalAuthMiddleware(), handlers.GetTransactionHistory)
 	app.Get("/deleteNotification", middleware.AuthMiddleware(), handlers.DeleteNotification)
 
 	// Protected wallet routes
-	app.Post("/transfer", middleware.AuthMiddleware(), handlers.TransferFunds)
+	app.Post("/transfer/prepare", middleware.AuthMiddleware(), handlers.PrepareTransfer)
+	app.Post("/transfer", middleware.AuthMiddleware(), middleware.StepUp(nil), handlers.TransferFunds)
 }
@@ -8,8 +8,10 @@ import (
 
 func SetupSorobanRoutes(app *fiber.App) {
 	// Soroban contract interaction routes
+	app.Post("/api/contribute/prepare", handlers.PrepareContributeHandler)
 	app.Post("/api/contribute", handlers.ContributeHandler)
 	app.Post("/api/balance", handlers.BalanceHandler)
+	app.Post("/api/withdraw/prepare", handlers.PrepareWithdrawHandler)
 	app.Post("/api/withdraw", handlers.WithdrawHandler)
 	app.Post("/api/history", handlers.HistoryHandler)
 }
@@ -0,0 +1,182 @@
+// Package scheduler runs background jobs inside the server process on cron
+// schedules. Run state lives in the scheduled_jobs table, and each run takes a
+// lease on the job's row so that only one replica runs it.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+
+	"chama-wallet-backend/logging"
+	"chama-wallet-backend/models"
+)
+
+// JobFunc is the work done by a job. It should stop when ctx is cancelled.
+type JobFunc func(ctx context.Context) error
+
+type job struct {
+	name     string
+	spec     string
+	schedule cron.Schedule
+	run      JobFunc
+	lease    time.Duration
+}
+
+// Scheduler polls the job table and runs jobs that are due
+type Scheduler struct {
+	db         *gorm.DB
+	instanceID string
+	interval   time.Duration
+	jobs       []*job
+	wg         sync.WaitGroup
+}
+
+// New creates a scheduler that checks for due jobs every interval
+func New(db *gorm.DB, interval time.Duration) *Scheduler {
+	hostname, _ := os.Hostname()
+	return &Scheduler{
+		db:         db,
+		instanceID: fmt.Sprintf("%s-%s", hostname, uuid.NewString()[:8]),
+		interval:   interval,
+	}
+}
+
+// Register adds a job. spec is a standard five field cron expression or a
+// descriptor such as "@daily" or "@every 15m". lease bounds a single run.
+func (s *Scheduler) Register(name, spec string, lease time.Duration, run JobFunc) error {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q for job %s: %w", spec, name, err)
+	}
+	s.jobs = append(s.jobs, &job{name: name, spec: spec, schedule: schedule, run: run, lease: lease})
+	return nil
+}
+
+// Start records the registered jobs and runs the polling loop until ctx is cancelled
+func (s *Scheduler) Start(ctx context.Context) error {
+	now := time.Now()
+	for _, j := range s.jobs {
+		state := models.ScheduledJob{Name: j.name, Schedule: j.spec, NextRunAt: j.schedule.Next(now)}
+		if err := s.db.Where(models.ScheduledJob{Name: j.name}).FirstOrCreate(&state).Error; err != nil {
+			return fmt.Errorf("failed to register job %s: %w", j.name, err)
+		}
+		// A changed schedule takes effect from now
+		if state.Schedule != j.spec {
+			s.db.Model(&models.ScheduledJob{}).Where("name = ?", j.name).
+				Updates(map[string]interface{}{"schedule": j.spec, "next_run_at": j.schedule.Next(now)})
+		}
+	}
+
+	slog.InfoContext(ctx, "scheduler started", "instance", s.instanceID, "jobs", len(s.jobs))
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			s.runDue(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// Wait blocks until the polling loop and any running job have stopped
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// runDue starts every job that is due and whose lease this instance wins. Each job
+// runs in its own goroutine, so a slow job does not hold up the others or the next poll;
+// its lease keeps it from being started again while it runs.
+func (s *Scheduler) runDue(ctx context.Context) {
+	for _, j := range s.jobs {
+		if ctx.Err() != nil {
+			return
+		}
+		if !s.acquire(j) {
+			continue
+		}
+		s.wg.Add(1)
+		go func(j *job) {
+			defer s.wg.Done()
+			s.execute(ctx, j)
+		}(j)
+	}
+}
+
+// acquire takes the job's lease if the job is due and nobody else holds it
+func (s *Scheduler) acquire(j *job) bool {
+	now := time.Now()
+	lockedUntil := now.Add(j.lease)
+
+	result := s.db.Model(&models.ScheduledJob{}).
+		Where("name = ? AND next_run_at <= ? AND (locked_until IS NULL OR locked_until < ?)", j.name, now, now).
+		Updates(map[string]interface{}{"locked_by": s.instanceID, "locked_until": lockedUntil})
+	if result.Error != nil {
+		slog.Error("scheduler failed to lock job", "job", j.name, "error", result.Error)
+		return false
+	}
+	return result.RowsAffected == 1
+}
+
+// execute runs a job under its lease and records the outcome. Everything the job
+// logs through its context carries the job's name and run ID.
+func (s *Scheduler) execute(ctx context.Context, j *job) {
+	runCtx, cancel := context.WithTimeout(ctx, j.lease)
+	defer cancel()
+	runCtx = logging.NewContext(runCtx, "job", j.name, "run_id", uuid.NewString())
+
+	started := time.Now()
+	slog.DebugContext(runCtx, "running job")
+
+	err := runSafely(runCtx, j.run)
+
+	finished := time.Now()
+	updates := map[string]interface{}{
+		"last_run_at":  started,
+		"last_run_ms":  finished.Sub(started).Milliseconds(),
+		"last_status":  "succeeded",
+		"last_error":   "",
+		"next_run_at":  j.schedule.Next(finished),
+		"locked_by":    "",
+		"locked_until": nil,
+	}
+	if err != nil {
+		slog.ErrorContext(runCtx, "job failed", "duration_ms", finished.Sub(started).Milliseconds(), "error", err)
+		updates["last_status"] = "failed"
+		updates["last_error"] = logging.Redact(err.Error())
+	} else {
+		slog.InfoContext(runCtx, "job finished", "duration_ms", finished.Sub(started).Milliseconds())
+	}
+
+	if err := s.db.Model(&models.ScheduledJob{}).
+		Where("name = ? AND locked_by = ?", j.name, s.instanceID).
+		Updates(updates).Error; err != nil {
+		slog.ErrorContext(runCtx, "failed to record job run", "error", err)
+	}
+}
+
+// runSafely turns a panic inside a job into an error so the loop keeps going
+func runSafely(ctx context.Context, run JobFunc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return run(ctx)
+}
@@ -0,0 +1,197 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+)
+
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.Open("sqlite", fmt.Sprintf("file:scheduler-%s?mode=memory&cache=shared", uuid.NewString()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.ScheduledJob{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// due registers the job on s and makes it due now
+func due(t *testing.T, db *gorm.DB, s *Scheduler, name string, lease time.Duration, run JobFunc) *job {
+	t.Helper()
+	if err := s.Register(name, "@every 1h", lease, run); err != nil {
+		t.Fatal(err)
+	}
+	state := models.ScheduledJob{Name: name, Schedule: "@every 1h", NextRunAt: time.Now().Add(-time.Second)}
+	if err := db.Where(models.ScheduledJob{Name: name}).Assign(state).FirstOrCreate(&state).Error; err != nil {
+		t.Fatal(err)
+	}
+	return s.jobs[len(s.jobs)-1]
+}
+
+func jobState(t *testing.T, db *gorm.DB, name string) models.ScheduledJob {
+	t.Helper()
+	var state models.ScheduledJob
+	if err := db.First(&state, "name = ?", name).Error; err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func noop(context.Context) error { return nil }
+
+func TestAcquireOneInstanceWins(t *testing.T) {
+	db := testDB(t)
+	a, b := New(db, time.Minute), New(db, time.Minute)
+	ja := due(t, db, a, "sweep", time.Minute, noop)
+	jb := due(t, db, b, "sweep", time.Minute, noop)
+
+	if !a.acquire(ja) {
+		t.Fatal("first instance did not get the lease")
+	}
+	if b.acquire(jb) {
+		t.Fatal("second instance got a lease already held")
+	}
+	if got := jobState(t, db, "sweep").LockedBy; got != a.instanceID {
+		t.Errorf("locked by %q, want %q", got, a.instanceID)
+	}
+
+	// Once the run is recorded the job is not due again until its next run
+	a.execute(context.Background(), ja)
+	if b.acquire(jb) {
+		t.Error("second instance ran a job that is no longer due")
+	}
+}
+
+func TestAcquireConcurrentInstances(t *testing.T) {
+	db := testDB(t)
+	instances := make([]*Scheduler, 8)
+	jobs := make([]*job, len(instances))
+	for i := range instances {
+		instances[i] = New(db, time.Minute)
+		jobs[i] = due(t, db, instances[i], "sweep", time.Minute, noop)
+	}
+
+	var wg sync.WaitGroup
+	won := make([]bool, len(instances))
+	for i := range instances {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			won[i] = instances[i].acquire(jobs[i])
+		}(i)
+	}
+	wg.Wait()
+
+	winners := 0
+	for i, ok := range won {
+		if ok {
+			winners++
+			if got := jobState(t, db, "sweep").LockedBy; got != instances[i].instanceID {
+				t.Errorf("locked by %q, winner is %q", got, instances[i].instanceID)
+			}
+		}
+	}
+	if winners != 1 {
+		t.Fatalf("%d instances acquired the lease, want 1", winners)
+	}
+}
+
+func TestExpiredLeaseIsTakenOver(t *testing.T) {
+	db := testDB(t)
+	a, b := New(db, time.Minute), New(db, time.Minute)
+	ja := due(t, db, a, "sweep", 20*time.Millisecond, noop)
+	jb := due(t, db, b, "sweep", 20*time.Millisecond, noop)
+
+	if !a.acquire(ja) {
+		t.Fatal("first instance did not get the lease")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if !b.acquire(jb) {
+		t.Fatal("second instance could not take over an expired lease")
+	}
+
+	// The first instance finishing late does not release the second one's lease
+	a.execute(context.Background(), ja)
+	if got := jobState(t, db, "sweep"); got.LockedBy != b.instanceID || got.LastStatus != "" {
+		t.Errorf("locked by %q with status %q, want %q's lease untouched", got.LockedBy, got.LastStatus, b.instanceID)
+	}
+}
+
+func TestRunDueRunsJobsConcurrently(t *testing.T) {
+	db := testDB(t)
+	s := New(db, time.Minute)
+
+	// Each job waits for the other to start, so running them one after another never ends
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	block := func(name string) JobFunc {
+		return func(ctx context.Context) error {
+			started <- name
+			select {
+			case <-release:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	due(t, db, s, "first", time.Minute, block("first"))
+	due(t, db, s, "second", time.Minute, block("second"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		s.runDue(ctx)
+		close(done)
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(2 * time.Second):
+			t.Fatal("jobs did not start side by side")
+		}
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("runDue waited for the jobs to finish")
+	}
+
+	close(release)
+	s.Wait()
+	for _, name := range []string{"first", "second"} {
+		if got := jobState(t, db, name); got.LastStatus != "succeeded" || got.LockedBy != "" {
+			t.Errorf("%s: status %q locked by %q, want succeeded and unlocked", name, got.LastStatus, got.LockedBy)
+		}
+	}
+}
+
+func TestPanickingJobIsRecorded(t *testing.T) {
+	db := testDB(t)
+	s := New(db, time.Minute)
+	due(t, db, s, "broken", time.Minute, func(context.Context) error { panic("boom") })
+
+	s.runDue(context.Background())
+	s.Wait()
+	if got := jobState(t, db, "broken"); got.LastStatus != "failed" || got.LastError == "" {
+		t.Errorf("status %q error %q, want the panic recorded as a failure", got.LastStatus, got.LastError)
+	}
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"chama-wallet-backend/mailer"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
+)
+
+// Account token purposes
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+)
+
+const (
+	emailVerificationTTL = 48 * time.Hour
+	passwordResetTTL     = time.Hour
+)
+
+// ErrInvalidAccountToken means a verification or reset link is malformed, expired or
+// already used
+var ErrInvalidAccountToken = errors.New("this link is invalid or has expired")
+
+// accountClaims is a signed, expiring token sent by email. The fingerprint ties it to the
+// account state it was issued for, so a reset link stops working once the password
+// changes and a verification link once the email does.
+type accountClaims struct {
+	Purpose     string `json:"purpose"`
+	Fingerprint string `json:"fp"`
+	jwt.RegisteredClaims
+}
+
+// SendVerificationEmail mails the user a link that confirms their email address
+func SendVerificationEmail(user models.User) error {
+	token, err := accountToken(user, PurposeVerifyEmail, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return mailer.Default.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address to join savings groups and receive payouts:\n\n%s\n\nThe link expires in %d hours.",
+			user.Name, accountLink("/verify-email", token), int(emailVerificationTTL.Hours())),
+	})
+}
+
+// VerifyEmail marks the email address in a verification token as confirmed
+func VerifyEmail(ctx context.Context, token string) (models.User, error) {
+	user, err := parseAccountToken(token, PurposeVerifyEmail)
+	if err != nil {
+		return user, err
+	}
+	if user.EmailVerifiedAt != nil {
+		return user, nil
+	}
+
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	if err := repository.Default.Users.Save(&user); err != nil {
+		return user, err
+	}
+	slog.InfoContext(ctx, "email verified", "user_id", user.ID)
+	return user, nil
+}
+
+// RequestPasswordReset mails a reset link if an account uses the email. It reports
+// nothing about whether one does.
+func RequestPasswordReset(email string) error {
+	user, err := repository.Default.Users.ByEmail(strings.TrimSpace(email))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := accountToken(user, PurposeResetPassword, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+	return mailer.Default.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. If it was you, choose a new password here:\n\n%s\n\nThe link expires in %d minutes. If you did not ask for this, ignore this email.",
+			user.Name, accountLink("/reset-password", token), int(passwordResetTTL.Minutes())),
+	})
+}
+
+// ResetPassword sets a new password from a reset token and signs the user out everywhere
+func ResetPassword(ctx context.Context, token, password string) (models.User, error) {
+	user, err := parseAccountToken(token, PurposeResetPassword)
+	if err != nil {
+		return user, err
+	}
+	if len(password) < 6 {
+		return user, opError(ErrInvalid, "Password must be at least 6 characters long")
+	}
+
+	hashed, err := HashPassword(password)
+	if err != nil {
+		return user, err
+	}
+	user.Password = hashed
+	// The link proves the user can read mail sent to the address
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	if err := repository.Default.Users.Save(&user); err != nil {
+		return user, err
+	}
+
+	if _, err := repository.Default.Sessions.RevokeForUser(user.ID, ""); err != nil {
+		return user, err
+	}
+	slog.InfoContext(ctx, "password reset, all sessions revoked", "user_id", user.ID)
+
+	return user, nil
+}
+
+// RequireVerifiedEmail stops users who have not confirmed their email address
+func RequireVerifiedEmail(user models.User) error {
+	if user.EmailVerifiedAt == nil {
+		return opError(ErrForbidden, "Verify your email address first")
+	}
+	return nil
+}
+
+func accountToken(user models.User, purpose string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	return signToken(&accountClaims{
+		Purpose:     purpose,
+		Fingerprint: accountFingerprint(user, purpose),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.ID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	})
+}
+
+// parseAccountToken checks a token's signature, expiry, purpose and fingerprint and
+// returns the account it was issued for
+func parseAccountToken(token, purpose string) (models.User, error) {
+	claims := &accountClaims{}
+	if err := parseToken(token, claims); err != nil || claims.Purpose != purpose {
+		return models.User{}, opError(ErrInvalid, ErrInvalidAccountToken.Error())
+	}
+	user, err := repository.Default.Users.ByID(claims.Subject)
+	if err != nil || claims.Fingerprint != accountFingerprint(user, purpose) {
+		return models.User{}, opError(ErrInvalid, ErrInvalidAccountToken.Error())
+	}
+	return user, nil
+}
+
+func accountFingerprint(user models.User, purpose string) string {
+	state := user.Email
+	if purpose == PurposeResetPassword {
+		state = user.Password
+	}
+	sum := sha256.Sum256([]byte(purpose + ":" + state))
+	return hex.EncodeToString(sum[:16])
+}
+
+// accountLink is the frontend page that handles a token, under APP_URL
+func accountLink(path, token string) string {
+	base := os.Getenv("APP_URL")
+	if base == "" {
+		base = "http://localhost:5173"
+	}
+	return strings.TrimRight(base, "/") + path + "?token=" + url.QueryEscape(token)
+}
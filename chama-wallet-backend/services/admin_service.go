@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+
+	"gorm.io/gorm"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/policy"
+)
+
+// NominationsNeeded is how many open nominations make a member an admin. It takes two
+// members; on a multisig treasury the nominators are its signers and sign the change of
+// signers, so it takes as many as the signer threshold, or the only signer if there is one.
+func NominationsNeeded(group models.Group) int {
+	if !group.Multisig {
+		return 2
+	}
+	needed := 2
+	if signers := len(GroupTreasurySigners(group)); signers < needed {
+		needed = signers
+	}
+	if group.SignerThreshold > needed {
+		needed = group.SignerThreshold
+	}
+	return needed
+}
+
+// PromoteToAdmin makes the nominee an admin and approves their nominations. Admins sign
+// for a multisig treasury, so on an active group the nominee's wallet is added to the
+// treasury's signers in the same step, signed only by the signers who nominated them;
+// the promotion is refused if they do not reach the signer threshold.
+func PromoteToAdmin(ctx context.Context, groupID, nomineeID string) error {
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var group models.Group
+		if err := database.ForUpdate(tx).First(&group, "id = ?", groupID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return opError(ErrNotFound, "Group not found")
+			}
+			return err
+		}
+
+		var nominee models.Member
+		if err := tx.Preload("User").Where("group_id = ? AND user_id = ? AND status = ?", groupID, nomineeID, "approved").
+			First(&nominee).Error; err != nil {
+			return opError(ErrNotFound, "Nominee is not a group member")
+		}
+
+		if err := tx.Model(&models.Member{}).Where("id = ?", nominee.ID).Update("role", policy.RoleAdmin).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.AdminNomination{}).
+			Where("group_id = ? AND nominee_id = ?", groupID, nomineeID).
+			Update("status", "approved").Error; err != nil {
+			return err
+		}
+
+		if !group.Multisig || IsTreasurySigner(group, nominee.User.Wallet) {
+			return nil
+		}
+		if nominee.User.Wallet == "" {
+			return opError(ErrInvalid, "Nominee has no wallet to sign for the treasury")
+		}
+
+		// The signer change is the only step on the ledger and runs last. A nomination is
+		// the signer's approval of it, so only nominators' keys sign.
+		var nominators []models.User
+		if err := tx.Where("id IN (?)", tx.Model(&models.AdminNomination{}).Select("nominator_id").
+			Where("group_id = ? AND nominee_id = ? AND status = ?", groupID, nomineeID, "approved")).
+			Find(&nominators).Error; err != nil {
+			return err
+		}
+		keys := map[string]string{}
+		for _, nominator := range nominators {
+			if IsTreasurySigner(group, nominator.Wallet) {
+				keys[nominator.Wallet] = nominator.SecretKey
+			}
+		}
+
+		signers := append(GroupTreasurySigners(group), nominee.User.Wallet)
+		signersJSON, _ := json.Marshal(signers)
+		if err := tx.Model(&models.Group{}).Where("id = ?", groupID).
+			Update("treasury_signers", string(signersJSON)).Error; err != nil {
+			return err
+		}
+
+		if _, err := UpdateTreasurySigners(ctx, group, signers, keys); err != nil {
+			slog.ErrorContext(ctx, "failed to add treasury signer", "group_id", groupID, "user_id", nomineeID, "error", err)
+			if errors.Is(err, ErrSignersUnavailable) {
+				return opError(ErrConflict, "Admins sign for the treasury, and %d of its signers must nominate the nominee to add them", group.SignerThreshold)
+			}
+			return opError(ErrInvalid, "Failed to add the nominee as a treasury signer: %v", err)
+		}
+		return nil
+	})
+}
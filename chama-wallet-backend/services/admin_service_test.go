@@ -0,0 +1,82 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stellar/go/clients/horizonclient"
+
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
+	"chama-wallet-backend/services"
+)
+
+func TestPromoteToAdminAddsTreasurySignerApprovedBySigners(t *testing.T) {
+	e := newEnv(t)
+	group, creator, members := activeGroup(t, e, 2, models.GroupSettings{ContributionAmount: 10, ContributionPeriod: 7, PayoutMode: services.PayoutAuction})
+	nominee := members[0].User
+	nominate := func(nominatorID string) {
+		t.Helper()
+		if err := repository.Default.Members.CreateNomination(&models.AdminNomination{
+			ID: uuid.NewString(), GroupID: group.ID, NominatorID: nominatorID, NomineeID: nominee.ID,
+			Status: "pending", CreatedAt: time.Now(),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only signers who nominated the nominee sign the change: a member's nomination is
+	// not the creator's approval, and the creator's stored key is not used without one
+	nominate(members[1].User.ID)
+	if err := services.PromoteToAdmin(e.Context(), group.ID, nominee.ID); !errors.Is(err, services.ErrConflict) {
+		t.Fatalf("promote without a signer's nomination: %v, want conflict", err)
+	}
+	if member, _ := repository.Default.Members.Approved(group.ID, nominee.ID); member.Role != "member" {
+		t.Errorf("role %q after a refused promotion, want member", member.Role)
+	}
+	if unchanged, _ := repository.Default.Groups.ByID(group.ID); services.IsTreasurySigner(unchanged, nominee.Wallet) {
+		t.Errorf("nominee became a signer without the signers' approval")
+	}
+
+	nominate(creator.User.ID)
+	if err := services.PromoteToAdmin(e.Context(), group.ID, nominee.ID); err != nil {
+		t.Fatalf("promote: %v", err)
+	}
+
+	promoted, err := repository.Default.Groups.ByID(group.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !services.IsTreasurySigner(promoted, nominee.Wallet) || !services.IsTreasurySigner(promoted, creator.User.Wallet) {
+		t.Fatalf("treasury signers %s, want the creator and the nominee", promoted.TreasurySigners)
+	}
+	account, err := e.Ledger.AccountDetail(horizonclient.AccountRequest{AccountID: group.Wallet})
+	if err != nil {
+		t.Fatal(err)
+	}
+	weights := map[string]int32{}
+	for _, signer := range account.Signers {
+		weights[signer.Key] = signer.Weight
+	}
+	if weights[nominee.Wallet] != 1 || weights[creator.User.Wallet] != 1 {
+		t.Errorf("ledger signers %v, want the creator and the nominee with weight 1", weights)
+	}
+
+	// Promoting again leaves the signers alone
+	if err := services.PromoteToAdmin(e.Context(), group.ID, nominee.ID); err != nil {
+		t.Fatalf("second promote: %v", err)
+	}
+	if again, _ := repository.Default.Groups.ByID(group.ID); again.TreasurySigners != promoted.TreasurySigners {
+		t.Errorf("signers %s after a second promotion, want %s", again.TreasurySigners, promoted.TreasurySigners)
+	}
+
+	outsider, err := e.Register("Outsider", "outsider@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := services.PromoteToAdmin(e.Context(), group.ID, outsider.User.ID); !errors.Is(err, services.ErrNotFound) {
+		t.Errorf("promote outsider: %v, want not found", err)
+	}
+}
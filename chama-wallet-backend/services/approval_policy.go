@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/policy"
+)
+
+// Approval policy kinds
+const (
+	PolicyCount           = "count"            // a fixed number of admin approvals
+	PolicyPercentAdmins   = "percent_admins"   // a percentage of the group's admins
+	PolicyMajorityMembers = "majority_members" // more than half of all members, any member votes
+)
+
+// GroupApprovalPolicy returns the approval policy stored on the group
+func GroupApprovalPolicy(group models.Group) models.ApprovalPolicy {
+	policy := models.ApprovalPolicy{
+		Kind:        group.ApprovalPolicy,
+		Count:       group.ApprovalCount,
+		Percent:     group.ApprovalPercent,
+		ExpiryHours: group.ApprovalExpiryHours,
+		Veto:        group.ApprovalVeto,
+	}
+	if policy.Kind == "" {
+		policy.Kind = PolicyCount
+	}
+	if policy.Kind == PolicyCount && policy.Count < 1 {
+		policy.Count = 1
+	}
+	return policy
+}
+
+// ValidateApprovalPolicy checks a policy can be met by the group's current admins
+func ValidateApprovalPolicy(policy models.ApprovalPolicy, adminCount int) error {
+	switch policy.Kind {
+	case PolicyCount:
+		if policy.Count < 1 || policy.Count > adminCount {
+			return fmt.Errorf("approval count must be between 1 and %d", adminCount)
+		}
+	case PolicyPercentAdmins:
+		if policy.Percent < 1 || policy.Percent > 100 {
+			return fmt.Errorf("approval percent must be between 1 and 100")
+		}
+	case PolicyMajorityMembers:
+	default:
+		return fmt.Errorf("unknown approval policy %q", policy.Kind)
+	}
+	if policy.ExpiryHours < 0 {
+		return fmt.Errorf("expiry hours cannot be negative")
+	}
+	return nil
+}
+
+// ApprovalPolicyUpdates returns the group columns that store a policy
+func ApprovalPolicyUpdates(policy models.ApprovalPolicy) map[string]interface{} {
+	return map[string]interface{}{
+		"approval_policy":       policy.Kind,
+		"approval_count":        policy.Count,
+		"approval_percent":      policy.Percent,
+		"approval_expiry_hours": policy.ExpiryHours,
+		"approval_veto":         policy.Veto,
+	}
+}
+
+// CanVoteOnPayout reports whether the member may vote on the group's payout requests
+func CanVoteOnPayout(group models.Group, member models.Member) bool {
+	return policy.Allows(group, member, policy.ApprovePayout)
+}
+
+// PayoutExpiry returns when a payout request created at createdAt expires, if ever
+func PayoutExpiry(group models.Group, createdAt time.Time) *time.Time {
+	hours := GroupApprovalPolicy(group).ExpiryHours
+	if hours <= 0 {
+		return nil
+	}
+	expiresAt := createdAt.Add(time.Duration(hours) * time.Hour)
+	return &expiresAt
+}
+
+// TallyPayout counts the votes on a payout request and decides its outcome under the
+// group's approval policy. Multisig treasuries also need the on-chain signature threshold.
+// This is the only place the policy is applied.
+func TallyPayout(group models.Group, payoutRequest models.PayoutRequest) (models.PayoutTally, error) {
+	return tallyPayout(database.DB, group, payoutRequest)
+}
+
+func tallyPayout(db *gorm.DB, group models.Group, payoutRequest models.PayoutRequest) (models.PayoutTally, error) {
+	var members []models.Member
+	if err := db.Where("group_id = ? AND status = ?", group.ID, "approved").Find(&members).Error; err != nil {
+		return models.PayoutTally{}, err
+	}
+	var admins int
+	for _, member := range members {
+		if policy.IsAdmin(member.Role) {
+			admins++
+		}
+	}
+
+	policy := GroupApprovalPolicy(group)
+	tally := models.PayoutTally{
+		Policy:    policy.Kind,
+		Veto:      policy.Veto,
+		ExpiresAt: payoutRequest.ExpiresAt,
+		Outcome:   "pending",
+	}
+
+	switch policy.Kind {
+	case PolicyMajorityMembers:
+		tally.Eligible = len(members)
+		tally.Required = len(members)/2 + 1
+	case PolicyPercentAdmins:
+		tally.Eligible = admins
+		tally.Required = (admins*policy.Percent + 99) / 100
+	default:
+		tally.Eligible = admins
+		tally.Required = policy.Count
+	}
+	if tally.Required < 1 {
+		tally.Required = 1
+	}
+
+	var approvals []models.PayoutApproval
+	if err := db.Preload("Admin").Where("payout_request_id = ?", payoutRequest.ID).
+		Find(&approvals).Error; err != nil {
+		return tally, err
+	}
+
+	signerRejections := 0
+	for _, approval := range approvals {
+		if approval.Approved {
+			tally.Approvals++
+			if approval.Signature != "" {
+				tally.Signatures++
+			}
+			continue
+		}
+		tally.Rejections++
+		if group.Multisig && IsTreasurySigner(group, approval.Admin.Wallet) {
+			signerRejections++
+		}
+	}
+
+	signersLeft := true
+	if group.Multisig {
+		tally.SignaturesRequired = group.PayoutThreshold
+		signersLeft = len(GroupTreasurySigners(group))-signerRejections >= group.PayoutThreshold
+	}
+
+	switch {
+	case payoutRequest.Status != "pending":
+		tally.Outcome = payoutRequest.Status
+	case payoutRequest.ExpiresAt != nil && time.Now().After(*payoutRequest.ExpiresAt):
+		tally.Outcome = "expired"
+	case tally.Approvals >= tally.Required && tally.Signatures >= tally.SignaturesRequired:
+		tally.Outcome = "approved"
+	case policy.Veto && tally.Rejections > 0:
+		tally.Outcome = "rejected"
+	case tally.Eligible-tally.Rejections < tally.Required || !signersLeft:
+		// Not enough voters or signers are left to reach the quorum
+		tally.Outcome = "rejected"
+	}
+	return tally, nil
+}
+
+// SettlePayoutVote tallies a pending payout request under a lock on it and records a
+// rejected or expired outcome. An approved outcome is left for the caller to execute.
+func SettlePayoutVote(ctx context.Context, group models.Group, payoutRequest models.PayoutRequest) (models.PayoutTally, error) {
+	var tally models.PayoutTally
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := database.ForUpdate(tx).First(&payoutRequest, "id = ?", payoutRequest.ID).Error; err != nil {
+			return err
+		}
+		var err error
+		tally, err = settlePayoutVote(tx, group, payoutRequest)
+		return err
+	})
+	return tally, err
+}
+
+// settlePayoutVote is SettlePayoutVote within the caller's transaction
+func settlePayoutVote(tx *gorm.DB, group models.Group, payoutRequest models.PayoutRequest) (models.PayoutTally, error) {
+	tally, err := tallyPayout(tx, group, payoutRequest)
+	if err != nil {
+		return tally, err
+	}
+	if payoutRequest.Status == "pending" && (tally.Outcome == "rejected" || tally.Outcome == "expired") {
+		slog.InfoContext(tx.Statement.Context, "payout vote settled", "payout_id", payoutRequest.ID,
+			"outcome", tally.Outcome, "approvals", tally.Approvals, "rejections", tally.Rejections)
+		err = tx.Model(&models.PayoutRequest{}).
+			Where("id = ? AND status = ?", payoutRequest.ID, "pending").
+			Update("status", tally.Outcome).Error
+		if err == nil && payoutRequest.LoanID != "" {
+			err = closeLoanDisbursement(tx, payoutRequest.ID, tally.Outcome)
+		}
+		if err == nil && payoutRequest.SettlementID != "" {
+			err = closeSettlementBatch(tx, payoutRequest.SettlementID, tally.Outcome)
+		}
+	}
+	return tally, err
+}
+
+// ExpirePayoutRequests marks pending payout requests past their approval window as
+// expired, along with the loans they would have disbursed and the share-outs they
+// would have paid
+func ExpirePayoutRequests(ctx context.Context) error {
+	result := database.DB.WithContext(ctx).Model(&models.PayoutRequest{}).
+		Where("status = ? AND expires_at IS NOT NULL AND expires_at < ?", "pending", time.Now()).
+		Update("status", "expired")
+	if result.Error != nil {
+		return result.Error
+	}
+	if err := database.DB.WithContext(ctx).Model(&models.Loan{}).
+		Where("status = ? AND payout_request_id IN (?)", "approving",
+			database.DB.Model(&models.PayoutRequest{}).Select("id").Where("status = ?", "expired")).
+		Updates(map[string]interface{}{"status": "expired", "updated_at": time.Now()}).Error; err != nil {
+		return err
+	}
+	var batches []models.PayoutRequest
+	if err := database.DB.WithContext(ctx).
+		Where("status = ? AND settlement_id IN (?)", "expired",
+			database.DB.Model(&models.Settlement{}).Select("id").Where("status = ?", "approving")).
+		Find(&batches).Error; err != nil {
+		return err
+	}
+	for _, batch := range batches {
+		if err := closeSettlementBatch(database.DB.WithContext(ctx), batch.SettlementID, "expired"); err != nil {
+			return err
+		}
+	}
+	if result.RowsAffected > 0 {
+		slog.InfoContext(ctx, "expired payout requests", "count", result.RowsAffected)
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stellar/go/keypair"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/policy"
+)
+
+// vote is a member's vote on the payout in a tally test, by their index
+type vote struct {
+	voter    int
+	approved bool
+	signed   bool
+}
+
+func TestTallyPayout(t *testing.T) {
+	db, err := database.Open("sqlite", fmt.Sprintf("file:tally-%s?mode=memory&cache=shared", uuid.NewString()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.MigrateSQLite(db); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	admins3 := []string{policy.RoleCreator, policy.RoleAdmin, policy.RoleAdmin}
+	mixed5 := []string{policy.RoleCreator, policy.RoleAdmin, policy.RoleMember, policy.RoleMember, policy.RoleTreasurer}
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		group     models.Group // approval policy and multisig settings
+		roles     []string
+		signers   []int // members who sign for a multisig treasury
+		votes     []vote
+		status    string
+		expiresAt *time.Time
+		want      models.PayoutTally // outcome and counts
+	}{
+		{
+			name:  "count waiting for votes",
+			group: models.Group{ApprovalPolicy: PolicyCount, ApprovalCount: 2},
+			roles: admins3, votes: []vote{{0, true, false}},
+			want: models.PayoutTally{Outcome: "pending", Approvals: 1, Required: 2, Eligible: 3},
+		},
+		{
+			name:  "count reached",
+			group: models.Group{ApprovalPolicy: PolicyCount, ApprovalCount: 2},
+			roles: admins3, votes: []vote{{0, true, false}, {2, true, false}},
+			want: models.PayoutTally{Outcome: "approved", Approvals: 2, Required: 2, Eligible: 3},
+		},
+		{
+			name:  "count defaults to one",
+			group: models.Group{},
+			roles: admins3, votes: []vote{{1, true, false}},
+			want: models.PayoutTally{Outcome: "approved", Approvals: 1, Required: 1, Eligible: 3},
+		},
+		{
+			name:  "count out of reach once too few voters are left",
+			group: models.Group{ApprovalPolicy: PolicyCount, ApprovalCount: 2},
+			roles: admins3, votes: []vote{{0, false, false}, {1, false, false}},
+			want: models.PayoutTally{Outcome: "rejected", Rejections: 2, Required: 2, Eligible: 3},
+		},
+		{
+			name:  "one rejection without veto",
+			group: models.Group{ApprovalPolicy: PolicyCount, ApprovalCount: 2},
+			roles: admins3, votes: []vote{{0, true, false}, {1, false, false}},
+			want: models.PayoutTally{Outcome: "pending", Approvals: 1, Rejections: 1, Required: 2, Eligible: 3},
+		},
+		{
+			name:  "one rejection with veto",
+			group: models.Group{ApprovalPolicy: PolicyCount, ApprovalCount: 2, ApprovalVeto: true},
+			roles: admins3, votes: []vote{{0, true, false}, {1, false, false}},
+			want: models.PayoutTally{Outcome: "rejected", Approvals: 1, Rejections: 1, Required: 2, Eligible: 3, Veto: true},
+		},
+		{
+			name:  "veto comes too late once approved",
+			group: models.Group{ApprovalPolicy: PolicyCount, ApprovalCount: 1, ApprovalVeto: true},
+			roles: admins3, votes: []vote{{0, true, false}, {1, false, false}},
+			want: models.PayoutTally{Outcome: "approved", Approvals: 1, Rejections: 1, Required: 1, Eligible: 3, Veto: true},
+		},
+		{
+			name:  "percent of admins rounds up",
+			group: models.Group{ApprovalPolicy: PolicyPercentAdmins, ApprovalPercent: 50},
+			roles: admins3, votes: []vote{{0, true, false}},
+			want: models.PayoutTally{Outcome: "pending", Approvals: 1, Required: 2, Eligible: 3},
+		},
+		{
+			name:  "percent of admins reached",
+			group: models.Group{ApprovalPolicy: PolicyPercentAdmins, ApprovalPercent: 50},
+			roles: mixed5, votes: []vote{{1, true, false}},
+			want: models.PayoutTally{Outcome: "approved", Approvals: 1, Required: 1, Eligible: 2},
+		},
+		{
+			name:  "all admins, one rejects",
+			group: models.Group{ApprovalPolicy: PolicyPercentAdmins, ApprovalPercent: 100},
+			roles: admins3, votes: []vote{{0, true, false}, {2, false, false}},
+			want: models.PayoutTally{Outcome: "rejected", Approvals: 1, Rejections: 1, Required: 3, Eligible: 3},
+		},
+		{
+			name:  "majority of members waiting",
+			group: models.Group{ApprovalPolicy: PolicyMajorityMembers},
+			roles: mixed5, votes: []vote{{0, true, false}, {2, true, false}},
+			want: models.PayoutTally{Outcome: "pending", Approvals: 2, Required: 3, Eligible: 5},
+		},
+		{
+			name:  "majority of members reached",
+			group: models.Group{ApprovalPolicy: PolicyMajorityMembers},
+			roles: mixed5, votes: []vote{{2, true, false}, {3, true, false}, {4, true, false}},
+			want: models.PayoutTally{Outcome: "approved", Approvals: 3, Required: 3, Eligible: 5},
+		},
+		{
+			name:  "majority out of reach",
+			group: models.Group{ApprovalPolicy: PolicyMajorityMembers},
+			roles: mixed5, votes: []vote{{2, false, false}, {3, false, false}, {4, false, false}},
+			want: models.PayoutTally{Outcome: "rejected", Rejections: 3, Required: 3, Eligible: 5},
+		},
+		{
+			name:  "expired with enough approvals",
+			group: models.Group{ApprovalPolicy: PolicyCount, ApprovalCount: 1},
+			roles: admins3, votes: []vote{{0, true, false}}, expiresAt: &past,
+			want: models.PayoutTally{Outcome: "expired", Approvals: 1, Required: 1, Eligible: 3},
+		},
+		{
+			name:  "not yet expired",
+			group: models.Group{ApprovalPolicy: PolicyCount, ApprovalCount: 2},
+			roles: admins3, votes: []vote{{0, true, false}}, expiresAt: &future,
+			want: models.PayoutTally{Outcome: "pending", Approvals: 1, Required: 2, Eligible: 3},
+		},
+		{
+			name:  "settled request keeps its status",
+			group: models.Group{ApprovalPolicy: PolicyCount, ApprovalCount: 2},
+			roles: admins3, votes: []vote{{0, true, false}}, status: "completed", expiresAt: &past,
+			want: models.PayoutTally{Outcome: "completed", Approvals: 1, Required: 2, Eligible: 3},
+		},
+		{
+			name:  "multisig approved but short of signatures",
+			group: models.Group{ApprovalPolicy: PolicyCount, ApprovalCount: 1, Multisig: true, PayoutThreshold: 2},
+			roles: admins3, signers: []int{0, 1, 2},
+			votes: []vote{{0, true, true}, {1, true, false}},
+			want:  models.PayoutTally{Outcome: "pending", Approvals: 2, Signatures: 1, SignaturesRequired: 2, Required: 1, Eligible: 3},
+		},
+		{
+			name:  "multisig with enough signatures",
+			group: models.Group{ApprovalPolicy: PolicyCount, ApprovalCount: 1, Multisig: true, PayoutThreshold: 2},
+			roles: admins3, signers: []int{0, 1, 2},
+			votes: []vote{{0, true, true}, {2, true, true}},
+			want:  models.PayoutTally{Outcome: "approved", Approvals: 2, Signatures: 2, SignaturesRequired: 2, Required: 1, Eligible: 3},
+		},
+		{
+			name:  "multisig rejected once too few signers are left",
+			group: models.Group{ApprovalPolicy: PolicyMajorityMembers, Multisig: true, PayoutThreshold: 2},
+			roles: mixed5, signers: []int{0, 1},
+			votes: []vote{{2, true, false}, {3, true, false}, {1, false, false}},
+			want:  models.PayoutTally{Outcome: "rejected", Approvals: 2, Rejections: 1, SignaturesRequired: 2, Required: 3, Eligible: 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group := tt.group
+			group.ID = uuid.NewString()
+
+			users := make([]models.User, len(tt.roles))
+			for i, role := range tt.roles {
+				users[i] = models.User{ID: uuid.NewString(), Email: uuid.NewString() + "@example.com", Wallet: keypair.MustRandom().Address()}
+				member := models.Member{ID: uuid.NewString(), GroupID: group.ID, UserID: users[i].ID, Role: role, Status: "approved"}
+				if err := db.Create(&users[i]).Error; err != nil {
+					t.Fatal(err)
+				}
+				if err := db.Omit("User").Create(&member).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			// A pending member neither counts nor votes
+			outsider := models.User{ID: uuid.NewString(), Email: uuid.NewString() + "@example.com"}
+			db.Create(&outsider)
+			db.Omit("User").Create(&models.Member{ID: uuid.NewString(), GroupID: group.ID, UserID: outsider.ID, Role: policy.RoleAdmin, Status: "pending"})
+
+			var signers []string
+			for _, i := range tt.signers {
+				signers = append(signers, users[i].Wallet)
+			}
+			signersJSON, _ := json.Marshal(signers)
+			group.TreasurySigners = string(signersJSON)
+
+			status := tt.status
+			if status == "" {
+				status = "pending"
+			}
+			payout := models.PayoutRequest{ID: uuid.NewString(), GroupID: group.ID, Status: status, ExpiresAt: tt.expiresAt}
+			for _, v := range tt.votes {
+				approval := models.PayoutApproval{ID: uuid.NewString(), PayoutRequestID: payout.ID, AdminID: users[v.voter].ID, Approved: v.approved}
+				if v.signed {
+					approval.Signature = "signature"
+				}
+				if err := db.Omit("PayoutRequest", "Admin").Create(&approval).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tally, err := tallyPayout(db, group, payout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := models.PayoutTally{
+				Outcome: tally.Outcome, Approvals: tally.Approvals, Rejections: tally.Rejections,
+				Required: tally.Required, Eligible: tally.Eligible, Signatures: tally.Signatures,
+				SignaturesRequired: tally.SignaturesRequired, Veto: tally.Veto,
+			}
+			if got != tt.want {
+				t.Errorf("tally %+v, want %+v", got, tt.want)
+			}
+			if tally.Policy != GroupApprovalPolicy(group).Kind {
+				t.Errorf("policy %q, want %q", tally.Policy, GroupApprovalPolicy(group).Kind)
+			}
+		})
+	}
+}
+
+func TestValidateApprovalPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy models.ApprovalPolicy
+		admins int
+		valid  bool
+	}{
+		{"count within the admins", models.ApprovalPolicy{Kind: PolicyCount, Count: 2}, 3, true},
+		{"count of every admin", models.ApprovalPolicy{Kind: PolicyCount, Count: 3}, 3, true},
+		{"count above the admins", models.ApprovalPolicy{Kind: PolicyCount, Count: 4}, 3, false},
+		{"count of zero", models.ApprovalPolicy{Kind: PolicyCount}, 3, false},
+		{"percent", models.ApprovalPolicy{Kind: PolicyPercentAdmins, Percent: 51}, 1, true},
+		{"percent of zero", models.ApprovalPolicy{Kind: PolicyPercentAdmins}, 3, false},
+		{"percent over 100", models.ApprovalPolicy{Kind: PolicyPercentAdmins, Percent: 101}, 3, false},
+		{"majority of members", models.ApprovalPolicy{Kind: PolicyMajorityMembers, Veto: true}, 1, true},
+		{"expiry", models.ApprovalPolicy{Kind: PolicyMajorityMembers, ExpiryHours: 48}, 1, true},
+		{"negative expiry", models.ApprovalPolicy{Kind: PolicyMajorityMembers, ExpiryHours: -1}, 1, false},
+		{"unknown kind", models.ApprovalPolicy{Kind: "unanimous"}, 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateApprovalPolicy(tt.policy, tt.admins)
+			if (err == nil) != tt.valid {
+				t.Errorf("error %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
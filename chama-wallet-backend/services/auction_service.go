@@ -0,0 +1,451 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+)
+
+// Payout modes of rotating groups
+const (
+	PayoutFixed   = "fixed"   // the payout_order given on activation
+	PayoutAuction = "auction" // each round's pot goes to the highest discount bid
+	PayoutDraw    = "draw"    // the order is drawn from a committed seed and a future ledger hash
+)
+
+// Where an auction discount goes
+const (
+	DiscountToMembers = "members" // split equally among the other members in the round's payout
+	DiscountToGroup   = "group"   // kept in the group wallet as group profit
+)
+
+// ProfitAuctionDiscount is the profit source of a discount the group keeps
+const ProfitAuctionDiscount = "auction_discount"
+
+// Bid windows stay open for 48 hours unless the admins say otherwise
+const (
+	defaultBidWindow = 48 * time.Hour
+	maxBidWindow     = 30 * 24 * time.Hour
+)
+
+// PayoutMode returns how the group decides who is paid each round
+func PayoutMode(group models.Group) string {
+	if group.PayoutMode == "" {
+		return PayoutFixed
+	}
+	return group.PayoutMode
+}
+
+// GroupAuctionPolicy returns where the group's auction discounts go
+func GroupAuctionPolicy(group models.Group) models.AuctionPolicy {
+	policy := models.AuctionPolicy{DiscountTo: group.AuctionDiscountTo}
+	if policy.DiscountTo == "" {
+		policy.DiscountTo = DiscountToMembers
+	}
+	return policy
+}
+
+// ValidateAuctionPolicy checks the group can use the auction policy
+func ValidateAuctionPolicy(policy models.AuctionPolicy) error {
+	switch policy.DiscountTo {
+	case DiscountToMembers, DiscountToGroup:
+		return nil
+	default:
+		return fmt.Errorf("discount_to must be %q or %q", DiscountToMembers, DiscountToGroup)
+	}
+}
+
+// EligibleBidders returns the approved members who have not been given a round yet,
+// longest-standing first
+func EligibleBidders(groupID string) ([]models.Member, error) {
+	return eligibleBidders(database.DB, groupID)
+}
+
+func eligibleBidders(db *gorm.DB, groupID string) ([]models.Member, error) {
+	var members []models.Member
+	err := db.Where("group_id = ? AND status = ? AND id NOT IN (?)", groupID, "approved",
+		db.Model(&models.PayoutSchedule{}).Select("member_id").Where("group_id = ?", groupID)).
+		Order("joined_at ASC").
+		Find(&members).Error
+	return members, err
+}
+
+// OpenBidWindow starts the auction of a round's pot. Round 0 means the group's current
+// round. Only one window is open in a group at a time.
+func OpenBidWindow(ctx context.Context, groupID string, round int, duration time.Duration) (models.BidWindow, error) {
+	var window models.BidWindow
+	var group models.Group
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := database.ForUpdate(tx).First(&group, "id = ?", groupID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return opError(ErrNotFound, "Group not found")
+			}
+			return err
+		}
+		if group.Status != "active" {
+			return opError(ErrInvalid, "Group is not active")
+		}
+		if PayoutMode(group) != PayoutAuction {
+			return opError(ErrInvalid, "Group does not auction its payouts")
+		}
+
+		if round == 0 {
+			round = group.CurrentRound
+		}
+		if round < group.CurrentRound {
+			return opError(ErrInvalid, "Round %d has already passed", round)
+		}
+		if duration == 0 {
+			duration = defaultBidWindow
+		}
+		if duration < time.Hour || duration > maxBidWindow {
+			return opError(ErrInvalid, "Bid window must be open between 1 hour and 30 days")
+		}
+
+		var existing int64
+		if err := tx.Model(&models.BidWindow{}).
+			Where("group_id = ? AND (status = ? OR round = ?)", groupID, "open", round).
+			Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return opError(ErrConflict, "Round %d has been auctioned or another auction is open", round)
+		}
+
+		var scheduled int64
+		if err := tx.Model(&models.PayoutSchedule{}).Where("group_id = ? AND round = ?", groupID, round).
+			Count(&scheduled).Error; err != nil {
+			return err
+		}
+		if scheduled > 0 {
+			return opError(ErrConflict, "Round %d already has a recipient", round)
+		}
+
+		eligible, err := eligibleBidders(tx, groupID)
+		if err != nil {
+			return err
+		}
+		if len(eligible) == 0 {
+			return opError(ErrConflict, "Every member has already been paid")
+		}
+
+		var members int64
+		if err := tx.Model(&models.Member{}).Where("group_id = ? AND status = ?", groupID, "approved").
+			Count(&members).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		window = models.BidWindow{
+			ID:         uuid.NewString(),
+			GroupID:    groupID,
+			Round:      round,
+			Pot:        stroops(group.ContributionAmount * float64(members)),
+			DiscountTo: GroupAuctionPolicy(group).DiscountTo,
+			Status:     "open",
+			ClosesAt:   now.Add(duration),
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		return tx.Create(&window).Error
+	})
+	if err != nil {
+		return window, err
+	}
+
+	slog.InfoContext(ctx, "bid window opened", "group_id", groupID, "window_id", window.ID,
+		"round", window.Round, "pot", window.Pot, "closes_at", window.ClosesAt)
+
+	eligible, _ := EligibleBidders(groupID)
+	for _, member := range eligible {
+		CreateNotification(
+			member.UserID,
+			groupID,
+			"bid_window_open",
+			"Payout Auction Open",
+			fmt.Sprintf("Bid for the round %d pot of %.2f XLM in %s before %s", window.Round, window.Pot, group.Name, window.ClosesAt.Format(time.RFC1123)),
+		)
+	}
+	return window, nil
+}
+
+// PlaceBid records the member's sealed bid in an open window, replacing their earlier
+// bid. The discount is the XLM the member would give up to be paid this round.
+func PlaceBid(ctx context.Context, groupID, windowID string, member models.Member, discount float64) (models.PayoutBid, error) {
+	var bid models.PayoutBid
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var window models.BidWindow
+		if err := database.ForUpdate(tx).Where("id = ? AND group_id = ?", windowID, groupID).
+			First(&window).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return opError(ErrNotFound, "Bid window not found")
+			}
+			return err
+		}
+		if window.Status != "open" || !time.Now().Before(window.ClosesAt) {
+			return opError(ErrConflict, "Bidding for round %d has closed", window.Round)
+		}
+		discount = stroops(discount)
+		if discount < 0 || discount >= window.Pot {
+			return opError(ErrInvalid, "Discount must be at least 0 and less than the pot of %.2f XLM", window.Pot)
+		}
+
+		var paid int64
+		if err := tx.Model(&models.PayoutSchedule{}).Where("group_id = ? AND member_id = ?", groupID, member.ID).
+			Count(&paid).Error; err != nil {
+			return err
+		}
+		if paid > 0 {
+			return opError(ErrForbidden, "Members who have had their round cannot bid")
+		}
+
+		now := time.Now()
+		err := tx.Where("window_id = ? AND member_id = ?", window.ID, member.ID).First(&bid).Error
+		switch {
+		case err == nil:
+			bid.Discount = discount
+			bid.UpdatedAt = now
+			return tx.Model(&models.PayoutBid{}).Where("id = ?", bid.ID).
+				Updates(map[string]interface{}{"discount": discount, "updated_at": now}).Error
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			bid = models.PayoutBid{
+				ID:        uuid.NewString(),
+				WindowID:  window.ID,
+				MemberID:  member.ID,
+				Discount:  discount,
+				CreatedAt: now,
+				UpdatedAt: now,
+			}
+			return tx.Omit("Member").Create(&bid).Error
+		default:
+			return err
+		}
+	})
+	if err != nil {
+		return bid, err
+	}
+
+	slog.InfoContext(ctx, "bid placed", "window_id", windowID, "member_id", member.ID)
+	return bid, nil
+}
+
+// CloseBidWindow ends an auction once its deadline has passed or every eligible member
+// has bid. The highest discount wins, the earliest bid among equals; with no bids the
+// longest-standing eligible member is paid the full pot. The winner is written into the
+// payout schedule for the round.
+func CloseBidWindow(ctx context.Context, groupID, windowID string) (models.BidWindow, models.PayoutSchedule, error) {
+	var window models.BidWindow
+	var schedule models.PayoutSchedule
+	var group models.Group
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := database.ForUpdate(tx).First(&group, "id = ?", groupID).Error; err != nil {
+			return err
+		}
+		if err := database.ForUpdate(tx).Where("id = ? AND group_id = ?", windowID, groupID).
+			First(&window).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return opError(ErrNotFound, "Bid window not found")
+			}
+			return err
+		}
+		if window.Status != "open" {
+			return opError(ErrConflict, "Bid window is %s", window.Status)
+		}
+
+		eligible, err := eligibleBidders(tx, groupID)
+		if err != nil {
+			return err
+		}
+		if len(eligible) == 0 {
+			return opError(ErrConflict, "Every member has already been paid")
+		}
+		isEligible := map[string]bool{}
+		for _, member := range eligible {
+			isEligible[member.ID] = true
+		}
+
+		var bids []models.PayoutBid
+		if err := tx.Where("window_id = ?", window.ID).Order("discount DESC, updated_at ASC").
+			Find(&bids).Error; err != nil {
+			return err
+		}
+		var valid []models.PayoutBid
+		for _, bid := range bids {
+			if isEligible[bid.MemberID] {
+				valid = append(valid, bid)
+			}
+		}
+		if time.Now().Before(window.ClosesAt) && len(valid) < len(eligible) {
+			return opError(ErrConflict, "Bidding is open until %s; %d of %d members have bid",
+				window.ClosesAt.Format(time.RFC3339), len(valid), len(eligible))
+		}
+
+		window.WinnerID = eligible[0].ID
+		window.Discount = 0
+		if len(valid) > 0 {
+			window.WinnerID = valid[0].MemberID
+			window.Discount = valid[0].Discount
+		}
+
+		now := time.Now()
+		window.Status = "closed"
+		window.ClosedAt = &now
+		if err := tx.Model(&models.BidWindow{}).Where("id = ?", window.ID).Updates(map[string]interface{}{
+			"status":     window.Status,
+			"winner_id":  window.WinnerID,
+			"discount":   window.Discount,
+			"closed_at":  now,
+			"updated_at": now,
+		}).Error; err != nil {
+			return err
+		}
+
+		schedule = models.PayoutSchedule{
+			ID:        uuid.NewString(),
+			GroupID:   groupID,
+			MemberID:  window.WinnerID,
+			Round:     window.Round,
+			Amount:    stroops(window.Pot - window.Discount),
+			Discount:  window.Discount,
+			DueDate:   group.NextContributionDate.AddDate(0, 0, (window.Round-group.CurrentRound)*group.ContributionPeriod),
+			Status:    "scheduled",
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := tx.Omit("Group", "Member").Create(&schedule).Error; err != nil {
+			return err
+		}
+
+		// The payout order lists the winners in the order they won
+		var winner models.Member
+		if err := tx.First(&winner, "id = ?", window.WinnerID).Error; err != nil {
+			return err
+		}
+		var order []string
+		json.Unmarshal([]byte(group.PayoutOrder), &order)
+		orderJSON, _ := json.Marshal(append(order, winner.UserID))
+		if err := tx.Model(&models.Group{}).Where("id = ?", groupID).
+			Update("payout_order", string(orderJSON)).Error; err != nil {
+			return err
+		}
+
+		if window.DiscountTo == DiscountToGroup {
+			return recordProfit(tx, groupID, ProfitAuctionDiscount, window.ID, window.Discount)
+		}
+		return nil
+	})
+	if err != nil {
+		return window, schedule, err
+	}
+
+	slog.InfoContext(ctx, "bid window closed", "group_id", groupID, "window_id", window.ID,
+		"round", window.Round, "winner_id", window.WinnerID, "discount", window.Discount)
+
+	var winner models.Member
+	database.DB.Preload("User").First(&winner, "id = ?", window.WinnerID)
+	var members []models.Member
+	database.DB.Where("group_id = ? AND status = ?", groupID, "approved").Find(&members)
+	for _, member := range members {
+		CreateNotification(
+			member.UserID,
+			groupID,
+			"bid_window_closed",
+			"Payout Auction Closed",
+			fmt.Sprintf("%s wins the round %d payout of %.2f XLM with a discount of %.2f XLM", winner.User.Name, window.Round, schedule.Amount, window.Discount),
+		)
+	}
+	return window, schedule, nil
+}
+
+// CloseBidWindows closes the open bid windows whose deadline has passed, writing each
+// winner, or the longest-standing eligible member when nobody bid, into the schedule
+func CloseBidWindows(ctx context.Context) error {
+	var windows []models.BidWindow
+	if err := database.DB.Where("status = ? AND closes_at <= ?", "open", time.Now()).
+		Find(&windows).Error; err != nil {
+		return err
+	}
+
+	var failed int
+	for _, window := range windows {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		closed, schedule, err := CloseBidWindow(ctx, window.GroupID, window.ID)
+		if err != nil {
+			if errors.Is(err, ErrConflict) {
+				continue // closed by an admin meanwhile, or nobody is left to pay
+			}
+			slog.ErrorContext(ctx, "failed to close bid window", "group_id", window.GroupID, "window_id", window.ID, "error", err)
+			failed++
+			continue
+		}
+
+		_, err = RecordAudit(AuditEntry{
+			GroupID:  closed.GroupID,
+			ActorID:  SystemActor,
+			Action:   AuditAuctionClose,
+			TargetID: closed.ID,
+			After: map[string]interface{}{
+				"round":       closed.Round,
+				"winner_id":   closed.WinnerID,
+				"discount":    closed.Discount,
+				"amount":      schedule.Amount,
+				"discount_to": closed.DiscountTo,
+			},
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to record audit event", "action", AuditAuctionClose, "window_id", closed.ID, "error", err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d bid windows failed to close", failed, len(windows))
+	}
+	return nil
+}
+
+// roundPayments returns the payments a round's payout makes: the pot less any auction
+// discount to the recipient and, when the group splits discounts among its members, an
+// equal part of the discount to each other member, rounded down to the stroop
+func roundPayments(group models.Group, schedule models.PayoutSchedule, recipientWallet string) ([]GroupPayment, error) {
+	payments := []GroupPayment{{Destination: recipientWallet, Amount: fmt.Sprintf("%.7f", schedule.Amount)}}
+	if schedule.Discount <= 0 {
+		return payments, nil
+	}
+
+	var window models.BidWindow
+	if err := database.DB.Where("group_id = ? AND round = ?", group.ID, schedule.Round).First(&window).Error; err != nil {
+		return nil, fmt.Errorf("failed to load bid window for round %d: %w", schedule.Round, err)
+	}
+	if window.DiscountTo != DiscountToMembers {
+		return payments, nil
+	}
+
+	var others []models.Member
+	if err := database.DB.Preload("User").
+		Where("group_id = ? AND status = ? AND id <> ?", group.ID, "approved", schedule.MemberID).
+		Order("joined_at ASC").Find(&others).Error; err != nil {
+		return nil, err
+	}
+	if len(others) == 0 {
+		return payments, nil
+	}
+	share := math.Floor(schedule.Discount/float64(len(others))*1e7) / 1e7
+	if share <= 0 {
+		return payments, nil
+	}
+	for _, member := range others {
+		payments = append(payments, GroupPayment{Destination: member.User.Wallet, Amount: fmt.Sprintf("%.7f", share)})
+	}
+	return payments, nil
+}
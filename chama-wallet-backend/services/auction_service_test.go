@@ -0,0 +1,127 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
+	"chama-wallet-backend/services"
+)
+
+var auctionSettings = models.GroupSettings{ContributionAmount: 10, ContributionPeriod: 7, PayoutMode: services.PayoutAuction}
+
+func TestCloseBidWindowTieGoesToEarliestBid(t *testing.T) {
+	e := newEnv(t)
+	group, _, members := activeGroup(t, e, 3, auctionSettings)
+
+	window, err := services.OpenBidWindow(e.Context(), group.ID, 0, time.Hour)
+	if err != nil {
+		t.Fatalf("open window: %v", err)
+	}
+
+	first, _ := repository.Default.Members.Find(group.ID, members[1].User.ID)
+	second, _ := repository.Default.Members.Find(group.ID, members[0].User.ID)
+	if _, err := services.PlaceBid(e.Context(), group.ID, window.ID, first, 5); err != nil {
+		t.Fatalf("first bid: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, err := services.PlaceBid(e.Context(), group.ID, window.ID, second, 5); err != nil {
+		t.Fatalf("second bid: %v", err)
+	}
+
+	// The deadline passes before everyone bids
+	e.DB.Model(&models.BidWindow{}).Where("id = ?", window.ID).Update("closes_at", time.Now().Add(-time.Minute))
+
+	closed, schedule, err := services.CloseBidWindow(e.Context(), group.ID, window.ID)
+	if err != nil {
+		t.Fatalf("close window: %v", err)
+	}
+	if closed.WinnerID != first.ID {
+		t.Errorf("winner = %s, want the earlier bidder %s", closed.WinnerID, first.ID)
+	}
+	if closed.Discount != 5 || schedule.Amount != window.Pot-5 {
+		t.Errorf("discount %v, amount %v; want 5 off a pot of %v", closed.Discount, schedule.Amount, window.Pot)
+	}
+}
+
+func TestCloseBidWindowRebidLosesTie(t *testing.T) {
+	e := newEnv(t)
+	group, _, members := activeGroup(t, e, 3, auctionSettings)
+
+	window, err := services.OpenBidWindow(e.Context(), group.ID, 0, time.Hour)
+	if err != nil {
+		t.Fatalf("open window: %v", err)
+	}
+	a, _ := repository.Default.Members.Find(group.ID, members[0].User.ID)
+	b, _ := repository.Default.Members.Find(group.ID, members[1].User.ID)
+
+	// a bids first but changes their bid to match b's afterwards
+	if _, err := services.PlaceBid(e.Context(), group.ID, window.ID, a, 2); err != nil {
+		t.Fatalf("bid: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, err := services.PlaceBid(e.Context(), group.ID, window.ID, b, 4); err != nil {
+		t.Fatalf("bid: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, err := services.PlaceBid(e.Context(), group.ID, window.ID, a, 4); err != nil {
+		t.Fatalf("rebid: %v", err)
+	}
+	e.DB.Model(&models.BidWindow{}).Where("id = ?", window.ID).Update("closes_at", time.Now().Add(-time.Minute))
+
+	closed, _, err := services.CloseBidWindow(e.Context(), group.ID, window.ID)
+	if err != nil {
+		t.Fatalf("close window: %v", err)
+	}
+	if closed.WinnerID != b.ID {
+		t.Errorf("winner = %s, want %s whose bid stood longer", closed.WinnerID, b.ID)
+	}
+}
+
+func TestCloseBidWindowsWithoutBidsPaysLongestStandingMember(t *testing.T) {
+	e := newEnv(t)
+	group, creator, _ := activeGroup(t, e, 3, auctionSettings)
+
+	window, err := services.OpenBidWindow(e.Context(), group.ID, 0, time.Hour)
+	if err != nil {
+		t.Fatalf("open window: %v", err)
+	}
+
+	// Still open: the job leaves it alone
+	if err := services.CloseBidWindows(e.Context()); err != nil {
+		t.Fatalf("close windows: %v", err)
+	}
+	var open models.BidWindow
+	e.DB.First(&open, "id = ?", window.ID)
+	if open.Status != "open" {
+		t.Fatalf("window closed before its deadline")
+	}
+
+	e.DB.Model(&models.BidWindow{}).Where("id = ?", window.ID).Update("closes_at", time.Now().Add(-time.Minute))
+	if err := services.CloseBidWindows(e.Context()); err != nil {
+		t.Fatalf("close windows: %v", err)
+	}
+
+	var closed models.BidWindow
+	e.DB.First(&closed, "id = ?", window.ID)
+	eldest, _ := repository.Default.Members.Find(group.ID, creator.User.ID)
+	if closed.Status != "closed" || closed.WinnerID != eldest.ID || closed.Discount != 0 {
+		t.Fatalf("window %s won by %s for %v, want closed and won by the creator %s for 0",
+			closed.Status, closed.WinnerID, closed.Discount, eldest.ID)
+	}
+
+	var schedule models.PayoutSchedule
+	if err := e.DB.First(&schedule, "group_id = ? AND round = ?", group.ID, window.Round).Error; err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	if schedule.MemberID != eldest.ID || schedule.Amount != window.Pot {
+		t.Errorf("scheduled %s for %v, want %s for the full pot %v", schedule.MemberID, schedule.Amount, eldest.ID, window.Pot)
+	}
+
+	var audits int64
+	e.DB.Model(&models.AuditEvent{}).Where("group_id = ? AND action = ? AND actor_id = ?", group.ID, services.AuditAuctionClose, services.SystemActor).Count(&audits)
+	if audits != 1 {
+		t.Errorf("%d close audits by the system, want 1", audits)
+	}
+}
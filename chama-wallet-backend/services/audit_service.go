@@ -0,0 +1,242 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+)
+
+// SystemActor is the actor recorded for actions taken by background jobs
+const SystemActor = "system"
+
+// Audited actions
+const (
+	AuditGroupCreate        = "group.create"
+	AuditGroupApprove       = "group.approve"
+	AuditGroupActivate      = "group.activate"
+	AuditGroupApprovalRule  = "group.approval_policy"
+	AuditGroupSecurity      = "group.security"
+	AuditGroupLatePolicy    = "group.late_policy"
+	AuditGroupLoanPolicy    = "group.loan_policy"
+	AuditGroupSharePolicy   = "group.share_policy"
+	AuditGroupSecretView    = "group.secret_view"
+	AuditMemberJoin         = "member.join"
+	AuditMemberAdd          = "member.add"
+	AuditMemberInvite       = "member.invite"
+	AuditMemberApprove      = "member.approve"
+	AuditMemberReject       = "member.reject"
+	AuditMemberRole         = "member.role_change"
+	AuditAdminNominate      = "admin.nominate"
+	AuditAdminPromote       = "admin.promote"
+	AuditInvitationAccept   = "invitation.accept"
+	AuditInvitationReject   = "invitation.reject"
+	AuditContribution       = "contribution.submit"
+	AuditRoundContribution  = "round_contribution.submit"
+	AuditPayoutRequest      = "payout.request"
+	AuditPayoutVote         = "payout.vote"
+	AuditPayoutExecute      = "payout.execute"
+	AuditRoundAuthorize     = "round.authorize"
+	AuditRoundPayout        = "round.payout"
+	AuditPenaltyAssess      = "penalty.assess"
+	AuditPenaltyPay         = "penalty.pay"
+	AuditPenaltyWaive       = "penalty.waive"
+	AuditLoanApply          = "loan.apply"
+	AuditLoanGuarantee      = "loan.guarantee"
+	AuditLoanRepay          = "loan.repay"
+	AuditSettlementPrepare  = "settlement.prepare"
+	AuditSettlementVote     = "settlement.vote"
+	AuditSettlementReissue  = "settlement.reissue"
+	AuditAuctionOpen        = "auction.open"
+	AuditAuctionBid         = "auction.bid"
+	AuditAuctionClose       = "auction.close"
+	AuditPayoutDraw         = "payout.draw"
+	AuditTransfer           = "wallet.transfer"
+	AuditSecretKeyExport    = "account.secret_key_export"
+	AuditRegister           = "account.register"
+	AuditLogin              = "account.login"
+	AuditLogout             = "account.logout"
+	AuditProfileUpdate      = "account.profile_update"
+	AuditSessionRevoke      = "account.session_revoke"
+	AuditEmailVerify        = "account.email_verify"
+	AuditPasswordReset      = "account.password_reset"
+	AuditTwoFactorEnable    = "account.2fa_enable"
+	AuditTwoFactorDisable   = "account.2fa_disable"
+	AuditRecoveryCodesRenew = "account.recovery_codes_renew"
+	AuditStepUp             = "account.step_up"
+)
+
+// AuditEntry is an action to add to the audit log. Before and After are marshalled to
+// JSON; pass only the fields the action changed, never secrets.
+type AuditEntry struct {
+	GroupID   string
+	ActorID   string
+	Action    string
+	TargetID  string
+	Before    interface{}
+	After     interface{}
+	IP        string
+	RequestID string
+}
+
+// RecordAudit appends an event to the end of its group's hash chain. Account events
+// with no group form a chain of their own.
+func RecordAudit(entry AuditEntry) (models.AuditEvent, error) {
+	before, err := auditJSON(entry.Before)
+	if err != nil {
+		return models.AuditEvent{}, err
+	}
+	after, err := auditJSON(entry.After)
+	if err != nil {
+		return models.AuditEvent{}, err
+	}
+
+	event := models.AuditEvent{
+		GroupID:   entry.GroupID,
+		ActorID:   entry.ActorID,
+		Action:    entry.Action,
+		TargetID:  entry.TargetID,
+		Before:    before,
+		After:     after,
+		IP:        entry.IP,
+		RequestID: entry.RequestID,
+		// Postgres keeps microseconds; the hash must survive the round trip
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// One writer per chain, so two events never link to the same predecessor
+		if err := database.LockKey(tx, "audit:"+event.GroupID); err != nil {
+			return err
+		}
+
+		var last models.AuditEvent
+		err := tx.Where("group_id = ?", event.GroupID).Order("id DESC").Limit(1).Find(&last).Error
+		if err != nil {
+			return err
+		}
+		event.PrevHash = last.Hash
+		event.Hash = auditHash(event)
+		return tx.Create(&event).Error
+	})
+	return event, err
+}
+
+// AuditFilter narrows a group's audit log
+type AuditFilter struct {
+	Action  string
+	ActorID string
+	From    *time.Time
+	To      *time.Time
+	Limit   int
+}
+
+// maxAuditEvents caps how many events one listing returns
+const maxAuditEvents = 5000
+
+// ListAuditEvents returns the group's audit events, newest first
+func ListAuditEvents(groupID string, filter AuditFilter) ([]models.AuditEvent, error) {
+	query := database.DB.Where("group_id = ?", groupID)
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.ActorID != "" {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", filter.From.UTC())
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", filter.To.UTC())
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	if limit > maxAuditEvents {
+		limit = maxAuditEvents
+	}
+
+	var events []models.AuditEvent
+	err := query.Order("id DESC").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+// AuditVerification is the result of checking a group's hash chain
+type AuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Events   int    `json:"events"`
+	Head     string `json:"head,omitempty"`      // hash of the latest event
+	BrokenAt int64  `json:"broken_at,omitempty"` // first event that does not match the chain
+	Reason   string `json:"reason,omitempty"`
+}
+
+// VerifyAuditChain recomputes every hash in the group's chain and reports the first
+// event that was altered, or whose predecessor was altered or removed
+func VerifyAuditChain(groupID string) (AuditVerification, error) {
+	var verification AuditVerification
+	prevHash := ""
+
+	var batch []models.AuditEvent
+	err := database.DB.Where("group_id = ?", groupID).Order("id").
+		FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+			for _, event := range batch {
+				if verification.BrokenAt == 0 {
+					switch {
+					case event.PrevHash != prevHash:
+						verification.BrokenAt = event.ID
+						verification.Reason = "previous hash does not match the event before it"
+					case event.Hash != auditHash(event):
+						verification.BrokenAt = event.ID
+						verification.Reason = "event contents do not match its hash"
+					}
+				}
+				prevHash = event.Hash
+				verification.Events++
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return verification, err
+	}
+
+	verification.Valid = verification.BrokenAt == 0
+	verification.Head = prevHash
+	return verification, nil
+}
+
+// auditHash is the SHA-256 of the event's fields and the hash of the event before it
+func auditHash(event models.AuditEvent) string {
+	canonical, _ := json.Marshal([]string{
+		event.PrevHash,
+		event.GroupID,
+		event.ActorID,
+		event.Action,
+		event.TargetID,
+		event.Before,
+		event.After,
+		event.IP,
+		event.RequestID,
+		event.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+func auditJSON(value interface{}) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("audit state: %w", err)
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,116 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/services"
+)
+
+// auditChain records n member approvals in a group of its own
+func auditChain(t *testing.T, n int) (string, []models.AuditEvent) {
+	t.Helper()
+	groupID := uuid.NewString()
+	var events []models.AuditEvent
+	for i := 0; i < n; i++ {
+		event, err := services.RecordAudit(services.AuditEntry{
+			GroupID:  groupID,
+			ActorID:  "admin",
+			Action:   services.AuditMemberApprove,
+			TargetID: uuid.NewString(),
+			Before:   map[string]string{"status": "pending"},
+			After:    map[string]string{"status": "approved"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	return groupID, events
+}
+
+func TestAuditEventsLinkToTheirPredecessor(t *testing.T) {
+	newEnv(t)
+	groupID, events := auditChain(t, 3)
+	other, _ := auditChain(t, 1)
+
+	if events[0].PrevHash != "" {
+		t.Errorf("first event links to %q, want nothing", events[0].PrevHash)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].PrevHash != events[i-1].Hash {
+			t.Errorf("event %d links to %q, want %q", i, events[i].PrevHash, events[i-1].Hash)
+		}
+	}
+
+	verification, err := services.VerifyAuditChain(groupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verification.Valid || verification.Events != 3 || verification.Head != events[2].Hash {
+		t.Errorf("verification %+v, want a valid chain of 3 ending at %s", verification, events[2].Hash)
+	}
+
+	// Each group has a chain of its own
+	if verification, _ := services.VerifyAuditChain(other); !verification.Valid || verification.Events != 1 {
+		t.Errorf("other group's verification %+v, want a valid chain of 1", verification)
+	}
+}
+
+func TestVerifyAuditChainCatchesTampering(t *testing.T) {
+	newEnv(t)
+	_, events := auditChain(t, 1)
+	if err := database.DB.Delete(&models.AuditEvent{}, "id = ?", events[0].ID).Error; err == nil {
+		t.Fatal("deleted an audit event")
+	}
+
+	// The triggers keep the application from rewriting the log; the chain is what
+	// catches someone who can drop them
+	if err := database.DB.Exec("DROP TRIGGER audit_events_no_update").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Exec("DROP TRIGGER audit_events_no_delete").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(events []models.AuditEvent) error
+		broken func(events []models.AuditEvent) int64
+	}{
+		{
+			"edited row",
+			func(events []models.AuditEvent) error {
+				return database.DB.Model(&models.AuditEvent{}).Where("id = ?", events[1].ID).
+					Update("after_state", `{"status":"rejected"}`).Error
+			},
+			func(events []models.AuditEvent) int64 { return events[1].ID },
+		},
+		{
+			"deleted row",
+			func(events []models.AuditEvent) error {
+				return database.DB.Delete(&models.AuditEvent{}, "id = ?", events[1].ID).Error
+			},
+			func(events []models.AuditEvent) int64 { return events[2].ID },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groupID, events := auditChain(t, 4)
+			if err := tt.tamper(events); err != nil {
+				t.Fatal(err)
+			}
+			verification, err := services.VerifyAuditChain(groupID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if verification.Valid || verification.BrokenAt != tt.broken(events) {
+				t.Errorf("verification %+v, want broken at event %d", verification, tt.broken(events))
+			}
+		})
+	}
+}
@@ -1,23 +1,27 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 
-	"chama-wallet-backend/database"
+	"chama-wallet-backend/config"
+	"chama-wallet-backend/keystore"
 	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
 	"chama-wallet-backend/utils"
 )
 
-var jwtSecret = []byte("your-secret-key-change-in-production") // Change this in production
-
 type Claims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
@@ -33,53 +37,81 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
-// GenerateJWT generates a JWT token for a user
-func GenerateJWT(userID, email string) (string, error) {
+// GenerateAccessToken signs a short-lived access token for a session with the active key
+func GenerateAccessToken(userID, email, sessionID string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(config.Auth.AccessTokenTTL)
 	claims := &Claims{
-		UserID: userID,
-		Email:  email,
+		UserID:    userID,
+		Email:     email,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	signed, err := signToken(claims)
+	return signed, expiresAt, err
 }
 
-// ValidateJWT validates a JWT token and returns the claims
+// ValidateJWT validates an access token and returns the claims
 func ValidateJWT(tokenString string) (*Claims, error) {
 	claims := &Claims{}
+	if err := parseToken(tokenString, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// signToken signs claims with the active key and names the key in the kid header
+func signToken(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = config.Auth.ActiveKeyID
+	return token.SignedString(config.Auth.SigningKeys[config.Auth.ActiveKeyID])
+}
+
+// parseToken verifies a token against the key named in its kid header and fills claims
+func parseToken(tokenString string, claims jwt.Claims) error {
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		key, ok := config.Auth.SigningKeys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if !token.Valid {
-		return nil, errors.New("invalid token")
+		return errors.New("invalid token")
 	}
 
-	return claims, nil
+	return nil
 }
 
-// RegisterUser creates a new user account
-func RegisterUser(req models.RegisterRequest) (models.AuthResponse, error) {
+// RegisterUser creates a new user account and signs the client in
+func RegisterUser(ctx context.Context, req models.RegisterRequest, client models.ClientInfo) (models.AuthResponse, error) {
 	// Generate wallet
 	// Check if user already exists
-	var existingUser models.User
-	if err := database.DB.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
+	if _, err := repository.Default.Users.ByEmail(req.Email); err == nil {
 		return models.AuthResponse{}, errors.New("user with this email already exists")
 	}
-	
+
 	wallet, err := utils.GenerateStellarWallet()
 	if err != nil {
 		return models.AuthResponse{}, err
 	}
 
+	// Encrypt the seed before storing it
+	sealedSecret, err := keystore.Default.Seal(wallet.SecretKey)
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), 14)
 	if err != nil {
@@ -93,53 +125,56 @@ func RegisterUser(req models.RegisterRequest) (models.AuthResponse, error) {
 		Email:     req.Email,
 		Password:  string(hashedPassword),
 		Wallet:    wallet.PublicKey,
-		SecretKey: wallet.SecretKey, // Make sure this is set
+		SecretKey: sealedSecret,
 	}
 
-	if err := database.DB.Create(&user).Error; err != nil {
+	if err := repository.Default.Users.Create(&user); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			return models.AuthResponse{}, errors.New("user with this email already exists")
+		}
 		return models.AuthResponse{}, err
 	}
 
-	// Generate token
-	token, err := GenerateJWT(user.ID, user.Email)
+	auth, err := StartSession(user, client)
 	if err != nil {
-		return models.AuthResponse{}, err
+		return auth, err
 	}
 
-	return models.AuthResponse{
-		User:  user,
-		Token: token,
-	}, nil
+	if err := SendVerificationEmail(user); err != nil {
+		slog.WarnContext(ctx, "failed to send verification email", "user_id", user.ID, "error", err)
+	}
+
+	return auth, nil
 }
 
-// LoginUser authenticates a user and returns a token
-func LoginUser(req models.LoginRequest) (models.AuthResponse, error) {
-	var user models.User
-	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		return models.AuthResponse{}, errors.New("invalid email or password")
+// LoginUser authenticates a user and starts a session for the client
+func LoginUser(ctx context.Context, req models.LoginRequest, client models.ClientInfo) (models.AuthResponse, error) {
+	// Locked out emails are refused before the password is looked at
+	if err := checkLoginLock(req.Email); err != nil {
+		return models.AuthResponse{}, err
 	}
 
-	// Check password
-	if !CheckPasswordHash(req.Password, user.Password) {
-		return models.AuthResponse{}, errors.New("invalid email or password")
+	user, err := repository.Default.Users.ByEmail(req.Email)
+	if err == nil && !CheckPasswordHash(req.Password, user.Password) {
+		err = errors.New("wrong password")
 	}
-
-	// Generate JWT token
-	token, err := GenerateJWT(user.ID, user.Email)
 	if err != nil {
-		return models.AuthResponse{}, err
+		if err := recordLoginFailure(ctx, req.Email); err != nil {
+			slog.WarnContext(ctx, "failed to record failed sign-in", "error", err)
+		}
+		return models.AuthResponse{}, errors.New("invalid email or password")
 	}
 
-	return models.AuthResponse{
-		User:  user,
-		Token: token,
-	}, nil
+	if err := clearLoginFailures(req.Email); err != nil {
+		slog.WarnContext(ctx, "failed to clear failed sign-ins", "user_id", user.ID, "error", err)
+	}
+	return StartSession(user, client)
 }
 
 // GetUserByID retrieves a user by ID
 func GetUserByID(userID string) (models.User, error) {
-	var user models.User
-	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+	user, err := repository.Default.Users.ByID(userID)
+	if err != nil {
 		return models.User{}, errors.New("user not found")
 	}
 	return user, nil
@@ -147,13 +182,13 @@ func GetUserByID(userID string) (models.User, error) {
 
 // UpdateUser updates a user's information
 func UpdateUser(user models.User) error {
-	return database.DB.Save(&user).Error
+	return repository.Default.Users.Save(&user)
 }
 
 // GetUserByEmail retrieves a user by email
 func GetUserByEmail(email string) (models.User, error) {
-	var user models.User
-	if err := database.DB.Where("email = ?", email).First(&user).Error; err != nil {
+	user, err := repository.Default.Users.ByEmail(email)
+	if err != nil {
 		return models.User{}, errors.New("user not found")
 	}
 	return user, nil
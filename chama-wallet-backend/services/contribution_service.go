@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+)
+
+// ConfirmRoundContribution marks a pending contribution as paid by txHash, fines it if it
+// arrived after the round's grace period, buys shares with it in a savings and credit
+// group and refreshes the round's totals. Confirming an
+// already confirmed contribution is a no-op.
+func ConfirmRoundContribution(ctx context.Context, contributionID, txHash string) error {
+	var contribution models.RoundContribution
+	if err := database.DB.First(&contribution, "id = ?", contributionID).Error; err != nil {
+		return err
+	}
+	if contribution.Status == "confirmed" {
+		return nil
+	}
+
+	result := database.DB.Model(&models.RoundContribution{}).
+		Where("id = ? AND status <> ?", contributionID, "confirmed").
+		Updates(map[string]interface{}{
+			"status":     "confirmed",
+			"tx_hash":    txHash,
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	assessLateFine(ctx, contribution, time.Now())
+	recordShares(ctx, contribution)
+
+	if err := UpdateRoundStatus(contribution.GroupID, contribution.Round); err != nil {
+		slog.WarnContext(ctx, "failed to update round status",
+			"group_id", contribution.GroupID, "round", contribution.Round, "error", err)
+	}
+	return nil
+}
+
+// TotalRounds is the last round members can contribute to: the end of the current cycle in
+// a savings and credit group, otherwise one round for each member of the payout rotation
+func TotalRounds(group models.Group) (int, error) {
+	if GroupType(group) == GroupASCA {
+		_, to := CycleRounds(group)
+		return to, nil
+	}
+
+	var members int64
+	if err := database.DB.Model(&models.Member{}).
+		Where("group_id = ? AND status = ?", group.ID, "approved").Count(&members).Error; err != nil {
+		return 0, err
+	}
+	var payoutOrder []string
+	json.Unmarshal([]byte(group.PayoutOrder), &payoutOrder)
+	return max(int(members), len(payoutOrder)), nil
+}
+
+// UpdateRoundStatus recomputes a round's totals from its confirmed contributions
+func UpdateRoundStatus(groupID string, round int) error {
+	// Get total required amount and member count
+	var group models.Group
+	database.DB.First(&group, "id = ?", groupID)
+
+	var totalMembers int64
+	database.DB.Model(&models.Member{}).Where("group_id = ? AND status = ?", groupID, "approved").Count(&totalMembers)
+
+	// Get current contributions for this round
+	var contributionsCount int64
+	var totalReceived float64
+	database.DB.Model(&models.RoundContribution{}).
+		Where("group_id = ? AND round = ? AND status = ?", groupID, round, "confirmed").
+		Count(&contributionsCount)
+
+	database.DB.Model(&models.RoundContribution{}).
+		Where("group_id = ? AND round = ? AND status = ?", groupID, round, "confirmed").
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&totalReceived)
+
+	var roundStatus models.RoundStatus
+	err := database.DB.Where("group_id = ? AND round = ?", groupID, round).First(&roundStatus).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err != nil {
+		roundStatus = models.RoundStatus{
+			ID:       uuid.NewString(),
+			GroupID:  groupID,
+			Round:    round,
+			Status:   "collecting",
+			Deadline: scheduledDeadline(group, round),
+		}
+	}
+
+	roundStatus.TotalRequired = group.ContributionAmount * float64(totalMembers)
+	roundStatus.TotalReceived = totalReceived
+	roundStatus.ContributorsCount = int(contributionsCount)
+	roundStatus.RequiredCount = int(totalMembers)
+
+	// A round closed at its deadline stays closed until everyone has paid
+	if contributionsCount >= totalMembers {
+		if roundStatus.Status == "collecting" || roundStatus.Status == "closed" {
+			roundStatus.Status = "ready_for_payout"
+		}
+	}
+
+	return database.DB.Save(&roundStatus).Error
+}
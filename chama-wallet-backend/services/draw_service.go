@@ -0,0 +1,333 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/ledger"
+	"chama-wallet-backend/models"
+)
+
+// drawLedgerDelay is how many ledgers after activation the draw's ledger closes, about a
+// minute on the public network
+const drawLedgerDelay = 12
+
+// DrawProof is everything a member needs to re-run a group's payout order draw
+type DrawProof struct {
+	Commitment string      `json:"commitment"`            // SHA-256 of the secret, published on activation
+	Ledger     int32       `json:"ledger"`                // the ledger whose hash seeds the draw
+	LedgerHash string      `json:"ledger_hash,omitempty"` // known once the ledger closes
+	Secret     string      `json:"secret,omitempty"`      // revealed once the order is drawn
+	Seed       string      `json:"seed,omitempty"`
+	Size       int         `json:"size"` // members in the first draw
+	DrawnAt    *time.Time  `json:"drawn_at,omitempty"`
+	Order      []DrawEntry `json:"order"`
+}
+
+// DrawEntry is one member's place in the drawn order
+type DrawEntry struct {
+	Round    int       `json:"round"`
+	MemberID string    `json:"member_id"`
+	UserID   string    `json:"user_id"`
+	Key      string    `json:"key"`      // SHA-256 of the seed and the user ID
+	DrawnAt  time.Time `json:"drawn_at"` // members drawn together are ordered by key
+	Late     bool      `json:"late"`     // joined after the first draw
+}
+
+// newDraw commits the group to a draw: a random secret, its SHA-256 commitment and a
+// ledger that has not closed yet. Neither the server, which chose the secret before the
+// ledger's hash existed, nor the network decides the seed alone.
+func newDraw(ctx context.Context) (map[string]interface{}, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	commitment := sha256.Sum256(secret)
+
+	root, err := LedgerFrom(ctx).Root()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the latest ledger: %w", err)
+	}
+
+	return map[string]interface{}{
+		"draw_commitment":  hex.EncodeToString(commitment[:]),
+		"draw_secret":      hex.EncodeToString(secret),
+		"draw_ledger":      root.HorizonSequence + drawLedgerDelay,
+		"draw_ledger_hash": "",
+		"draw_seed":        "",
+		"draw_size":        0,
+		"drawn_at":         nil,
+	}, nil
+}
+
+// DrawSeed combines the draw secret with the ledger hash: the SHA-256 of the secret's
+// bytes followed by the hash's bytes, hex encoded
+func DrawSeed(secret, ledgerHash string) (string, error) {
+	secretBytes, err := hex.DecodeString(secret)
+	if err != nil {
+		return "", fmt.Errorf("invalid draw secret: %w", err)
+	}
+	hashBytes, err := hex.DecodeString(ledgerHash)
+	if err != nil {
+		return "", fmt.Errorf("invalid ledger hash: %w", err)
+	}
+	seed := sha256.Sum256(append(secretBytes, hashBytes...))
+	return hex.EncodeToString(seed[:]), nil
+}
+
+// DrawKey ranks a user in the draw: the SHA-256 of the seed's bytes followed by the user
+// ID, hex encoded
+func DrawKey(seed, userID string) (string, error) {
+	seedBytes, err := hex.DecodeString(seed)
+	if err != nil {
+		return "", fmt.Errorf("invalid draw seed: %w", err)
+	}
+	key := sha256.Sum256(append(seedBytes, userID...))
+	return hex.EncodeToString(key[:]), nil
+}
+
+// DrawOrder is the shuffle: it sorts user IDs by their draw keys, lowest first. Given the
+// seed anyone can run it on the same members and get the same order, and a member's key
+// does not depend on who else is drawn.
+func DrawOrder(seed string, userIDs []string) ([]string, error) {
+	keys := map[string][]byte{}
+	for _, userID := range userIDs {
+		key, err := DrawKey(seed, userID)
+		if err != nil {
+			return nil, err
+		}
+		keys[userID], _ = hex.DecodeString(key)
+	}
+
+	order := append([]string(nil), userIDs...)
+	sort.Slice(order, func(i, j int) bool {
+		return bytes.Compare(keys[order[i]], keys[order[j]]) < 0
+	})
+	return order, nil
+}
+
+// GroupDraw returns the group's draw commitment and, once the order is drawn, the secret,
+// seed and each member's place with their key
+func GroupDraw(group models.Group) (DrawProof, error) {
+	proof := DrawProof{
+		Commitment: group.DrawCommitment,
+		Ledger:     group.DrawLedger,
+		LedgerHash: group.DrawLedgerHash,
+		Seed:       group.DrawSeed,
+		Size:       group.DrawSize,
+		DrawnAt:    group.DrawnAt,
+		Order:      []DrawEntry{},
+	}
+	if group.DrawSeed == "" {
+		return proof, nil
+	}
+	proof.Secret = group.DrawSecret
+
+	var schedules []models.PayoutSchedule
+	if err := database.DB.Where("group_id = ?", group.ID).Preload("Member").
+		Order("round ASC").Find(&schedules).Error; err != nil {
+		return proof, err
+	}
+	for _, schedule := range schedules {
+		key, err := DrawKey(group.DrawSeed, schedule.Member.UserID)
+		if err != nil {
+			return proof, err
+		}
+		proof.Order = append(proof.Order, DrawEntry{
+			Round:    schedule.Round,
+			MemberID: schedule.MemberID,
+			UserID:   schedule.Member.UserID,
+			Key:      key,
+			DrawnAt:  schedule.CreatedAt,
+			Late:     schedule.Round > group.DrawSize,
+		})
+	}
+	return proof, nil
+}
+
+// DrawPayoutOrder makes the group's draw once its ledger has closed: it seeds the draw
+// with the ledger's hash, reveals the secret and schedules the approved members in the
+// drawn order. Run again, it draws the members who joined since with the same seed and
+// schedules them after everyone already drawn. It returns how many members were drawn.
+func DrawPayoutOrder(ctx context.Context, groupID string) (models.Group, int, error) {
+	var group models.Group
+	var drawn []models.PayoutSchedule
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := database.ForUpdate(tx).First(&group, "id = ?", groupID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return opError(ErrNotFound, "Group not found")
+			}
+			return err
+		}
+		if group.Status != "active" {
+			return opError(ErrInvalid, "Group is not active")
+		}
+		if PayoutMode(group) != PayoutDraw {
+			return opError(ErrInvalid, "Group does not draw its payout order")
+		}
+
+		updates := map[string]interface{}{}
+		if group.DrawSeed == "" {
+			closed, err := LedgerFrom(ctx).LedgerDetail(uint32(group.DrawLedger))
+			if ledger.IsNotFound(err) {
+				return opError(ErrConflict, "Ledger %d has not closed yet", group.DrawLedger)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read ledger %d: %w", group.DrawLedger, err)
+			}
+			seed, err := DrawSeed(group.DrawSecret, closed.Hash)
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			group.DrawLedgerHash = closed.Hash
+			group.DrawSeed = seed
+			group.DrawnAt = &now
+			updates["draw_ledger_hash"] = closed.Hash
+			updates["draw_seed"] = seed
+			updates["drawn_at"] = now
+		}
+
+		var members []models.Member
+		if err := tx.Where("group_id = ? AND status = ?", groupID, "approved").Find(&members).Error; err != nil {
+			return err
+		}
+		var scheduled []models.PayoutSchedule
+		if err := tx.Where("group_id = ?", groupID).Order("round ASC").Find(&scheduled).Error; err != nil {
+			return err
+		}
+
+		// Members already in the order keep their rounds
+		inOrder := map[string]bool{}
+		for _, schedule := range scheduled {
+			inOrder[schedule.MemberID] = true
+		}
+		memberByUser := map[string]models.Member{}
+		var entrants []string
+		for _, member := range members {
+			if !inOrder[member.ID] {
+				memberByUser[member.UserID] = member
+				entrants = append(entrants, member.UserID)
+			}
+		}
+
+		order, err := DrawOrder(group.DrawSeed, entrants)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		pot := stroops(group.ContributionAmount * float64(len(members)))
+		for i, userID := range order {
+			round := len(scheduled) + i + 1
+			drawn = append(drawn, models.PayoutSchedule{
+				ID:        uuid.NewString(),
+				GroupID:   groupID,
+				MemberID:  memberByUser[userID].ID,
+				Round:     round,
+				Amount:    pot,
+				DueDate:   group.NextContributionDate.AddDate(0, 0, (round-group.CurrentRound)*group.ContributionPeriod),
+				Status:    "scheduled",
+				CreatedAt: now,
+				UpdatedAt: now,
+			})
+		}
+
+		if group.DrawSize == 0 {
+			group.DrawSize = len(drawn)
+			updates["draw_size"] = group.DrawSize
+		}
+		if len(drawn) > 0 {
+			var payoutOrder []string
+			json.Unmarshal([]byte(group.PayoutOrder), &payoutOrder)
+			payoutOrderJSON, _ := json.Marshal(append(payoutOrder, order...))
+			group.PayoutOrder = string(payoutOrderJSON)
+			updates["payout_order"] = group.PayoutOrder
+		}
+
+		if len(updates) > 0 {
+			if err := tx.Model(&models.Group{}).Where("id = ?", groupID).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if len(drawn) == 0 {
+			return nil
+		}
+		return tx.Omit("Group", "Member").Create(&drawn).Error
+	})
+	if err != nil {
+		return group, 0, err
+	}
+	if len(drawn) == 0 {
+		return group, 0, nil
+	}
+
+	slog.InfoContext(ctx, "payout order drawn", "group_id", groupID, "ledger", group.DrawLedger,
+		"seed", group.DrawSeed, "drawn", len(drawn), "first_round", drawn[0].Round)
+
+	for _, schedule := range drawn {
+		var member models.Member
+		if err := database.DB.First(&member, "id = ?", schedule.MemberID).Error; err != nil {
+			continue
+		}
+		CreateNotification(
+			member.UserID,
+			groupID,
+			"payout_drawn",
+			"Payout Order Drawn",
+			fmt.Sprintf("You were drawn for round %d of %s, due %s", schedule.Round, group.Name, schedule.DueDate.Format("January 2, 2006")),
+		)
+	}
+	return group, len(drawn), nil
+}
+
+// DrawPayoutOrders makes the draws whose ledgers have closed and draws the members who
+// joined drawn groups since
+func DrawPayoutOrders(ctx context.Context) error {
+	var groups []models.Group
+	if err := database.DB.Where("status = ? AND payout_mode = ?", "active", PayoutDraw).Find(&groups).Error; err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Drawn groups only need another draw when someone has joined since
+		if group.DrawSeed != "" {
+			var undrawn int64
+			if err := database.DB.Model(&models.Member{}).
+				Where("group_id = ? AND status = ? AND id NOT IN (?)", group.ID, "approved",
+					database.DB.Model(&models.PayoutSchedule{}).Select("member_id").Where("group_id = ?", group.ID)).
+				Count(&undrawn).Error; err != nil {
+				slog.ErrorContext(ctx, "failed to count undrawn members", "group_id", group.ID, "error", err)
+				continue
+			}
+			if undrawn == 0 {
+				continue
+			}
+		}
+
+		if _, _, err := DrawPayoutOrder(ctx, group.ID); err != nil {
+			if errors.Is(err, ErrConflict) {
+				continue // the draw's ledger has not closed yet
+			}
+			slog.ErrorContext(ctx, "failed to draw payout order", "group_id", group.ID, "error", err)
+		}
+	}
+	return nil
+}
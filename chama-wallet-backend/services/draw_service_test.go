@@ -0,0 +1,205 @@
+package services_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"testing"
+
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
+	"chama-wallet-backend/services"
+	"chama-wallet-backend/testenv"
+)
+
+var drawSettings = models.GroupSettings{ContributionAmount: 10, ContributionPeriod: 7, PayoutMode: services.PayoutDraw}
+
+// publishedDraw fetches the draw the way a member sees it
+func publishedDraw(t *testing.T, e *testenv.Env, groupID string, member models.AuthResponse) services.DrawProof {
+	t.Helper()
+	var resp struct {
+		Draw services.DrawProof `json:"draw"`
+	}
+	status, err := e.Request("GET", "/group/"+groupID+"/draw", member.Token, nil, &resp)
+	if err != nil || status != 200 {
+		t.Fatalf("get draw: status %d, err %v", status, err)
+	}
+	return resp.Draw
+}
+
+// rerunDraw re-runs the draw from the published proof alone, without the server's code:
+// the seed is SHA-256(secret ‖ ledger hash), each member's key SHA-256(seed ‖ user ID),
+// and members are ordered by key, lowest first
+func rerunDraw(t *testing.T, proof services.DrawProof, userIDs []string) []string {
+	t.Helper()
+	secret, err := hex.DecodeString(proof.Secret)
+	if err != nil {
+		t.Fatalf("secret: %v", err)
+	}
+	if commitment := sha256.Sum256(secret); hex.EncodeToString(commitment[:]) != proof.Commitment {
+		t.Fatalf("revealed secret does not match the commitment %s", proof.Commitment)
+	}
+	ledgerHash, err := hex.DecodeString(proof.LedgerHash)
+	if err != nil {
+		t.Fatalf("ledger hash: %v", err)
+	}
+	seed := sha256.Sum256(append(secret, ledgerHash...))
+	if hex.EncodeToString(seed[:]) != proof.Seed {
+		t.Fatalf("seed %s, want SHA-256 of the secret and the ledger hash", proof.Seed)
+	}
+
+	keys := map[string][]byte{}
+	for _, userID := range userIDs {
+		key := sha256.Sum256(append(seed[:], userID...))
+		keys[userID] = key[:]
+	}
+	order := append([]string(nil), userIDs...)
+	sort.Slice(order, func(i, j int) bool { return bytes.Compare(keys[order[i]], keys[order[j]]) < 0 })
+	return order
+}
+
+func drawnUsers(proof services.DrawProof) []string {
+	var users []string
+	for _, entry := range proof.Order {
+		users = append(users, entry.UserID)
+	}
+	return users
+}
+
+func equalOrder(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDrawReproducibleFromProof(t *testing.T) {
+	e := newEnv(t)
+	group, creator, members := activeGroup(t, e, 4, drawSettings)
+
+	// Only the commitment and the ledger are published before the draw
+	before := publishedDraw(t, e, group.ID, members[0])
+	if before.Commitment == "" || before.Ledger == 0 || before.Secret != "" || before.Seed != "" || len(before.Order) != 0 {
+		t.Fatalf("draw before it is made %+v, want only the commitment and ledger", before)
+	}
+
+	if _, _, err := services.DrawPayoutOrder(e.Context(), group.ID); !errors.Is(err, services.ErrConflict) {
+		t.Fatalf("draw before ledger %d closed: %v, want a conflict", before.Ledger, err)
+	}
+
+	e.Ledger.CloseLedgers(20)
+	if _, drawn, err := services.DrawPayoutOrder(e.Context(), group.ID); err != nil || drawn != 5 {
+		t.Fatalf("draw: %d drawn, err %v", drawn, err)
+	}
+
+	proof := publishedDraw(t, e, group.ID, members[0])
+	if proof.Commitment != before.Commitment || proof.Ledger != before.Ledger || proof.Size != 5 {
+		t.Fatalf("draw %+v changed its commitment or ledger", proof)
+	}
+	closed, err := e.Ledger.LedgerDetail(uint32(proof.Ledger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proof.LedgerHash != closed.Hash {
+		t.Fatalf("ledger hash %s, want %s from the network", proof.LedgerHash, closed.Hash)
+	}
+
+	userIDs := []string{creator.User.ID}
+	for _, member := range members {
+		userIDs = append(userIDs, member.User.ID)
+	}
+	if want := rerunDraw(t, proof, userIDs); !equalOrder(drawnUsers(proof), want) {
+		t.Fatalf("drawn order %v, re-run gives %v", drawnUsers(proof), want)
+	}
+	for i, entry := range proof.Order {
+		if entry.Round != i+1 || entry.Late {
+			t.Errorf("entry %d: round %d late %v", i, entry.Round, entry.Late)
+		}
+	}
+
+	// The order is the one scheduled
+	updated, err := repository.Default.Groups.ByID(group.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule, err := repository.Default.Payouts.Schedule(group.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, round := range schedule {
+		if round.MemberID != proof.Order[i].MemberID {
+			t.Errorf("round %d pays member %s, draw has %s", round.Round, round.MemberID, proof.Order[i].MemberID)
+		}
+	}
+	if updated.DrawSeed != proof.Seed {
+		t.Errorf("group seed %s, proof %s", updated.DrawSeed, proof.Seed)
+	}
+}
+
+func TestDrawAppendsLateJoiners(t *testing.T) {
+	e := newEnv(t)
+	group, creator, members := activeGroup(t, e, 2, drawSettings)
+
+	e.Ledger.CloseLedgers(20)
+	if _, _, err := services.DrawPayoutOrder(e.Context(), group.ID); err != nil {
+		t.Fatalf("draw: %v", err)
+	}
+	first := publishedDraw(t, e, group.ID, members[0])
+
+	var late []string
+	for _, email := range []string{"late1@example.com", "late2@example.com"} {
+		joiner, err := e.Register("Late", email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status, err := e.Request("POST", "/group/"+group.ID+"/join", joiner.Token, map[string]string{}, nil); err != nil || status != 200 {
+			t.Fatalf("join: status %d, err %v", status, err)
+		}
+		pending, err := repository.Default.Members.Find(group.ID, joiner.User.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status, err := e.Request("POST", "/group/"+group.ID+"/approve-member", creator.Token,
+			map[string]string{"member_id": pending.ID, "action": "approve"}, nil); err != nil || status != 200 {
+			t.Fatalf("approve member: status %d, err %v", status, err)
+		}
+		late = append(late, joiner.User.ID)
+	}
+
+	if err := services.DrawPayoutOrders(e.Context()); err != nil {
+		t.Fatalf("draw job: %v", err)
+	}
+	proof := publishedDraw(t, e, group.ID, members[0])
+	if proof.Seed != first.Seed || proof.Size != 3 || len(proof.Order) != 5 {
+		t.Fatalf("draw after late joiners %+v, want the same seed with 2 members appended to 3", proof)
+	}
+
+	// Members already drawn keep their rounds
+	for i, entry := range first.Order {
+		if proof.Order[i].UserID != entry.UserID || proof.Order[i].Round != entry.Round || proof.Order[i].Late {
+			t.Errorf("round %d: %+v, was %+v", entry.Round, proof.Order[i], entry)
+		}
+	}
+	// Late joiners follow them, ordered among themselves with the same seed
+	appended := drawnUsers(proof)[3:]
+	if want := rerunDraw(t, proof, late); !equalOrder(appended, want) {
+		t.Errorf("late joiners drawn %v, re-run gives %v", appended, want)
+	}
+	for _, entry := range proof.Order[3:] {
+		if !entry.Late {
+			t.Errorf("round %d not marked late", entry.Round)
+		}
+	}
+
+	// A further run has no one left to draw
+	if _, drawn, err := services.DrawPayoutOrder(e.Context(), group.ID); err != nil || drawn != 0 {
+		t.Errorf("third draw: %d drawn, err %v", drawn, err)
+	}
+}
@@ -1,7 +1,7 @@
 package services
 
 import (
-	"log"
+	"log/slog"
 
 	"github.com/joho/godotenv"
 )
@@ -9,6 +9,6 @@ import (
 func init() {
 	err := godotenv.Load()
 	if err != nil {
-		log.Println("⚠️  No .env file found or failed to load")
+		slog.Warn("no .env file found or failed to load")
 	}
 }
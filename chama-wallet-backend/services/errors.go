@@ -0,0 +1,30 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of business rule violation returned by service operations. Handlers map them
+// to HTTP statuses.
+var (
+	ErrInvalid   = errors.New("invalid request")
+	ErrForbidden = errors.New("forbidden")
+	ErrNotFound  = errors.New("not found")
+	ErrConflict  = errors.New("conflict")
+	// ErrStepUpRequired means the action needs a fresh second-factor check first
+	ErrStepUpRequired = errors.New("step-up required")
+)
+
+// OpError is a business rule violation whose message can be shown to the client
+type OpError struct {
+	Kind    error
+	Message string
+}
+
+func (e *OpError) Error() string { return e.Message }
+func (e *OpError) Unwrap() error { return e.Kind }
+
+func opError(kind error, format string, args ...interface{}) error {
+	return &OpError{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
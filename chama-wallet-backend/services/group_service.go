@@ -1,12 +1,19 @@
 package services
 
 import (
-	"github.com/google/uuid"
-	"time"
+	"context"
+	"encoding/json"
 	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 
 	"chama-wallet-backend/database"
 	"chama-wallet-backend/models"
+	"chama-wallet-backend/policy"
+	"chama-wallet-backend/repository"
 	"chama-wallet-backend/utils"
 )
 
@@ -46,9 +53,7 @@ func CreateGroup(name, description, creatorID string) (models.Group, error) {
 }
 
 func GetGroupByID(groupID string) (models.Group, error) {
-	var group models.Group
-	err := database.DB.Preload("Members.User").Preload("Creator").First(&group, "id = ?", groupID).Error
-	return group, err
+	return repository.Default.Groups.WithMembers(groupID)
 }
 
 func AddMemberToGroup(groupID, userID, walletAddress string) (models.Group, error) {
@@ -57,6 +62,14 @@ func AddMemberToGroup(groupID, userID, walletAddress string) (models.Group, erro
 		return group, err
 	}
 
+	user, err := repository.Default.Users.ByID(userID)
+	if err != nil {
+		return group, opError(ErrNotFound, "User not found")
+	}
+	if err := RequireVerifiedEmail(user); err != nil {
+		return group, err
+	}
+
 	// Check if member already exists
 	for _, member := range group.Members {
 		if member.UserID == userID {
@@ -74,6 +87,9 @@ func AddMemberToGroup(groupID, userID, walletAddress string) (models.Group, erro
 		JoinedAt: time.Now(),
 	}
 	if err := database.DB.Create(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return group, nil // Added concurrently
+		}
 		return group, err
 	}
 
@@ -113,23 +129,15 @@ func GetAllGroups() ([]models.Group, error) {
 }
 
 func GetUserGroups(userID string) ([]models.Group, error) {
-	var groups []models.Group
-	err := database.DB.
-		Joins("INNER JOIN members ON groups.id = members.group_id").
-		Where("members.user_id = ? AND members.status = ?", userID, "approved").
-		Preload("Members.User").
-		Preload("Creator").
-		Distinct().
-		Find(&groups).Error
-	return groups, err
+	return repository.Default.Groups.ForUser(userID)
 }
 
 func InviteUserToGroup(groupID, inviterID, email string) error {
-	// Check if inviter is admin/creator
+	// Check the inviter's role allows invitations
 	var member models.Member
-	if err := database.DB.Where("group_id = ? AND user_id = ? AND role IN ?", 
-		groupID, inviterID, []string{"creator", "admin"}).First(&member).Error; err != nil {
-		return errors.New("only admins can invite users")
+	if err := database.DB.Where("group_id = ? AND user_id = ? AND status = ?",
+		groupID, inviterID, "approved").First(&member).Error; err != nil || !policy.HasRole(member.Role, policy.Invite) {
+		return errors.New("your role does not allow inviting users")
 	}
 
 	// Check if user exists
@@ -156,29 +164,302 @@ func InviteUserToGroup(groupID, inviterID, email string) error {
 func GetNonGroupMembers(groupID string) ([]models.User, error) {
 	var users []models.User
 	err := database.DB.
-		Where("id NOT IN (SELECT user_id FROM members WHERE group_id = ? AND status = ?)", 
+		Where("id NOT IN (SELECT user_id FROM members WHERE group_id = ? AND status = ?)",
 			groupID, "approved").
 		Find(&users).Error
 	return users, err
 }
 
-func ApproveGroupActivation(groupID, adminID string, settings models.GroupSettings) error {
-	// Verify admin permissions
-	var member models.Member
-	if err := database.DB.Where("group_id = ? AND user_id = ? AND role IN ?", 
-		groupID, adminID, []string{"creator", "admin"}).First(&member).Error; err != nil {
-		return errors.New("insufficient permissions")
+// ActivateGroup starts a group's contribution rounds. Under a lock on the group row and in
+// one transaction it stores the contribution settings and approval policy, turns the wallet
+// into a multisig treasury controlled by the creator and admins, and creates the payout
+// schedule, so a failure leaves the group as it was. Savings and credit groups have no
+// payout schedule; they store their loan terms instead. Groups that auction their payouts
+// fill the schedule one round at a time as each auction closes, and groups that draw it
+// commit to the draw here and fill it once the draw is made.
+func ActivateGroup(ctx context.Context, groupID string, user models.User, settings models.GroupSettings) (models.Group, error) {
+	switch settings.Type {
+	case "":
+		settings.Type = GroupRotating
+	case GroupRotating, GroupASCA:
+	default:
+		return models.Group{}, opError(ErrInvalid, "Unknown group type %q", settings.Type)
+	}
+	switch settings.PayoutMode {
+	case "":
+		settings.PayoutMode = PayoutFixed
+	case PayoutFixed, PayoutAuction, PayoutDraw:
+	default:
+		return models.Group{}, opError(ErrInvalid, "Unknown payout mode %q", settings.PayoutMode)
+	}
+	if settings.Type == GroupASCA && settings.PayoutMode != PayoutFixed {
+		return models.Group{}, opError(ErrInvalid, "Savings and credit groups have no payout order")
+	}
+	if settings.Type == GroupASCA || settings.PayoutMode != PayoutFixed {
+		// Auction winners are added to the payout order as their rounds are sold, and drawn
+		// orders once the draw's ledger closes
+		settings.PayoutOrder = []string{}
+	} else if len(settings.PayoutOrder) == 0 {
+		return models.Group{}, opError(ErrInvalid, "Payout order cannot be empty")
+	}
+	if settings.ContributionAmount <= 0 || settings.ContributionPeriod <= 0 {
+		return models.Group{}, opError(ErrInvalid, "Contribution amount and period must be positive")
+	}
+
+	payoutOrderJSON, err := json.Marshal(settings.PayoutOrder)
+	if err != nil {
+		return models.Group{}, opError(ErrInvalid, "Invalid payout order")
+	}
+
+	var group models.Group
+	err = database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := database.ForUpdate(tx).First(&group, "id = ?", groupID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return opError(ErrNotFound, "Group not found")
+			}
+			return err
+		}
+
+		var caller models.Member
+		if err := tx.Where("group_id = ? AND user_id = ?", groupID, user.ID).First(&caller).Error; err != nil ||
+			!policy.Allows(group, caller, policy.ActivateGroup) {
+			return opError(ErrForbidden, "Only admins can activate groups")
+		}
+
+		// The creator and admins become the treasury's signers
+		var admins []models.Member
+		if err := tx.Where("group_id = ? AND role IN ? AND status = ?",
+			groupID, policy.AdminRoles, "approved").Preload("User").Find(&admins).Error; err != nil {
+			return err
+		}
+
+		if !group.IsApproved {
+			return opError(ErrInvalid, "Group must be approved before activation")
+		}
+		if group.Status == "active" {
+			return opError(ErrConflict, "Group is already active")
+		}
+
+		updates := map[string]interface{}{
+			"status":                 "active",
+			"group_type":             settings.Type,
+			"contribution_amount":    settings.ContributionAmount,
+			"contribution_period":    settings.ContributionPeriod,
+			"payout_order":           string(payoutOrderJSON),
+			"payout_mode":            settings.PayoutMode,
+			"current_round":          1,
+			"next_contribution_date": time.Now().AddDate(0, 0, settings.ContributionPeriod),
+		}
+
+		// Payout requests need the approvals set by the group's policy, one admin by default
+		if settings.ApprovalPolicy != nil {
+			if err := ValidateApprovalPolicy(*settings.ApprovalPolicy, len(admins)); err != nil {
+				return opError(ErrInvalid, "%v", err)
+			}
+			for column, value := range ApprovalPolicyUpdates(*settings.ApprovalPolicy) {
+				updates[column] = value
+			}
+		}
+
+		// Late contributions are not fined unless the group sets a policy
+		if settings.LatePolicy != nil {
+			if err := ValidateLatePolicy(*settings.LatePolicy); err != nil {
+				return opError(ErrInvalid, "%v", err)
+			}
+			for column, value := range LatePolicyUpdates(*settings.LatePolicy) {
+				updates[column] = value
+			}
+		}
+
+		var members []models.Member
+		if err := tx.Where("group_id = ? AND status = ?", groupID, "approved").Find(&members).Error; err != nil {
+			return err
+		}
+
+		// Savings and credit groups lend on the group's terms, by default interest free
+		// over up to a year
+		if settings.Type == GroupASCA && settings.LoanPolicy != nil {
+			if err := ValidateLoanPolicy(*settings.LoanPolicy, len(members)); err != nil {
+				return opError(ErrInvalid, "%v", err)
+			}
+			for column, value := range LoanPolicyUpdates(*settings.LoanPolicy) {
+				updates[column] = value
+			}
+		}
+
+		// Their contributions buy shares, by default one per XLM, shared out every 12 rounds
+		if settings.Type == GroupASCA && settings.SharePolicy != nil {
+			if err := ValidateSharePolicy(*settings.SharePolicy); err != nil {
+				return opError(ErrInvalid, "%v", err)
+			}
+			for column, value := range SharePolicyUpdates(*settings.SharePolicy) {
+				updates[column] = value
+			}
+		}
+
+		// Auction groups decide each round's recipient by bidding, by default splitting
+		// the discount among the other members
+		if settings.PayoutMode == PayoutAuction && settings.AuctionPolicy != nil {
+			if err := ValidateAuctionPolicy(*settings.AuctionPolicy); err != nil {
+				return opError(ErrInvalid, "%v", err)
+			}
+			updates["auction_discount_to"] = settings.AuctionPolicy.DiscountTo
+		}
+
+		// Drawn orders are seeded by a secret committed to now and a ledger yet to close
+		if settings.PayoutMode == PayoutDraw {
+			draw, err := newDraw(ctx)
+			if err != nil {
+				return opError(ErrInvalid, "Failed to commit to the payout draw: %v", err)
+			}
+			for column, value := range draw {
+				updates[column] = value
+			}
+		}
+
+		// One payout per round, in the agreed order
+		memberByUser := map[string]models.Member{}
+		for _, member := range members {
+			memberByUser[member.UserID] = member
+		}
+
+		totalPayout := settings.ContributionAmount * float64(len(members))
+		startDate := time.Now()
+		var schedules []models.PayoutSchedule
+		for i, userID := range settings.PayoutOrder {
+			member, ok := memberByUser[userID]
+			if !ok {
+				return opError(ErrInvalid, "Payout order includes %s, who is not an approved member", userID)
+			}
+			schedules = append(schedules, models.PayoutSchedule{
+				ID:        uuid.NewString(),
+				GroupID:   groupID,
+				MemberID:  member.ID,
+				Round:     i + 1,
+				Amount:    totalPayout,
+				DueDate:   startDate.AddDate(0, 0, i*settings.ContributionPeriod),
+				Status:    "scheduled",
+				CreatedAt: time.Now(),
+				UpdatedAt: time.Now(),
+			})
+		}
+
+		// Turn the group wallet into a multisig treasury controlled by the creator and admins.
+		// This is the only step on the ledger and runs last, once everything else is checked.
+		if !group.Multisig {
+			var signers []string
+			for _, admin := range admins {
+				if admin.User.Wallet != "" {
+					signers = append(signers, admin.User.Wallet)
+				}
+			}
+
+			payoutThreshold := settings.PayoutThreshold
+			if payoutThreshold == 0 {
+				payoutThreshold = len(signers)/2 + 1 // majority of signers
+			}
+			signerThreshold := settings.SignerThreshold
+			if signerThreshold == 0 {
+				signerThreshold = payoutThreshold
+			}
+
+			if _, err := SetupGroupMultisig(ctx, group, signers, payoutThreshold, signerThreshold); err != nil {
+				slog.ErrorContext(ctx, "failed to set up multisig treasury", "group_id", groupID, "error", err)
+				return opError(ErrInvalid, "Failed to set up multisig treasury: %v", err)
+			}
+
+			signersJSON, _ := json.Marshal(signers)
+			updates["multisig"] = true
+			updates["treasury_signers"] = string(signersJSON)
+			updates["payout_threshold"] = payoutThreshold
+			updates["signer_threshold"] = signerThreshold
+			updates["secret_key"] = "" // the master key now has zero weight
+		}
+
+		if err := tx.Model(&models.Group{}).Where("id = ?", groupID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if len(schedules) == 0 {
+			return nil
+		}
+		return tx.Create(&schedules).Error
+	})
+	if err != nil {
+		return group, err
 	}
 
-	// Update group with contribution settings
-	updates := map[string]interface{}{
-		"status": "active",
-		"contribution_amount": settings.ContributionAmount,
-		"contribution_period": settings.ContributionPeriod,
-		"payout_order": settings.PayoutOrder,
+	slog.InfoContext(ctx, "group activated", "group_id", groupID, "type", settings.Type, "rounds", len(settings.PayoutOrder))
+
+	return group, database.DB.First(&group, "id = ?", groupID).Error
+}
+
+// AcceptInvitation adds the invited user to the group as an approved member and marks the
+// invitation accepted, in one transaction under a lock on the invitation
+func AcceptInvitation(invitationID string, user models.User) (models.GroupInvitation, error) {
+	var invitation models.GroupInvitation
+	if err := RequireVerifiedEmail(user); err != nil {
+		return invitation, err
 	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := database.ForUpdate(tx).Where("id = ? AND email = ?", invitationID, user.Email).
+			First(&invitation).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return opError(ErrNotFound, "Invitation not found")
+			}
+			return err
+		}
 
-	return database.DB.Model(&models.Group{}).Where("id = ?", groupID).Updates(updates).Error
+		if invitation.Status != "pending" {
+			return opError(ErrInvalid, "Invitation already processed")
+		}
+		if time.Now().After(invitation.ExpiresAt) {
+			return opError(ErrInvalid, "Invitation has expired")
+		}
+
+		if err := tx.Model(&models.GroupInvitation{}).Where("id = ?", invitation.ID).
+			Updates(map[string]interface{}{"status": "accepted", "user_id": user.ID}).Error; err != nil {
+			return err
+		}
+
+		// Invited users are approved straight away
+		member := models.Member{
+			ID:       uuid.NewString(),
+			GroupID:  invitation.GroupID,
+			UserID:   user.ID,
+			Wallet:   user.Wallet,
+			Role:     "member",
+			Status:   "approved",
+			JoinedAt: time.Now(),
+		}
+		if err := tx.Create(&member).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return opError(ErrConflict, "Already a member of this group")
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return invitation, err
+	}
+
+	// Notify group admins about new member (not request)
+	var admins []models.Member
+	database.DB.Where("group_id = ? AND role IN ? AND status = ?",
+		invitation.GroupID, policy.AdminRoles, "approved").Find(&admins)
+
+	for _, admin := range admins {
+		CreateNotification(admin.UserID, invitation.GroupID, "new_member_joined", "New Member Joined",
+			user.Name+" has joined the group")
+	}
+
+	// Notify the user that they successfully joined
+	CreateNotification(user.ID, invitation.GroupID, "membership_approved", "Welcome to the Group",
+		"You have successfully joined the group")
+
+	invitation.Status = "accepted"
+	invitation.UserID = user.ID
+	return invitation, nil
 }
 
 func JoinGroupRequest(groupID, userID, walletAddress string) error {
@@ -199,5 +480,9 @@ func JoinGroupRequest(groupID, userID, walletAddress string) error {
 		JoinedAt: time.Now(),
 	}
 
-	return database.DB.Create(&member).Error
+	err := database.DB.Create(&member).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return errors.New("user is already a member of this group")
+	}
+	return err
 }
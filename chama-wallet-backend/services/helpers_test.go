@@ -0,0 +1,37 @@
+package services_test
+
+import (
+	"testing"
+
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/testenv"
+)
+
+// newEnv starts a test environment that is closed when the test ends
+func newEnv(t *testing.T) *testenv.Env {
+	t.Helper()
+	e, err := testenv.New()
+	if err != nil {
+		t.Fatalf("testenv: %v", err)
+	}
+	t.Cleanup(func() { e.Close() })
+	return e
+}
+
+// activeGroup registers a creator and n members and activates a group of them with settings
+func activeGroup(t *testing.T, e *testenv.Env, n int, settings models.GroupSettings) (models.Group, models.AuthResponse, []models.AuthResponse) {
+	t.Helper()
+	creator, err := e.Register("Creator", "creator@example.com")
+	if err != nil {
+		t.Fatalf("register creator: %v", err)
+	}
+	members, err := e.Members(n)
+	if err != nil {
+		t.Fatalf("register members: %v", err)
+	}
+	group, err := e.ActiveGroup(creator, members, settings)
+	if err != nil {
+		t.Fatalf("activate group: %v", err)
+	}
+	return group, creator, members
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+)
+
+const (
+	// idempotencyKeyTTL is how long a stored response is replayed for the same key
+	idempotencyKeyTTL = 24 * time.Hour
+	// idempotencyLockTimeout is how long a request may hold a key before a retry can take it over
+	idempotencyLockTimeout = 2 * time.Minute
+)
+
+var (
+	// ErrIdempotencyKeyReused means the key was already used for a different request
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+	// ErrIdempotencyKeyInFlight means another request with the key is still being processed
+	ErrIdempotencyKeyInFlight = errors.New("a request with this idempotency key is still being processed")
+)
+
+// BeginIdempotentRequest claims key for the user's request. It returns the stored record
+// and replay=true when the request already completed and its response should be replayed.
+func BeginIdempotentRequest(userID, key, method, path, requestHash string) (*models.IdempotencyKey, bool, error) {
+	now := time.Now()
+	record := models.IdempotencyKey{
+		ID:          uuid.NewString(),
+		UserID:      userID,
+		Key:         key,
+		Method:      method,
+		Path:        path,
+		RequestHash: requestHash,
+		Status:      "processing",
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(idempotencyKeyTTL),
+	}
+	if err := database.DB.Create(&record).Error; err == nil {
+		return &record, false, nil
+	}
+
+	var existing models.IdempotencyKey
+	if err := database.DB.Where("user_id = ? AND key = ?", userID, key).First(&existing).Error; err != nil {
+		return nil, false, err
+	}
+
+	// An expired key is free to be used again
+	if existing.ExpiresAt.Before(now) {
+		result := database.DB.Where("id = ? AND expires_at < ?", existing.ID, now).Delete(&models.IdempotencyKey{})
+		if result.Error != nil {
+			return nil, false, result.Error
+		}
+		if err := database.DB.Create(&record).Error; err != nil {
+			return nil, false, ErrIdempotencyKeyInFlight
+		}
+		return &record, false, nil
+	}
+
+	if existing.RequestHash != requestHash || existing.Method != method || existing.Path != path {
+		return nil, false, ErrIdempotencyKeyReused
+	}
+
+	if existing.Status == "completed" {
+		return &existing, true, nil
+	}
+
+	// A request that died while holding the key can be taken over once its lock times out
+	if existing.CreatedAt.Before(now.Add(-idempotencyLockTimeout)) {
+		result := database.DB.Model(&models.IdempotencyKey{}).
+			Where("id = ? AND status = ? AND created_at = ?", existing.ID, "processing", existing.CreatedAt).
+			Update("created_at", now)
+		if result.Error == nil && result.RowsAffected == 1 {
+			existing.CreatedAt = now
+			return &existing, false, nil
+		}
+	}
+	return nil, false, ErrIdempotencyKeyInFlight
+}
+
+// CompleteIdempotentRequest stores the response to replay for the key
+func CompleteIdempotentRequest(id string, status int, body []byte) error {
+	return database.DB.Model(&models.IdempotencyKey{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":          "completed",
+			"response_status": status,
+			"response_body":   body,
+		}).Error
+}
+
+// ReleaseIdempotentRequest frees the key so the request can be retried
+func ReleaseIdempotentRequest(id string) error {
+	return database.DB.Where("id = ?", id).Delete(&models.IdempotencyKey{}).Error
+}
+
+// PurgeExpiredIdempotencyKeys deletes keys whose replay window has passed
+func PurgeExpiredIdempotencyKeys(ctx context.Context) error {
+	result := database.DB.WithContext(ctx).Where("expires_at < ?", time.Now()).Delete(&models.IdempotencyKey{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		slog.InfoContext(ctx, "purged expired idempotency keys", "count", result.RowsAffected)
+	}
+	return nil
+}
@@ -0,0 +1,537 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/policy"
+)
+
+// Group types
+const (
+	GroupRotating = "rotating" // contributions are paid out to one member per round
+	GroupASCA     = "asca"     // contributions are saved and lent to members
+)
+
+// openLoan are the loan statuses a member can have only one of at a time
+var openLoan = []string{"pending", "approving", "active"}
+
+// stroops rounds an amount to whole stroops, the smallest amount the ledger can move
+func stroops(amount float64) float64 {
+	return math.Round(amount*1e7) / 1e7
+}
+
+// GroupType returns the group's type, rotating unless set
+func GroupType(group models.Group) string {
+	if group.Type == "" {
+		return GroupRotating
+	}
+	return group.Type
+}
+
+// GroupLoanPolicy returns the loan terms stored on the group
+func GroupLoanPolicy(group models.Group) models.LoanPolicy {
+	return models.LoanPolicy{
+		InterestRate:  group.LoanInterestRate,
+		MaxTermMonths: group.LoanMaxTermMonths,
+		Guarantors:    group.LoanGuarantors,
+		MaxMultiple:   group.LoanMaxMultiple,
+	}
+}
+
+// ValidateLoanPolicy checks loan terms are ones the group can lend on
+func ValidateLoanPolicy(policy models.LoanPolicy, members int) error {
+	if policy.InterestRate < 0 || policy.InterestRate > 100 {
+		return fmt.Errorf("interest rate must be between 0 and 100 percent a month")
+	}
+	if policy.MaxTermMonths < 1 || policy.MaxTermMonths > 60 {
+		return fmt.Errorf("max term must be between 1 and 60 months")
+	}
+	if policy.Guarantors < 0 {
+		return fmt.Errorf("guarantors cannot be negative")
+	}
+	if members > 0 && policy.Guarantors > members-1 {
+		return fmt.Errorf("group has %d other members to guarantee a loan, %d required", members-1, policy.Guarantors)
+	}
+	if policy.MaxMultiple < 0 {
+		return fmt.Errorf("max multiple cannot be negative")
+	}
+	return nil
+}
+
+// LoanPolicyUpdates returns the group columns that store loan terms
+func LoanPolicyUpdates(policy models.LoanPolicy) map[string]interface{} {
+	return map[string]interface{}{
+		"loan_interest_rate":   policy.InterestRate,
+		"loan_max_term_months": policy.MaxTermMonths,
+		"loan_guarantors":      policy.Guarantors,
+		"loan_max_multiple":    policy.MaxMultiple,
+	}
+}
+
+// LoanSchedule splits a loan into monthly installments, the first due a month after start.
+// Interest is flat: rate percent of the principal each month. The last installment takes
+// whatever rounding left over, so the installments add up to the total due.
+func LoanSchedule(principal, rate float64, termMonths int, start time.Time) []models.LoanInstallment {
+	monthlyPrincipal := stroops(principal / float64(termMonths))
+	monthlyInterest := stroops(principal * rate / 100)
+
+	installments := make([]models.LoanInstallment, 0, termMonths)
+	remaining := principal
+	for i := 1; i <= termMonths; i++ {
+		part := monthlyPrincipal
+		if i == termMonths {
+			part = stroops(remaining)
+		}
+		remaining -= part
+		installments = append(installments, models.LoanInstallment{
+			ID:        uuid.NewString(),
+			Number:    i,
+			DueDate:   start.AddDate(0, i, 0),
+			Principal: part,
+			Interest:  monthlyInterest,
+			Amount:    stroops(part + monthlyInterest),
+			Status:    "due",
+		})
+	}
+	return installments
+}
+
+// LoanTotalDue returns the principal plus the flat interest over the term
+func LoanTotalDue(principal, rate float64, termMonths int) float64 {
+	return stroops(principal + stroops(principal*rate/100)*float64(termMonths))
+}
+
+// LoanMemo is the memo a loan repayment carries so it can be matched on the ledger
+func LoanMemo(repaymentID string) string {
+	return "loan " + strings.ReplaceAll(repaymentID, "-", "")[:20]
+}
+
+// MemberSavings returns the total of the member's confirmed round contributions
+func MemberSavings(groupID, memberID string) (float64, error) {
+	var total float64
+	err := database.DB.Model(&models.RoundContribution{}).
+		Where("group_id = ? AND member_id = ? AND status = ?", groupID, memberID, "confirmed").
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// LoanApplication is what a member asks to borrow
+type LoanApplication struct {
+	Amount     float64  `json:"amount"`
+	TermMonths int      `json:"term_months"`
+	Purpose    string   `json:"purpose"`
+	Guarantors []string `json:"guarantors"` // member IDs
+}
+
+// ApplyForLoan records the member's loan application under the group's loan terms and
+// asks the named guarantors to stand behind it. A loan that needs no guarantors goes
+// straight to the admins as a disbursement payout request.
+func ApplyForLoan(ctx context.Context, group models.Group, borrower models.Member, application LoanApplication) (models.Loan, error) {
+	var loan models.Loan
+
+	if GroupType(group) != GroupASCA {
+		return loan, opError(ErrInvalid, "Only savings and credit groups lend to members")
+	}
+	if group.Status != "active" {
+		return loan, opError(ErrInvalid, "Group must be active to apply for loans")
+	}
+
+	terms := GroupLoanPolicy(group)
+	if application.Amount <= 0 {
+		return loan, opError(ErrInvalid, "Loan amount must be positive")
+	}
+	if application.TermMonths < 1 || application.TermMonths > terms.MaxTermMonths {
+		return loan, opError(ErrInvalid, "Term must be between 1 and %d months", terms.MaxTermMonths)
+	}
+	if len(application.Guarantors) < terms.Guarantors {
+		return loan, opError(ErrInvalid, "Loan needs %d guarantors", terms.Guarantors)
+	}
+
+	if terms.MaxMultiple > 0 {
+		savings, err := MemberSavings(group.ID, borrower.ID)
+		if err != nil {
+			return loan, err
+		}
+		if limit := savings * terms.MaxMultiple; application.Amount > limit {
+			return loan, opError(ErrInvalid, "You can borrow up to %.2f XLM, %.1f times your savings of %.2f XLM", limit, terms.MaxMultiple, savings)
+		}
+	}
+
+	loan = models.Loan{
+		ID:           uuid.NewString(),
+		GroupID:      group.ID,
+		MemberID:     borrower.ID,
+		Principal:    stroops(application.Amount),
+		InterestRate: terms.InterestRate,
+		TermMonths:   application.TermMonths,
+		Purpose:      application.Purpose,
+		Status:       "pending",
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	loan.TotalDue = LoanTotalDue(loan.Principal, loan.InterestRate, loan.TermMonths)
+
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the borrower so two applications cannot both pass the open loan check
+		if err := database.ForUpdate(tx).First(&borrower, "id = ?", borrower.ID).Error; err != nil {
+			return err
+		}
+
+		var open int64
+		if err := tx.Model(&models.Loan{}).Where("member_id = ? AND status IN ?", borrower.ID, openLoan).
+			Count(&open).Error; err != nil {
+			return err
+		}
+		if open > 0 {
+			return opError(ErrConflict, "You already have a loan in progress")
+		}
+
+		seen := map[string]bool{}
+		for _, memberID := range application.Guarantors {
+			if memberID == borrower.ID {
+				return opError(ErrInvalid, "You cannot guarantee your own loan")
+			}
+			if seen[memberID] {
+				continue
+			}
+			seen[memberID] = true
+
+			var guarantor models.Member
+			if err := tx.Where("id = ? AND group_id = ? AND status = ?", memberID, group.ID, "approved").
+				First(&guarantor).Error; err != nil {
+				return opError(ErrInvalid, "Guarantor %s is not an approved member", memberID)
+			}
+			loan.Guarantors = append(loan.Guarantors, models.LoanGuarantor{
+				ID:        uuid.NewString(),
+				LoanID:    loan.ID,
+				MemberID:  guarantor.ID,
+				Member:    guarantor,
+				Status:    "pending",
+				CreatedAt: time.Now(),
+			})
+		}
+		if len(loan.Guarantors) < terms.Guarantors {
+			return opError(ErrInvalid, "Loan needs %d different guarantors", terms.Guarantors)
+		}
+
+		if err := tx.Omit(clause.Associations).Create(&loan).Error; err != nil {
+			return err
+		}
+		if len(loan.Guarantors) > 0 {
+			return tx.Omit("Member").Create(&loan.Guarantors).Error
+		}
+		return openLoanDisbursement(tx, group, &loan)
+	})
+	if err != nil {
+		return loan, err
+	}
+
+	slog.InfoContext(ctx, "loan application recorded", "loan_id", loan.ID, "member_id", borrower.ID,
+		"principal", loan.Principal, "term_months", loan.TermMonths, "guarantors", len(loan.Guarantors))
+
+	for _, guarantor := range loan.Guarantors {
+		CreateNotification(
+			guarantor.Member.UserID,
+			group.ID,
+			"loan_guarantee_request",
+			"Loan Guarantee Requested",
+			fmt.Sprintf("You have been asked to guarantee a loan of %.2f XLM over %d month(s) in %s", loan.Principal, loan.TermMonths, group.Name),
+		)
+	}
+	if loan.Status == "approving" {
+		notifyLoanApprovers(group, loan)
+	}
+	return loan, nil
+}
+
+// RespondToGuarantee records a guarantor accepting or declining a loan. A decline
+// declines the loan; once every guarantor has accepted, the loan goes to the admins as a
+// disbursement payout request.
+func RespondToGuarantee(ctx context.Context, group models.Group, loanID string, guarantor models.Member, accept bool) (models.Loan, error) {
+	var loan models.Loan
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := database.ForUpdate(tx).Where("id = ? AND group_id = ?", loanID, group.ID).
+			First(&loan).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return opError(ErrNotFound, "Loan not found")
+			}
+			return err
+		}
+
+		var request models.LoanGuarantor
+		if err := tx.Where("loan_id = ? AND member_id = ?", loan.ID, guarantor.ID).First(&request).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return opError(ErrForbidden, "You are not a guarantor of this loan")
+			}
+			return err
+		}
+		if loan.Status != "pending" {
+			return opError(ErrConflict, "Loan is already %s", loan.Status)
+		}
+		if request.Status != "pending" {
+			return opError(ErrConflict, "You have already %s this loan", request.Status)
+		}
+
+		now := time.Now()
+		status := "declined"
+		if accept {
+			status = "accepted"
+		}
+		if err := tx.Model(&models.LoanGuarantor{}).Where("id = ?", request.ID).
+			Updates(map[string]interface{}{"status": status, "responded_at": now}).Error; err != nil {
+			return err
+		}
+
+		if !accept {
+			loan.Status = "declined"
+			return tx.Model(&models.Loan{}).Where("id = ?", loan.ID).
+				Updates(map[string]interface{}{"status": loan.Status, "updated_at": now}).Error
+		}
+
+		var waiting int64
+		if err := tx.Model(&models.LoanGuarantor{}).Where("loan_id = ? AND status <> ?", loan.ID, "accepted").
+			Count(&waiting).Error; err != nil {
+			return err
+		}
+		if waiting > 0 {
+			return nil
+		}
+		return openLoanDisbursement(tx, group, &loan)
+	})
+	if err != nil {
+		return loan, err
+	}
+
+	slog.InfoContext(ctx, "loan guarantee recorded", "loan_id", loan.ID, "guarantor_id", guarantor.ID, "accepted", accept)
+
+	var borrower models.Member
+	if err := database.DB.First(&borrower, "id = ?", loan.MemberID).Error; err == nil {
+		switch loan.Status {
+		case "declined":
+			CreateNotification(borrower.UserID, group.ID, "loan_declined", "Loan Declined",
+				fmt.Sprintf("A guarantor declined your loan of %.2f XLM in %s", loan.Principal, group.Name))
+		case "approving":
+			CreateNotification(borrower.UserID, group.ID, "loan_guaranteed", "Loan Guaranteed",
+				fmt.Sprintf("Your loan of %.2f XLM in %s is fully guaranteed and awaiting admin approval", loan.Principal, group.Name))
+		}
+	}
+	if loan.Status == "approving" {
+		notifyLoanApprovers(group, loan)
+	}
+	return loan, nil
+}
+
+// openLoanDisbursement raises the payout request the admins vote on to disburse the loan
+// from the group wallet, and moves the loan to approving
+func openLoanDisbursement(tx *gorm.DB, group models.Group, loan *models.Loan) error {
+	var borrower models.Member
+	if err := tx.Preload("User").First(&borrower, "id = ?", loan.MemberID).Error; err != nil {
+		return err
+	}
+
+	payoutRequest := models.PayoutRequest{
+		ID:          uuid.NewString(),
+		GroupID:     group.ID,
+		RecipientID: borrower.UserID,
+		Amount:      loan.Principal,
+		Status:      "pending",
+		LoanID:      loan.ID,
+		CreatedAt:   time.Now(),
+	}
+	payoutRequest.ExpiresAt = PayoutExpiry(group, payoutRequest.CreatedAt)
+
+	// Multisig treasuries need a fixed envelope that each signer approves
+	if group.Multisig {
+		envelope, err := BuildGroupPayoutTx(tx.Statement.Context, group, borrower.User.Wallet, fmt.Sprintf("%.7f", loan.Principal))
+		if err != nil {
+			return fmt.Errorf("failed to build loan disbursement: %w", err)
+		}
+		payoutRequest.EnvelopeXDR = envelope
+	}
+	if err := tx.Create(&payoutRequest).Error; err != nil {
+		return err
+	}
+
+	loan.Status = "approving"
+	loan.PayoutRequestID = payoutRequest.ID
+	loan.UpdatedAt = time.Now()
+	return tx.Model(&models.Loan{}).Where("id = ?", loan.ID).Updates(map[string]interface{}{
+		"status":            loan.Status,
+		"payout_request_id": loan.PayoutRequestID,
+		"updated_at":        loan.UpdatedAt,
+	}).Error
+}
+
+// notifyLoanApprovers tells the members who vote on payouts that a loan awaits approval
+func notifyLoanApprovers(group models.Group, loan models.Loan) {
+	var members []models.Member
+	database.DB.Where("group_id = ? AND status = ?", group.ID, "approved").Find(&members)
+	for _, member := range members {
+		if member.ID == loan.MemberID || !policy.Allows(group, member, policy.ApprovePayout) {
+			continue
+		}
+		CreateNotification(
+			member.UserID,
+			group.ID,
+			"loan_approval",
+			"Loan Awaiting Approval",
+			fmt.Sprintf("A loan of %.2f XLM over %d month(s) requires approval (payout request %s)", loan.Principal, loan.TermMonths, loan.PayoutRequestID),
+		)
+	}
+}
+
+// DisburseLoan activates the loan a completed payout request paid out and sets its
+// repayment schedule from the disbursement date. Disbursing an active loan is a no-op.
+func DisburseLoan(ctx context.Context, payoutRequest models.PayoutRequest, txHash string) error {
+	var loan models.Loan
+	now := time.Now()
+	activated := false
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := database.ForUpdate(tx).First(&loan, "id = ?", payoutRequest.LoanID).Error; err != nil {
+			return err
+		}
+		if loan.Status != "approving" {
+			return nil
+		}
+
+		installments := LoanSchedule(loan.Principal, loan.InterestRate, loan.TermMonths, now)
+		for i := range installments {
+			installments[i].LoanID = loan.ID
+		}
+		if err := tx.Create(&installments).Error; err != nil {
+			return err
+		}
+
+		activated = true
+		loan.Status = "active"
+		return tx.Model(&models.Loan{}).Where("id = ?", loan.ID).Updates(map[string]interface{}{
+			"status":       loan.Status,
+			"tx_hash":      txHash,
+			"disbursed_at": now,
+			"updated_at":   now,
+		}).Error
+	})
+	if err != nil || !activated {
+		return err
+	}
+
+	slog.InfoContext(ctx, "loan disbursed", "loan_id", loan.ID, "principal", loan.Principal, "tx_hash", txHash)
+
+	CreateNotification(
+		payoutRequest.RecipientID,
+		loan.GroupID,
+		"loan_disbursed",
+		"Loan Disbursed",
+		fmt.Sprintf("Your loan of %.2f XLM has been sent to your wallet. %.2f XLM is due over %d month(s), the first installment on %s", loan.Principal, loan.TotalDue, loan.TermMonths, now.AddDate(0, 1, 0).Format("2006-01-02")),
+	)
+	return nil
+}
+
+// closeLoanDisbursement ends the loans waiting on a payout request that was rejected,
+// expired or failed
+func closeLoanDisbursement(db *gorm.DB, payoutRequestID, status string) error {
+	return db.Model(&models.Loan{}).
+		Where("payout_request_id = ? AND status = ?", payoutRequestID, "approving").
+		Updates(map[string]interface{}{"status": status, "updated_at": time.Now()}).Error
+}
+
+// ConfirmLoanRepayment marks a repayment as paid by txHash and applies it to the loan's
+// installments in order. The loan is repaid once the total due has been paid. Confirming
+// an already confirmed repayment is a no-op.
+func ConfirmLoanRepayment(ctx context.Context, repaymentID, txHash string) error {
+	var loan models.Loan
+	var repayment models.LoanRepayment
+	confirmed := false
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := database.ForUpdate(tx).First(&repayment, "id = ?", repaymentID).Error; err != nil {
+			return err
+		}
+		if repayment.Status == "confirmed" {
+			return nil
+		}
+		if err := database.ForUpdate(tx).First(&loan, "id = ?", repayment.LoanID).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.LoanRepayment{}).Where("id = ?", repayment.ID).Updates(map[string]interface{}{
+			"status":     "confirmed",
+			"tx_hash":    txHash,
+			"updated_at": now,
+		}).Error; err != nil {
+			return err
+		}
+
+		var installments []models.LoanInstallment
+		if err := tx.Where("loan_id = ? AND status = ?", loan.ID, "due").Order("number ASC").
+			Find(&installments).Error; err != nil {
+			return err
+		}
+		// Each installment's interest is paid before its principal and is the group's profit
+		left := repayment.Amount
+		interest := 0.0
+		for _, installment := range installments {
+			if left <= 0 {
+				break
+			}
+			paid := math.Min(installment.Amount-installment.AmountPaid, left)
+			left = stroops(left - paid)
+			interest += math.Min(paid, math.Max(installment.Interest-installment.AmountPaid, 0))
+			updates := map[string]interface{}{"amount_paid": stroops(installment.AmountPaid + paid)}
+			if stroops(installment.AmountPaid+paid) >= installment.Amount {
+				updates["status"] = "paid"
+				updates["paid_at"] = now
+			}
+			if err := tx.Model(&models.LoanInstallment{}).Where("id = ?", installment.ID).
+				Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := recordProfit(tx, loan.GroupID, ProfitLoanInterest, repayment.ID, interest); err != nil {
+			return err
+		}
+
+		loan.AmountRepaid = stroops(loan.AmountRepaid + repayment.Amount)
+		updates := map[string]interface{}{"amount_repaid": loan.AmountRepaid, "updated_at": now}
+		if loan.Status == "active" && loan.AmountRepaid >= loan.TotalDue {
+			loan.Status = "repaid"
+			updates["status"] = loan.Status
+		}
+		confirmed = true
+		return tx.Model(&models.Loan{}).Where("id = ?", loan.ID).Updates(updates).Error
+	})
+	if err != nil || !confirmed {
+		return err
+	}
+
+	slog.InfoContext(ctx, "loan repayment confirmed", "loan_id", loan.ID, "repayment_id", repayment.ID,
+		"amount", repayment.Amount, "tx_hash", txHash)
+
+	if loan.Status == "repaid" {
+		var borrower models.Member
+		if err := database.DB.First(&borrower, "id = ?", loan.MemberID).Error; err == nil {
+			CreateNotification(borrower.UserID, loan.GroupID, "loan_repaid", "Loan Repaid",
+				fmt.Sprintf("Your loan of %.2f XLM is fully repaid", loan.Principal))
+		}
+	}
+	return nil
+}
+
+// LoanOutstanding returns what is left to repay on the loan
+func LoanOutstanding(loan models.Loan) float64 {
+	return math.Max(stroops(loan.TotalDue-loan.AmountRepaid), 0)
+}
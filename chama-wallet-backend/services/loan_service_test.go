@@ -0,0 +1,159 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
+	"chama-wallet-backend/services"
+	"chama-wallet-backend/testenv"
+)
+
+func TestLoanSchedule(t *testing.T) {
+	start := time.Date(2026, 1, 31, 9, 0, 0, 0, time.UTC)
+	installments := services.LoanSchedule(100, 2, 3, start)
+
+	want := []struct {
+		principal, interest, amount float64
+		due                         time.Time
+	}{
+		{33.3333333, 2, 35.3333333, start.AddDate(0, 1, 0)},
+		{33.3333333, 2, 35.3333333, start.AddDate(0, 2, 0)},
+		{33.3333334, 2, 35.3333334, start.AddDate(0, 3, 0)}, // takes the rounding
+	}
+	if len(installments) != len(want) {
+		t.Fatalf("%d installments, want %d", len(installments), len(want))
+	}
+	var total float64
+	for i, installment := range installments {
+		w := want[i]
+		if installment.Number != i+1 || installment.Principal != w.principal || installment.Interest != w.interest ||
+			installment.Amount != w.amount || !installment.DueDate.Equal(w.due) || installment.Status != "due" {
+			t.Errorf("installment %d: %+v, want principal %v, interest %v, amount %v due %s", i+1, installment, w.principal, w.interest, w.amount, w.due)
+		}
+		total += installment.Amount
+	}
+	if due := services.LoanTotalDue(100, 2, 3); due != 106 || total-due > 1e-7 || due-total > 1e-7 {
+		t.Errorf("total due %v, installments add up to %v, want 106", due, total)
+	}
+	if due := services.LoanTotalDue(50, 0, 4); due != 50 {
+		t.Errorf("interest-free total due %v, want 50", due)
+	}
+}
+
+// lendingGroup activates a savings and credit group that lends without guarantors, with
+// round 1 paid in so the treasury holds 30 XLM
+func lendingGroup(t *testing.T, e *testenv.Env) (models.Group, models.AuthResponse, []models.Member) {
+	t.Helper()
+	group, creator, members := activeGroup(t, e, 2, models.GroupSettings{
+		Type:               services.GroupASCA,
+		ContributionAmount: 10,
+		ContributionPeriod: 7,
+		SharePolicy:        &models.SharePolicy{SharePrice: 1, CycleRounds: 1},
+	})
+	for _, member := range append([]models.AuthResponse{creator}, members...) {
+		if err := e.Contribute(member, group.ID, 1, 10); err != nil {
+			t.Fatalf("contribute: %v", err)
+		}
+	}
+	e.DB.Model(&models.Group{}).Where("id = ?", group.ID).
+		Updates(services.LoanPolicyUpdates(models.LoanPolicy{InterestRate: 1, MaxTermMonths: 6}))
+	group, err := repository.Default.Groups.ByID(group.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	borrowers := make([]models.Member, len(members))
+	for i, member := range members {
+		e.DB.First(&borrowers[i], "group_id = ? AND user_id = ?", group.ID, member.User.ID)
+	}
+	return group, creator, borrowers
+}
+
+func loanStatus(t *testing.T, e *testenv.Env, id string) models.Loan {
+	t.Helper()
+	var loan models.Loan
+	if err := e.DB.Preload("Installments").First(&loan, "id = ?", id).Error; err != nil {
+		t.Fatalf("loan: %v", err)
+	}
+	return loan
+}
+
+func TestLoanDisbursedThroughPayoutVote(t *testing.T) {
+	e := newEnv(t)
+	group, creator, borrowers := lendingGroup(t, e)
+	borrower := borrowers[0]
+	var user models.User
+	e.DB.First(&user, "id = ?", borrower.UserID)
+	before := e.Ledger.Balance(user.Wallet)
+
+	loan, err := services.ApplyForLoan(e.Context(), group, borrower, services.LoanApplication{Amount: 20, TermMonths: 2, Purpose: "stock"})
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if loan.Status != "approving" || loan.PayoutRequestID == "" || loan.TotalDue != 20.4 {
+		t.Fatalf("loan %+v, want approving with a disbursement request and 20.4 XLM due", loan)
+	}
+	disbursement := payoutStatus(t, e, loan.PayoutRequestID)
+	if disbursement.LoanID != loan.ID || disbursement.Amount != 20 || disbursement.RecipientID != borrower.UserID {
+		t.Fatalf("disbursement %+v, want 20 XLM to the borrower for the loan", disbursement)
+	}
+
+	// Nothing moves until the vote passes
+	if _, _, err := services.ExecutePayout(e.Context(), disbursement.ID); err == nil {
+		t.Fatal("disbursed before the vote")
+	}
+	_, tally, err := services.VoteOnPayout(e.Context(), disbursement.ID, creator.User, true, "")
+	if err != nil || tally.Outcome != "approved" {
+		t.Fatalf("vote: %+v, %v", tally, err)
+	}
+	resp, state, err := services.ExecutePayout(e.Context(), disbursement.ID)
+	if err != nil || state != services.SubmissionConfirmed {
+		t.Fatalf("execute: state %v, err %v", state, err)
+	}
+
+	active := loanStatus(t, e, loan.ID)
+	if active.Status != "active" || active.TxHash != resp.Hash || active.DisbursedAt == nil || len(active.Installments) != 2 {
+		t.Errorf("loan %s with hash %s and %d installments, want active with %s and 2", active.Status, active.TxHash, len(active.Installments), resp.Hash)
+	}
+	if after := e.Ledger.Balance(user.Wallet); after == before {
+		t.Errorf("borrower balance still %s", after)
+	}
+}
+
+func TestLoanClosesWhenDisbursementIsRejectedOrExpires(t *testing.T) {
+	e := newEnv(t)
+	group, creator, borrowers := lendingGroup(t, e)
+
+	rejected, err := services.ApplyForLoan(e.Context(), group, borrowers[0], services.LoanApplication{Amount: 5, TermMonths: 1})
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if _, tally, err := services.VoteOnPayout(e.Context(), rejected.PayoutRequestID, creator.User, false, ""); err != nil || tally.Outcome != "rejected" {
+		t.Fatalf("reject: %+v, %v", tally, err)
+	}
+	if got := loanStatus(t, e, rejected.ID).Status; got != "rejected" {
+		t.Errorf("loan %s after the vote was rejected, want rejected", got)
+	}
+
+	expired, err := services.ApplyForLoan(e.Context(), group, borrowers[1], services.LoanApplication{Amount: 5, TermMonths: 1})
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	e.DB.Model(&models.PayoutRequest{}).Where("id = ?", expired.PayoutRequestID).Update("expires_at", time.Now().Add(-time.Minute))
+	if err := services.ExpirePayoutRequests(e.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if got := payoutStatus(t, e, expired.PayoutRequestID).Status; got != "expired" {
+		t.Errorf("disbursement %s, want expired", got)
+	}
+	if got := loanStatus(t, e, expired.ID).Status; got != "expired" {
+		t.Errorf("loan %s after the vote expired, want expired", got)
+	}
+
+	// A closed loan no longer blocks the borrower from applying again
+	if _, err := services.ApplyForLoan(e.Context(), group, borrowers[0], services.LoanApplication{Amount: 5, TermMonths: 1}); err != nil {
+		t.Errorf("apply after a rejected loan: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"chama-wallet-backend/config"
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+)
+
+// loginThrottleRetention is how long failed sign-ins are remembered once the last one
+// is over and any lockout has ended
+const loginThrottleRetention = 24 * time.Hour
+
+// LoginLockedError is returned when an account is locked out after repeated failed
+// sign-ins
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("too many failed sign-in attempts, try again in %s", e.RetryAfter.Round(time.Second))
+}
+
+// checkLoginLock returns a LoginLockedError while the email is locked out
+func checkLoginLock(email string) error {
+	var throttle models.LoginThrottle
+	err := database.DB.Where("email = ?", throttleKey(email)).Limit(1).Find(&throttle).Error
+	if err != nil {
+		return err
+	}
+	if throttle.LockedUntil != nil && time.Now().Before(*throttle.LockedUntil) {
+		return &LoginLockedError{RetryAfter: time.Until(*throttle.LockedUntil)}
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed sign-in. From the threshold on, each failure locks
+// the email out for twice as long as the last, up to the maximum.
+func recordLoginFailure(ctx context.Context, email string) error {
+	key := throttleKey(email)
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.LoginThrottle{Email: key, UpdatedAt: now}).Error
+		if err != nil {
+			return err
+		}
+
+		var throttle models.LoginThrottle
+		if err := database.ForUpdate(tx).First(&throttle, "email = ?", key).Error; err != nil {
+			return err
+		}
+
+		// Failures stop counting once they are old enough to be purged
+		if now.Sub(throttle.UpdatedAt) > loginThrottleRetention && (throttle.LockedUntil == nil || now.After(*throttle.LockedUntil)) {
+			throttle.Failures = 0
+		}
+		throttle.Failures++
+
+		updates := map[string]interface{}{"failures": throttle.Failures, "updated_at": now}
+		if lockout := lockoutFor(throttle.Failures); lockout > 0 {
+			until := now.Add(lockout)
+			updates["locked_until"] = until
+			slog.WarnContext(tx.Statement.Context, "sign-in locked", "lockout", lockout.String(), "failures", throttle.Failures)
+		}
+		return tx.Model(&models.LoginThrottle{}).Where("email = ?", key).Updates(updates).Error
+	})
+}
+
+// clearLoginFailures forgets an email's failed sign-ins after a successful one
+func clearLoginFailures(email string) error {
+	return database.DB.Where("email = ?", throttleKey(email)).Delete(&models.LoginThrottle{}).Error
+}
+
+// lockoutFor is how long the given number of failures locks sign-in for
+func lockoutFor(failures int) time.Duration {
+	over := failures - config.Auth.LockoutThreshold
+	if over < 0 {
+		return 0
+	}
+	lockout := config.Auth.LockoutBase
+	for i := 0; i < over && lockout < config.Auth.LockoutMax; i++ {
+		lockout *= 2
+	}
+	if lockout > config.Auth.LockoutMax {
+		lockout = config.Auth.LockoutMax
+	}
+	return lockout
+}
+
+// PurgeLoginThrottles deletes failed sign-in counts that no longer matter
+func PurgeLoginThrottles(ctx context.Context) error {
+	now := time.Now()
+	result := database.DB.WithContext(ctx).
+		Where("updated_at < ? AND (locked_until IS NULL OR locked_until < ?)", now.Add(-loginThrottleRetention), now).
+		Delete(&models.LoginThrottle{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		slog.InfoContext(ctx, "purged login throttles", "count", result.RowsAffected)
+	}
+	return nil
+}
+
+func throttleKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
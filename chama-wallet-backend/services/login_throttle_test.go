@@ -0,0 +1,78 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"chama-wallet-backend/config"
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/services"
+)
+
+func TestLoginLockoutGrowsPerEmailAndResets(t *testing.T) {
+	e := newEnv(t)
+	previous := config.Auth
+	t.Cleanup(func() { config.Auth = previous })
+	config.Auth.LockoutThreshold = 2
+	config.Auth.LockoutBase = time.Minute
+	config.Auth.LockoutMax = time.Hour
+
+	if _, err := e.Register("Njeri", "njeri@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	client := models.ClientInfo{UserAgent: "test"}
+	login := func(email, password string) error {
+		_, err := services.LoginUser(e.Context(), models.LoginRequest{Email: email, Password: password}, client)
+		return err
+	}
+	lockedFor := func(err error) time.Duration {
+		t.Helper()
+		var locked *services.LoginLockedError
+		if !errors.As(err, &locked) {
+			t.Fatalf("login: %v, want locked out", err)
+		}
+		return locked.RetryAfter
+	}
+	unlock := func() {
+		t.Helper()
+		if err := database.DB.Model(&models.LoginThrottle{}).Where("email = ?", "njeri@example.com").
+			Update("locked_until", time.Now().Add(-time.Second)).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Below the threshold a wrong password is just wrong
+	if err := login("njeri@example.com", "wrong"); err == nil || errors.As(err, new(*services.LoginLockedError)) {
+		t.Fatalf("first failure: %v, want invalid credentials", err)
+	}
+
+	// The threshold locks the email for the base lockout, even for the right password
+	login("Njeri@Example.com", "wrong")
+	if wait := lockedFor(login("njeri@example.com", "password123")); wait <= 0 || wait > time.Minute {
+		t.Errorf("first lockout %s, want up to a minute", wait)
+	}
+
+	// Other emails are not affected
+	if err := login("someone@example.com", "wrong"); errors.As(err, new(*services.LoginLockedError)) {
+		t.Errorf("another email is locked out")
+	}
+
+	// The next failure doubles the lockout
+	unlock()
+	login("njeri@example.com", "wrong")
+	if wait := lockedFor(login("njeri@example.com", "password123")); wait <= time.Minute || wait > 2*time.Minute {
+		t.Errorf("second lockout %s, want between one and two minutes", wait)
+	}
+
+	// Signing in clears the count, so the next failure does not lock
+	unlock()
+	if err := login("njeri@example.com", "password123"); err != nil {
+		t.Fatalf("login after the lockout: %v", err)
+	}
+	login("njeri@example.com", "wrong")
+	if err := login("njeri@example.com", "password123"); err != nil {
+		t.Errorf("login after one failure: %v, want success", err)
+	}
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"chama-wallet-backend/database"
 	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
 	"fmt"
 	"time"
 
@@ -19,28 +20,15 @@ func CreateNotification(userID, groupID, notificationType, title, message string
 		Message:   message,
 		CreatedAt: time.Now(),
 	}
-	return database.DB.Create(&notification).Error
+	return repository.Default.Notifications.Create(&notification)
 }
 
 func GetUserNotifications(userID string) ([]models.Notification, error) {
-	var notifications []models.Notification
-	err := database.DB.
-		Where("user_id = ?", userID).
-		Preload("Group").
-		Preload("User").
-		Order("created_at DESC").
-		Find(&notifications).Error
-	
-	fmt.Printf("🔍 Query: SELECT * FROM notifications WHERE user_id = '%s'\n", userID)
-	fmt.Printf("✅ Found %d notifications in database\n", len(notifications))
-	
-	return notifications, err
+	return repository.Default.Notifications.ForUser(userID)
 }
 
 func MarkNotificationAsRead(notificationID string) error {
-	return database.DB.Model(&models.Notification{}).
-		Where("id = ?", notificationID).
-		Update("read", true).Error
+	return repository.Default.Notifications.MarkRead(notificationID)
 }
 
 func SendContributionReminders() error {
@@ -48,16 +36,29 @@ func SendContributionReminders() error {
 	var groups []models.Group
 	fiveDaysFromNow := time.Now().Add(5 * 24 * time.Hour)
 
-	if err := database.DB.Where("status = ? AND next_contribution_date BETWEEN ? AND ?", 
+	if err := database.DB.Where("status = ? AND next_contribution_date BETWEEN ? AND ?",
 		"active", time.Now(), fiveDaysFromNow).Find(&groups).Error; err != nil {
 		return err
 	}
 
 	for _, group := range groups {
 		var members []models.Member
-		database.DB.Where("group_id = ? AND status = ?", group.ID, "approved").Find(&members)
+		if err := database.DB.Where("group_id = ? AND status = ?", group.ID, "approved").Find(&members).Error; err != nil {
+			return err
+		}
 
 		for _, member := range members {
+			// Members who have paid the current round need no reminder
+			var paid int64
+			if err := database.DB.Model(&models.RoundContribution{}).
+				Where("group_id = ? AND member_id = ? AND round = ? AND status = ?", group.ID, member.ID, group.CurrentRound, "confirmed").
+				Count(&paid).Error; err != nil {
+				return err
+			}
+			if paid > 0 {
+				continue
+			}
+
 			daysUntil := int(group.NextContributionDate.Sub(time.Now()).Hours() / 24)
 			CreateNotification(
 				member.UserID,
@@ -0,0 +1,49 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/services"
+)
+
+func TestContributionRemindersSkipPaidMembers(t *testing.T) {
+	e := newEnv(t)
+	group, creator, members := activeGroup(t, e, 2, models.GroupSettings{ContributionAmount: 10, ContributionPeriod: 7, PayoutMode: services.PayoutAuction})
+	if err := database.DB.Model(&models.Group{}).Where("id = ?", group.ID).
+		Update("next_contribution_date", time.Now().Add(48*time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Contribute(creator, group.ID, 1, 10); err != nil {
+		t.Fatalf("contribute: %v", err)
+	}
+
+	if err := services.SendContributionReminders(); err != nil {
+		t.Fatalf("send reminders: %v", err)
+	}
+
+	reminders := func(userID string) int {
+		t.Helper()
+		notifications, err := services.GetUserNotifications(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count := 0
+		for _, notification := range notifications {
+			if notification.Type == "contribution_reminder" {
+				count++
+			}
+		}
+		return count
+	}
+	if got := reminders(creator.User.ID); got != 0 {
+		t.Errorf("creator, who paid the round, got %d reminders", got)
+	}
+	for _, member := range members {
+		if got := reminders(member.User.ID); got != 1 {
+			t.Errorf("%s got %d reminders, want 1", member.User.Email, got)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/protocols/horizon/operations"
+	"gorm.io/gorm"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+)
+
+// paymentPageSize is the number of payments read from Horizon per request
+const paymentPageSize = 200
+
+// IngestGroupPayments reads the payments of every active group wallet since its saved
+// cursor. Deposits are credited to members as round contributions, and payouts or
+// contributions whose submission outcome was unknown are confirmed.
+func IngestGroupPayments(ctx context.Context) error {
+	var groups []models.Group
+	if err := database.DB.Where("status = ? AND wallet <> ''", "active").Find(&groups).Error; err != nil {
+		return err
+	}
+
+	var failed int
+	for _, group := range groups {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := ingestWalletPayments(ctx, group); err != nil {
+			slog.ErrorContext(ctx, "failed to ingest payments", "group_id", group.ID, "error", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("payment ingestion failed for %d of %d groups", failed, len(groups))
+	}
+	return nil
+}
+
+// ingestWalletPayments processes one group wallet's payments page by page, saving the
+// cursor after each page
+func ingestWalletPayments(ctx context.Context, group models.Group) error {
+	var cursor models.PaymentCursor
+	if err := database.DB.Where(models.PaymentCursor{Account: group.Wallet}).
+		FirstOrCreate(&cursor).Error; err != nil {
+		return err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		page, err := LedgerFrom(ctx).Payments(horizonclient.OperationRequest{
+			ForAccount: group.Wallet,
+			Cursor:     cursor.Cursor,
+			Order:      horizonclient.OrderAsc,
+			Limit:      paymentPageSize,
+			Join:       "transactions",
+		})
+		if err != nil {
+			return err
+		}
+
+		records := page.Embedded.Records
+		for _, record := range records {
+			if err := reconcilePayment(ctx, group, record); err != nil {
+				return fmt.Errorf("payment %s: %w", record.PagingToken(), err)
+			}
+			cursor.Cursor = record.PagingToken()
+		}
+
+		if len(records) > 0 {
+			if err := database.DB.Model(&models.PaymentCursor{}).
+				Where("account = ?", group.Wallet).
+				Updates(map[string]interface{}{"cursor": cursor.Cursor, "updated_at": time.Now()}).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(records) < paymentPageSize {
+			return nil
+		}
+	}
+}
+
+// reconcilePayment applies a single payment to the group's records
+func reconcilePayment(ctx context.Context, group models.Group, record operations.Operation) error {
+	payment, ok := record.(operations.Payment)
+	if !ok || !payment.TransactionSuccessful {
+		return nil
+	}
+
+	// Outgoing payments settle payouts whose submission outcome was unknown
+	if payment.From == group.Wallet {
+		var payoutRequest models.PayoutRequest
+		err := database.DB.Where("group_id = ? AND tx_hash = ? AND status = ?",
+			group.ID, payment.TransactionHash, "approved").First(&payoutRequest).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "payout confirmed on the ledger", "payout_id", payoutRequest.ID, "tx_hash", payment.TransactionHash)
+		return CompletePayout(ctx, payoutRequest.ID, payment.TransactionHash)
+	}
+
+	if payment.To != group.Wallet || payment.Asset.Type != "native" {
+		return nil
+	}
+
+	paid, err := strconv.ParseFloat(payment.Amount, 64)
+	if err != nil {
+		return fmt.Errorf("invalid amount %q: %w", payment.Amount, err)
+	}
+
+	// 1. A contribution submitted through the API with this transaction
+	var contribution models.RoundContribution
+	err = database.DB.Where("group_id = ? AND tx_hash = ?", group.ID, payment.TransactionHash).First(&contribution).Error
+	if err == nil {
+		if contribution.Status == "confirmed" {
+			return nil
+		}
+		slog.InfoContext(ctx, "contribution confirmed on the ledger", "contribution_id", contribution.ID, "tx_hash", payment.TransactionHash)
+		return ConfirmRoundContribution(ctx, contribution.ID, payment.TransactionHash)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	// 2. A prepared contribution whose memo the payment carries
+	memo, err := paymentMemo(ctx, payment)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(memo, "chama ") {
+		err = database.DB.Where("group_id = ? AND memo = ? AND status IN ?",
+			group.ID, memo, []string{"awaiting_signature", "pending"}).First(&contribution).Error
+		if err == nil && paid >= contribution.Amount {
+			slog.InfoContext(ctx, "contribution paid from an external wallet", "contribution_id", contribution.ID, "tx_hash", payment.TransactionHash)
+			return ConfirmRoundContribution(ctx, contribution.ID, payment.TransactionHash)
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+
+	// 3. A late fine, paid through the API or from any wallet, whose memo the payment carries
+	if strings.HasPrefix(memo, "fine ") {
+		var penalty models.Penalty
+		err = database.DB.Where("group_id = ? AND memo = ?", group.ID, memo).First(&penalty).Error
+		switch {
+		case err == nil && penalty.Status == "paid":
+			return nil
+		case err == nil && penalty.Status != "waived" && paid >= penalty.Amount:
+			slog.InfoContext(ctx, "late fine confirmed on the ledger", "penalty_id", penalty.ID, "tx_hash", payment.TransactionHash)
+			return ConfirmPenaltyPayment(ctx, penalty.ID, payment.TransactionHash)
+		case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+		// Never credited as a contribution
+		notifyUnmatchedDeposit(ctx, group, payment)
+		return nil
+	}
+
+	// 4. A loan repayment, paid through the API or from any wallet, whose memo the payment carries
+	if strings.HasPrefix(memo, "loan ") {
+		var repayment models.LoanRepayment
+		err = database.DB.Where("group_id = ? AND memo = ?", group.ID, memo).First(&repayment).Error
+		switch {
+		case err == nil && repayment.Status == "confirmed":
+			return nil
+		case err == nil && paid >= repayment.Amount:
+			slog.InfoContext(ctx, "loan repayment confirmed on the ledger", "repayment_id", repayment.ID, "tx_hash", payment.TransactionHash)
+			return ConfirmLoanRepayment(ctx, repayment.ID, payment.TransactionHash)
+		case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+		// Never credited as a contribution
+		notifyUnmatchedDeposit(ctx, group, payment)
+		return nil
+	}
+
+	// 5. A direct payment from a member's wallet counts towards the current round
+	var member models.Member
+	err = database.DB.Where("group_id = ? AND status = ? AND (wallet = ? OR user_id IN (?))",
+		group.ID, "approved", payment.From,
+		database.DB.Model(&models.User{}).Select("id").Where("wallet = ?", payment.From)).
+		First(&member).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err == nil && paid >= group.ContributionAmount {
+		credited, err := creditDirectContribution(ctx, group, member, payment, paid, memo)
+		if err != nil || credited {
+			return err
+		}
+	}
+
+	notifyUnmatchedDeposit(ctx, group, payment)
+	return nil
+}
+
+// creditDirectContribution records a member's direct deposit as their contribution for the
+// group's current round. It returns false when the round is already paid or in flight.
+func creditDirectContribution(ctx context.Context, group models.Group, member models.Member, payment operations.Payment, paid float64, memo string) (bool, error) {
+	var contribution models.RoundContribution
+	err := database.DB.Where("group_id = ? AND member_id = ? AND round = ?",
+		group.ID, member.ID, group.CurrentRound).First(&contribution).Error
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		contribution = models.RoundContribution{
+			ID:        uuid.NewString(),
+			GroupID:   group.ID,
+			MemberID:  member.ID,
+			Round:     group.CurrentRound,
+			Amount:    paid,
+			Status:    "confirmed",
+			TxHash:    payment.TransactionHash,
+			Memo:      memo,
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}
+		if err := database.DB.Create(&contribution).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				// The member prepared a contribution for the round meanwhile
+				return creditDirectContribution(ctx, group, member, payment, paid, memo)
+			}
+			return false, err
+		}
+		slog.InfoContext(ctx, "direct deposit credited to round",
+			"member_id", member.ID, "round", group.CurrentRound, "tx_hash", payment.TransactionHash)
+		assessLateFine(ctx, contribution, payment.LedgerCloseTime)
+		recordShares(ctx, contribution)
+		if err := UpdateRoundStatus(group.ID, group.CurrentRound); err != nil {
+			slog.WarnContext(ctx, "failed to update round status", "group_id", group.ID, "round", group.CurrentRound, "error", err)
+		}
+		return true, nil
+
+	case err != nil:
+		return false, err
+
+	case contribution.Status == "awaiting_signature":
+		slog.InfoContext(ctx, "direct deposit settles contribution",
+			"member_id", member.ID, "contribution_id", contribution.ID, "tx_hash", payment.TransactionHash)
+		return true, ConfirmRoundContribution(ctx, contribution.ID, payment.TransactionHash)
+	}
+
+	// Already confirmed, or a submission of its own is in flight
+	return false, nil
+}
+
+// paymentMemo returns the text memo of the payment's transaction
+func paymentMemo(ctx context.Context, payment operations.Payment) (string, error) {
+	tx := payment.Transaction
+	if tx == nil {
+		detail, err := LedgerFrom(ctx).TransactionDetail(payment.TransactionHash)
+		if err != nil {
+			return "", fmt.Errorf("failed to load transaction %s: %w", payment.TransactionHash, err)
+		}
+		tx = &detail
+	}
+	if tx.MemoType != "text" {
+		return "", nil
+	}
+	return tx.Memo, nil
+}
+
+// notifyUnmatchedDeposit tells the group admins about a deposit no member could be credited for
+func notifyUnmatchedDeposit(ctx context.Context, group models.Group, payment operations.Payment) {
+	slog.WarnContext(ctx, "unmatched deposit", "group_id", group.ID,
+		"amount", payment.Amount, "from", payment.From, "tx_hash", payment.TransactionHash)
+
+	notifyAdmins(group, "deposit_unmatched", "Unmatched Deposit",
+		fmt.Sprintf("%s received %s XLM from %s that could not be matched to a contribution (tx %s)", group.Name, payment.Amount, payment.From, payment.TransactionHash))
+}
@@ -0,0 +1,193 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/txnbuild"
+
+	"chama-wallet-backend/keystore"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/services"
+	"chama-wallet-backend/testenv"
+)
+
+var watchedSettings = models.GroupSettings{ContributionAmount: 10, ContributionPeriod: 7, PayoutMode: services.PayoutAuction}
+
+// submit signs ops from the signer's account with a text memo and puts them on the fake
+// ledger without going through the API, as a member's own wallet would
+func submit(t *testing.T, e *testenv.Env, secretKey, source, memo string, ops ...txnbuild.Operation) string {
+	t.Helper()
+	signer, err := keystore.Default.Signer(secretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := e.Ledger.AccountDetail(horizonclient.AccountRequest{AccountID: source})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var txMemo txnbuild.Memo
+	if memo != "" {
+		txMemo = txnbuild.MemoText(memo)
+	}
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        &account,
+		IncrementSequenceNum: true,
+		Operations:           ops,
+		BaseFee:              txnbuild.MinBaseFee,
+		Memo:                 txMemo,
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewInfiniteTimeout()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx, err = signer.SignTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := e.Ledger.SubmitTransaction(tx)
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	return resp.Hash
+}
+
+// prepare asks the API for member's round contribution and returns it unsigned
+func prepare(t *testing.T, e *testenv.Env, member models.AuthResponse, groupID string, round int) models.RoundContribution {
+	t.Helper()
+	var prepared struct {
+		ContributionID string `json:"contribution_id"`
+	}
+	if status, err := e.Request("POST", "/group/"+groupID+"/contribute-round/prepare", member.Token,
+		map[string]interface{}{"round": round, "amount": 10}, &prepared); err != nil || status != 200 {
+		t.Fatalf("prepare: status %d, err %v", status, err)
+	}
+	return contributionStatus(t, e, prepared.ContributionID)
+}
+
+func contributionStatus(t *testing.T, e *testenv.Env, id string) models.RoundContribution {
+	t.Helper()
+	var contribution models.RoundContribution
+	if err := e.DB.First(&contribution, "id = ?", id).Error; err != nil {
+		t.Fatalf("contribution: %v", err)
+	}
+	return contribution
+}
+
+func unmatchedDeposits(t *testing.T, e *testenv.Env, groupID string) int64 {
+	t.Helper()
+	var count int64
+	if err := e.DB.Model(&models.Notification{}).
+		Where("group_id = ? AND type = ?", groupID, "deposit_unmatched").Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestIngestMatchesContributionByMemoAndAmount(t *testing.T) {
+	e := newEnv(t)
+	group, _, members := activeGroup(t, e, 2, watchedSettings)
+
+	paid := prepare(t, e, members[0], group.ID, 1)
+	short := prepare(t, e, members[1], group.ID, 1)
+
+	hash := submit(t, e, members[0].User.SecretKey, members[0].User.Wallet, paid.Memo,
+		&txnbuild.Payment{Destination: group.Wallet, Amount: "10", Asset: txnbuild.NativeAsset{}})
+	submit(t, e, members[1].User.SecretKey, members[1].User.Wallet, short.Memo,
+		&txnbuild.Payment{Destination: group.Wallet, Amount: "9.9999999", Asset: txnbuild.NativeAsset{}})
+
+	if err := services.IngestGroupPayments(e.Context()); err != nil {
+		t.Fatalf("ingest: %v", err)
+	}
+
+	if got := contributionStatus(t, e, paid.ID); got.Status != "confirmed" || got.TxHash != hash {
+		t.Errorf("paid contribution %s with tx %q, want confirmed by %s", got.Status, got.TxHash, hash)
+	}
+	if got := contributionStatus(t, e, short.ID); got.Status != "awaiting_signature" {
+		t.Errorf("short contribution %s, want awaiting_signature", got.Status)
+	}
+	if unmatchedDeposits(t, e, group.ID) == 0 {
+		t.Error("short payment was not reported to the admins as unmatched")
+	}
+}
+
+func TestIngestIgnoresOtherAssets(t *testing.T) {
+	e := newEnv(t)
+	group, creator, members := activeGroup(t, e, 2, watchedSettings)
+	contribution := prepare(t, e, members[0], group.ID, 1)
+
+	// The member issues a token the treasury trusts and pays the contribution in it
+	token := txnbuild.CreditAsset{Code: "CHAMA", Issuer: members[0].User.Wallet}
+	line, err := token.ToChangeTrustAsset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	treasuryKey := group.SecretKey
+	if group.Multisig {
+		treasuryKey = creator.User.SecretKey // the only treasury signer
+	}
+	submit(t, e, treasuryKey, group.Wallet, "", &txnbuild.ChangeTrust{Line: line, Limit: "1000"})
+	submit(t, e, members[0].User.SecretKey, members[0].User.Wallet, contribution.Memo,
+		&txnbuild.Payment{Destination: group.Wallet, Amount: "10", Asset: token})
+
+	if err := services.IngestGroupPayments(e.Context()); err != nil {
+		t.Fatalf("ingest: %v", err)
+	}
+	if got := contributionStatus(t, e, contribution.ID); got.Status != "awaiting_signature" {
+		t.Errorf("contribution paid in another asset is %s, want awaiting_signature", got.Status)
+	}
+	var credited int64
+	e.DB.Model(&models.RoundContribution{}).Where("group_id = ? AND status = ?", group.ID, "confirmed").Count(&credited)
+	if credited != 0 {
+		t.Errorf("%d contributions credited, want none", credited)
+	}
+}
+
+func TestIngestResumesFromCursor(t *testing.T) {
+	e := newEnv(t)
+	group, _, members := activeGroup(t, e, 2, watchedSettings)
+
+	// An unmatched deposit is reported each time it is processed
+	submit(t, e, members[0].User.SecretKey, members[0].User.Wallet, "",
+		&txnbuild.Payment{Destination: group.Wallet, Amount: "1", Asset: txnbuild.NativeAsset{}})
+	if err := services.IngestGroupPayments(e.Context()); err != nil {
+		t.Fatalf("ingest: %v", err)
+	}
+	reported := unmatchedDeposits(t, e, group.ID)
+	if reported == 0 {
+		t.Fatal("deposit was not reported")
+	}
+
+	page, err := e.Ledger.Payments(horizonclient.OperationRequest{ForAccount: group.Wallet, Order: horizonclient.OrderDesc, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cursor models.PaymentCursor
+	if err := e.DB.First(&cursor, "account = ?", group.Wallet).Error; err != nil {
+		t.Fatalf("cursor: %v", err)
+	}
+	if want := page.Embedded.Records[0].PagingToken(); cursor.Cursor != want {
+		t.Errorf("cursor %q, want the latest payment %q", cursor.Cursor, want)
+	}
+
+	// Nothing new: the deposit is not processed again
+	if err := services.IngestGroupPayments(e.Context()); err != nil {
+		t.Fatalf("ingest: %v", err)
+	}
+	if got := unmatchedDeposits(t, e, group.ID); got != reported {
+		t.Errorf("%d reports after ingesting again, want %d", got, reported)
+	}
+
+	// A later deposit is picked up after the cursor
+	contribution := prepare(t, e, members[1], group.ID, 1)
+	submit(t, e, members[1].User.SecretKey, members[1].User.Wallet, contribution.Memo,
+		&txnbuild.Payment{Destination: group.Wallet, Amount: "10", Asset: txnbuild.NativeAsset{}})
+	if err := services.IngestGroupPayments(e.Context()); err != nil {
+		t.Fatalf("ingest: %v", err)
+	}
+	if got := contributionStatus(t, e, contribution.ID); got.Status != "confirmed" {
+		t.Errorf("later contribution %s, want confirmed", got.Status)
+	}
+	if got := unmatchedDeposits(t, e, group.ID); got != reported {
+		t.Errorf("%d reports after the later deposit, want %d", got, reported)
+	}
+}
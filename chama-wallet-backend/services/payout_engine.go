@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"gorm.io/gorm"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/policy"
+)
+
+// ExecuteAuthorizedPayouts pays out every fully funded round whose payout has been
+// authorized, to the recipient on the group's payout schedule. Rounds whose payout
+// outcome is unknown are retried on the next run with the same transaction.
+func ExecuteAuthorizedPayouts(ctx context.Context) error {
+	var rounds []models.RoundStatus
+	if err := database.DB.Where("status = ? AND payout_authorized = ?", "ready_for_payout", true).
+		Find(&rounds).Error; err != nil {
+		return err
+	}
+
+	var failed int
+	for _, round := range rounds {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := executeRoundPayout(ctx, round); err != nil {
+			slog.ErrorContext(ctx, "round payout failed", "group_id", round.GroupID, "round", round.Round, "error", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d round payouts failed", failed, len(rounds))
+	}
+	return nil
+}
+
+// executeRoundPayout sends one round's pot to its scheduled recipient
+func executeRoundPayout(ctx context.Context, round models.RoundStatus) error {
+	var group models.Group
+	if err := database.DB.First(&group, "id = ?", round.GroupID).Error; err != nil {
+		return err
+	}
+	if group.Status != "active" {
+		return nil
+	}
+
+	var schedule models.PayoutSchedule
+	if err := database.DB.Where("group_id = ? AND round = ?", group.ID, round.Round).
+		First(&schedule).Error; err != nil {
+		return fmt.Errorf("no payout schedule for round %d: %w", round.Round, err)
+	}
+	if schedule.Status == "paid" {
+		return database.DB.Model(&models.RoundStatus{}).Where("id = ?", round.ID).Update("status", "completed").Error
+	}
+
+	var payoutRequest models.PayoutRequest
+	err := database.DB.Where("group_id = ? AND round = ? AND status IN ?",
+		group.ID, round.Round, []string{"pending", "approved"}).First(&payoutRequest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if group.Multisig {
+			// Signatures are collected when admins authorize the round
+			return fmt.Errorf("round %d is authorized but has no signed payout request", round.Round)
+		}
+		payoutRequest, err = EnsureRoundPayoutRequest(ctx, group, schedule)
+	}
+	if err != nil {
+		return err
+	}
+
+	if payoutRequest.Status == "pending" {
+		tally, err := SettlePayoutVote(ctx, group, payoutRequest)
+		if err != nil {
+			return err
+		}
+		if tally.Outcome != "approved" {
+			return fmt.Errorf("payout for round %d is %s with %d of %d approvals and %d of %d signatures",
+				round.Round, tally.Outcome, tally.Approvals, tally.Required, tally.Signatures, tally.SignaturesRequired)
+		}
+	}
+
+	database.DB.Model(&models.PayoutSchedule{}).Where("id = ? AND status <> ?", schedule.ID, "paid").Update("status", "pending")
+
+	resp, state, err := ExecutePayout(ctx, payoutRequest.ID)
+	switch state {
+	case SubmissionConfirmed:
+		slog.InfoContext(ctx, "round paid out", "group_id", group.ID, "round", round.Round, "tx_hash", resp.Hash)
+		auditRoundPayout(ctx, payoutRequest, map[string]interface{}{"status": "completed", "tx_hash": resp.Hash})
+		return err
+	case SubmissionRejected:
+		auditRoundPayout(ctx, payoutRequest, map[string]interface{}{"status": "failed", "error": fmt.Sprint(err)})
+		notifyAdmins(group, "round_payout_failed", "Round Payout Failed",
+			fmt.Sprintf("The round %d payout of %.2f XLM could not be sent and needs to be authorized again: %v", round.Round, payoutRequest.Amount, err))
+		return err
+	default:
+		if errors.Is(err, ErrPayoutInProgress) {
+			return nil
+		}
+		if errors.Is(err, ErrRecipientUnverified) || errors.Is(err, ErrRecipientOwesFines) || errors.Is(err, ErrPayoutNeedsSignatures) {
+			return fmt.Errorf("round %d: %w", round.Round, err)
+		}
+		slog.WarnContext(ctx, "round payout pending confirmation", "group_id", group.ID, "round", round.Round, "error", err)
+		return nil
+	}
+}
+
+// auditRoundPayout records the payout engine settling a round's payout
+func auditRoundPayout(ctx context.Context, payoutRequest models.PayoutRequest, after map[string]interface{}) {
+	after["round"] = payoutRequest.Round
+	after["amount"] = payoutRequest.Amount
+	after["recipient_id"] = payoutRequest.RecipientID
+	_, err := RecordAudit(AuditEntry{
+		GroupID:  payoutRequest.GroupID,
+		ActorID:  SystemActor,
+		Action:   AuditRoundPayout,
+		TargetID: payoutRequest.ID,
+		Before:   map[string]interface{}{"status": payoutRequest.Status},
+		After:    after,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to record audit event", "action", AuditRoundPayout, "payout_id", payoutRequest.ID, "error", err)
+	}
+}
+
+// notifyAdmins sends a notification to every admin and the creator of the group
+func notifyAdmins(group models.Group, notificationType, title, message string) {
+	var admins []models.Member
+	database.DB.Where("group_id = ? AND status = ? AND role IN ?", group.ID, "approved", policy.AdminRoles).Find(&admins)
+	for _, admin := range admins {
+		CreateNotification(admin.UserID, group.ID, notificationType, title, message)
+	}
+}
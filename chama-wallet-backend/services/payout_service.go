@@ -0,0 +1,461 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stellar/go/protocols/horizon"
+	"gorm.io/gorm"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/keystore"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
+)
+
+// ErrPayoutInProgress means another request is already paying out the payout request
+var ErrPayoutInProgress = errors.New("payout is already being processed")
+
+// ErrRecipientUnverified is returned when a payout's recipient has not confirmed their
+// email address. The request stays pending until they do.
+var ErrRecipientUnverified = errors.New("payout recipient has not verified their email address")
+
+// ErrPayoutNeedsSignatures means the payout envelope was rebuilt on a newer sequence
+// number of the group wallet and too few treasury signers could sign it again with
+// their custodial keys. The request stays pending until the others sign it.
+var ErrPayoutNeedsSignatures = errors.New("payout envelope was rebuilt and needs more signatures")
+
+// payoutAttempts is how many times ExecutePayout rebuilds a payout whose sequence number
+// another transaction from the group wallet took first
+const payoutAttempts = 3
+
+// EnsureRoundPayoutRequest returns the open payout request for a scheduled round,
+// creating one for the scheduled recipient if there is none
+func EnsureRoundPayoutRequest(ctx context.Context, group models.Group, schedule models.PayoutSchedule) (models.PayoutRequest, error) {
+	var payoutRequest models.PayoutRequest
+	err := database.DB.Where("group_id = ? AND round = ? AND status IN ?",
+		group.ID, schedule.Round, []string{"pending", "approved"}).First(&payoutRequest).Error
+	if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) {
+		return payoutRequest, err
+	}
+
+	var recipient models.Member
+	if err := database.DB.Preload("User").First(&recipient, "id = ?", schedule.MemberID).Error; err != nil {
+		return payoutRequest, fmt.Errorf("failed to load scheduled recipient: %w", err)
+	}
+
+	payoutRequest = models.PayoutRequest{
+		ID:          uuid.NewString(),
+		GroupID:     group.ID,
+		RecipientID: recipient.UserID,
+		Amount:      schedule.Amount,
+		Round:       schedule.Round,
+		Status:      "pending",
+		CreatedAt:   time.Now(),
+	}
+	payoutRequest.ExpiresAt = PayoutExpiry(group, payoutRequest.CreatedAt)
+
+	// Multisig treasuries need a fixed envelope that each signer approves. Other groups
+	// build the payout when it is sent.
+	if group.Multisig {
+		payments, err := roundPayments(group, schedule, recipient.User.Wallet)
+		if err != nil {
+			return payoutRequest, err
+		}
+		envelope, err := BuildGroupBatchPayoutTx(ctx, group, payments)
+		if err != nil {
+			return payoutRequest, err
+		}
+		payoutRequest.EnvelopeXDR = envelope
+	}
+
+	return payoutRequest, database.DB.Create(&payoutRequest).Error
+}
+
+// PreparePayoutTx builds the signed payout transaction and returns its envelope and hash
+func PreparePayoutTx(ctx context.Context, payoutRequest models.PayoutRequest) (string, string, error) {
+	slog.InfoContext(ctx, "preparing payout",
+		"payout_id", payoutRequest.ID, "amount", payoutRequest.Amount, "recipient_id", payoutRequest.RecipientID)
+
+	// Get group details
+	var group models.Group
+	if err := database.DB.First(&group, "id = ?", payoutRequest.GroupID).Error; err != nil {
+		return "", "", fmt.Errorf("failed to get group: %w", err)
+	}
+
+	// Multisig treasuries submit the approved envelope with the collected signatures,
+	// signed again if it had to be rebuilt
+	if group.Multisig {
+		if err := refreshPayoutEnvelope(ctx, group, &payoutRequest); err != nil {
+			return "", "", err
+		}
+
+		var approvals []models.PayoutApproval
+		database.DB.Where("payout_request_id = ? AND approved = ? AND signature <> ''",
+			payoutRequest.ID, true).Find(&approvals)
+
+		if len(approvals) < group.PayoutThreshold {
+			return "", "", ErrPayoutNeedsSignatures
+		}
+
+		var signatures []string
+		for _, approval := range approvals {
+			signatures = append(signatures, approval.Signature)
+		}
+
+		tx, err := AssembleGroupPayout(payoutRequest.EnvelopeXDR, signatures)
+		if err != nil {
+			return "", "", err
+		}
+		return EnvelopeHash(tx)
+	}
+
+	// Validate group has secret key for transactions
+	if group.SecretKey == "" {
+		return "", "", fmt.Errorf("group secret key not available")
+	}
+
+	signer, err := keystore.Default.Signer(group.SecretKey)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to load group signer: %w", err)
+	}
+
+	// Build the payout now, from the group wallet's current sequence number. A request
+	// raised with an envelope is rebuilt if that envelope can no longer apply.
+	envelope := payoutRequest.EnvelopeXDR
+	if envelope == "" {
+		payments, err := payoutPayments(payoutRequest)
+		if err != nil {
+			return "", "", err
+		}
+		if envelope, err = BuildGroupBatchPayoutTx(ctx, group, payments); err != nil {
+			return "", "", fmt.Errorf("failed to build payout transaction: %w", err)
+		}
+	} else if envelope, _, err = RefreshPayoutEnvelope(ctx, group, envelope); err != nil {
+		return "", "", err
+	}
+
+	signature, err := SignPayoutEnvelope(envelope, signer)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to sign payout: %w", err)
+	}
+	tx, err := AssembleGroupPayout(envelope, []string{signature})
+	if err != nil {
+		return "", "", err
+	}
+	return EnvelopeHash(tx)
+}
+
+// payoutPayments returns the payments a payout request makes out of the group wallet:
+// a share-out batch pays its members, a scheduled round its recipient and any auction
+// discount split among the members, anything else its recipient
+func payoutPayments(payoutRequest models.PayoutRequest) ([]GroupPayment, error) {
+	if payoutRequest.SettlementID != "" {
+		return settlementPayments(payoutRequest.ID)
+	}
+	recipient, err := repository.Default.Users.ByID(payoutRequest.RecipientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recipient: %w", err)
+	}
+
+	if payoutRequest.LoanID == "" && payoutRequest.Round > 0 {
+		var schedule models.PayoutSchedule
+		err := database.DB.Preload("Member").Where("group_id = ? AND round = ?", payoutRequest.GroupID, payoutRequest.Round).
+			First(&schedule).Error
+		if err == nil && schedule.Member.UserID == recipient.ID && schedule.Amount == payoutRequest.Amount {
+			var group models.Group
+			if err := database.DB.First(&group, "id = ?", payoutRequest.GroupID).Error; err != nil {
+				return nil, err
+			}
+			return roundPayments(group, schedule, recipient.Wallet)
+		}
+	}
+	return []GroupPayment{{Destination: recipient.Wallet, Amount: fmt.Sprintf("%.7f", payoutRequest.Amount)}}, nil
+}
+
+// refreshPayoutEnvelope builds a pending multisig payout's envelope if it has none yet,
+// or rebuilds it once its sequence number has been taken or its time bounds have passed.
+// Approving signers with a custodial key sign the new envelope; the others are asked to
+// approve it again to sign it.
+func refreshPayoutEnvelope(ctx context.Context, group models.Group, payoutRequest *models.PayoutRequest) error {
+	var envelope string
+	if payoutRequest.EnvelopeXDR == "" {
+		payments, err := payoutPayments(*payoutRequest)
+		if err != nil {
+			return err
+		}
+		if envelope, err = BuildGroupBatchPayoutTx(ctx, group, payments); err != nil {
+			return err
+		}
+	} else {
+		rebuilt := false
+		var err error
+		envelope, rebuilt, err = RefreshPayoutEnvelope(ctx, group, payoutRequest.EnvelopeXDR)
+		if err != nil || !rebuilt {
+			return err
+		}
+	}
+
+	var unsigned []models.PayoutApproval
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Only one caller replaces the envelope it read
+		result := tx.Model(&models.PayoutRequest{}).
+			Where("id = ? AND status = ? AND envelope_xdr = ?", payoutRequest.ID, "pending", payoutRequest.EnvelopeXDR).
+			Update("envelope_xdr", envelope)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrPayoutInProgress
+		}
+
+		var approvals []models.PayoutApproval
+		if err := tx.Preload("Admin").Where("payout_request_id = ? AND approved = ?", payoutRequest.ID, true).
+			Find(&approvals).Error; err != nil {
+			return err
+		}
+		for _, approval := range approvals {
+			if !IsTreasurySigner(group, approval.Admin.Wallet) {
+				continue
+			}
+			signature := ""
+			if signer, err := keystore.Default.Signer(approval.Admin.SecretKey); err == nil {
+				signature, _ = SignPayoutEnvelope(envelope, signer)
+			}
+			if signature == "" {
+				unsigned = append(unsigned, approval)
+			}
+			if err := tx.Model(&models.PayoutApproval{}).Where("id = ?", approval.ID).
+				Update("signature", signature).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "payout envelope built", "payout_id", payoutRequest.ID, "unsigned", len(unsigned))
+	payoutRequest.EnvelopeXDR = envelope
+	for _, approval := range unsigned {
+		CreateNotification(
+			approval.AdminID,
+			group.ID,
+			"payout_signature_needed",
+			"Payout Needs Your Signature",
+			fmt.Sprintf("The payout of %.2f XLM has a new transaction from the group wallet, approve it again to sign it", payoutRequest.Amount),
+		)
+	}
+	return nil
+}
+
+// ExecutePayout sends an approved payout exactly once. A pending request has its
+// transaction built and recorded before submission; a request already paying out has
+// its recorded transaction looked up or resent. It returns what is known about the
+// transaction; the request is completed or failed accordingly. A transaction refused
+// because another one from the group wallet took its sequence number is rebuilt.
+func ExecutePayout(ctx context.Context, payoutID string) (horizon.Transaction, SubmissionState, error) {
+	var resp horizon.Transaction
+	var state SubmissionState
+	var err error
+	for attempt := 1; attempt <= payoutAttempts; attempt++ {
+		resp, state, err = executePayout(ctx, payoutID)
+		if !errors.Is(err, errStaleSequence) {
+			break
+		}
+		slog.WarnContext(ctx, "payout sequence number taken, rebuilding", "payout_id", payoutID, "attempt", attempt)
+	}
+	return resp, state, err
+}
+
+// errStaleSequence means a payout went back to pending to be rebuilt on the group
+// wallet's next sequence number
+var errStaleSequence = errors.New("payout transaction lost its sequence number to another transaction")
+
+// executePayout is one attempt of ExecutePayout
+func executePayout(ctx context.Context, payoutID string) (horizon.Transaction, SubmissionState, error) {
+	var payoutRequest models.PayoutRequest
+	if err := database.DB.First(&payoutRequest, "id = ?", payoutID).Error; err != nil {
+		return horizon.Transaction{}, SubmissionUnknown, err
+	}
+
+	switch payoutRequest.Status {
+	case "completed":
+		return horizon.Transaction{Hash: payoutRequest.TxHash, Successful: true}, SubmissionConfirmed, nil
+
+	case "pending":
+		// A share-out batch has no single recipient; its members are paid what they saved
+		if payoutRequest.SettlementID == "" {
+			recipient, err := repository.Default.Users.ByID(payoutRequest.RecipientID)
+			if err != nil {
+				return horizon.Transaction{}, SubmissionUnknown, err
+			}
+			if RequireVerifiedEmail(recipient) != nil {
+				return horizon.Transaction{}, SubmissionUnknown, ErrRecipientUnverified
+			}
+			owed, err := OutstandingFines(payoutRequest.GroupID, recipient.ID)
+			if err != nil {
+				return horizon.Transaction{}, SubmissionUnknown, err
+			}
+			if owed > 0 {
+				return horizon.Transaction{}, SubmissionUnknown, ErrRecipientOwesFines
+			}
+		}
+
+		envelope, txHash, err := PreparePayoutTx(ctx, payoutRequest)
+		if errors.Is(err, ErrPayoutNeedsSignatures) || errors.Is(err, ErrPayoutInProgress) {
+			return horizon.Transaction{}, SubmissionUnknown, err
+		}
+		if err != nil {
+			failPayout(payoutRequest, "pending")
+			return horizon.Transaction{}, SubmissionRejected, err
+		}
+
+		// Record the payout transaction before submitting it. Only one caller can
+		// move the request out of pending, so the payout is sent once.
+		result := database.DB.Model(&models.PayoutRequest{}).
+			Where("id = ? AND status = ?", payoutID, "pending").
+			Updates(map[string]interface{}{
+				"status":        "approved",
+				"tx_hash":       txHash,
+				"submitted_xdr": envelope,
+			})
+		if result.Error != nil {
+			return horizon.Transaction{}, SubmissionUnknown, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return horizon.Transaction{}, SubmissionUnknown, ErrPayoutInProgress
+		}
+		payoutRequest.Status = "approved"
+		payoutRequest.TxHash = txHash
+		payoutRequest.SubmittedXDR = envelope
+
+	case "approved":
+		if payoutRequest.SubmittedXDR == "" {
+			return horizon.Transaction{}, SubmissionUnknown, fmt.Errorf("payout request %s has no recorded transaction", payoutID)
+		}
+
+	default:
+		return horizon.Transaction{}, SubmissionRejected, fmt.Errorf("payout request is %s", payoutRequest.Status)
+	}
+
+	resp, state, err := SubmitOnce(ctx, payoutRequest.SubmittedXDR, payoutRequest.TxHash)
+	switch state {
+	case SubmissionConfirmed:
+		slog.InfoContext(ctx, "payout executed", "payout_id", payoutRequest.ID, "tx_hash", resp.Hash)
+		if err := CompletePayout(ctx, payoutRequest.ID, resp.Hash); err != nil {
+			return resp, state, err
+		}
+	case SubmissionRejected:
+		if staleSequence(err) && reopenPayout(payoutRequest) {
+			return resp, SubmissionUnknown, fmt.Errorf("%w: %v", errStaleSequence, err)
+		}
+		failPayout(payoutRequest, "approved")
+	}
+	return resp, state, err
+}
+
+// reopenPayout moves a payout whose transaction never applied back to pending, so the
+// next attempt builds it again
+func reopenPayout(payoutRequest models.PayoutRequest) bool {
+	result := database.DB.Model(&models.PayoutRequest{}).
+		Where("id = ? AND status = ? AND tx_hash = ?", payoutRequest.ID, "approved", payoutRequest.TxHash).
+		Updates(map[string]interface{}{"status": "pending", "tx_hash": "", "submitted_xdr": ""})
+	return result.Error == nil && result.RowsAffected > 0
+}
+
+// failPayout marks a payout request failed and reopens its round for a new authorization
+func failPayout(payoutRequest models.PayoutRequest, fromStatus string) {
+	result := database.DB.Model(&models.PayoutRequest{}).
+		Where("id = ? AND status = ?", payoutRequest.ID, fromStatus).
+		Update("status", "failed")
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+
+	// A loan disbursement has no round; the borrower applies again
+	if payoutRequest.LoanID != "" {
+		closeLoanDisbursement(database.DB, payoutRequest.ID, "failed")
+		return
+	}
+	if payoutRequest.SettlementID != "" {
+		closeSettlementBatch(database.DB, payoutRequest.SettlementID, "failed")
+		return
+	}
+
+	database.DB.Model(&models.PayoutSchedule{}).
+		Where("group_id = ? AND round = ? AND status <> ?", payoutRequest.GroupID, payoutRequest.Round, "paid").
+		Updates(map[string]interface{}{"status": "failed", "updated_at": time.Now()})
+	database.DB.Model(&models.RoundStatus{}).
+		Where("group_id = ? AND round = ? AND status = ?", payoutRequest.GroupID, payoutRequest.Round, "ready_for_payout").
+		Update("payout_authorized", false)
+}
+
+// CompletePayout marks an approved payout as paid by txHash, settles the round's
+// schedule, moves the group to its next round and notifies the members. A loan
+// disbursement activates the loan and a share-out batch pays its members instead.
+// Completing an already completed payout is a no-op.
+func CompletePayout(ctx context.Context, payoutID, txHash string) error {
+	result := database.DB.Model(&models.PayoutRequest{}).
+		Where("id = ? AND status = ?", payoutID, "approved").
+		Updates(map[string]interface{}{"status": "completed", "tx_hash": txHash})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	var payoutRequest models.PayoutRequest
+	if err := database.DB.First(&payoutRequest, "id = ?", payoutID).Error; err != nil {
+		return err
+	}
+	if payoutRequest.LoanID != "" {
+		return DisburseLoan(ctx, payoutRequest, txHash)
+	}
+	if payoutRequest.SettlementID != "" {
+		return CompleteSettlementBatch(ctx, payoutRequest, txHash)
+	}
+
+	now := time.Now()
+	database.DB.Model(&models.PayoutSchedule{}).
+		Where("group_id = ? AND round = ?", payoutRequest.GroupID, payoutRequest.Round).
+		Updates(map[string]interface{}{"status": "paid", "tx_hash": txHash, "paid_at": now, "updated_at": now})
+	database.DB.Model(&models.RoundStatus{}).
+		Where("group_id = ? AND round = ?", payoutRequest.GroupID, payoutRequest.Round).
+		Update("status", "completed")
+
+	// Fetch group details again to get the latest CurrentRound and ContributionPeriod
+	var currentGroup models.Group
+	if err := database.DB.First(&currentGroup, "id = ?", payoutRequest.GroupID).Error; err != nil {
+		slog.ErrorContext(ctx, "failed to fetch group for round update", "group_id", payoutRequest.GroupID, "error", err)
+	} else {
+		// Move to the next round, once, if this payout closed the current one
+		database.DB.Model(&models.Group{}).
+			Where("id = ? AND current_round = ?", payoutRequest.GroupID, payoutRequest.Round).
+			Updates(map[string]interface{}{
+				"current_round":          payoutRequest.Round + 1,
+				"next_contribution_date": now.AddDate(0, 0, currentGroup.ContributionPeriod),
+			})
+	}
+
+	// Notify all members about successful payout
+	var members []models.Member
+	database.DB.Where("group_id = ? AND status = ?", payoutRequest.GroupID, "approved").Find(&members)
+
+	for _, member := range members {
+		CreateNotification(
+			member.UserID,
+			payoutRequest.GroupID,
+			"payout_approved",
+			"Payout Approved",
+			fmt.Sprintf("Payout of %.2f XLM has been approved and processed", payoutRequest.Amount),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/txnbuild"
+
+	"chama-wallet-backend/ledger"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/services"
+	"chama-wallet-backend/testenv"
+)
+
+// paidRound activates a fixed-order group paying members[0] first, has everyone pay
+// round 1 and has the creator authorize its payout
+func paidRound(t *testing.T, e *testenv.Env) (models.Group, models.AuthResponse, []models.AuthResponse, models.PayoutRequest) {
+	t.Helper()
+	creator, err := e.Register("Creator", "creator@example.com")
+	if err != nil {
+		t.Fatalf("register creator: %v", err)
+	}
+	members, err := e.Members(2)
+	if err != nil {
+		t.Fatalf("register members: %v", err)
+	}
+	group, err := e.ActiveGroup(creator, members, models.GroupSettings{
+		ContributionAmount: 10,
+		ContributionPeriod: 7,
+		PayoutOrder:        []string{members[0].User.ID, creator.User.ID, members[1].User.ID},
+	})
+	if err != nil {
+		t.Fatalf("activate group: %v", err)
+	}
+
+	for _, member := range append([]models.AuthResponse{creator}, members...) {
+		if err := e.Contribute(member, group.ID, 1, 10); err != nil {
+			t.Fatalf("contribute: %v", err)
+		}
+	}
+	if got := e.Ledger.Balance(group.Wallet); got == "0" {
+		t.Fatalf("group wallet %s does not exist", group.Wallet)
+	}
+
+	auth, err := services.AuthorizeRoundPayout(e.Context(), group.ID, creator.User, 1, "")
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	if auth.Tally.Outcome != "approved" {
+		t.Fatalf("tally %q, want approved by the only treasury signer", auth.Tally.Outcome)
+	}
+	return group, creator, members, auth.PayoutRequest
+}
+
+func payoutStatus(t *testing.T, e *testenv.Env, id string) models.PayoutRequest {
+	t.Helper()
+	var payout models.PayoutRequest
+	if err := e.DB.First(&payout, "id = ?", id).Error; err != nil {
+		t.Fatalf("payout: %v", err)
+	}
+	return payout
+}
+
+func TestRoundPayoutPaysRecipient(t *testing.T) {
+	e := newEnv(t)
+	group, _, members, payout := paidRound(t, e)
+
+	if got := e.Ledger.Balance(members[0].User.Wallet); got != "9989.9999900" {
+		t.Fatalf("recipient balance before payout %s, want 10,000 less the contribution and its fee", got)
+	}
+
+	resp, state, err := services.ExecutePayout(e.Context(), payout.ID)
+	if err != nil || state != services.SubmissionConfirmed {
+		t.Fatalf("execute: state %v, err %v", state, err)
+	}
+	if got := e.Ledger.Balance(members[0].User.Wallet); got != "10019.9999900" {
+		t.Errorf("recipient balance %s, want the 30 XLM pot added", got)
+	}
+
+	completed := payoutStatus(t, e, payout.ID)
+	if completed.Status != "completed" || completed.TxHash != resp.Hash {
+		t.Errorf("payout %s with hash %s, want completed with %s", completed.Status, completed.TxHash, resp.Hash)
+	}
+	var schedule models.PayoutSchedule
+	e.DB.First(&schedule, "group_id = ? AND round = ?", group.ID, 1)
+	if schedule.Status != "paid" {
+		t.Errorf("schedule %s, want paid", schedule.Status)
+	}
+
+	// Executing again reports the payout without sending it twice
+	again, state, err := services.ExecutePayout(e.Context(), payout.ID)
+	if err != nil || state != services.SubmissionConfirmed || again.Hash != resp.Hash {
+		t.Errorf("second execute: hash %s state %v err %v", again.Hash, state, err)
+	}
+	if got := e.Ledger.Balance(members[0].User.Wallet); got != "10019.9999900" {
+		t.Errorf("recipient balance %s after a second execute", got)
+	}
+}
+
+func TestPayoutBeyondTreasuryBalanceFails(t *testing.T) {
+	e := newEnv(t)
+	group, _, members, payout := paidRound(t, e)
+
+	// The pot is more than the treasury holds
+	e.DB.Model(&models.PayoutRequest{}).Where("id = ?", payout.ID).
+		Updates(map[string]interface{}{"amount": 20000, "envelope_xdr": ""})
+	e.DB.Model(&models.PayoutSchedule{}).Where("group_id = ? AND round = ?", group.ID, 1).Update("amount", 20000)
+
+	_, state, err := services.ExecutePayout(e.Context(), payout.ID)
+	if state != services.SubmissionRejected || err == nil {
+		t.Fatalf("execute: state %v, err %v; want rejected", state, err)
+	}
+	if codes := ledger.ResultCodes(errors.Unwrap(err)); codes == nil || len(codes.OperationCodes) == 0 || codes.OperationCodes[0] != "op_underfunded" {
+		t.Errorf("result codes %+v, want op_underfunded", codes)
+	}
+	if got := payoutStatus(t, e, payout.ID).Status; got != "failed" {
+		t.Errorf("payout %s, want failed", got)
+	}
+	if got := e.Ledger.Balance(members[0].User.Wallet); got != "9989.9999900" {
+		t.Errorf("recipient balance %s, want unchanged", got)
+	}
+}
+
+func TestPayoutRebuiltAfterSequenceTaken(t *testing.T) {
+	e := newEnv(t)
+	group, creator, members, payout := paidRound(t, e)
+	original := payoutStatus(t, e, payout.ID).EnvelopeXDR
+
+	// Another transaction from the treasury uses the sequence number the payout was built on
+	account, err := e.Ledger.AccountDetail(horizonclient.AccountRequest{AccountID: group.Wallet})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        &account,
+		IncrementSequenceNum: true,
+		BaseFee:              txnbuild.MinBaseFee,
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewInfiniteTimeout()},
+		Operations:           []txnbuild.Operation{&txnbuild.Payment{Destination: members[1].User.Wallet, Amount: "1", Asset: txnbuild.NativeAsset{}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope, _ := tx.Base64()
+	signed, err := e.Sign(creator.User, envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Ledger.SubmitTransactionXDR(signed); err != nil {
+		t.Fatalf("submit competing transaction: %v", err)
+	}
+
+	_, state, err := services.ExecutePayout(e.Context(), payout.ID)
+	if err != nil || state != services.SubmissionConfirmed {
+		t.Fatalf("execute: state %v, err %v", state, err)
+	}
+	completed := payoutStatus(t, e, payout.ID)
+	if completed.Status != "completed" || completed.EnvelopeXDR == original {
+		t.Errorf("payout %s, rebuilt %v; want completed on a new envelope", completed.Status, completed.EnvelopeXDR != original)
+	}
+	if got := e.Ledger.Balance(members[0].User.Wallet); got != "10019.9999900" {
+		t.Errorf("recipient balance %s, want the pot added once", got)
+	}
+}
+
+func TestPayoutSubmitFailureIsRetried(t *testing.T) {
+	e := newEnv(t)
+	_, _, members, payout := paidRound(t, e)
+
+	// The submission times out without reaching the network
+	e.Ledger.FailNext(ledger.MethodSubmit, errors.New("connection reset by peer"))
+	_, state, err := services.ExecutePayout(e.Context(), payout.ID)
+	if state != services.SubmissionUnknown || err == nil {
+		t.Fatalf("execute: state %v, err %v; want unknown", state, err)
+	}
+	pending := payoutStatus(t, e, payout.ID)
+	if pending.Status != "approved" || pending.SubmittedXDR == "" {
+		t.Fatalf("payout %s with envelope %q, want approved with the recorded envelope", pending.Status, pending.SubmittedXDR)
+	}
+
+	// The retry resends the recorded envelope
+	resp, state, err := services.ExecutePayout(e.Context(), payout.ID)
+	if err != nil || state != services.SubmissionConfirmed || resp.Hash != pending.TxHash {
+		t.Fatalf("retry: hash %s state %v err %v; want %s confirmed", resp.Hash, state, err, pending.TxHash)
+	}
+	if got := e.Ledger.Balance(members[0].User.Wallet); got != "10019.9999900" {
+		t.Errorf("recipient balance %s, want the pot added once", got)
+	}
+}
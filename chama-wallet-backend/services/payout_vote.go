@@ -0,0 +1,289 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/keystore"
+	"chama-wallet-backend/models"
+)
+
+var errAlreadyVoted = opError(ErrInvalid, "Already voted on this request")
+
+// RoundAuthorization is the state of a round's payout after an authorization
+type RoundAuthorization struct {
+	Schedule      models.PayoutSchedule
+	PayoutRequest models.PayoutRequest
+	Tally         models.PayoutTally
+}
+
+// VoteOnPayout records the user's vote on a payout request and settles the vote, in one
+// transaction under a lock on the request. A tally with outcome approved means the payout
+// is ready for ExecutePayout, including one whose earlier submission is still unconfirmed.
+func VoteOnPayout(ctx context.Context, payoutID string, user models.User, approved bool, signedXDR string) (models.PayoutRequest, models.PayoutTally, error) {
+	var payoutRequest models.PayoutRequest
+	var tally models.PayoutTally
+	expired := false
+
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := database.ForUpdate(tx).First(&payoutRequest, "id = ?", payoutID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return opError(ErrNotFound, "Payout request not found")
+			}
+			return err
+		}
+
+		var group models.Group
+		if err := tx.First(&group, "id = ?", payoutRequest.GroupID).Error; err != nil {
+			return err
+		}
+
+		// Check the user may vote under the group's approval policy
+		var voter models.Member
+		if err := tx.Where("group_id = ? AND user_id = ?", group.ID, user.ID).First(&voter).Error; err != nil ||
+			!CanVoteOnPayout(group, voter) {
+			return opError(ErrForbidden, "Insufficient permissions")
+		}
+
+		var err error
+
+		// A payout whose transaction was recorded but not confirmed is finished, never rebuilt
+		if payoutRequest.Status == "approved" && payoutRequest.SubmittedXDR != "" {
+			tally, err = tallyPayout(tx, group, payoutRequest)
+			return err
+		}
+
+		if payoutRequest.Status != "pending" {
+			return opError(ErrInvalid, "Payout request is already %s", payoutRequest.Status)
+		}
+
+		if payoutRequest.ExpiresAt != nil && time.Now().After(*payoutRequest.ExpiresAt) {
+			expired = true
+			tally, err = settlePayoutVote(tx, group, payoutRequest)
+			return err
+		}
+
+		if err := recordPayoutVote(tx, group, payoutRequest, user, approved, signedXDR); err != nil {
+			return err
+		}
+
+		tally, err = settlePayoutVote(tx, group, payoutRequest)
+		return err
+	})
+	if err != nil {
+		return payoutRequest, tally, err
+	}
+	if expired {
+		return payoutRequest, tally, opError(ErrInvalid, "Payout request has expired")
+	}
+
+	slog.InfoContext(ctx, "payout vote tallied", "payout_id", payoutID,
+		"approvals", tally.Approvals, "required", tally.Required, "rejections", tally.Rejections)
+	return payoutRequest, tally, nil
+}
+
+// AuthorizeRoundPayout records the user's authorization of a fully funded round's payout
+// to its scheduled recipient. Once the group's approval policy, and on multisig treasuries
+// the payout threshold, is met the round is marked authorized for the payout engine. The
+// vote and the authorization run in one transaction under a lock on the payout request.
+func AuthorizeRoundPayout(ctx context.Context, groupID string, user models.User, round int, signedXDR string) (RoundAuthorization, error) {
+	var result RoundAuthorization
+
+	var group models.Group
+	if err := database.DB.First(&group, "id = ?", groupID).Error; err != nil {
+		return result, opError(ErrNotFound, "Group not found")
+	}
+	if GroupType(group) == GroupASCA {
+		return result, opError(ErrInvalid, "Savings and credit groups keep their rounds' contributions")
+	}
+
+	// Check the user may vote under the group's approval policy
+	var voter models.Member
+	if err := database.DB.Where("group_id = ? AND user_id = ?", groupID, user.ID).
+		First(&voter).Error; err != nil || !CanVoteOnPayout(group, voter) {
+		return result, opError(ErrForbidden, "Only admins can authorize payouts")
+	}
+
+	// Check if all members have contributed
+	var totalMembers int64
+	database.DB.Model(&models.Member{}).Where("group_id = ? AND status = ?", groupID, "approved").Count(&totalMembers)
+
+	var contributionsCount int64
+	database.DB.Model(&models.RoundContribution{}).Where("group_id = ? AND round = ? AND status = ?",
+		groupID, round, "confirmed").Count(&contributionsCount)
+
+	if contributionsCount < totalMembers {
+		return result, opError(ErrInvalid, "Not all members have contributed. %d/%d paid", contributionsCount, totalMembers)
+	}
+
+	// Get the recipient for this round from payout schedule
+	if err := database.DB.Where("group_id = ? AND round = ?", groupID, round).
+		Preload("Member").
+		Preload("Member.User").
+		First(&result.Schedule).Error; err != nil {
+		switch PayoutMode(group) {
+		case PayoutAuction:
+			return result, opError(ErrNotFound, "Round %d has not been auctioned yet", round)
+		case PayoutDraw:
+			return result, opError(ErrNotFound, "Round %d has not been drawn yet", round)
+		}
+		return result, opError(ErrNotFound, "Payout schedule not found")
+	}
+	if result.Schedule.Status == "paid" {
+		return result, opError(ErrConflict, "Round has already been paid out")
+	}
+
+	if err := UpdateRoundStatus(groupID, round); err != nil {
+		return result, err
+	}
+
+	payoutRequest, err := EnsureRoundPayoutRequest(ctx, group, result.Schedule)
+	if err != nil {
+		return result, fmt.Errorf("failed to create round payout request: %w", err)
+	}
+
+	expired, newlyAuthorized := false, false
+	err = database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := database.ForUpdate(tx).First(&payoutRequest, "id = ?", payoutRequest.ID).Error; err != nil {
+			return err
+		}
+
+		var err error
+		switch {
+		case payoutRequest.Status == "approved":
+			// Already paying out; nothing left to authorize
+		case payoutRequest.Status != "pending":
+			return opError(ErrConflict, "Round payout is %s, authorize the round again", payoutRequest.Status)
+		case payoutRequest.ExpiresAt != nil && time.Now().After(*payoutRequest.ExpiresAt):
+			expired = true
+			result.Tally, err = settlePayoutVote(tx, group, payoutRequest)
+			return err
+		default:
+			// Record this authorization, with the signer's signature on multisig treasuries
+			err = recordPayoutVote(tx, group, payoutRequest, user, true, signedXDR)
+			if err != nil && err != errAlreadyVoted {
+				return err
+			}
+		}
+
+		result.Tally, err = settlePayoutVote(tx, group, payoutRequest)
+		if err != nil || result.Tally.Outcome != "approved" {
+			return err
+		}
+
+		// Update round status to authorized; the payout engine picks it up from here
+		update := tx.Model(&models.RoundStatus{}).
+			Where("group_id = ? AND round = ? AND payout_authorized = ?", groupID, round, false).
+			Updates(map[string]interface{}{
+				"payout_authorized": true,
+				"status":            "ready_for_payout",
+			})
+		newlyAuthorized = update.RowsAffected > 0
+		return update.Error
+	})
+	result.PayoutRequest = payoutRequest
+	if err != nil {
+		return result, err
+	}
+	if expired {
+		return result, opError(ErrInvalid, "Payout authorization has expired, authorize the round again")
+	}
+
+	if newlyAuthorized {
+		// Notify all members about authorized payout
+		var members []models.Member
+		database.DB.Where("group_id = ? AND status = ?", groupID, "approved").Find(&members)
+
+		for _, member := range members {
+			CreateNotification(
+				member.UserID,
+				groupID,
+				"round_payout_authorized",
+				"Round Payout Authorized",
+				fmt.Sprintf("Round %d payout has been authorized for %s", round, result.Schedule.Member.User.Name),
+			)
+		}
+	}
+	return result, nil
+}
+
+// recordPayoutVote stores the user's vote on a pending payout request. Each approving
+// treasury signer contributes one signature to the multisig payout envelope, and signs
+// again if the envelope is built anew; other voters only count towards the quorum.
+func recordPayoutVote(tx *gorm.DB, group models.Group, payoutRequest models.PayoutRequest, user models.User, approved bool, signedXDR string) error {
+	var existing models.PayoutApproval
+	err := tx.Where("payout_request_id = ? AND admin_id = ?", payoutRequest.ID, user.ID).First(&existing).Error
+	if err == nil {
+		// A signer whose signature was cleared when the envelope was rebuilt signs it again
+		if existing.Approved && approved && existing.Signature == "" && payoutRequest.EnvelopeXDR != "" &&
+			group.Multisig && IsTreasurySigner(group, user.Wallet) {
+			signature, err := PayoutSignature(payoutRequest, user, signedXDR)
+			if err != nil {
+				return opError(ErrInvalid, "Could not sign payout: %v", err)
+			}
+			slog.InfoContext(tx.Statement.Context, "payout signed again", "payout_id", payoutRequest.ID, "user_id", user.ID)
+			return tx.Model(&models.PayoutApproval{}).Where("id = ?", existing.ID).Update("signature", signature).Error
+		}
+		return errAlreadyVoted
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	approval := models.PayoutApproval{
+		ID:              uuid.NewString(),
+		PayoutRequestID: payoutRequest.ID,
+		AdminID:         user.ID,
+		Approved:        approved,
+		CreatedAt:       time.Now(),
+	}
+
+	// A share-out batch waiting for the one before it has no envelope yet; its approving
+	// signers sign when it is built
+	if group.Multisig && approved && IsTreasurySigner(group, user.Wallet) && payoutRequest.EnvelopeXDR != "" {
+		signature, err := PayoutSignature(payoutRequest, user, signedXDR)
+		if err != nil {
+			slog.ErrorContext(tx.Statement.Context, "failed to sign payout",
+				"payout_id", payoutRequest.ID, "user_id", user.ID, "error", err)
+			return opError(ErrInvalid, "Could not sign payout: %v", err)
+		}
+		approval.Signature = signature
+	}
+
+	if err := tx.Create(&approval).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return errAlreadyVoted
+		}
+		return err
+	}
+
+	slog.InfoContext(tx.Statement.Context, "payout vote recorded",
+		"payout_id", payoutRequest.ID, "user_id", user.ID, "approved", approved)
+
+	return nil
+}
+
+// PayoutSignature returns the signer's signature on the payout envelope, taken from a
+// client-signed copy when provided, otherwise produced with the signer's custodial key
+func PayoutSignature(payoutRequest models.PayoutRequest, user models.User, signedXDR string) (string, error) {
+	if payoutRequest.EnvelopeXDR == "" {
+		return "", fmt.Errorf("payout envelope is missing")
+	}
+
+	if signedXDR != "" {
+		return ExtractPayoutSignature(payoutRequest.EnvelopeXDR, signedXDR, user.Wallet)
+	}
+
+	signer, err := keystore.Default.Signer(user.SecretKey)
+	if err != nil {
+		return "", fmt.Errorf("no custodial key available, submit signed_xdr instead: %w", err)
+	}
+	return SignPayoutEnvelope(payoutRequest.EnvelopeXDR, signer)
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+)
+
+// Late fine kinds
+const (
+	FineNone    = "none"    // late contributions are not fined
+	FineFlat    = "flat"    // a fixed amount of XLM per day late
+	FinePercent = "percent" // a percentage of the contribution per day late
+)
+
+// ErrRecipientOwesFines is returned when a payout's recipient has late fines outstanding.
+// The request stays pending until they are paid or waived.
+var ErrRecipientOwesFines = errors.New("payout recipient has outstanding late fines")
+
+// outstandingFine are the penalty statuses that still block the member's payouts
+var outstandingFine = []string{"owed", "pending"}
+
+// GroupLatePolicy returns the late fine policy stored on the group
+func GroupLatePolicy(group models.Group) models.LatePolicy {
+	policy := models.LatePolicy{
+		GraceHours: group.GracePeriodHours,
+		Kind:       group.LateFineKind,
+		Amount:     group.LateFineAmount,
+	}
+	if policy.Kind == "" {
+		policy.Kind = FineNone
+	}
+	return policy
+}
+
+// ValidateLatePolicy checks a late fine policy is one the group can apply
+func ValidateLatePolicy(policy models.LatePolicy) error {
+	switch policy.Kind {
+	case FineNone:
+	case FineFlat:
+		if policy.Amount <= 0 {
+			return fmt.Errorf("flat fine must be a positive amount of XLM")
+		}
+	case FinePercent:
+		if policy.Amount <= 0 || policy.Amount > 100 {
+			return fmt.Errorf("percentage fine must be between 0 and 100")
+		}
+	default:
+		return fmt.Errorf("unknown late fine kind %q", policy.Kind)
+	}
+	if policy.GraceHours < 0 {
+		return fmt.Errorf("grace hours cannot be negative")
+	}
+	return nil
+}
+
+// LatePolicyUpdates returns the group columns that store a late fine policy
+func LatePolicyUpdates(policy models.LatePolicy) map[string]interface{} {
+	amount := policy.Amount
+	if policy.Kind == FineNone {
+		amount = 0
+	}
+	return map[string]interface{}{
+		"grace_period_hours": policy.GraceHours,
+		"late_fine_kind":     policy.Kind,
+		"late_fine_amount":   amount,
+	}
+}
+
+// RoundDeadline returns when contributions for the round are due: the deadline on the
+// round's status once it has one, otherwise the group's next contribution date moved by
+// a contribution period for each round after the current one
+func RoundDeadline(group models.Group, round int) time.Time {
+	var roundStatus models.RoundStatus
+	err := database.DB.Where("group_id = ? AND round = ?", group.ID, round).First(&roundStatus).Error
+	if err == nil && !roundStatus.Deadline.IsZero() {
+		return roundStatus.Deadline
+	}
+	return scheduledDeadline(group, round)
+}
+
+func scheduledDeadline(group models.Group, round int) time.Time {
+	if group.NextContributionDate.IsZero() {
+		return time.Time{}
+	}
+	return group.NextContributionDate.AddDate(0, 0, (round-group.CurrentRound)*group.ContributionPeriod)
+}
+
+// GraceEnd returns when a round's contributions start being fined
+func GraceEnd(group models.Group, deadline time.Time) time.Time {
+	return deadline.Add(time.Duration(group.GracePeriodHours) * time.Hour)
+}
+
+// LateFine returns the days a contribution made at paidAt is late and the fine it owes
+// under the group's policy. Days are counted from the end of the grace period, and any
+// part of a day counts as a whole one.
+func LateFine(group models.Group, deadline, paidAt time.Time) (int, float64) {
+	if deadline.IsZero() {
+		return 0, 0
+	}
+	graceEnd := GraceEnd(group, deadline)
+	if !paidAt.After(graceEnd) {
+		return 0, 0
+	}
+	days := int(math.Ceil(paidAt.Sub(graceEnd).Hours() / 24))
+
+	var perDay float64
+	switch policy := GroupLatePolicy(group); policy.Kind {
+	case FineFlat:
+		perDay = policy.Amount
+	case FinePercent:
+		perDay = group.ContributionAmount * policy.Amount / 100
+	}
+	// Whole stroops, the smallest amount the ledger can move
+	return days, math.Round(perDay*float64(days)*1e7) / 1e7
+}
+
+// PenaltyMemo is the memo a fine's payment carries so it can be matched on the ledger
+func PenaltyMemo(penaltyID string) string {
+	return "fine " + strings.ReplaceAll(penaltyID, "-", "")[:20]
+}
+
+// assessLateFine records the fine a just confirmed round contribution owes if it arrived
+// after the round's grace period, and tells the member. A contribution is fined once.
+func assessLateFine(ctx context.Context, contribution models.RoundContribution, paidAt time.Time) {
+	if paidAt.IsZero() {
+		paidAt = time.Now()
+	}
+
+	var group models.Group
+	if err := database.DB.First(&group, "id = ?", contribution.GroupID).Error; err != nil {
+		slog.ErrorContext(ctx, "failed to load group for late fine", "group_id", contribution.GroupID, "error", err)
+		return
+	}
+
+	days, amount := LateFine(group, RoundDeadline(group, contribution.Round), paidAt)
+	if amount <= 0 {
+		if days > 0 {
+			slog.InfoContext(ctx, "late contribution", "contribution_id", contribution.ID, "days_late", days)
+		}
+		return
+	}
+
+	penalty := models.Penalty{
+		ID:             uuid.NewString(),
+		GroupID:        contribution.GroupID,
+		MemberID:       contribution.MemberID,
+		Round:          contribution.Round,
+		ContributionID: contribution.ID,
+		Amount:         amount,
+		DaysLate:       days,
+		Status:         "owed",
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+	penalty.Memo = PenaltyMemo(penalty.ID)
+
+	if err := database.DB.Create(&penalty).Error; err != nil {
+		if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			slog.ErrorContext(ctx, "failed to record late fine", "contribution_id", contribution.ID, "error", err)
+		}
+		return
+	}
+
+	slog.InfoContext(ctx, "late fine assessed", "penalty_id", penalty.ID, "contribution_id", contribution.ID,
+		"days_late", days, "amount", amount)
+
+	_, err := RecordAudit(AuditEntry{
+		GroupID:  penalty.GroupID,
+		ActorID:  SystemActor,
+		Action:   AuditPenaltyAssess,
+		TargetID: penalty.ID,
+		After: map[string]interface{}{
+			"member_id": penalty.MemberID,
+			"round":     penalty.Round,
+			"days_late": days,
+			"amount":    amount,
+		},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to record audit event", "action", AuditPenaltyAssess, "penalty_id", penalty.ID, "error", err)
+	}
+
+	var member models.Member
+	if err := database.DB.First(&member, "id = ?", penalty.MemberID).Error; err == nil {
+		CreateNotification(
+			member.UserID,
+			group.ID,
+			"late_fine",
+			"Late Contribution Fine",
+			fmt.Sprintf("Your round %d contribution to %s was %d day(s) late. A fine of %.2f XLM is due before you can receive a payout.", penalty.Round, group.Name, days, amount),
+		)
+	}
+}
+
+// OutstandingFines returns the total of the user's late fines in the group that are not
+// yet paid or waived
+func OutstandingFines(groupID, userID string) (float64, error) {
+	var total float64
+	err := database.DB.Model(&models.Penalty{}).
+		Where("group_id = ? AND status IN ? AND member_id IN (?)", groupID, outstandingFine,
+			database.DB.Model(&models.Member{}).Select("id").Where("group_id = ? AND user_id = ?", groupID, userID)).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// ConfirmPenaltyPayment marks an owed or pending fine as paid by txHash. A savings and
+// credit group counts the fine as profit. Confirming an already paid fine is a no-op.
+func ConfirmPenaltyPayment(ctx context.Context, penaltyID, txHash string) error {
+	now := time.Now()
+	result := database.DB.Model(&models.Penalty{}).
+		Where("id = ? AND status IN ?", penaltyID, outstandingFine).
+		Updates(map[string]interface{}{
+			"status":     "paid",
+			"tx_hash":    txHash,
+			"paid_at":    now,
+			"updated_at": now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		slog.InfoContext(ctx, "late fine paid", "penalty_id", penaltyID, "tx_hash", txHash)
+		recordFineProfit(ctx, penaltyID)
+	}
+	return nil
+}
+
+// WaivePenalty cancels a fine that has not been paid. A fine whose payment is in flight
+// cannot be waived.
+func WaivePenalty(ctx context.Context, groupID, penaltyID string, user models.User) (models.Penalty, error) {
+	var penalty models.Penalty
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := database.ForUpdate(tx).Where("id = ? AND group_id = ?", penaltyID, groupID).
+			First(&penalty).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return opError(ErrNotFound, "Fine not found")
+			}
+			return err
+		}
+		if penalty.Status != "owed" {
+			return opError(ErrConflict, "Fine is %s and cannot be waived", penalty.Status)
+		}
+
+		penalty.Status = "waived"
+		penalty.WaivedBy = user.ID
+		penalty.UpdatedAt = time.Now()
+		return tx.Model(&models.Penalty{}).Where("id = ?", penalty.ID).Updates(map[string]interface{}{
+			"status":     penalty.Status,
+			"waived_by":  penalty.WaivedBy,
+			"updated_at": penalty.UpdatedAt,
+		}).Error
+	})
+	if err != nil {
+		return penalty, err
+	}
+
+	slog.InfoContext(ctx, "late fine waived", "penalty_id", penalty.ID, "amount", penalty.Amount)
+	return penalty, nil
+}
@@ -0,0 +1,132 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/services"
+)
+
+func TestLateFine(t *testing.T) {
+	deadline := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	graceEnd := deadline.Add(24 * time.Hour)
+
+	tests := []struct {
+		name   string
+		kind   string
+		amount float64
+		paidAt time.Time
+		days   int
+		fine   float64
+	}{
+		{"before the deadline", services.FineFlat, 0.5, deadline.Add(-time.Hour), 0, 0},
+		{"within the grace period", services.FineFlat, 0.5, deadline.Add(23 * time.Hour), 0, 0},
+		{"as the grace period ends", services.FineFlat, 0.5, graceEnd, 0, 0},
+		{"a minute after the grace period", services.FineFlat, 0.5, graceEnd.Add(time.Minute), 1, 0.5},
+		{"flat, part of a second day", services.FineFlat, 0.5, graceEnd.Add(25 * time.Hour), 2, 1},
+		{"percent of the contribution", services.FinePercent, 5, graceEnd.Add(72 * time.Hour), 3, 1.5},
+		{"percent rounds to stroops", services.FinePercent, 1.0 / 3, graceEnd.Add(time.Hour), 1, 0.0333333},
+		{"late without a fine", services.FineNone, 0, graceEnd.Add(72 * time.Hour), 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group := models.Group{ContributionAmount: 10, GracePeriodHours: 24, LateFineKind: tt.kind, LateFineAmount: tt.amount}
+			days, fine := services.LateFine(group, deadline, tt.paidAt)
+			if days != tt.days || fine != tt.fine {
+				t.Errorf("%d days, fine %v; want %d days, fine %v", days, fine, tt.days, tt.fine)
+			}
+		})
+	}
+
+	if days, fine := services.LateFine(models.Group{LateFineKind: services.FineFlat, LateFineAmount: 1}, time.Time{}, time.Now()); days != 0 || fine != 0 {
+		t.Errorf("no deadline: %d days, fine %v", days, fine)
+	}
+}
+
+func TestLateFineIsAssessedOnceAndBlocksPayout(t *testing.T) {
+	e := newEnv(t)
+	creator, err := e.Register("Creator", "creator@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	members, err := e.Members(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group, err := e.ActiveGroup(creator, members, models.GroupSettings{
+		ContributionAmount: 10,
+		ContributionPeriod: 7,
+		PayoutOrder:        []string{members[0].User.ID, creator.User.ID, members[1].User.ID},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Round 1 closed 49 hours ago with a day's grace: a day late, and part of a second
+	deadline := time.Now().Add(-49 * time.Hour)
+	e.DB.Model(&models.Group{}).Where("id = ?", group.ID).Updates(map[string]interface{}{
+		"next_contribution_date": deadline,
+		"grace_period_hours":     24,
+		"late_fine_kind":         services.FineFlat,
+		"late_fine_amount":       1.5,
+	})
+	e.DB.Model(&models.RoundStatus{}).Where("group_id = ? AND round = ?", group.ID, 1).Update("deadline", deadline)
+
+	for _, member := range append([]models.AuthResponse{creator}, members...) {
+		if err := e.Contribute(member, group.ID, 1, 10); err != nil {
+			t.Fatalf("contribute: %v", err)
+		}
+	}
+
+	var recipient models.Member
+	e.DB.First(&recipient, "group_id = ? AND user_id = ?", group.ID, members[0].User.ID)
+	penalties := func() []models.Penalty {
+		t.Helper()
+		var penalties []models.Penalty
+		if err := e.DB.Where("group_id = ? AND member_id = ? AND round = ?", group.ID, recipient.ID, 1).Find(&penalties).Error; err != nil {
+			t.Fatal(err)
+		}
+		return penalties
+	}
+	fined := penalties()
+	if len(fined) != 1 || fined[0].DaysLate != 2 || fined[0].Amount != 3 || fined[0].Status != "owed" {
+		t.Fatalf("penalties %+v, want one owed fine of 3 XLM for 2 days", fined)
+	}
+
+	// Confirming the contribution again, even after it is reset, does not fine twice
+	var contribution models.RoundContribution
+	e.DB.First(&contribution, "group_id = ? AND member_id = ? AND round = ?", group.ID, recipient.ID, 1)
+	if err := services.ConfirmRoundContribution(e.Context(), contribution.ID, contribution.TxHash); err != nil {
+		t.Fatal(err)
+	}
+	e.DB.Model(&models.RoundContribution{}).Where("id = ?", contribution.ID).Update("status", "pending")
+	if err := services.ConfirmRoundContribution(e.Context(), contribution.ID, contribution.TxHash); err != nil {
+		t.Fatal(err)
+	}
+	if got := penalties(); len(got) != 1 || got[0].ID != fined[0].ID {
+		t.Fatalf("penalties %+v after confirming again, want the one fine", got)
+	}
+
+	auth, err := services.AuthorizeRoundPayout(e.Context(), group.ID, creator.User, 1, "")
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	if _, _, err := services.ExecutePayout(e.Context(), auth.PayoutRequest.ID); !errors.Is(err, services.ErrRecipientOwesFines) {
+		t.Fatalf("execute with a fine owed: %v, want ErrRecipientOwesFines", err)
+	}
+	if got := payoutStatus(t, e, auth.PayoutRequest.ID).Status; got != "pending" {
+		t.Errorf("payout %s while the fine is owed, want pending", got)
+	}
+
+	if err := services.ConfirmPenaltyPayment(e.Context(), fined[0].ID, "fine-hash"); err != nil {
+		t.Fatal(err)
+	}
+	if owed, _ := services.OutstandingFines(group.ID, members[0].User.ID); owed != 0 {
+		t.Errorf("%v XLM outstanding after paying the fine", owed)
+	}
+	if _, state, err := services.ExecutePayout(e.Context(), auth.PayoutRequest.ID); err != nil || state != services.SubmissionConfirmed {
+		t.Fatalf("execute after paying: state %v, err %v", state, err)
+	}
+}
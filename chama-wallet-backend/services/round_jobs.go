@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/policy"
+)
+
+// DetectOverdueContributions notifies members who have not paid the current
+// round once the group's contribution date has passed, and tells the admins
+// who is behind. Each member is notified at most once per deadline.
+func DetectOverdueContributions(ctx context.Context) error {
+	var groups []models.Group
+	if err := database.DB.Where("status = ? AND next_contribution_date < ?", "active", time.Now()).
+		Find(&groups).Error; err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if group.NextContributionDate.IsZero() {
+			continue
+		}
+
+		var members []models.Member
+		database.DB.Where("group_id = ? AND status = ?", group.ID, "approved").Find(&members)
+
+		var overdue []models.Member
+		for _, member := range members {
+			var paid int64
+			database.DB.Model(&models.RoundContribution{}).
+				Where("group_id = ? AND member_id = ? AND round = ? AND status = ?", group.ID, member.ID, group.CurrentRound, "confirmed").
+				Count(&paid)
+			if paid > 0 {
+				continue
+			}
+			overdue = append(overdue, member)
+
+			var notified int64
+			database.DB.Model(&models.Notification{}).
+				Where("user_id = ? AND group_id = ? AND type = ? AND created_at >= ?", member.UserID, group.ID, "contribution_overdue", group.NextContributionDate).
+				Count(&notified)
+			if notified > 0 {
+				continue
+			}
+
+			CreateNotification(
+				member.UserID,
+				group.ID,
+				"contribution_overdue",
+				"Contribution Overdue",
+				fmt.Sprintf("Your contribution of %.2f XLM for round %d in %s was due on %s", group.ContributionAmount, group.CurrentRound, group.Name, group.NextContributionDate.Format("2006-01-02")),
+			)
+		}
+
+		if len(overdue) == 0 {
+			continue
+		}
+
+		for _, admin := range members {
+			if !policy.IsAdmin(admin.Role) {
+				continue
+			}
+			var notified int64
+			database.DB.Model(&models.Notification{}).
+				Where("user_id = ? AND group_id = ? AND type = ? AND created_at >= ?", admin.UserID, group.ID, "overdue_summary", group.NextContributionDate).
+				Count(&notified)
+			if notified > 0 {
+				continue
+			}
+			CreateNotification(
+				admin.UserID,
+				group.ID,
+				"overdue_summary",
+				"Members Behind on Contributions",
+				fmt.Sprintf("%d of %d members have not contributed for round %d in %s", len(overdue), len(members), group.CurrentRound, group.Name),
+			)
+		}
+
+		slog.InfoContext(ctx, "overdue contributions", "group_id", group.ID, "round", group.CurrentRound, "count", len(overdue))
+	}
+	return nil
+}
+
+// CloseExpiredRounds closes the current round of every active group whose
+// deadline has passed while it was still collecting, and notifies the admins.
+// Savings and credit groups pay no one out, so their round is completed at its
+// deadline and the group moves to the next one.
+func CloseExpiredRounds(ctx context.Context) error {
+	var groups []models.Group
+	if err := database.DB.Where("status = ?", "active").Find(&groups).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, group := range groups {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if group.NextContributionDate.IsZero() {
+			continue
+		}
+
+		roundStatus, err := ensureRoundStatus(group)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to load round", "group_id", group.ID, "round", group.CurrentRound, "error", err)
+			continue
+		}
+		if GroupType(group) == GroupASCA {
+			if !now.Before(roundStatus.Deadline) {
+				completeSavingsRound(ctx, group, roundStatus)
+			}
+			continue
+		}
+		if roundStatus.Status != "collecting" || now.Before(roundStatus.Deadline) {
+			continue
+		}
+
+		result := database.DB.Model(&models.RoundStatus{}).
+			Where("id = ? AND status = ?", roundStatus.ID, "collecting").
+			Update("status", "closed")
+		if result.Error != nil {
+			slog.ErrorContext(ctx, "failed to close round", "group_id", group.ID, "round", group.CurrentRound, "error", result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		slog.InfoContext(ctx, "closed round", "group_id", group.ID, "round", roundStatus.Round,
+			"contributors", roundStatus.ContributorsCount, "required", roundStatus.RequiredCount)
+
+		notifyAdmins(group, "round_closed", "Round Closed",
+			fmt.Sprintf("Round %d of %s closed at its deadline with %d of %d contributions (%.2f of %.2f XLM)", roundStatus.Round, group.Name, roundStatus.ContributorsCount, roundStatus.RequiredCount, roundStatus.TotalReceived, roundStatus.TotalRequired))
+	}
+	return nil
+}
+
+// completeSavingsRound completes a savings and credit group's round at its deadline and
+// moves the group to the next round, one contribution period after the deadline
+func completeSavingsRound(ctx context.Context, group models.Group, roundStatus models.RoundStatus) {
+	result := database.DB.Model(&models.RoundStatus{}).
+		Where("id = ? AND status <> ?", roundStatus.ID, "completed").
+		Update("status", "completed")
+	if result.Error != nil {
+		slog.ErrorContext(ctx, "failed to complete round", "group_id", group.ID, "round", roundStatus.Round, "error", result.Error)
+		return
+	}
+
+	err := database.DB.Model(&models.Group{}).
+		Where("id = ? AND current_round = ?", group.ID, roundStatus.Round).
+		Updates(map[string]interface{}{
+			"current_round":          roundStatus.Round + 1,
+			"next_contribution_date": roundStatus.Deadline.AddDate(0, 0, group.ContributionPeriod),
+		}).Error
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to start next round", "group_id", group.ID, "round", roundStatus.Round+1, "error", err)
+		return
+	}
+
+	slog.InfoContext(ctx, "savings round completed", "group_id", group.ID, "round", roundStatus.Round,
+		"contributors", roundStatus.ContributorsCount, "received", roundStatus.TotalReceived)
+}
+
+// ensureRoundStatus loads the status row for the group's current round,
+// creating it with the group's next contribution date as its deadline
+func ensureRoundStatus(group models.Group) (models.RoundStatus, error) {
+	var roundStatus models.RoundStatus
+	err := database.DB.Where("group_id = ? AND round = ?", group.ID, group.CurrentRound).First(&roundStatus).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return roundStatus, err
+	}
+	if err == nil {
+		if roundStatus.Deadline.IsZero() {
+			roundStatus.Deadline = group.NextContributionDate
+			err = database.DB.Model(&roundStatus).Update("deadline", roundStatus.Deadline).Error
+		}
+		return roundStatus, err
+	}
+
+	var memberCount int64
+	database.DB.Model(&models.Member{}).Where("group_id = ? AND status = ?", group.ID, "approved").Count(&memberCount)
+
+	roundStatus = models.RoundStatus{
+		ID:            uuid.NewString(),
+		GroupID:       group.ID,
+		Round:         group.CurrentRound,
+		TotalRequired: group.ContributionAmount * float64(memberCount),
+		RequiredCount: int(memberCount),
+		Status:        "collecting",
+		Deadline:      group.NextContributionDate,
+	}
+	return roundStatus, database.DB.Create(&roundStatus).Error
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"chama-wallet-backend/config"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
+)
+
+const (
+	// refreshTokenBytes is the amount of randomness in a refresh token
+	refreshTokenBytes = 32
+	// endedSessionRetention is how long revoked and expired sessions are kept, so a
+	// replayed refresh token is still recognised as reuse
+	endedSessionRetention = 7 * 24 * time.Hour
+)
+
+// ErrInvalidRefreshToken means the refresh token is unknown, expired, revoked or already used
+var ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+// StartSession records a new signed-in device for the user and issues its tokens
+func StartSession(user models.User, client models.ClientInfo) (models.AuthResponse, error) {
+	refreshToken, hash, err := newRefreshToken()
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:               uuid.NewString(),
+		UserID:           user.ID,
+		RefreshTokenHash: hash,
+		UserAgent:        client.UserAgent,
+		IP:               client.IP,
+		CreatedAt:        now,
+		LastUsedAt:       now,
+		ExpiresAt:        now.Add(config.Auth.RefreshTokenTTL),
+	}
+	if err := repository.Default.Sessions.Create(&session); err != nil {
+		return models.AuthResponse{}, err
+	}
+
+	return sessionTokens(user, session.ID, refreshToken)
+}
+
+// RefreshSession exchanges a refresh token for a new access token and a new refresh token.
+// Each refresh token works once; presenting one that was already exchanged means it was
+// copied, so the whole session is revoked.
+func RefreshSession(ctx context.Context, refreshToken string) (models.AuthResponse, error) {
+	hash := hashRefreshToken(refreshToken)
+
+	session, err := repository.Default.Sessions.ByRefreshHash(hash)
+	if errors.Is(err, repository.ErrNotFound) {
+		if reused, err := repository.Default.Sessions.ByPreviousHash(hash); err == nil && reused.RevokedAt == nil {
+			slog.WarnContext(ctx, "refresh token reused, revoking session", "session_id", reused.ID, "user_id", reused.UserID)
+			repository.Default.Sessions.Revoke(reused.ID)
+		}
+		return models.AuthResponse{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return models.AuthResponse{}, ErrInvalidRefreshToken
+	}
+
+	user, err := repository.Default.Users.ByID(session.UserID)
+	if err != nil {
+		return models.AuthResponse{}, ErrInvalidRefreshToken
+	}
+
+	next, nextHash, err := newRefreshToken()
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+	rotated, err := repository.Default.Sessions.Rotate(session.ID, hash, nextHash, time.Now().Add(config.Auth.RefreshTokenTTL))
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+	if !rotated {
+		// Another request exchanged this token first
+		return models.AuthResponse{}, ErrInvalidRefreshToken
+	}
+
+	return sessionTokens(user, session.ID, next)
+}
+
+// SessionActive reports whether the session exists for the user and is neither revoked
+// nor expired
+func SessionActive(sessionID, userID string) bool {
+	session, err := repository.Default.Sessions.ByID(sessionID)
+	if err != nil {
+		return false
+	}
+	return session.UserID == userID && session.RevokedAt == nil && time.Now().Before(session.ExpiresAt)
+}
+
+// ListSessions returns the user's signed-in devices, marking the one making the request
+func ListSessions(userID, currentID string) ([]models.Session, error) {
+	sessions, err := repository.Default.Sessions.ListActive(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+	return sessions, nil
+}
+
+// RevokeSession signs one of the user's devices out
+func RevokeSession(userID, sessionID string) error {
+	session, err := repository.Default.Sessions.ByID(sessionID)
+	if err != nil || session.UserID != userID {
+		return opError(ErrNotFound, "Session not found")
+	}
+	return repository.Default.Sessions.Revoke(sessionID)
+}
+
+// RevokeOtherSessions signs the user out everywhere except the current session
+func RevokeOtherSessions(userID, currentID string) (int64, error) {
+	return repository.Default.Sessions.RevokeForUser(userID, currentID)
+}
+
+// PurgeEndedSessions deletes sessions that ended more than a week ago
+func PurgeEndedSessions(ctx context.Context) error {
+	purged, err := repository.Default.Sessions.PurgeEnded(time.Now().Add(-endedSessionRetention))
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		slog.InfoContext(ctx, "purged ended sessions", "count", purged)
+	}
+	return nil
+}
+
+// sessionTokens issues an access token for the session alongside its refresh token
+func sessionTokens(user models.User, sessionID, refreshToken string) (models.AuthResponse, error) {
+	token, expiresAt, err := GenerateAccessToken(user.ID, user.Email, sessionID)
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+	return models.AuthResponse{
+		User:         user,
+		Token:        token,
+		ExpiresAt:    expiresAt,
+		RefreshToken: refreshToken,
+		SessionID:    sessionID,
+	}, nil
+}
+
+// newRefreshToken returns a random refresh token and the hash stored for it
+func newRefreshToken() (string, string, error) {
+	raw := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	return token, hashRefreshToken(token), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
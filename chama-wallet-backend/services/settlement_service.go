@@ -0,0 +1,792 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stellar/go/clients/horizonclient"
+	"gorm.io/gorm"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/policy"
+)
+
+// Profit sources
+const (
+	ProfitLoanInterest = "loan_interest"
+	ProfitFine         = "fine"
+)
+
+// settlementBatchSize is the most payments one share-out transaction makes, the
+// operation limit of a Stellar transaction
+const settlementBatchSize = 100
+
+// openSettlement are the settlement statuses that still have members to pay
+var openSettlement = []string{"approving", "incomplete"}
+
+// GroupSharePolicy returns the share price and cycle length stored on the group
+func GroupSharePolicy(group models.Group) models.SharePolicy {
+	policy := models.SharePolicy{SharePrice: group.SharePrice, CycleRounds: group.CycleRounds}
+	if policy.SharePrice <= 0 {
+		policy.SharePrice = 1
+	}
+	if policy.CycleRounds <= 0 {
+		policy.CycleRounds = 12
+	}
+	return policy
+}
+
+// ValidateSharePolicy checks a share price and cycle length the group can use
+func ValidateSharePolicy(policy models.SharePolicy) error {
+	if policy.SharePrice <= 0 {
+		return fmt.Errorf("share price must be a positive amount of XLM")
+	}
+	if policy.CycleRounds < 1 || policy.CycleRounds > 120 {
+		return fmt.Errorf("cycle must be between 1 and 120 rounds")
+	}
+	return nil
+}
+
+// SharePolicyUpdates returns the group columns that store a share policy
+func SharePolicyUpdates(policy models.SharePolicy) map[string]interface{} {
+	return map[string]interface{}{
+		"share_price":  policy.SharePrice,
+		"cycle_rounds": policy.CycleRounds,
+	}
+}
+
+// CycleRounds returns the first and last round of the group's current cycle
+func CycleRounds(group models.Group) (int, int) {
+	from := group.CycleStartRound
+	if from < 1 {
+		from = 1
+	}
+	return from, from + GroupSharePolicy(group).CycleRounds - 1
+}
+
+// MemberShare is what a member put into the current cycle
+type MemberShare struct {
+	MemberID    string  `json:"member_id"`
+	Shares      float64 `json:"shares"`
+	Contributed float64 `json:"contributed"`
+	ShareOut    float64 `json:"share_out" gorm:"-"` // what they would be paid if the cycle were shared out now
+}
+
+// CycleSummary is where a savings and credit group's current cycle stands
+type CycleSummary struct {
+	Cycle       int           `json:"cycle"`
+	FromRound   int           `json:"from_round"`
+	ToRound     int           `json:"to_round"`
+	SharePrice  float64       `json:"share_price"`
+	TotalShares float64       `json:"total_shares"`
+	Savings     float64       `json:"savings"`
+	Profit      float64       `json:"profit"`
+	Members     []MemberShare `json:"members"`
+}
+
+// recordShares buys shares with a just confirmed contribution to a savings and credit
+// group, at the group's current share price. A contribution buys shares once.
+func recordShares(ctx context.Context, contribution models.RoundContribution) {
+	var group models.Group
+	if err := database.DB.First(&group, "id = ?", contribution.GroupID).Error; err != nil {
+		slog.ErrorContext(ctx, "failed to load group for shares", "group_id", contribution.GroupID, "error", err)
+		return
+	}
+	if GroupType(group) != GroupASCA {
+		return
+	}
+
+	shares := stroops(contribution.Amount / GroupSharePolicy(group).SharePrice)
+	if err := database.DB.Model(&models.RoundContribution{}).
+		Where("id = ? AND shares = ?", contribution.ID, 0).
+		Update("shares", shares).Error; err != nil {
+		slog.ErrorContext(ctx, "failed to record shares", "contribution_id", contribution.ID, "error", err)
+	}
+}
+
+// recordProfit adds income to the group's profit for the next share-out. Each source is
+// counted once.
+func recordProfit(db *gorm.DB, groupID, source, sourceID string, amount float64) error {
+	if amount <= 0 {
+		return nil
+	}
+	err := db.Create(&models.ProfitEntry{
+		ID:        uuid.NewString(),
+		GroupID:   groupID,
+		Source:    source,
+		SourceID:  sourceID,
+		Amount:    stroops(amount),
+		CreatedAt: time.Now(),
+	}).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil
+	}
+	return err
+}
+
+// recordFineProfit counts a paid late fine as profit in savings and credit groups
+func recordFineProfit(ctx context.Context, penaltyID string) {
+	var penalty models.Penalty
+	if err := database.DB.First(&penalty, "id = ?", penaltyID).Error; err != nil {
+		return
+	}
+	var group models.Group
+	if err := database.DB.First(&group, "id = ?", penalty.GroupID).Error; err != nil || GroupType(group) != GroupASCA {
+		return
+	}
+	if err := recordProfit(database.DB, group.ID, ProfitFine, penalty.ID, penalty.Amount); err != nil {
+		slog.ErrorContext(ctx, "failed to record fine as profit", "penalty_id", penalty.ID, "error", err)
+	}
+}
+
+// CurrentCycle returns the shares members have bought so far this cycle, the profit not
+// yet shared out and what each member's share-out would be
+func CurrentCycle(group models.Group) (CycleSummary, error) {
+	summary, err := cycleSummary(database.DB, group)
+	if err != nil {
+		return summary, err
+	}
+	pool := summary.Savings + summary.Profit
+	for i := range summary.Members {
+		summary.Members[i].ShareOut = shareOut(pool, summary.Members[i].Shares, summary.TotalShares)
+	}
+	return summary, nil
+}
+
+func cycleSummary(db *gorm.DB, group models.Group) (CycleSummary, error) {
+	from, to := CycleRounds(group)
+	summary := CycleSummary{
+		Cycle:      group.Cycle,
+		FromRound:  from,
+		ToRound:    to,
+		SharePrice: GroupSharePolicy(group).SharePrice,
+		Members:    []MemberShare{},
+	}
+
+	if err := db.Model(&models.RoundContribution{}).
+		Select("member_id, COALESCE(SUM(shares), 0) AS shares, COALESCE(SUM(amount), 0) AS contributed").
+		Where("group_id = ? AND status = ? AND round BETWEEN ? AND ?", group.ID, "confirmed", from, to).
+		Group("member_id").
+		Order("member_id").
+		Scan(&summary.Members).Error; err != nil {
+		return summary, err
+	}
+	for _, member := range summary.Members {
+		summary.TotalShares += member.Shares
+		summary.Savings += member.Contributed
+	}
+	summary.TotalShares = stroops(summary.TotalShares)
+	summary.Savings = stroops(summary.Savings)
+
+	err := db.Model(&models.ProfitEntry{}).
+		Where("group_id = ? AND settlement_id = ?", group.ID, "").
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&summary.Profit).Error
+	summary.Profit = stroops(summary.Profit)
+	return summary, err
+}
+
+// shareOut is a member's part of the pool for their shares, rounded down to whole stroops
+// so the payments never add up to more than the pool
+func shareOut(pool, shares, totalShares float64) float64 {
+	if totalShares <= 0 {
+		return 0
+	}
+	return math.Floor(pool*shares/totalShares*1e7) / 1e7
+}
+
+// SettleCycles prepares the share-out of every savings and credit group whose cycle has
+// run its last round. A cycle is prepared once; a share-out the admins reject is prepared
+// again by hand.
+func SettleCycles(ctx context.Context) error {
+	var groups []models.Group
+	if err := database.DB.Where("status = ? AND group_type = ?", "active", GroupASCA).Find(&groups).Error; err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, to := CycleRounds(group); group.CurrentRound <= to {
+			continue
+		}
+
+		var prepared int64
+		database.DB.Model(&models.Settlement{}).Where("group_id = ? AND cycle = ?", group.ID, group.Cycle).Count(&prepared)
+		if prepared > 0 {
+			continue
+		}
+
+		settlement, err := PrepareSettlement(ctx, group.ID)
+		if err != nil {
+			slog.WarnContext(ctx, "share-out not prepared", "group_id", group.ID, "cycle", group.Cycle, "error", err)
+			var opErr *OpError
+			if errors.As(err, &opErr) {
+				notifyAdmins(group, "settlement_blocked", "Share-out Waiting",
+					fmt.Sprintf("Cycle %d of %s has ended but its share-out could not be prepared: %s", group.Cycle, group.Name, opErr.Message))
+			}
+			continue
+		}
+		_, err = RecordAudit(AuditEntry{
+			GroupID:  group.ID,
+			ActorID:  SystemActor,
+			Action:   AuditSettlementPrepare,
+			TargetID: settlement.ID,
+			After:    SettlementAudit(settlement),
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to record audit event", "action", AuditSettlementPrepare, "settlement_id", settlement.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// PrepareSettlement computes the share-out of the group's ended cycle: every member who
+// bought shares gets the cycle's savings and profit in proportion to their shares. It
+// records the distribution and raises a payout request for each batch of payments, which
+// the admins vote on with VoteOnSettlement. All loans must be repaid first.
+func PrepareSettlement(ctx context.Context, groupID string) (models.Settlement, error) {
+	var settlement models.Settlement
+	var group models.Group
+
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := database.ForUpdate(tx).First(&group, "id = ?", groupID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return opError(ErrNotFound, "Group not found")
+			}
+			return err
+		}
+		if GroupType(group) != GroupASCA {
+			return opError(ErrInvalid, "Only savings and credit groups share out their savings")
+		}
+		if group.Status != "active" {
+			return opError(ErrInvalid, "Group is not active")
+		}
+		from, to := CycleRounds(group)
+		if group.CurrentRound <= to {
+			return opError(ErrInvalid, "Cycle %d runs until round %d is complete", group.Cycle, to)
+		}
+
+		var open int64
+		if err := tx.Model(&models.Settlement{}).Where("group_id = ? AND status IN ?", group.ID, openSettlement).
+			Count(&open).Error; err != nil {
+			return err
+		}
+		if open > 0 {
+			return opError(ErrConflict, "A share-out is already in progress")
+		}
+
+		var loans int64
+		if err := tx.Model(&models.Loan{}).Where("group_id = ? AND status IN ?", group.ID, openLoan).
+			Count(&loans).Error; err != nil {
+			return err
+		}
+		if loans > 0 {
+			return opError(ErrConflict, "%d loan(s) must be repaid or closed before the share-out", loans)
+		}
+
+		summary, err := cycleSummary(tx, group)
+		if err != nil {
+			return err
+		}
+		if summary.TotalShares <= 0 {
+			return opError(ErrInvalid, "No shares were bought in cycle %d", group.Cycle)
+		}
+
+		pool := stroops(summary.Savings + summary.Profit)
+		available, err := spendableBalance(ctx, group.Wallet)
+		if err != nil {
+			return fmt.Errorf("failed to check group balance: %w", err)
+		}
+		if pool > available {
+			return opError(ErrConflict, "Group wallet can pay out %.7f XLM, the share-out needs %.7f XLM", available, pool)
+		}
+
+		settlement = models.Settlement{
+			ID:          uuid.NewString(),
+			GroupID:     group.ID,
+			Cycle:       group.Cycle,
+			FromRound:   from,
+			ToRound:     to,
+			TotalShares: summary.TotalShares,
+			Savings:     summary.Savings,
+			Profit:      summary.Profit,
+			Status:      "approving",
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+		}
+
+		for _, share := range summary.Members {
+			var member models.Member
+			if err := tx.Preload("User").First(&member, "id = ?", share.MemberID).Error; err != nil {
+				return err
+			}
+			wallet := member.User.Wallet
+			if wallet == "" {
+				wallet = member.Wallet
+			}
+			amount := shareOut(pool, share.Shares, summary.TotalShares)
+			if amount <= 0 {
+				continue
+			}
+			settlement.Total += amount
+			settlement.Payouts = append(settlement.Payouts, models.SettlementPayout{
+				ID:           uuid.NewString(),
+				SettlementID: settlement.ID,
+				MemberID:     member.ID,
+				Member:       member,
+				Wallet:       wallet,
+				Shares:       share.Shares,
+				Contributed:  share.Contributed,
+				Amount:       amount,
+				Batch:        len(settlement.Payouts)/settlementBatchSize + 1,
+				Status:       "scheduled",
+			})
+		}
+		settlement.Total = stroops(settlement.Total)
+
+		if err := tx.Omit("Payouts").Create(&settlement).Error; err != nil {
+			return err
+		}
+		if err := tx.Omit("Member").Create(&settlement.Payouts).Error; err != nil {
+			return err
+		}
+
+		// The profit is now this share-out's; anything earned from here on goes to the next
+		if err := tx.Model(&models.ProfitEntry{}).
+			Where("group_id = ? AND settlement_id = ?", group.ID, "").
+			Update("settlement_id", settlement.ID).Error; err != nil {
+			return err
+		}
+
+		return raiseSettlementBatches(tx, group, settlement.Payouts)
+	})
+	if err != nil {
+		return settlement, err
+	}
+
+	slog.InfoContext(ctx, "share-out prepared", "group_id", group.ID, "settlement_id", settlement.ID,
+		"cycle", settlement.Cycle, "members", len(settlement.Payouts), "total", settlement.Total)
+
+	var approvers []models.Member
+	database.DB.Where("group_id = ? AND status = ?", group.ID, "approved").Find(&approvers)
+	for _, member := range approvers {
+		if !policy.Allows(group, member, policy.ApprovePayout) {
+			continue
+		}
+		CreateNotification(
+			member.UserID,
+			group.ID,
+			"settlement_approval",
+			"Share-out Awaiting Approval",
+			fmt.Sprintf("The cycle %d share-out of %s, %.2f XLM to %d members, is ready for approval", settlement.Cycle, group.Name, settlement.Total, len(settlement.Payouts)),
+		)
+	}
+	return settlement, nil
+}
+
+// raiseSettlementBatches creates a payout request for each batch of the payouts. Batches
+// are submitted in order, so on a multisig treasury only the first has its envelope
+// built now for the signers; each later one is built from the group wallet's sequence
+// once the batch before it is confirmed. Other groups build each batch when it is sent.
+func raiseSettlementBatches(tx *gorm.DB, group models.Group, payouts []models.SettlementPayout) error {
+	var batches [][]models.SettlementPayout
+	for i := 0; i < len(payouts); i += settlementBatchSize {
+		end := i + settlementBatchSize
+		if end > len(payouts) {
+			end = len(payouts)
+		}
+		batches = append(batches, payouts[i:end])
+	}
+
+	for i, batch := range batches {
+		var payments []GroupPayment
+		var amount float64
+		var ids []string
+		for _, payout := range batch {
+			payments = append(payments, GroupPayment{Destination: payout.Wallet, Amount: fmt.Sprintf("%.7f", payout.Amount)})
+			amount += payout.Amount
+			ids = append(ids, payout.ID)
+		}
+
+		envelope := ""
+		if group.Multisig && i == 0 {
+			var err error
+			envelope, err = BuildGroupBatchPayoutTx(tx.Statement.Context, group, payments)
+			if err != nil {
+				return fmt.Errorf("failed to build share-out batch %d: %w", batch[0].Batch, err)
+			}
+		}
+
+		// A batch pays many members, so the request has no single recipient
+		payoutRequest := models.PayoutRequest{
+			ID:           uuid.NewString(),
+			GroupID:      group.ID,
+			Amount:       stroops(amount),
+			Status:       "pending",
+			EnvelopeXDR:  envelope,
+			SettlementID: batch[0].SettlementID,
+			CreatedAt:    time.Now(),
+		}
+		payoutRequest.ExpiresAt = PayoutExpiry(group, payoutRequest.CreatedAt)
+		if err := tx.Omit("RecipientID").Create(&payoutRequest).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.SettlementPayout{}).Where("id IN ?", ids).
+			Update("payout_request_id", payoutRequest.ID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spendableBalance returns the XLM the wallet can send without going below its reserve
+func spendableBalance(ctx context.Context, wallet string) (float64, error) {
+	account, err := LedgerFrom(ctx).AccountDetail(horizonclient.AccountRequest{AccountID: wallet})
+	if err != nil {
+		return 0, err
+	}
+	native, err := account.GetNativeBalance()
+	if err != nil {
+		return 0, err
+	}
+	balance, err := strconv.ParseFloat(native, 64)
+	if err != nil {
+		return 0, err
+	}
+	// Base reserve for the account and each subentry, plus room for the batch fees
+	reserve := float64(2+account.SubentryCount)*0.5 + 0.01
+	return math.Max(stroops(balance-reserve), 0), nil
+}
+
+// SettlementBatch is where one batch of a share-out stands after a vote
+type SettlementBatch struct {
+	Batch    int                `json:"batch"`
+	PayoutID string             `json:"payout_id"`
+	Members  int                `json:"members"`
+	Amount   float64            `json:"amount"`
+	Tally    models.PayoutTally `json:"tally"`
+	Status   string             `json:"status"`
+	TxHash   string             `json:"tx_hash,omitempty"`
+	Error    string             `json:"error,omitempty"`
+}
+
+// VoteOnSettlement records the user's vote on every open batch of a share-out. Batches
+// that reach the group's approval policy are paid in order; a batch whose payment is not
+// confirmed holds back the ones after it, whose envelopes are built once it is.
+func VoteOnSettlement(ctx context.Context, groupID, settlementID string, user models.User, approved bool, signedXDRs map[string]string) (models.Settlement, []SettlementBatch, error) {
+	var settlement models.Settlement
+	if err := database.DB.Where("id = ? AND group_id = ?", settlementID, groupID).First(&settlement).Error; err != nil {
+		return settlement, nil, opError(ErrNotFound, "Share-out not found")
+	}
+	if settlement.Status != "approving" {
+		return settlement, nil, opError(ErrConflict, "Share-out is %s", settlement.Status)
+	}
+
+	batches, err := settlementBatches(settlement.ID)
+	if err != nil {
+		return settlement, nil, err
+	}
+
+	var group models.Group
+	if err := database.DB.First(&group, "id = ?", groupID).Error; err != nil {
+		return settlement, nil, err
+	}
+
+	blocked := false
+	for i := range batches {
+		batch := &batches[i]
+		payoutRequest, err := loadPayoutRequest(batch.PayoutID)
+		if err != nil {
+			return settlement, batches, err
+		}
+
+		switch payoutRequest.Status {
+		case "pending":
+			_, batch.Tally, err = VoteOnPayout(ctx, payoutRequest.ID, user, approved, signedXDRs[payoutRequest.ID])
+			if err == errAlreadyVoted {
+				batch.Tally, err = SettlePayoutVote(ctx, group, payoutRequest)
+			}
+			if err != nil {
+				return settlement, batches, err
+			}
+		case "approved":
+			batch.Tally, err = TallyPayout(group, payoutRequest)
+			if err != nil {
+				return settlement, batches, err
+			}
+		default:
+			batch.Status = payoutRequest.Status
+			batch.TxHash = payoutRequest.TxHash
+			continue
+		}
+
+		batch.Status = batch.Tally.Outcome
+		if batch.Tally.Outcome != "approved" || blocked {
+			blocked = blocked || batch.Tally.Outcome != "rejected"
+			continue
+		}
+
+		resp, state, err := ExecutePayout(ctx, payoutRequest.ID)
+		switch state {
+		case SubmissionConfirmed:
+			batch.Status = "completed"
+			batch.TxHash = resp.Hash
+		case SubmissionRejected:
+			batch.Status = "failed"
+			batch.Error = fmt.Sprint(err)
+			blocked = true
+		default:
+			batch.Status = "approved"
+			if err != nil {
+				batch.Error = err.Error()
+			}
+			blocked = true
+		}
+	}
+
+	slog.InfoContext(ctx, "share-out vote recorded", "settlement_id", settlement.ID, "user_id", user.ID, "approved", approved)
+
+	err = database.DB.First(&settlement, "id = ?", settlement.ID).Error
+	return settlement, batches, err
+}
+
+// settlementBatches lists a share-out's batches in payment order with their latest
+// payout requests
+func settlementBatches(settlementID string) ([]SettlementBatch, error) {
+	var payouts []models.SettlementPayout
+	if err := database.DB.Where("settlement_id = ?", settlementID).Order("batch ASC").
+		Find(&payouts).Error; err != nil {
+		return nil, err
+	}
+
+	var batches []SettlementBatch
+	index := map[string]int{}
+	for _, payout := range payouts {
+		i, ok := index[payout.PayoutRequestID]
+		if !ok {
+			i = len(batches)
+			index[payout.PayoutRequestID] = i
+			batches = append(batches, SettlementBatch{Batch: payout.Batch, PayoutID: payout.PayoutRequestID})
+		}
+		batches[i].Members++
+		batches[i].Amount = stroops(batches[i].Amount + payout.Amount)
+	}
+	return batches, nil
+}
+
+// settlementPayments returns the payments of a share-out batch, in payout order
+func settlementPayments(payoutRequestID string) ([]GroupPayment, error) {
+	var payouts []models.SettlementPayout
+	if err := database.DB.Where("payout_request_id = ?", payoutRequestID).Order("batch ASC, id ASC").
+		Find(&payouts).Error; err != nil {
+		return nil, err
+	}
+	if len(payouts) == 0 {
+		return nil, fmt.Errorf("share-out batch %s has no payments", payoutRequestID)
+	}
+	var payments []GroupPayment
+	for _, payout := range payouts {
+		payments = append(payments, GroupPayment{Destination: payout.Wallet, Amount: fmt.Sprintf("%.7f", payout.Amount)})
+	}
+	return payments, nil
+}
+
+// buildNextSettlementBatch builds the multisig envelope of the share-out's next open
+// batch, from the sequence the group wallet reached with the batches before it, and has
+// the admins who already approved it sign it
+func buildNextSettlementBatch(ctx context.Context, settlementID string) error {
+	var payout models.SettlementPayout
+	err := database.DB.Where("settlement_id = ? AND status = ? AND payout_request_id IN (?)", settlementID, "scheduled",
+		database.DB.Model(&models.PayoutRequest{}).Select("id").Where("status IN ?", []string{"pending", "approved"})).
+		Order("batch ASC").First(&payout).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	next, err := loadPayoutRequest(payout.PayoutRequestID)
+	if err != nil || next.EnvelopeXDR != "" {
+		return err
+	}
+
+	var group models.Group
+	if err := database.DB.First(&group, "id = ?", next.GroupID).Error; err != nil || !group.Multisig {
+		return err
+	}
+	return refreshPayoutEnvelope(ctx, group, &next)
+}
+
+func loadPayoutRequest(id string) (models.PayoutRequest, error) {
+	var payoutRequest models.PayoutRequest
+	err := database.DB.First(&payoutRequest, "id = ?", id).Error
+	return payoutRequest, err
+}
+
+// closeSettlementBatch records a share-out batch that was rejected, expired or failed. If
+// nobody has been paid yet the share-out is called off, its other batches are rejected and
+// its profit waits for the next share-out. Otherwise it is incomplete until the unpaid
+// batches are raised again with ReissueSettlement.
+func closeSettlementBatch(db *gorm.DB, settlementID, outcome string) error {
+	var paid int64
+	if err := db.Model(&models.SettlementPayout{}).Where("settlement_id = ? AND status = ?", settlementID, "paid").
+		Count(&paid).Error; err != nil {
+		return err
+	}
+	if paid > 0 {
+		return db.Model(&models.Settlement{}).Where("id = ? AND status = ?", settlementID, "approving").
+			Updates(map[string]interface{}{"status": "incomplete", "updated_at": time.Now()}).Error
+	}
+
+	result := db.Model(&models.Settlement{}).Where("id = ? AND status IN ?", settlementID, openSettlement).
+		Updates(map[string]interface{}{"status": outcome, "updated_at": time.Now()})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	if err := db.Model(&models.PayoutRequest{}).Where("settlement_id = ? AND status = ?", settlementID, "pending").
+		Update("status", "rejected").Error; err != nil {
+		return err
+	}
+	return db.Model(&models.ProfitEntry{}).Where("settlement_id = ?", settlementID).
+		Update("settlement_id", "").Error
+}
+
+// CompleteSettlementBatch marks the members a completed share-out batch paid. Once every
+// member is paid the share-out is completed and the group starts its next cycle.
+func CompleteSettlementBatch(ctx context.Context, payoutRequest models.PayoutRequest, txHash string) error {
+	var settlement models.Settlement
+	var paid []models.SettlementPayout
+	completed := false
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := database.ForUpdate(tx).First(&settlement, "id = ?", payoutRequest.SettlementID).Error; err != nil {
+			return err
+		}
+		if err := tx.Preload("Member").Where("payout_request_id = ? AND status = ?", payoutRequest.ID, "scheduled").
+			Find(&paid).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.SettlementPayout{}).
+			Where("payout_request_id = ? AND status = ?", payoutRequest.ID, "scheduled").
+			Updates(map[string]interface{}{"status": "paid", "tx_hash": txHash}).Error; err != nil {
+			return err
+		}
+
+		var unpaid int64
+		if err := tx.Model(&models.SettlementPayout{}).Where("settlement_id = ? AND status <> ?", settlement.ID, "paid").
+			Count(&unpaid).Error; err != nil {
+			return err
+		}
+		if unpaid > 0 || settlement.Status == "completed" {
+			return nil
+		}
+
+		now := time.Now()
+		completed = true
+		settlement.Status = "completed"
+		if err := tx.Model(&models.Settlement{}).Where("id = ?", settlement.ID).Updates(map[string]interface{}{
+			"status":       settlement.Status,
+			"completed_at": now,
+			"updated_at":   now,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Group{}).Where("id = ? AND cycle = ?", settlement.GroupID, settlement.Cycle).
+			Updates(map[string]interface{}{
+				"cycle":             settlement.Cycle + 1,
+				"cycle_start_round": settlement.ToRound + 1,
+			}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "share-out batch paid", "settlement_id", settlement.ID, "payout_id", payoutRequest.ID,
+		"members", len(paid), "tx_hash", txHash)
+	if completed {
+		slog.InfoContext(ctx, "share-out completed", "settlement_id", settlement.ID, "cycle", settlement.Cycle)
+	} else if err := buildNextSettlementBatch(ctx, settlement.ID); err != nil {
+		// The next batch is built again when it is paid out
+		slog.ErrorContext(ctx, "failed to build next share-out batch", "settlement_id", settlement.ID, "error", err)
+	}
+
+	for _, payout := range paid {
+		CreateNotification(
+			payout.Member.UserID,
+			settlement.GroupID,
+			"settlement_paid",
+			"Share-out Paid",
+			fmt.Sprintf("Your cycle %d share-out of %.2f XLM for %.2f shares has been sent to your wallet", settlement.Cycle, payout.Amount, payout.Shares),
+		)
+	}
+	return nil
+}
+
+// ReissueSettlement raises new payout requests for the batches of an incomplete share-out
+// that were rejected, expired or failed, with the same payments
+func ReissueSettlement(ctx context.Context, groupID, settlementID string) (models.Settlement, error) {
+	var settlement models.Settlement
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := database.ForUpdate(tx).Where("id = ? AND group_id = ?", settlementID, groupID).
+			First(&settlement).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return opError(ErrNotFound, "Share-out not found")
+			}
+			return err
+		}
+		if settlement.Status != "incomplete" {
+			return opError(ErrConflict, "Share-out is %s", settlement.Status)
+		}
+
+		var group models.Group
+		if err := tx.First(&group, "id = ?", groupID).Error; err != nil {
+			return err
+		}
+
+		var unpaid []models.SettlementPayout
+		if err := tx.Where("settlement_id = ? AND status = ? AND payout_request_id IN (?)", settlement.ID, "scheduled",
+			tx.Model(&models.PayoutRequest{}).Select("id").Where("status IN ?", []string{"rejected", "expired", "failed"})).
+			Order("batch ASC").Find(&unpaid).Error; err != nil {
+			return err
+		}
+		if len(unpaid) == 0 {
+			return opError(ErrConflict, "No share-out batch needs to be raised again")
+		}
+
+		if err := raiseSettlementBatches(tx, group, unpaid); err != nil {
+			return err
+		}
+		settlement.Status = "approving"
+		return tx.Model(&models.Settlement{}).Where("id = ?", settlement.ID).
+			Updates(map[string]interface{}{"status": settlement.Status, "updated_at": time.Now()}).Error
+	})
+	if err != nil {
+		return settlement, err
+	}
+
+	slog.InfoContext(ctx, "share-out batches raised again", "settlement_id", settlement.ID)
+	return settlement, nil
+}
+
+// SettlementAudit is the audit record of a prepared share-out
+func SettlementAudit(settlement models.Settlement) map[string]interface{} {
+	return map[string]interface{}{
+		"cycle":        settlement.Cycle,
+		"from_round":   settlement.FromRound,
+		"to_round":     settlement.ToRound,
+		"total_shares": settlement.TotalShares,
+		"savings":      settlement.Savings,
+		"profit":       settlement.Profit,
+		"total":        settlement.Total,
+		"members":      len(settlement.Payouts),
+	}
+}
@@ -0,0 +1,138 @@
+package services_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/services"
+	"chama-wallet-backend/testenv"
+)
+
+// addSavers adds n approved members who each bought one share in round 1. They are
+// written straight to the database, as registering that many users is slow.
+func addSavers(t *testing.T, e *testenv.Env, groupID string, n int) {
+	t.Helper()
+	now := time.Now()
+	for i := 0; i < n; i++ {
+		wallet := keypair.MustRandom().Address()
+		if err := e.Ledger.CreateAccount(wallet, "1"); err != nil {
+			t.Fatal(err)
+		}
+		user := models.User{ID: uuid.NewString(), Name: fmt.Sprintf("Saver %d", i), Email: fmt.Sprintf("saver%d@example.com", i),
+			Password: "-", Wallet: wallet, EmailVerifiedAt: &now}
+		member := models.Member{ID: uuid.NewString(), GroupID: groupID, UserID: user.ID, Wallet: wallet,
+			Role: "member", Status: "approved", JoinedAt: now}
+		contribution := models.RoundContribution{ID: uuid.NewString(), GroupID: groupID, MemberID: member.ID,
+			Round: 1, Amount: 1, Shares: 1, Status: "confirmed"}
+		for _, row := range []interface{}{&user, &member, &contribution} {
+			if err := e.DB.Omit("Group", "Member", "User").Create(row).Error; err != nil {
+				t.Fatalf("add saver: %v", err)
+			}
+		}
+	}
+}
+
+func submittedSequence(t *testing.T, e *testenv.Env, payoutID string) int64 {
+	t.Helper()
+	generic, err := txnbuild.TransactionFromXDR(payoutStatus(t, e, payoutID).SubmittedXDR)
+	if err != nil {
+		t.Fatalf("submitted envelope: %v", err)
+	}
+	tx, _ := generic.Transaction()
+	return tx.SequenceNumber()
+}
+
+func TestShareOutBatchesPaidInSequence(t *testing.T) {
+	e := newEnv(t)
+	group, creator, members := activeGroup(t, e, 2, models.GroupSettings{
+		Type:               services.GroupASCA,
+		ContributionAmount: 10,
+		ContributionPeriod: 7,
+		SharePolicy:        &models.SharePolicy{SharePrice: 1, CycleRounds: 1},
+	})
+	for _, member := range append([]models.AuthResponse{creator}, members...) {
+		if err := e.Contribute(member, group.ID, 1, 10); err != nil {
+			t.Fatalf("contribute: %v", err)
+		}
+	}
+	// Enough savers for a second batch of payments
+	addSavers(t, e, group.ID, 100)
+	e.DB.Model(&models.Group{}).Where("id = ?", group.ID).Update("current_round", 2)
+
+	settlement, err := services.PrepareSettlement(e.Context(), group.ID)
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	if len(settlement.Payouts) != 103 || settlement.Total != 130 {
+		t.Fatalf("share-out of %.7f XLM to %d members, want 130 XLM to 103", settlement.Total, len(settlement.Payouts))
+	}
+	var first, second string
+	e.DB.Model(&models.SettlementPayout{}).Where("settlement_id = ? AND batch = ?", settlement.ID, 1).
+		Limit(1).Pluck("payout_request_id", &first)
+	e.DB.Model(&models.SettlementPayout{}).Where("settlement_id = ? AND batch = ?", settlement.ID, 2).
+		Limit(1).Pluck("payout_request_id", &second)
+	if first == "" || second == "" || first == second {
+		t.Fatalf("batch payout requests %q and %q, want two", first, second)
+	}
+	// Only the first batch is built up front
+	if payoutStatus(t, e, first).EnvelopeXDR == "" || payoutStatus(t, e, second).EnvelopeXDR != "" {
+		t.Fatal("want an envelope for the first batch only")
+	}
+
+	// Another transaction from the treasury takes the sequence the first batch was built on
+	account, err := e.Ledger.AccountDetail(horizonclient.AccountRequest{AccountID: group.Wallet})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        &account,
+		IncrementSequenceNum: true,
+		BaseFee:              txnbuild.MinBaseFee,
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewInfiniteTimeout()},
+		Operations:           []txnbuild.Operation{&txnbuild.Payment{Destination: members[1].User.Wallet, Amount: "1", Asset: txnbuild.NativeAsset{}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope, _ := tx.Base64()
+	signed, err := e.Sign(creator.User, envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Ledger.SubmitTransactionXDR(signed); err != nil {
+		t.Fatalf("submit competing transaction: %v", err)
+	}
+
+	settled, batches, err := services.VoteOnSettlement(e.Context(), group.ID, settlement.ID, creator.User, true, nil)
+	if err != nil {
+		t.Fatalf("vote: %v", err)
+	}
+	for _, batch := range batches {
+		if batch.Status != "completed" {
+			t.Errorf("batch %d %s (%s), want completed", batch.Batch, batch.Status, batch.Error)
+		}
+	}
+	if settled.Status != "completed" {
+		t.Fatalf("share-out %s, want completed", settled.Status)
+	}
+
+	// The second batch follows the sequence the first one confirmed
+	if a, b := submittedSequence(t, e, first), submittedSequence(t, e, second); b != a+1 {
+		t.Errorf("batch sequences %d and %d, want consecutive", a, b)
+	}
+	var unpaid int64
+	e.DB.Model(&models.SettlementPayout{}).Where("settlement_id = ? AND status <> ?", settlement.ID, "paid").Count(&unpaid)
+	if unpaid != 0 {
+		t.Errorf("%d members unpaid", unpaid)
+	}
+	if got := e.Ledger.Balance(members[0].User.Wallet); got != "9999.9999900" {
+		t.Errorf("member balance %s, want their 10 XLM back", got)
+	}
+}
@@ -2,14 +2,21 @@
 package services
 
 import (
-	"bytes"
+	"context"
 	"fmt"
+	"log/slog"
 	"os"
-	"os/exec"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+
 	"chama-wallet-backend/config"
+	"chama-wallet-backend/keystore"
+	"chama-wallet-backend/sorobanrpc"
 )
 
 type SorobanInvokeRequest struct {
@@ -32,247 +39,296 @@ func validateContractID(contractID string) error {
 	return nil
 }
 
-// checkContractExists verifies the contract exists on the network
-func checkContractExists(contractID string) error {
-	network := config.GetSorobanNetwork()
-	cmd := exec.Command("soroban", "contract", "inspect", "--id", contractID, "--network", network)
-	
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("contract does not exist or is not accessible on %s: %v, stderr: %s", network, err, stderr.String())
+// sorobanTimeout bounds a full simulate, submit and confirm round trip
+const sorobanTimeout = 90 * time.Second
+
+var (
+	sorobanRPCMu sync.Mutex
+	sorobanRPC   *sorobanrpc.Client
+)
+
+// SorobanRPC returns the RPC client used for contract calls, created from config on first use
+func SorobanRPC() *sorobanrpc.Client {
+	sorobanRPCMu.Lock()
+	defer sorobanRPCMu.Unlock()
+	if sorobanRPC == nil {
+		sorobanRPC = sorobanrpc.NewClient(config.Config.SorobanRPCURL)
+	}
+	return sorobanRPC
+}
+
+// SetSorobanRPC points contract calls at another RPC server, e.g. a sorobanrpc.FakeServer
+func SetSorobanRPC(client *sorobanrpc.Client) {
+	sorobanRPCMu.Lock()
+	defer sorobanRPCMu.Unlock()
+	sorobanRPC = client
+}
+
+// checkContractExists verifies the contract instance exists on the network
+func checkContractExists(ctx context.Context, contractID string) error {
+	key, err := sorobanrpc.ContractInstanceKey(contractID)
+	if err != nil {
+		return err
+	}
+	resp, err := SorobanRPC().GetLedgerEntries(ctx, key)
+	if err != nil {
+		return fmt.Errorf("could not look up contract on %s: %w", config.GetSorobanNetwork(), err)
+	}
+	if len(resp.Entries) == 0 {
+		return fmt.Errorf("contract does not exist on %s", config.GetSorobanNetwork())
 	}
 	return nil
 }
 
-// CallSorobanFunction executes a Soroban contract function
-func CallSorobanFunction(contractID, functionName string, args []string) (string, error) {
+// CallSorobanFunction executes a Soroban contract function. Read-only functions are
+// answered by simulation; state-changing calls are signed by the platform account.
+func CallSorobanFunction(ctx context.Context, contractID, functionName string, args []string) (string, error) {
 	// Validate inputs
 	if err := validateContractID(contractID); err != nil {
 		return "", fmt.Errorf("invalid contract ID: %w", err)
 	}
-	
+
 	if functionName == "" {
 		return "", fmt.Errorf("function name cannot be empty")
 	}
 
+	if !isReadOnlyFunction(functionName) {
+		signer, err := platformSigner()
+		if err != nil {
+			return "", err
+		}
+		return CallSorobanFunctionWithAuth(ctx, contractID, functionName, signer, args)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sorobanTimeout)
+	defer cancel()
+
 	// Check if contract exists
-	if err := checkContractExists(contractID); err != nil {
+	if err := checkContractExists(ctx, contractID); err != nil {
 		return "", fmt.Errorf("contract validation failed: %w", err)
 	}
 
-	network := config.GetSorobanNetwork()
-	sourceAccount := getSourceAccount()
-
-	cmd := []string{
-		"contract", "invoke",
-		"--id", contractID,
-		"--network", network,
-		"--source-account", sourceAccount,
-		"--",
-		functionName,
-	}
-
-	// Convert function arguments to proper format
-	if functionName == "contribute" && len(args) >= 2 {
-		cmd = append(cmd, "--user", args[0], "--amount", args[1])
-	} else if functionName == "get_balance" && len(args) >= 1 {
-		cmd = append(cmd, "--user", args[0])
-	} else if functionName == "withdraw" && len(args) >= 2 {
-		cmd = append(cmd, "--user", args[0], "--amount", args[1])
-	} else if functionName == "get_contribution_history" && len(args) >= 1 {
-		cmd = append(cmd, "--user", args[0])
-	} else {
-		cmd = append(cmd, args...)
-	}
-
-	fmt.Printf("🔧 Executing Soroban command on %s: soroban %s\n", network, strings.Join(cmd, " "))
-	
-	// Execute the command with timeout
-	execCmd := exec.Command("soroban", cmd...)
-	
-	var out bytes.Buffer
-	var stderr bytes.Buffer
-	execCmd.Stdout = &out
-	execCmd.Stderr = &stderr
-	
-	// Set a timeout for the command
-	done := make(chan error, 1)
-	go func() {
-		done <- execCmd.Run()
-	}()
-	
-	select {
-	case err := <-done:
-		if err != nil {
-			fmt.Printf("❌ Soroban command failed: %v\n", err)
-			fmt.Printf("❌ Stderr: %s\n", stderr.String())
-			fmt.Printf("❌ Stdout: %s\n", out.String())
-			return "", fmt.Errorf("soroban invoke failed: %v, stderr: %s", err, stderr.String())
-		}
-	case <-time.After(60 * time.Second): // Increased timeout for mainnet
-		execCmd.Process.Kill()
-		return "", fmt.Errorf("soroban command timed out after 60 seconds")
+	scArgs, err := chamaContractArgs(functionName, args)
+	if err != nil {
+		return "", err
+	}
+	op, err := sorobanrpc.InvokeContractOp(contractID, functionName, scArgs...)
+	if err != nil {
+		return "", err
+	}
+
+	source, err := simulationSource(args)
+	if err != nil {
+		return "", err
+	}
+
+	slog.DebugContext(ctx, "simulating soroban call",
+		"function", functionName, "contract_id", contractID, "network", config.GetSorobanNetwork())
+
+	// Simulation does not check sequence numbers, so the account is not loaded
+	_, sim, err := SorobanRPC().PrepareTransaction(ctx, txnbuild.TransactionParams{
+		SourceAccount:        &txnbuild.SimpleAccount{AccountID: source},
+		IncrementSequenceNum: true,
+		Operations:           []txnbuild.Operation{op},
+		BaseFee:              txnbuild.MinBaseFee,
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewInfiniteTimeout()},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "soroban simulation failed", "function", functionName, "error", err)
+		return "", fmt.Errorf("soroban invoke failed: %w", err)
 	}
-	
-	result := strings.TrimSpace(out.String())
-	fmt.Printf("✅ Soroban result on %s: %s\n", network, result)
-	
+
+	value, err := sim.ReturnValue()
+	if err != nil {
+		return "", err
+	}
+	result := sorobanrpc.FormatScVal(value)
+	slog.InfoContext(ctx, "soroban call simulated", "function", functionName, "result", result)
 
 	return result, nil
 }
 
-// CallSorobanFunctionWithAuth executes a Soroban contract function with user authentication
-func CallSorobanFunctionWithAuth(contractID, functionName, userSecretKey string, args []string) (string, error) {
+// CallSorobanFunctionWithAuth executes a Soroban contract function signed by the given signer
+// and returns the transaction hash. Signing happens in-process so the seed never leaves the keystore.
+func CallSorobanFunctionWithAuth(ctx context.Context, contractID, functionName string, signer keystore.Signer, args []string) (string, error) {
 	// Validate inputs
 	if err := validateContractID(contractID); err != nil {
 		return "", fmt.Errorf("invalid contract ID: %w", err)
 	}
-	
+
 	if functionName == "" {
 		return "", fmt.Errorf("function name cannot be empty")
 	}
-	
-	if userSecretKey == "" {
-		return "", fmt.Errorf("user secret key is required")
+
+	if signer == nil {
+		return "", fmt.Errorf("signer is required")
 	}
 
-	// Check if contract exists
-	if err := checkContractExists(contractID); err != nil {
-		return "", fmt.Errorf("contract validation failed: %w", err)
+	tx, err := buildSorobanInvoke(ctx, contractID, functionName, signer.Address(), args)
+	if err != nil {
+		return "", err
 	}
 
-	keyName := fmt.Sprintf("temp-user-key-%d-%d", os.Getpid(), time.Now().Unix())
-	
-	fmt.Printf("🔑 Adding temporary key: %s\n", keyName)
+	tx, err = signer.SignTransaction(tx)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign soroban transaction: %w", err)
+	}
 
-	// Add user's key temporarily with better error handling
-	addKeyCmd := exec.Command("soroban", "keys", "add", keyName, "--secret-key")
-	addKeyCmd.Stdin = strings.NewReader(userSecretKey)
+	hash, err := SubmitSorobanTx(ctx, tx)
+	if err != nil {
+		slog.ErrorContext(ctx, "soroban invoke submission failed", "function", functionName, "error", err)
+		return "", fmt.Errorf("soroban invoke failed: %w", err)
+	}
 
-	var addKeyStderr bytes.Buffer
-	var addKeyStdout bytes.Buffer
-	addKeyCmd.Stderr = &addKeyStderr
-	addKeyCmd.Stdout = &addKeyStdout
+	slog.InfoContext(ctx, "soroban call submitted",
+		"function", functionName, "source", signer.Address(), "network", config.GetSorobanNetwork(), "tx_hash", hash)
 
-	if err := addKeyCmd.Run(); err != nil {
-		fmt.Printf("❌ Failed to add key: %v\n", err)
-		fmt.Printf("❌ Stderr: %s\n", addKeyStderr.String())
-		fmt.Printf("❌ Stdout: %s\n", addKeyStdout.String())
-		return "", fmt.Errorf("failed to add user key: %v, stderr: %s, stdout: %s", err, addKeyStderr.String(), addKeyStdout.String())
+	return hash, nil
+}
+
+// SubmitSorobanTx sends a signed contract transaction through RPC and waits for it to be applied
+func SubmitSorobanTx(ctx context.Context, tx *txnbuild.Transaction) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, sorobanTimeout)
+	defer cancel()
+
+	resp, err := SorobanRPC().SubmitTransaction(ctx, tx)
+	if err != nil {
+		return "", err
+	}
+	return resp.TxHash, nil
+}
+
+// buildSorobanInvoke simulates an invocation for the given source address and
+// returns the assembled, unsigned transaction
+func buildSorobanInvoke(ctx context.Context, contractID, functionName, source string, args []string) (*txnbuild.Transaction, error) {
+	scArgs, err := chamaContractArgs(functionName, args)
+	if err != nil {
+		return nil, err
+	}
+	op, err := sorobanrpc.InvokeContractOp(contractID, functionName, scArgs...)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.DebugContext(ctx, "simulating soroban call",
+		"function", functionName, "contract_id", contractID, "source", source, "network", config.GetSorobanNetwork())
+
+	return prepareHostFunction(ctx, source, op)
+}
+
+// prepareHostFunction loads the source account and assembles a simulated host function call
+func prepareHostFunction(ctx context.Context, source string, op *txnbuild.InvokeHostFunction) (*txnbuild.Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, sorobanTimeout)
+	defer cancel()
+
+	rpc := SorobanRPC()
+	account, err := rpc.GetAccount(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("could not load source account: %w", err)
+	}
+
+	tx, _, err := rpc.PrepareTransaction(ctx, txnbuild.TransactionParams{
+		SourceAccount:        account,
+		IncrementSequenceNum: true,
+		Operations:           []txnbuild.Operation{op},
+		BaseFee:              txnbuild.MinBaseFee,
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewTimeout(300)}, // 5 minutes to sign
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "soroban simulation failed", "source", source, "error", err)
+		return nil, fmt.Errorf("soroban simulation failed: %w", err)
 	}
-	
-	fmt.Printf("✅ Key added successfully\n")
+	return tx, nil
+}
 
-	// Ensure cleanup
-	defer func() {
-		fmt.Printf("🧹 Cleaning up temporary key: %s\n", keyName)
-		cleanupCmd := exec.Command("soroban", "keys", "rm", keyName)
-		if err := cleanupCmd.Run(); err != nil {
-			fmt.Printf("⚠️ Warning: Failed to cleanup key %s: %v\n", keyName, err)
+// chamaContractArgs converts positional arguments into the typed arguments of the chama contract
+func chamaContractArgs(functionName string, args []string) ([]xdr.ScVal, error) {
+	switch functionName {
+	case "contribute", "withdraw":
+		if len(args) < 2 {
+			return nil, fmt.Errorf("%s needs a user address and an amount", functionName)
 		}
-	}()
-
-	network := config.GetSorobanNetwork()
-
-	// Build command arguments
-	cmdArgs := []string{
-		"contract", "invoke",
-		"--id", contractID,
-		"--source-account", keyName,
-		"--network", network,
-		"--",
-		functionName,
-	}
-
-	// Add function-specific arguments
-	if functionName == "contribute" && len(args) >= 2 {
-		cmdArgs = append(cmdArgs, "--user", args[0], "--amount", args[1])
-	} else if functionName == "get_balance" && len(args) >= 1 {
-		cmdArgs = append(cmdArgs, "--user", args[0])
-	} else if functionName == "withdraw" && len(args) >= 2 {
-		cmdArgs = append(cmdArgs, "--user", args[0], "--amount", args[1])
-	} else if functionName == "get_contribution_history" && len(args) >= 1 {
-		cmdArgs = append(cmdArgs, "--user", args[0])
-	} else {
-		cmdArgs = append(cmdArgs, args...)
-	}
-
-	fmt.Printf("🔧 Executing authenticated Soroban command on %s: soroban %s\n", network, strings.Join(cmdArgs, " "))
-	
-	// Execute the command with timeout
-	cmd := exec.Command("soroban", cmdArgs...)
-
-	var out bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
-
-	// Set a timeout for the command
-	done := make(chan error, 1)
-	go func() {
-		done <- cmd.Run()
-	}()
-	
-	select {
-	case err := <-done:
+		user, err := sorobanrpc.AddressVal(args[0])
 		if err != nil {
-			fmt.Printf("❌ Soroban invoke failed: %v\n", err)
-			fmt.Printf("❌ Stderr: %s\n", stderr.String())
-			fmt.Printf("❌ Stdout: %s\n", out.String())
-			return "", fmt.Errorf("soroban invoke failed: %v, stderr: %s", err, stderr.String())
+			return nil, err
 		}
-	case <-time.After(90 * time.Second): // Increased timeout for mainnet
-		cmd.Process.Kill()
-		return "", fmt.Errorf("soroban command timed out after 90 seconds")
+		amount, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("contract amounts must be whole numbers: %w", err)
+		}
+		return []xdr.ScVal{user, sorobanrpc.I128Val(amount)}, nil
+	case "get_balance", "get_contribution_history":
+		if len(args) < 1 {
+			return nil, fmt.Errorf("%s needs a user address", functionName)
+		}
+		user, err := sorobanrpc.AddressVal(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return []xdr.ScVal{user}, nil
 	}
 
-	result := strings.TrimSpace(out.String())
-	fmt.Printf("✅ Authenticated Soroban result on %s: %s\n", network, result)
-	
-	return result, nil
+	if len(args) > 0 {
+		return nil, fmt.Errorf("unsupported arguments for contract function %s", functionName)
+	}
+	return nil, nil
 }
 
-// getSourceAccount returns the appropriate source account based on network
-func getSourceAccount() string {
-	if config.Config.IsMainnet {
-		// For mainnet, use environment variable or configured account
-		if account := os.Getenv("SOROBAN_PUBLIC_KEY"); account != "" {
-			return account
-		}
-		return "mainnet-account" // This should be configured in soroban keys
+// isReadOnlyFunction reports whether a chama contract function only reads state
+func isReadOnlyFunction(functionName string) bool {
+	switch functionName {
+	case "get_balance", "get_contribution_history", "get_all_contributions", "get_total_pool", "is_initialized", "get_stats":
+		return true
 	}
-	return "malika" // Testnet account
+	return false
 }
+
+// platformSigner returns the signer for the platform account configured in SOROBAN_SECRET_KEY
+func platformSigner() (keystore.Signer, error) {
+	secret := os.Getenv("SOROBAN_SECRET_KEY")
+	if secret == "" {
+		return nil, fmt.Errorf("missing SOROBAN_SECRET_KEY in environment")
+	}
+	return keystore.SignerFromSeed(secret)
+}
+
+// simulationSource picks the account used as source for read-only simulations
+func simulationSource(args []string) (string, error) {
+	if account := os.Getenv("SOROBAN_PUBLIC_KEY"); account != "" {
+		return account, nil
+	}
+	if len(args) > 0 && strings.HasPrefix(args[0], "G") {
+		return args[0], nil
+	}
+	return "", fmt.Errorf("SOROBAN_PUBLIC_KEY is required for read-only contract calls")
+}
+
 // Wrapper functions with improved error handling
-func Contribute(contractID, userAddress, amount string) (string, error) {
-	fmt.Printf("🔄 Contributing %s XLM from %s to contract %s on %s\n", amount, userAddress, contractID, config.Config.Network)
+func Contribute(ctx context.Context, contractID, userAddress, amount string) (string, error) {
+	slog.InfoContext(ctx, "contributing to contract", "contract_id", contractID, "address", userAddress, "amount", amount)
 	args := []string{userAddress, amount}
-	return CallSorobanFunction(contractID, "contribute", args)
+	return CallSorobanFunction(ctx, contractID, "contribute", args)
 }
 
-func GetBalance(contractID, userAddress string) (string, error) {
-	fmt.Printf("🔍 Getting balance for %s from contract %s on %s\n", userAddress, contractID, config.Config.Network)
+func GetBalance(ctx context.Context, contractID, userAddress string) (string, error) {
 	args := []string{userAddress}
-	return CallSorobanFunction(contractID, "get_balance", args)
+	return CallSorobanFunction(ctx, contractID, "get_balance", args)
 }
 
-func Withdraw(contractID, userAddress, amount string) (string, error) {
-	fmt.Printf("💸 Withdrawing %s XLM for %s from contract %s on %s\n", amount, userAddress, contractID, config.Config.Network)
+func Withdraw(ctx context.Context, contractID, userAddress, amount string) (string, error) {
+	slog.InfoContext(ctx, "withdrawing from contract", "contract_id", contractID, "address", userAddress, "amount", amount)
 	args := []string{userAddress, amount}
-	return CallSorobanFunction(contractID, "withdraw", args)
+	return CallSorobanFunction(ctx, contractID, "withdraw", args)
 }
 
-func GetContributionHistory(contractID, userAddress string) (string, error) {
-	fmt.Printf("📊 Getting contribution history for %s from contract %s on %s\n", userAddress, contractID, config.Config.Network)
+func GetContributionHistory(ctx context.Context, contractID, userAddress string) (string, error) {
 	args := []string{userAddress}
-	return CallSorobanFunction(contractID, "get_contribution_history", args)
+	return CallSorobanFunction(ctx, contractID, "get_contribution_history", args)
 }
 
 // ContributeWithAuth - wrapper for authenticated contributions
-func ContributeWithAuth(contractID, userAddress, amount, secretKey string) (string, error) {
-	fmt.Printf("🔐 Making authenticated contribution: %s XLM from %s on %s\n", amount, userAddress, config.Config.Network)
+func ContributeWithAuth(ctx context.Context, contractID, userAddress, amount string, signer keystore.Signer) (string, error) {
+	slog.InfoContext(ctx, "making authenticated contribution", "contract_id", contractID, "address", userAddress, "amount", amount)
 	args := []string{userAddress, amount}
-	return CallSorobanFunctionWithAuth(contractID, "contribute", secretKey, args)
+	return CallSorobanFunctionWithAuth(ctx, contractID, "contribute", signer, args)
 }
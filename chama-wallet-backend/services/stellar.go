@@ -1,10 +1,9 @@
 package services
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
 
 	"github.com/stellar/go/clients/horizonclient"
@@ -13,55 +12,73 @@ import (
 	"github.com/stellar/go/txnbuild"
 
 	"chama-wallet-backend/config"
+	"chama-wallet-backend/keystore"
+	"chama-wallet-backend/ledger"
+	"chama-wallet-backend/logging"
 )
 
-// GetHorizonClient returns the appropriate Horizon client based on network configuration
-func GetHorizonClient() *horizonclient.Client {
-	return config.GetHorizonClient()
+// LedgerFrom returns the ledger carried by ctx, which the server and the jobs set up with
+// ledger.NewContext, falling back to Horizon for the configured network
+func LedgerFrom(ctx context.Context) ledger.Ledger {
+	if l := ledger.FromContext(ctx); l != nil {
+		return l
+	}
+	return ledger.NewHorizon(config.GetHorizonClient())
 }
 
 // CreateWallet generates a new Stellar keypair
 func CreateWallet() (string, string) {
 	kp, err := keypair.Random()
 	if err != nil {
-		log.Fatal(err)
+		logging.Fatal("failed to generate keypair", "error", err)
 	}
 	return kp.Address(), kp.Seed()
 }
 
 // FundWallet funds a wallet using Friendbot (testnet only)
-func FundWallet(address string) error {
+func FundWallet(ctx context.Context, address string) error {
 	if config.Config.IsMainnet {
 		return fmt.Errorf("funding not available on mainnet - use real XLM deposits")
 	}
 
-	url := fmt.Sprintf("https://friendbot.stellar.org/?addr=%s", address)
-	resp, err := http.Get(url)
+	resp, err := LedgerFrom(ctx).Fund(address)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	body, _ := ioutil.ReadAll(resp.Body)
-	fmt.Printf("Friendbot response for %s: %s\n", address, string(body))
+	slog.InfoContext(ctx, "friendbot funded wallet", "address", address, "tx_hash", resp.Hash)
+
 	return nil
 }
 
 // SendXLM transfers XLM from sender to receiver
-func SendXLM(seed, destination, amount string) (horizon.Transaction, error) {
-	client := GetHorizonClient()
+func SendXLM(ctx context.Context, signer keystore.Signer, destination, amount string) (horizon.Transaction, error) {
+	tx, err := SignXLMPayment(ctx, signer, destination, amount)
+	if err != nil {
+		return horizon.Transaction{}, err
+	}
 
-	// Load source account
-	kp, err := keypair.ParseFull(seed)
+	txeBase64, err := tx.Base64()
 	if err != nil {
 		return horizon.Transaction{}, err
 	}
 
-	ar := horizonclient.AccountRequest{AccountID: kp.Address()}
-	sourceAccount, err := client.AccountDetail(ar)
+	resp, err := LedgerFrom(ctx).SubmitTransactionXDR(txeBase64)
 	if err != nil {
 		return horizon.Transaction{}, err
 	}
 
+	return resp, nil
+}
+
+// SignXLMPayment builds and signs an XLM payment from the signer's account without submitting it
+func SignXLMPayment(ctx context.Context, signer keystore.Signer, destination, amount string) (*txnbuild.Transaction, error) {
+	// Load source account
+	ar := horizonclient.AccountRequest{AccountID: signer.Address()}
+	sourceAccount, err := LedgerFrom(ctx).AccountDetail(ar)
+	if err != nil {
+		return nil, err
+	}
+
 	// Build the transaction
 	op := txnbuild.Payment{
 		Destination: destination,
@@ -86,29 +103,14 @@ func SendXLM(seed, destination, amount string) (horizon.Transaction, error) {
 		},
 	)
 	if err != nil {
-		return horizon.Transaction{}, err
+		return nil, err
 	}
 
-	tx, err = tx.Sign(config.GetNetworkPassphrase(), kp)
-	if err != nil {
-		return horizon.Transaction{}, err
-	}
-
-	txeBase64, err := tx.Base64()
-	if err != nil {
-		return horizon.Transaction{}, err
-	}
-
-	resp, err := client.SubmitTransactionXDR(txeBase64)
-	if err != nil {
-		return horizon.Transaction{}, err
-	}
-
-	return resp, nil
+	return signer.SignTransaction(tx)
 }
 
 // SendUSDC transfers USDC from sender to receiver (mainnet only)
-func SendUSDC(seed, destination, amount string) (horizon.Transaction, error) {
+func SendUSDC(ctx context.Context, signer keystore.Signer, destination, amount string) (horizon.Transaction, error) {
 	if !config.Config.IsMainnet {
 		return horizon.Transaction{}, fmt.Errorf("USDC transfers only available on mainnet")
 	}
@@ -117,15 +119,10 @@ func SendUSDC(seed, destination, amount string) (horizon.Transaction, error) {
 		return horizon.Transaction{}, fmt.Errorf("USDC asset configuration missing")
 	}
 
-	client := GetHorizonClient()
+	client := LedgerFrom(ctx)
 
 	// Load source account
-	kp, err := keypair.ParseFull(seed)
-	if err != nil {
-		return horizon.Transaction{}, err
-	}
-
-	ar := horizonclient.AccountRequest{AccountID: kp.Address()}
+	ar := horizonclient.AccountRequest{AccountID: signer.Address()}
 	sourceAccount, err := client.AccountDetail(ar)
 	if err != nil {
 		return horizon.Transaction{}, err
@@ -160,7 +157,7 @@ func SendUSDC(seed, destination, amount string) (horizon.Transaction, error) {
 		return horizon.Transaction{}, err
 	}
 
-	tx, err = tx.Sign(config.GetNetworkPassphrase(), kp)
+	tx, err = signer.SignTransaction(tx)
 	if err != nil {
 		return horizon.Transaction{}, err
 	}
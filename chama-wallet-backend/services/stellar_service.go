@@ -1,23 +1,20 @@
 package services
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 
 	"github.com/stellar/go/clients/horizonclient"
-	"github.com/stellar/go/keypair"
 	"github.com/stellar/go/txnbuild"
 
 	"chama-wallet-backend/config"
+	"chama-wallet-backend/keystore"
 )
 
-func SendPayment(fromSecret, toAddress, amount string) error {
-	senderKP, err := keypair.ParseFull(fromSecret)
-	if err != nil {
-		return fmt.Errorf("invalid secret key: %w", err)
-	}
-
-	client := config.GetHorizonClient()
-	ar := horizonclient.AccountRequest{AccountID: senderKP.Address()}
+func SendPayment(ctx context.Context, signer keystore.Signer, toAddress, amount string) error {
+	client := LedgerFrom(ctx)
+	ar := horizonclient.AccountRequest{AccountID: signer.Address()}
 	sourceAccount, err := client.AccountDetail(ar)
 	if err != nil {
 		return fmt.Errorf("could not load source account: %w", err)
@@ -51,16 +48,17 @@ func SendPayment(fromSecret, toAddress, amount string) error {
 		return fmt.Errorf("cannot build tx: %w", err)
 	}
 
-	tx, err = tx.Sign(config.GetNetworkPassphrase(), senderKP)
+	tx, err = signer.SignTransaction(tx)
 	if err != nil {
 		return fmt.Errorf("cannot sign tx: %w", err)
 	}
 
-	_, err = client.SubmitTransaction(tx)
+	resp, err := client.SubmitTransaction(tx)
 	if err != nil {
 		return fmt.Errorf("tx failed: %w", err)
 	}
 
-	fmt.Printf("✅ Payment sent on %s network\n", config.Config.Network)
+	slog.InfoContext(ctx, "payment sent", "network", config.Config.Network, "tx_hash", resp.Hash)
+
 	return nil
 }
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/txnbuild"
+
+	"chama-wallet-backend/config"
+	"chama-wallet-backend/ledger"
+)
+
+// SubmissionState is what is known about a transaction after trying to submit it
+type SubmissionState string
+
+const (
+	// SubmissionConfirmed means the transaction is in the ledger and succeeded
+	SubmissionConfirmed SubmissionState = "confirmed"
+	// SubmissionRejected means the transaction failed or was refused and will never apply
+	SubmissionRejected SubmissionState = "rejected"
+	// SubmissionUnknown means the outcome could not be determined, e.g. after a timeout.
+	// The same envelope can safely be submitted again.
+	SubmissionUnknown SubmissionState = "unknown"
+)
+
+// EnvelopeHash returns the signed envelope and the hash a transaction will have on the network.
+// Callers record both before submitting so a retry can find or resend the same transaction.
+func EnvelopeHash(tx *txnbuild.Transaction) (string, string, error) {
+	envelope, err := tx.Base64()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode transaction: %w", err)
+	}
+	hash, err := tx.HashHex(config.GetNetworkPassphrase())
+	if err != nil {
+		return "", "", fmt.Errorf("failed to hash transaction: %w", err)
+	}
+	return envelope, hash, nil
+}
+
+// SubmitOnce makes sure the envelope with the given hash is applied at most once. It looks
+// the hash up first and only submits the envelope when the network has not seen it.
+func SubmitOnce(ctx context.Context, envelopeXDR, txHash string) (horizon.Transaction, SubmissionState, error) {
+	client := LedgerFrom(ctx)
+
+	existing, err := client.TransactionDetail(txHash)
+	if err == nil {
+		if existing.Successful {
+			return existing, SubmissionConfirmed, nil
+		}
+		return existing, SubmissionRejected, fmt.Errorf("transaction %s failed on the ledger", txHash)
+	}
+	if !ledger.IsNotFound(err) {
+		return horizon.Transaction{}, SubmissionUnknown, fmt.Errorf("failed to look up transaction %s: %w", txHash, err)
+	}
+
+	resp, err := client.SubmitTransactionXDR(envelopeXDR)
+	if err == nil {
+		slog.InfoContext(ctx, "transaction submitted", "network", config.Config.Network, "tx_hash", resp.Hash)
+		return resp, SubmissionConfirmed, nil
+	}
+
+	// Result codes mean the network refused or failed the transaction. Anything else
+	// (timeouts, 5xx) leaves it in flight.
+	if codes := ledger.ResultCodes(err); codes != nil {
+		return horizon.Transaction{}, SubmissionRejected, fmt.Errorf("transaction submission failed (%s %v): %w", codes.TransactionCode, codes.OperationCodes, err)
+	}
+	return horizon.Transaction{}, SubmissionUnknown, fmt.Errorf("transaction submission failed: %w", err)
+}
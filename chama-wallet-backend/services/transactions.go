@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+
+	"chama-wallet-backend/config"
+)
+
+// PaymentExpectation describes the payment a client-signed envelope must contain
+type PaymentExpectation struct {
+	Source      string
+	Destination string
+	Amount      string
+	Asset       txnbuild.Asset
+	Memo        string
+}
+
+// SorobanExpectation describes the contract call a client-signed envelope must contain
+type SorobanExpectation struct {
+	Source     string
+	ContractID string
+	Function   string
+	User       string
+	Amount     string
+}
+
+// BuildPaymentTx builds an unsigned payment from source to destination for the client to sign
+func BuildPaymentTx(ctx context.Context, expected PaymentExpectation) (*txnbuild.Transaction, error) {
+	client := LedgerFrom(ctx)
+	sourceAccount, err := client.AccountDetail(horizonclient.AccountRequest{AccountID: expected.Source})
+	if err != nil {
+		return nil, fmt.Errorf("could not load source account: %w", err)
+	}
+
+	asset := expected.Asset
+	if asset == nil {
+		asset = txnbuild.NativeAsset{}
+	}
+
+	var memo txnbuild.Memo
+	if expected.Memo != "" {
+		memo = txnbuild.MemoText(expected.Memo)
+	}
+
+	return txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        &sourceAccount,
+		IncrementSequenceNum: true,
+		Operations: []txnbuild.Operation{&txnbuild.Payment{
+			Destination: expected.Destination,
+			Amount:      expected.Amount,
+			Asset:       asset,
+		}},
+		BaseFee:       txnbuild.MinBaseFee,
+		Memo:          memo,
+		Preconditions: txnbuild.Preconditions{TimeBounds: txnbuild.NewTimeout(300)}, // 5 minutes to sign
+	})
+}
+
+// BuildSorobanInvokeTx builds an unsigned, simulated contract call for the client to sign
+func BuildSorobanInvokeTx(ctx context.Context, expected SorobanExpectation) (*txnbuild.Transaction, error) {
+	if err := validateContractID(expected.ContractID); err != nil {
+		return nil, fmt.Errorf("invalid contract ID: %w", err)
+	}
+	return buildSorobanInvoke(ctx, expected.ContractID, expected.Function, expected.Source, []string{expected.User, expected.Amount})
+}
+
+// VerifySignedPayment parses a client-signed envelope and checks it is exactly the expected payment
+func VerifySignedPayment(signedXDR string, expected PaymentExpectation) (*txnbuild.Transaction, error) {
+	tx, err := parseSignedTx(signedXDR, expected.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := tx.Operations()
+	if len(ops) != 1 {
+		return nil, fmt.Errorf("expected exactly one operation, got %d", len(ops))
+	}
+	payment, ok := ops[0].(*txnbuild.Payment)
+	if !ok {
+		return nil, errors.New("operation is not a payment")
+	}
+	if payment.SourceAccount != "" && payment.SourceAccount != expected.Source {
+		return nil, errors.New("payment operation has a different source account")
+	}
+	if payment.Destination != expected.Destination {
+		return nil, fmt.Errorf("payment destination %s does not match %s", payment.Destination, expected.Destination)
+	}
+
+	gotAmount, err := amount.ParseInt64(payment.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payment amount: %w", err)
+	}
+	wantAmount, err := amount.ParseInt64(expected.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expected amount: %w", err)
+	}
+	if gotAmount != wantAmount {
+		return nil, fmt.Errorf("payment amount %s does not match %s", payment.Amount, expected.Amount)
+	}
+
+	asset := expected.Asset
+	if asset == nil {
+		asset = txnbuild.NativeAsset{}
+	}
+	if payment.Asset == nil || payment.Asset.GetCode() != asset.GetCode() || payment.Asset.GetIssuer() != asset.GetIssuer() {
+		return nil, errors.New("payment asset does not match")
+	}
+
+	if expected.Memo != "" {
+		memo, ok := tx.Memo().(txnbuild.MemoText)
+		if !ok || string(memo) != expected.Memo {
+			return nil, fmt.Errorf("transaction memo must be %q", expected.Memo)
+		}
+	}
+
+	return tx, nil
+}
+
+// VerifySignedSorobanInvoke parses a client-signed envelope and checks it is exactly the expected contract call
+func VerifySignedSorobanInvoke(signedXDR string, expected SorobanExpectation) (*txnbuild.Transaction, error) {
+	tx, err := parseSignedTx(signedXDR, expected.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := tx.Operations()
+	if len(ops) != 1 {
+		return nil, fmt.Errorf("expected exactly one operation, got %d", len(ops))
+	}
+	invoke, ok := ops[0].(*txnbuild.InvokeHostFunction)
+	if !ok || invoke.HostFunction.Type != xdr.HostFunctionTypeHostFunctionTypeInvokeContract {
+		return nil, errors.New("operation is not a contract invocation")
+	}
+	call := invoke.HostFunction.InvokeContract
+
+	contractID, err := call.ContractAddress.String()
+	if err != nil || contractID != expected.ContractID {
+		return nil, fmt.Errorf("transaction does not call contract %s", expected.ContractID)
+	}
+	if string(call.FunctionName) != expected.Function {
+		return nil, fmt.Errorf("transaction calls %s instead of %s", call.FunctionName, expected.Function)
+	}
+	if len(call.Args) != 2 {
+		return nil, fmt.Errorf("expected 2 contract arguments, got %d", len(call.Args))
+	}
+
+	user, ok := call.Args[0].GetAddress()
+	if !ok {
+		return nil, errors.New("first contract argument must be the user address")
+	}
+	if userAddress, err := user.String(); err != nil || userAddress != expected.User {
+		return nil, fmt.Errorf("contract call is not for user %s", expected.User)
+	}
+
+	wantAmount, err := strconv.ParseUint(expected.Amount, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("contract amounts must be whole numbers: %w", err)
+	}
+	gotAmount, ok := call.Args[1].GetI128()
+	if !ok || gotAmount.Hi != 0 || uint64(gotAmount.Lo) != wantAmount {
+		return nil, fmt.Errorf("contract call amount does not match %s", expected.Amount)
+	}
+
+	return tx, nil
+}
+
+// SubmitSignedTx submits a verified client-signed transaction to Horizon
+func SubmitSignedTx(ctx context.Context, tx *txnbuild.Transaction) (horizon.Transaction, error) {
+	resp, err := LedgerFrom(ctx).SubmitTransaction(tx)
+	if err != nil {
+		return horizon.Transaction{}, fmt.Errorf("transaction submission failed: %w", err)
+	}
+	slog.InfoContext(ctx, "client-signed transaction submitted", "network", config.Config.Network, "tx_hash", resp.Hash)
+
+	return resp, nil
+}
+
+// parseSignedTx decodes an envelope and checks it comes from, and is signed by, the source account
+func parseSignedTx(signedXDR, source string) (*txnbuild.Transaction, error) {
+	if signedXDR == "" {
+		return nil, errors.New("signed transaction XDR is required")
+	}
+
+	generic, err := txnbuild.TransactionFromXDR(signedXDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction XDR: %w", err)
+	}
+	tx, ok := generic.Transaction()
+	if !ok {
+		return nil, errors.New("fee bump transactions are not accepted")
+	}
+
+	if tx.SourceAccount().AccountID != source {
+		return nil, fmt.Errorf("transaction source %s does not match %s", tx.SourceAccount().AccountID, source)
+	}
+
+	if err := verifySignedBy(tx, source); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// verifySignedBy checks that one of the envelope signatures belongs to address
+func verifySignedBy(tx *txnbuild.Transaction, address string) error {
+	kp, err := keypair.ParseAddress(address)
+	if err != nil {
+		return fmt.Errorf("invalid account address: %w", err)
+	}
+
+	hash, err := tx.Hash(config.GetNetworkPassphrase())
+	if err != nil {
+		return fmt.Errorf("failed to hash transaction: %w", err)
+	}
+
+	hint := kp.Hint()
+	for _, sig := range tx.Signatures() {
+		if sig.Hint != xdr.SignatureHint(hint) {
+			continue
+		}
+		if kp.Verify(hash[:], sig.Signature) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("transaction is not signed by %s", address)
+}
+
+// ContributionMemo derives the memo text that ties an on-chain payment to a contribution record.
+// Memo text is limited to 28 bytes, so only part of the ID is used.
+func ContributionMemo(contributionID string) string {
+	return "chama " + strings.ReplaceAll(contributionID, "-", "")[:20]
+}
@@ -0,0 +1,397 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+
+	"chama-wallet-backend/config"
+	"chama-wallet-backend/keystore"
+	"chama-wallet-backend/ledger"
+	"chama-wallet-backend/models"
+)
+
+// payoutEnvelopeTTL is how long admins have to collect signatures on a payout
+const payoutEnvelopeTTL = 7 * 24 * 60 * 60
+
+// SetupGroupMultisig turns the group wallet into a multisig account. Every signer gets
+// weight 1, the master key is weighted to zero and the thresholds are applied.
+// Signed once with the group's master key, which is useless afterwards.
+func SetupGroupMultisig(ctx context.Context, group models.Group, signers []string, payoutThreshold, signerThreshold int) (string, error) {
+	if len(signers) == 0 {
+		return "", errors.New("multisig treasury needs at least one signer")
+	}
+	if payoutThreshold < 1 || payoutThreshold > len(signers) {
+		return "", fmt.Errorf("payout threshold must be between 1 and %d", len(signers))
+	}
+	if signerThreshold < payoutThreshold || signerThreshold > len(signers) {
+		return "", fmt.Errorf("signer threshold must be between %d and %d", payoutThreshold, len(signers))
+	}
+	client := LedgerFrom(ctx)
+	account, err := client.AccountDetail(horizonclient.AccountRequest{AccountID: group.Wallet})
+	if err != nil {
+		return "", fmt.Errorf("could not load group account: %w", err)
+	}
+
+	// A retried activation finds the treasury already set up
+	if treasuryConfigured(account, signers, payoutThreshold, signerThreshold) {
+		slog.InfoContext(ctx, "group treasury already multisig",
+			"group_id", group.ID, "threshold", payoutThreshold, "signers", len(signers))
+		return "", nil
+	}
+
+	if group.SecretKey == "" {
+		return "", errors.New("group master key not available")
+	}
+
+	masterSigner, err := keystore.Default.Signer(group.SecretKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to load group master key: %w", err)
+	}
+
+	var ops []txnbuild.Operation
+	for _, address := range signers {
+		if _, err := keypair.ParseAddress(address); err != nil {
+			return "", fmt.Errorf("invalid signer address %q: %w", address, err)
+		}
+		ops = append(ops, &txnbuild.SetOptions{
+			Signer: &txnbuild.Signer{Address: address, Weight: 1},
+		})
+	}
+	ops = append(ops, &txnbuild.SetOptions{
+		MasterWeight:    txnbuild.NewThreshold(0),
+		LowThreshold:    txnbuild.NewThreshold(1),
+		MediumThreshold: txnbuild.NewThreshold(txnbuild.Threshold(payoutThreshold)),
+		HighThreshold:   txnbuild.NewThreshold(txnbuild.Threshold(signerThreshold)),
+	})
+
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        &account,
+		IncrementSequenceNum: true,
+		Operations:           ops,
+		BaseFee:              txnbuild.MinBaseFee,
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewTimeout(300)},
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot build multisig setup: %w", err)
+	}
+
+	tx, err = masterSigner.SignTransaction(tx)
+	if err != nil {
+		return "", fmt.Errorf("cannot sign multisig setup: %w", err)
+	}
+
+	resp, err := client.SubmitTransaction(tx)
+	if err != nil {
+		return "", fmt.Errorf("multisig setup failed: %w", err)
+	}
+
+	slog.InfoContext(ctx, "group treasury is now multisig",
+		"group_id", group.ID, "threshold", payoutThreshold, "signers", len(signers), "tx_hash", resp.Hash)
+
+	return resp.Hash, nil
+}
+
+// ErrSignersUnavailable means too few treasury signers have a custodial key to sign a
+// change of the treasury's signers
+var ErrSignersUnavailable = errors.New("too few treasury signers have a custodial key to change the signers")
+
+// UpdateTreasurySigners changes a multisig treasury's signers to signers, each with
+// weight 1, and applies the group's thresholds again. Changing signers needs the signer
+// threshold, so the transaction is signed with the custodial keys of current signers;
+// keys maps their addresses to sealed secret keys.
+func UpdateTreasurySigners(ctx context.Context, group models.Group, signers []string, keys map[string]string) (string, error) {
+	if group.PayoutThreshold > len(signers) || group.SignerThreshold > len(signers) {
+		return "", fmt.Errorf("thresholds %d and %d need at least that many signers", group.PayoutThreshold, group.SignerThreshold)
+	}
+	client := LedgerFrom(ctx)
+	account, err := client.AccountDetail(horizonclient.AccountRequest{AccountID: group.Wallet})
+	if err != nil {
+		return "", fmt.Errorf("could not load group account: %w", err)
+	}
+
+	// A retried change finds the treasury already updated
+	if treasuryConfigured(account, signers, group.PayoutThreshold, group.SignerThreshold) {
+		return "", nil
+	}
+
+	keep := map[string]bool{}
+	var ops []txnbuild.Operation
+	for _, address := range signers {
+		if _, err := keypair.ParseAddress(address); err != nil {
+			return "", fmt.Errorf("invalid signer address %q: %w", address, err)
+		}
+		keep[address] = true
+		ops = append(ops, &txnbuild.SetOptions{
+			Signer: &txnbuild.Signer{Address: address, Weight: 1},
+		})
+	}
+	for _, signer := range account.Signers {
+		if signer.Key != account.AccountID && !keep[signer.Key] {
+			ops = append(ops, &txnbuild.SetOptions{
+				Signer: &txnbuild.Signer{Address: signer.Key, Weight: 0},
+			})
+		}
+	}
+	ops = append(ops, &txnbuild.SetOptions{
+		MasterWeight:    txnbuild.NewThreshold(0),
+		LowThreshold:    txnbuild.NewThreshold(1),
+		MediumThreshold: txnbuild.NewThreshold(txnbuild.Threshold(group.PayoutThreshold)),
+		HighThreshold:   txnbuild.NewThreshold(txnbuild.Threshold(group.SignerThreshold)),
+	})
+
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        &account,
+		IncrementSequenceNum: true,
+		Operations:           ops,
+		BaseFee:              txnbuild.MinBaseFee,
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewTimeout(300)},
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot build signer change: %w", err)
+	}
+
+	signed := 0
+	for _, address := range GroupTreasurySigners(group) {
+		if signed >= group.SignerThreshold {
+			break
+		}
+		signer, err := keystore.Default.Signer(keys[address])
+		if err != nil || signer.Address() != address {
+			continue
+		}
+		if tx, err = signer.SignTransaction(tx); err != nil {
+			return "", fmt.Errorf("cannot sign signer change: %w", err)
+		}
+		signed++
+	}
+	if signed < group.SignerThreshold {
+		return "", ErrSignersUnavailable
+	}
+
+	resp, err := client.SubmitTransaction(tx)
+	if err != nil {
+		return "", fmt.Errorf("signer change failed: %w", err)
+	}
+
+	slog.InfoContext(ctx, "group treasury signers changed",
+		"group_id", group.ID, "signers", len(signers), "tx_hash", resp.Hash)
+	return resp.Hash, nil
+}
+
+// treasuryConfigured reports whether the account already has exactly the given signers
+// and thresholds with its master key disabled
+func treasuryConfigured(account horizon.Account, signers []string, payoutThreshold, signerThreshold int) bool {
+	if int(account.Thresholds.MedThreshold) != payoutThreshold || int(account.Thresholds.HighThreshold) != signerThreshold {
+		return false
+	}
+	weights := map[string]int32{}
+	for _, signer := range account.Signers {
+		if signer.Key == account.AccountID {
+			if signer.Weight != 0 {
+				return false
+			}
+			continue
+		}
+		weights[signer.Key] = signer.Weight
+	}
+	if len(weights) != len(signers) {
+		return false
+	}
+	for _, address := range signers {
+		if weights[address] != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// GroupTreasurySigners returns the signer addresses recorded for a multisig group
+func GroupTreasurySigners(group models.Group) []string {
+	var signers []string
+	if group.TreasurySigners != "" {
+		json.Unmarshal([]byte(group.TreasurySigners), &signers)
+	}
+	return signers
+}
+
+// IsTreasurySigner reports whether address is one of the group's treasury signers
+func IsTreasurySigner(group models.Group, address string) bool {
+	for _, signer := range GroupTreasurySigners(group) {
+		if signer == address {
+			return true
+		}
+	}
+	return false
+}
+
+// GroupPayment is one payment out of the group wallet
+type GroupPayment struct {
+	Destination string
+	Amount      string
+}
+
+// BuildGroupPayoutTx builds the unsigned payout envelope that treasury signers approve
+func BuildGroupPayoutTx(ctx context.Context, group models.Group, destination, amount string) (string, error) {
+	return BuildGroupBatchPayoutTx(ctx, group, []GroupPayment{{Destination: destination, Amount: amount}})
+}
+
+// BuildGroupBatchPayoutTx builds one unsigned envelope making all the payments, at the
+// group wallet's next sequence number
+func BuildGroupBatchPayoutTx(ctx context.Context, group models.Group, payments []GroupPayment) (string, error) {
+	account, err := LedgerFrom(ctx).AccountDetail(horizonclient.AccountRequest{AccountID: group.Wallet})
+	if err != nil {
+		return "", fmt.Errorf("could not load group account: %w", err)
+	}
+
+	var operations []txnbuild.Operation
+	for _, payment := range payments {
+		operations = append(operations, &txnbuild.Payment{
+			Destination: payment.Destination,
+			Amount:      payment.Amount,
+			Asset:       txnbuild.NativeAsset{},
+		})
+	}
+	return buildPayoutEnvelope(&account, operations)
+}
+
+// RefreshPayoutEnvelope rebuilds a payout envelope that can no longer apply: another
+// transaction from the group wallet has used its sequence number, or its time bounds
+// have passed. The new envelope makes the same payments from the wallet's next sequence
+// number. It reports whether the envelope was rebuilt; signatures on the old one are void.
+func RefreshPayoutEnvelope(ctx context.Context, group models.Group, envelopeXDR string) (string, bool, error) {
+	tx, err := parseEnvelope(envelopeXDR)
+	if err != nil {
+		return "", false, err
+	}
+	account, err := LedgerFrom(ctx).AccountDetail(horizonclient.AccountRequest{AccountID: group.Wallet})
+	if err != nil {
+		return "", false, fmt.Errorf("could not load group account: %w", err)
+	}
+
+	bounds := tx.Timebounds()
+	expired := bounds.MaxTime != 0 && time.Now().Unix() >= bounds.MaxTime
+	if tx.SequenceNumber() == account.Sequence+1 && !expired {
+		return envelopeXDR, false, nil
+	}
+
+	envelope, err := buildPayoutEnvelope(&account, tx.Operations())
+	if err != nil {
+		return "", false, err
+	}
+	return envelope, true, nil
+}
+
+// buildPayoutEnvelope builds an unsigned payout from the group account at its next
+// sequence number, valid for payoutEnvelopeTTL
+func buildPayoutEnvelope(account *horizon.Account, operations []txnbuild.Operation) (string, error) {
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        account,
+		IncrementSequenceNum: true,
+		Operations:           operations,
+		BaseFee:              txnbuild.MinBaseFee,
+		Memo:                 txnbuild.MemoText("Chama Payout"),
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewTimeout(payoutEnvelopeTTL)},
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot build payout: %w", err)
+	}
+	return tx.Base64()
+}
+
+// staleSequence reports whether a submission was refused because the transaction's
+// sequence number had been used, or its time bounds had passed, before it arrived
+func staleSequence(err error) bool {
+	codes := ledger.ResultCodes(err)
+	return codes != nil && (codes.TransactionCode == "tx_bad_seq" || codes.TransactionCode == "tx_too_late")
+}
+
+// SignPayoutEnvelope produces one signer's base64 decorated signature for a payout envelope
+func SignPayoutEnvelope(envelopeXDR string, signer keystore.Signer) (string, error) {
+	tx, err := parseEnvelope(envelopeXDR)
+	if err != nil {
+		return "", err
+	}
+
+	signed, err := signer.SignTransaction(tx)
+	if err != nil {
+		return "", fmt.Errorf("cannot sign payout: %w", err)
+	}
+	signatures := signed.Signatures()
+	return xdr.MarshalBase64(signatures[len(signatures)-1])
+}
+
+// ExtractPayoutSignature pulls address's signature out of a client-signed copy of the payout envelope
+func ExtractPayoutSignature(envelopeXDR, signedXDR, address string) (string, error) {
+	original, err := parseEnvelope(envelopeXDR)
+	if err != nil {
+		return "", err
+	}
+	signed, err := parseEnvelope(signedXDR)
+	if err != nil {
+		return "", err
+	}
+
+	originalHash, err := original.Hash(config.GetNetworkPassphrase())
+	if err != nil {
+		return "", err
+	}
+	signedHash, err := signed.Hash(config.GetNetworkPassphrase())
+	if err != nil {
+		return "", err
+	}
+	if originalHash != signedHash {
+		return "", errors.New("signed envelope is not the payout that was requested")
+	}
+
+	kp, err := keypair.ParseAddress(address)
+	if err != nil {
+		return "", fmt.Errorf("invalid signer address: %w", err)
+	}
+	for _, sig := range signed.Signatures() {
+		if sig.Hint == xdr.SignatureHint(kp.Hint()) && kp.Verify(signedHash[:], sig.Signature) == nil {
+			return xdr.MarshalBase64(sig)
+		}
+	}
+	return "", fmt.Errorf("envelope is not signed by %s", address)
+}
+
+// AssembleGroupPayout attaches the collected signatures to the payout envelope
+func AssembleGroupPayout(envelopeXDR string, signatures []string) (*txnbuild.Transaction, error) {
+	tx, err := parseEnvelope(envelopeXDR)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, encoded := range signatures {
+		var sig xdr.DecoratedSignature
+		if err := xdr.SafeUnmarshalBase64(encoded, &sig); err != nil {
+			return nil, fmt.Errorf("invalid stored signature: %w", err)
+		}
+		if tx, err = tx.AddSignatureDecorated(sig); err != nil {
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+func parseEnvelope(envelopeXDR string) (*txnbuild.Transaction, error) {
+	generic, err := txnbuild.TransactionFromXDR(envelopeXDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction XDR: %w", err)
+	}
+	tx, ok := generic.Transaction()
+	if !ok {
+		return nil, errors.New("fee bump transactions are not accepted")
+	}
+	return tx, nil
+}
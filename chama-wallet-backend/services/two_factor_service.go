@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"chama-wallet-backend/config"
+	"chama-wallet-backend/keystore"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
+	"chama-wallet-backend/totp"
+)
+
+// recoveryCodeCount is how many recovery codes a user gets at a time
+const recoveryCodeCount = 10
+
+// TOTPEnrollment is the secret to load into an authenticator app
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"` // render as a QR code
+}
+
+// TwoFactorStatus describes a user's second factor
+type TwoFactorStatus struct {
+	Enabled           bool       `json:"enabled"`
+	EnabledAt         *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesLeft int64      `json:"recovery_codes_left"`
+}
+
+// GetTwoFactorStatus reports whether the user has TOTP enabled
+func GetTwoFactorStatus(user models.User) (TwoFactorStatus, error) {
+	status := TwoFactorStatus{Enabled: user.TOTPEnabledAt != nil, EnabledAt: user.TOTPEnabledAt}
+	if !status.Enabled {
+		return status, nil
+	}
+	left, err := repository.Default.Users.CountRecoveryCodes(user.ID)
+	status.RecoveryCodesLeft = left
+	return status, err
+}
+
+// BeginTOTPEnrollment generates a TOTP secret for the user. It takes effect once
+// ConfirmTOTPEnrollment sees a code from it; until then a new call replaces it.
+func BeginTOTPEnrollment(user models.User) (TOTPEnrollment, error) {
+	if user.TOTPEnabledAt != nil {
+		return TOTPEnrollment{}, opError(ErrConflict, "Two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	sealed, err := keystore.Default.SealValue(secret)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	user.TOTPSecret = sealed
+	user.TOTPLastStep = 0
+	if err := repository.Default.Users.Save(&user); err != nil {
+		return TOTPEnrollment{}, err
+	}
+
+	return TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(config.Auth.TOTPIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTPEnrollment turns TOTP on once the user proves their app has the secret, and
+// returns their recovery codes. The codes are shown this once.
+func ConfirmTOTPEnrollment(ctx context.Context, user models.User, code string) ([]string, error) {
+	if user.TOTPEnabledAt != nil {
+		return nil, opError(ErrConflict, "Two-factor authentication is already enabled")
+	}
+	if user.TOTPSecret == "" {
+		return nil, opError(ErrInvalid, "Start enrolment first")
+	}
+	ok, err := checkTOTP(user, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, opError(ErrInvalid, "Invalid authentication code")
+	}
+
+	now := time.Now()
+	user, err = repository.Default.Users.ByID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPEnabledAt = &now
+	if err := repository.Default.Users.Save(&user); err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "two-factor authentication enabled", "user_id", user.ID)
+	return newRecoveryCodes(user.ID)
+}
+
+// DisableTOTP turns TOTP off after checking a current code or a recovery code
+func DisableTOTP(ctx context.Context, user models.User, code string) error {
+	if err := verifySecondFactor(ctx, user, code); err != nil {
+		return err
+	}
+
+	user, err := repository.Default.Users.ByID(user.ID)
+	if err != nil {
+		return err
+	}
+	user.TOTPSecret = ""
+	user.TOTPEnabledAt = nil
+	user.TOTPLastStep = 0
+	if err := repository.Default.Users.Save(&user); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "two-factor authentication disabled", "user_id", user.ID)
+	return repository.Default.Users.ReplaceRecoveryCodes(user.ID, nil)
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking a second factor
+func RegenerateRecoveryCodes(ctx context.Context, user models.User, code string) ([]string, error) {
+	if err := verifySecondFactor(ctx, user, code); err != nil {
+		return nil, err
+	}
+	return newRecoveryCodes(user.ID)
+}
+
+// StepUp checks a second factor and marks the session as freshly verified. Sensitive
+// actions are allowed on it until the returned time.
+func StepUp(ctx context.Context, user models.User, sessionID, code string) (time.Time, error) {
+	if err := verifySecondFactor(ctx, user, code); err != nil {
+		return time.Time{}, err
+	}
+	now := time.Now()
+	if err := repository.Default.Sessions.StepUp(sessionID, now); err != nil {
+		return time.Time{}, err
+	}
+	return now.Add(config.Auth.StepUpTTL), nil
+}
+
+// RequireStepUp checks that a sensitive action may go ahead on the session. For a group
+// action the group decides whether a second factor is needed; for the user's own wallet
+// it is needed once they have enrolled, or if any of their groups requires it.
+func RequireStepUp(user models.User, sessionID, groupID string) error {
+	var required bool
+	if groupID != "" {
+		group, err := repository.Default.Groups.ByID(groupID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return opError(ErrNotFound, "Group not found")
+		}
+		if err != nil {
+			return err
+		}
+		required = group.RequireStepUp
+	} else {
+		required = user.TOTPEnabledAt != nil
+		if !required {
+			inGroup, err := repository.Default.Groups.RequiresStepUp(user.ID)
+			if err != nil {
+				return err
+			}
+			required = inGroup
+		}
+	}
+
+	if !required {
+		return nil
+	}
+	return freshStepUp(user, sessionID)
+}
+
+// SetGroupStepUp turns the step-up requirement on or off for a group. Either way the
+// admin making the change must have just passed a second-factor check.
+func SetGroupStepUp(ctx context.Context, groupID string, user models.User, sessionID string, require bool) error {
+	if err := freshStepUp(user, sessionID); err != nil {
+		return err
+	}
+	if err := repository.Default.Groups.Update(groupID, map[string]interface{}{"require_step_up": require}); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "group step-up requirement set", "group_id", groupID, "require", require)
+	return nil
+}
+
+// freshStepUp checks the session passed a second-factor check within the step-up window
+func freshStepUp(user models.User, sessionID string) error {
+	if user.TOTPEnabledAt == nil {
+		return opError(ErrStepUpRequired, "This action requires two-factor authentication, enable it first")
+	}
+	session, err := repository.Default.Sessions.ByID(sessionID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	if session.StepUpAt == nil || time.Since(*session.StepUpAt) > config.Auth.StepUpTTL {
+		return opError(ErrStepUpRequired, "Confirm this action with your authentication code")
+	}
+	return nil
+}
+
+// verifySecondFactor accepts a current TOTP code or an unused recovery code
+func verifySecondFactor(ctx context.Context, user models.User, code string) error {
+	if user.TOTPEnabledAt == nil {
+		return opError(ErrInvalid, "Two-factor authentication is not enabled")
+	}
+
+	ok, err := checkTOTP(user, code)
+	if err != nil {
+		return err
+	}
+	if !ok && len(normalizeRecoveryCode(code)) > totp.Digits {
+		ok, err = repository.Default.Users.UseRecoveryCode(user.ID, hashRecoveryCode(code))
+		if err != nil {
+			return err
+		}
+		if ok {
+			slog.WarnContext(ctx, "recovery code used", "user_id", user.ID)
+		}
+	}
+	if !ok {
+		return opError(ErrInvalid, "Invalid authentication code")
+	}
+	return nil
+}
+
+// checkTOTP matches a code against the user's secret. Each time step is accepted once,
+// so a code seen by someone else cannot be replayed.
+func checkTOTP(user models.User, code string) (bool, error) {
+	if user.TOTPSecret == "" {
+		return false, nil
+	}
+	secret, err := keystore.Default.OpenValue(user.TOTPSecret)
+	if err != nil {
+		return false, fmt.Errorf("failed to open TOTP secret: %w", err)
+	}
+	step, ok := totp.Match(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return repository.Default.Users.AdvanceTOTPStep(user.ID, step)
+}
+
+// newRecoveryCodes replaces the user's recovery codes and returns the new ones
+func newRecoveryCodes(userID string) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 6)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw))
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	if err := repository.Default.Users.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
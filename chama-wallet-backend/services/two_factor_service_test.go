@@ -0,0 +1,77 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"chama-wallet-backend/database"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
+	"chama-wallet-backend/services"
+	"chama-wallet-backend/totp"
+)
+
+func TestTOTPCodesWorkOnce(t *testing.T) {
+	e := newEnv(t)
+	auth, err := e.Register("Wanjiru", "wanjiru@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var session models.Session
+	if err := database.DB.Where("user_id = ?", auth.User.ID).First(&session).Error; err != nil {
+		t.Fatal(err)
+	}
+	user := func() models.User {
+		t.Helper()
+		user, err := repository.Default.Users.ByID(auth.User.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user
+	}
+	code := func(secret string, step int64) string {
+		t.Helper()
+		code, err := totp.Code(secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	enrollment, err := services.BeginTOTPEnrollment(user())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := totp.Step(time.Now())
+	recoveryCodes, err := services.ConfirmTOTPEnrollment(e.Context(), user(), code(enrollment.Secret, now))
+	if err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if user().TOTPLastStep != now {
+		t.Errorf("last step %d, want %d", user().TOTPLastStep, now)
+	}
+
+	// The confirming code, and any earlier one still in the window, are spent
+	for _, step := range []int64{now, now - 1} {
+		if _, err := services.StepUp(e.Context(), user(), session.ID, code(enrollment.Secret, step)); !errors.Is(err, services.ErrInvalid) {
+			t.Errorf("step-up with the code of step %+d: %v, want invalid", step-now, err)
+		}
+	}
+
+	next := code(enrollment.Secret, now+1)
+	if _, err := services.StepUp(e.Context(), user(), session.ID, next); err != nil {
+		t.Fatalf("step-up with the next code: %v", err)
+	}
+	if _, err := services.StepUp(e.Context(), user(), session.ID, next); !errors.Is(err, services.ErrInvalid) {
+		t.Errorf("replayed step-up: %v, want invalid", err)
+	}
+
+	// Recovery codes work once too
+	if _, err := services.StepUp(e.Context(), user(), session.ID, recoveryCodes[0]); err != nil {
+		t.Fatalf("step-up with a recovery code: %v", err)
+	}
+	if _, err := services.StepUp(e.Context(), user(), session.ID, recoveryCodes[0]); !errors.Is(err, services.ErrInvalid) {
+		t.Errorf("reused recovery code: %v, want invalid", err)
+	}
+}
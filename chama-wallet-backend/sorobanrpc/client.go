@@ -0,0 +1,396 @@
+// Package sorobanrpc is a small JSON-RPC client for the Stellar (Soroban) RPC
+// server. It covers what the app needs to call the chama contract: simulating,
+// sending and polling transactions, and reading ledger entries.
+package sorobanrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+)
+
+// Transaction statuses reported by sendTransaction and getTransaction
+const (
+	SendStatusPending       = "PENDING"
+	SendStatusDuplicate     = "DUPLICATE"
+	SendStatusTryAgainLater = "TRY_AGAIN_LATER"
+	SendStatusError         = "ERROR"
+
+	TransactionStatusSuccess  = "SUCCESS"
+	TransactionStatusNotFound = "NOT_FOUND"
+	TransactionStatusFailed   = "FAILED"
+)
+
+// Client talks to a single RPC server
+type Client struct {
+	URL          string
+	HTTPClient   *http.Client
+	PollInterval time.Duration // delay between getTransaction polls
+
+	nextID int64
+}
+
+func NewClient(url string) *Client {
+	return &Client{
+		URL:          url,
+		HTTPClient:   &http.Client{Timeout: 30 * time.Second},
+		PollInterval: 2 * time.Second,
+	}
+}
+
+// Error is a JSON-RPC error returned by the server
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+type request struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int64       `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int64           `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// call performs one JSON-RPC request and decodes the result into out
+func (c *Client) call(ctx context.Context, method string, params, out interface{}) error {
+	body, err := json.Marshal(request{
+		JSONRPC: "2.0",
+		ID:      atomic.AddInt64(&c.nextID, 1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s request failed with HTTP %d", method, resp.StatusCode)
+	}
+
+	var rpcResp response
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		return fmt.Errorf("invalid %s response: %w", method, err)
+	}
+	if rpcResp.Error != nil {
+		return rpcResp.Error
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(rpcResp.Result, out)
+}
+
+// SimulateHostFunctionResult is the outcome of the simulated host function
+type SimulateHostFunctionResult struct {
+	Auth []string `json:"auth"`
+	XDR  string   `json:"xdr"`
+}
+
+// RestorePreamble is returned when archived ledger entries must be restored first
+type RestorePreamble struct {
+	TransactionData string `json:"transactionData"`
+	MinResourceFee  int64  `json:"minResourceFee,string"`
+}
+
+type SimulateTransactionResponse struct {
+	LatestLedger    uint32                       `json:"latestLedger"`
+	MinResourceFee  int64                        `json:"minResourceFee,string,omitempty"`
+	TransactionData string                       `json:"transactionData,omitempty"`
+	Results         []SimulateHostFunctionResult `json:"results,omitempty"`
+	Events          []string                     `json:"events,omitempty"`
+	RestorePreamble *RestorePreamble             `json:"restorePreamble,omitempty"`
+	Error           string                       `json:"error,omitempty"`
+}
+
+// ReturnValue decodes the value returned by the simulated contract call
+func (r *SimulateTransactionResponse) ReturnValue() (xdr.ScVal, error) {
+	var val xdr.ScVal
+	if len(r.Results) == 0 {
+		return val, errors.New("simulation returned no result")
+	}
+	if err := xdr.SafeUnmarshalBase64(r.Results[0].XDR, &val); err != nil {
+		return val, fmt.Errorf("invalid simulation result: %w", err)
+	}
+	return val, nil
+}
+
+type SendTransactionResponse struct {
+	Status                string `json:"status"`
+	Hash                  string `json:"hash"`
+	LatestLedger          uint32 `json:"latestLedger"`
+	LatestLedgerCloseTime string `json:"latestLedgerCloseTime"`
+	ErrorResultXDR        string `json:"errorResultXdr,omitempty"`
+}
+
+type GetTransactionResponse struct {
+	Status        string `json:"status"`
+	TxHash        string `json:"txHash,omitempty"`
+	LatestLedger  uint32 `json:"latestLedger"`
+	Ledger        uint32 `json:"ledger,omitempty"`
+	EnvelopeXDR   string `json:"envelopeXdr,omitempty"`
+	ResultXDR     string `json:"resultXdr,omitempty"`
+	ResultMetaXDR string `json:"resultMetaXdr,omitempty"`
+}
+
+// ReturnValue decodes the contract return value from the transaction meta
+func (r *GetTransactionResponse) ReturnValue() (xdr.ScVal, error) {
+	var meta xdr.TransactionMeta
+	if err := xdr.SafeUnmarshalBase64(r.ResultMetaXDR, &meta); err != nil {
+		return xdr.ScVal{}, fmt.Errorf("invalid transaction meta: %w", err)
+	}
+
+	switch meta.V {
+	case 3:
+		if meta.V3.SorobanMeta != nil {
+			return meta.V3.SorobanMeta.ReturnValue, nil
+		}
+	case 4:
+		if meta.V4.SorobanMeta != nil && meta.V4.SorobanMeta.ReturnValue != nil {
+			return *meta.V4.SorobanMeta.ReturnValue, nil
+		}
+	}
+	return xdr.ScVal{}, errors.New("transaction has no contract return value")
+}
+
+type LedgerEntryResult struct {
+	Key                string  `json:"key"`
+	XDR                string  `json:"xdr"`
+	LastModifiedLedger uint32  `json:"lastModifiedLedgerSeq"`
+	LiveUntilLedgerSeq *uint32 `json:"liveUntilLedgerSeq,omitempty"`
+}
+
+// Data decodes the ledger entry body
+func (e LedgerEntryResult) Data() (xdr.LedgerEntryData, error) {
+	var data xdr.LedgerEntryData
+	err := xdr.SafeUnmarshalBase64(e.XDR, &data)
+	return data, err
+}
+
+type GetLedgerEntriesResponse struct {
+	Entries      []LedgerEntryResult `json:"entries"`
+	LatestLedger uint32              `json:"latestLedger"`
+}
+
+// SimulateTransaction dry-runs a transaction and returns its footprint, fees and result
+func (c *Client) SimulateTransaction(ctx context.Context, txXDR string) (*SimulateTransactionResponse, error) {
+	var resp SimulateTransactionResponse
+	if err := c.call(ctx, "simulateTransaction", map[string]string{"transaction": txXDR}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SendTransaction submits a signed transaction. It does not wait for it to be applied.
+func (c *Client) SendTransaction(ctx context.Context, txXDR string) (*SendTransactionResponse, error) {
+	var resp SendTransactionResponse
+	if err := c.call(ctx, "sendTransaction", map[string]string{"transaction": txXDR}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetTransaction looks up a transaction by hash
+func (c *Client) GetTransaction(ctx context.Context, hash string) (*GetTransactionResponse, error) {
+	var resp GetTransactionResponse
+	if err := c.call(ctx, "getTransaction", map[string]string{"hash": hash}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// WaitForTransaction polls getTransaction until the transaction leaves NOT_FOUND or ctx ends
+func (c *Client) WaitForTransaction(ctx context.Context, hash string) (*GetTransactionResponse, error) {
+	interval := c.PollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	for {
+		resp, err := c.GetTransaction(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Status != TransactionStatusNotFound {
+			return resp, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("transaction %s not found before deadline: %w", hash, ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
+
+// GetLedgerEntries reads ledger entries by key. Missing entries are left out of the result.
+func (c *Client) GetLedgerEntries(ctx context.Context, keys ...xdr.LedgerKey) (*GetLedgerEntriesResponse, error) {
+	encoded := make([]string, 0, len(keys))
+	for _, key := range keys {
+		b64, err := xdr.MarshalBase64(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ledger key: %w", err)
+		}
+		encoded = append(encoded, b64)
+	}
+
+	var resp GetLedgerEntriesResponse
+	if err := c.call(ctx, "getLedgerEntries", map[string][]string{"keys": encoded}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetAccount loads an account's current sequence number from the ledger
+func (c *Client) GetAccount(ctx context.Context, address string) (*txnbuild.SimpleAccount, error) {
+	accountID, err := xdr.AddressToAccountId(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid account address: %w", err)
+	}
+	var key xdr.LedgerKey
+	if err := key.SetAccount(accountID); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.GetLedgerEntries(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Entries) == 0 {
+		return nil, fmt.Errorf("account %s not found", address)
+	}
+
+	data, err := resp.Entries[0].Data()
+	if err != nil {
+		return nil, fmt.Errorf("invalid account entry: %w", err)
+	}
+	account, ok := data.GetAccount()
+	if !ok {
+		return nil, fmt.Errorf("ledger entry for %s is not an account", address)
+	}
+	return &txnbuild.SimpleAccount{AccountID: address, Sequence: int64(account.SeqNum)}, nil
+}
+
+// PrepareTransaction builds a transaction with a single InvokeHostFunction operation,
+// simulates it and returns it assembled with the simulated footprint, auth and resource fee.
+// The operation in params is updated in place.
+func (c *Client) PrepareTransaction(ctx context.Context, params txnbuild.TransactionParams) (*txnbuild.Transaction, *SimulateTransactionResponse, error) {
+	if len(params.Operations) != 1 {
+		return nil, nil, errors.New("soroban transactions must have exactly one operation")
+	}
+	op, ok := params.Operations[0].(*txnbuild.InvokeHostFunction)
+	if !ok {
+		return nil, nil, errors.New("operation is not an InvokeHostFunction")
+	}
+
+	tx, err := txnbuild.NewTransaction(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	txXDR, err := tx.Base64()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sim, err := c.SimulateTransaction(ctx, txXDR)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sim.Error != "" {
+		return nil, sim, fmt.Errorf("simulation failed: %s", sim.Error)
+	}
+	if sim.RestorePreamble != nil {
+		return nil, sim, errors.New("contract state is archived and must be restored first")
+	}
+
+	var data xdr.SorobanTransactionData
+	if err := xdr.SafeUnmarshalBase64(sim.TransactionData, &data); err != nil {
+		return nil, sim, fmt.Errorf("invalid simulated transaction data: %w", err)
+	}
+
+	if len(op.Auth) == 0 && len(sim.Results) > 0 {
+		for _, encoded := range sim.Results[0].Auth {
+			var entry xdr.SorobanAuthorizationEntry
+			if err := xdr.SafeUnmarshalBase64(encoded, &entry); err != nil {
+				return nil, sim, fmt.Errorf("invalid simulated auth entry: %w", err)
+			}
+			op.Auth = append(op.Auth, entry)
+		}
+	}
+	op.Ext = xdr.TransactionExt{V: 1, SorobanData: &data}
+
+	// The sequence number was already bumped by the first build
+	params.IncrementSequenceNum = false
+	tx, err = txnbuild.NewTransaction(params)
+	if err != nil {
+		return nil, sim, err
+	}
+	return tx, sim, nil
+}
+
+// SubmitTransaction sends a signed transaction and waits until it succeeds or fails
+func (c *Client) SubmitTransaction(ctx context.Context, tx *txnbuild.Transaction) (*GetTransactionResponse, error) {
+	txXDR, err := tx.Base64()
+	if err != nil {
+		return nil, err
+	}
+
+	sent, err := c.SendTransaction(ctx, txXDR)
+	if err != nil {
+		return nil, err
+	}
+	switch sent.Status {
+	case SendStatusPending, SendStatusDuplicate:
+	case SendStatusTryAgainLater:
+		return nil, errors.New("rpc server is busy, try again later")
+	default:
+		return nil, fmt.Errorf("transaction rejected with status %s: %s", sent.Status, sent.ErrorResultXDR)
+	}
+
+	result, err := c.WaitForTransaction(ctx, sent.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if result.TxHash == "" {
+		result.TxHash = sent.Hash
+	}
+	if result.Status != TransactionStatusSuccess {
+		return result, fmt.Errorf("transaction %s %s: %s", sent.Hash, result.Status, result.ResultXDR)
+	}
+	return result, nil
+}
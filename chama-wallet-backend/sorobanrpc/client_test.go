@@ -0,0 +1,247 @@
+package sorobanrpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/strkey"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+
+	"chama-wallet-backend/sorobanrpc"
+)
+
+const baseFee = txnbuild.MinBaseFee
+
+// setup starts a fake server with a funded source account and a contract to call
+func setup(t *testing.T) (*sorobanrpc.FakeServer, *keypair.Full, string) {
+	t.Helper()
+	server := sorobanrpc.NewFakeServer(network.TestNetworkPassphrase)
+	t.Cleanup(server.Close)
+
+	source := keypair.MustRandom()
+	if err := server.SetAccount(source.Address(), 100); err != nil {
+		t.Fatal(err)
+	}
+	contractID, err := strkey.Encode(strkey.VersionByteContract, make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SetContract(contractID); err != nil {
+		t.Fatal(err)
+	}
+	return server, source, contractID
+}
+
+// prepare builds a contract call from source and prepares it through the client
+func prepare(t *testing.T, client *sorobanrpc.Client, source *keypair.Full, contractID string) (*txnbuild.Transaction, *sorobanrpc.SimulateTransactionResponse, error) {
+	t.Helper()
+	account, err := client.GetAccount(context.Background(), source.Address())
+	if err != nil {
+		t.Fatalf("get account: %v", err)
+	}
+	op, err := sorobanrpc.InvokeContractOp(contractID, "balance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client.PrepareTransaction(context.Background(), txnbuild.TransactionParams{
+		SourceAccount:        account,
+		IncrementSequenceNum: true,
+		BaseFee:              baseFee,
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewTimeout(300)},
+		Operations:           []txnbuild.Operation{op},
+	})
+}
+
+func TestSimulatePrepareSendPoll(t *testing.T) {
+	server, source, contractID := setup(t)
+	server.SetReturnValue(sorobanrpc.I128Val(42))
+	client := server.Client()
+
+	tx, sim, err := prepare(t, client, source, contractID)
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	if tx.SequenceNumber() != 101 {
+		t.Errorf("sequence %d, want the account's next", tx.SequenceNumber())
+	}
+	simulated, err := sim.ReturnValue()
+	if err != nil || sorobanrpc.FormatScVal(simulated) != "42" {
+		t.Errorf("simulated return %s, %v", sorobanrpc.FormatScVal(simulated), err)
+	}
+	op := tx.Operations()[0].(*txnbuild.InvokeHostFunction)
+	if op.Ext.SorobanData == nil || op.Ext.SorobanData.ResourceFee != 100_000 {
+		t.Fatalf("operation carries no simulated transaction data")
+	}
+
+	tx, err = tx.Sign(network.TestNetworkPassphrase, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := client.SubmitTransaction(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	hash, _ := tx.HashHex(network.TestNetworkPassphrase)
+	if result.Status != sorobanrpc.TransactionStatusSuccess || result.TxHash != hash {
+		t.Errorf("result %s %s, want %s succeeded", result.TxHash, result.Status, hash)
+	}
+	if _, ok := server.Sent()[hash]; !ok {
+		t.Errorf("server did not receive %s", hash)
+	}
+	returned, err := result.ReturnValue()
+	if err != nil || sorobanrpc.FormatScVal(returned) != "42" {
+		t.Errorf("return value %s, %v", sorobanrpc.FormatScVal(returned), err)
+	}
+}
+
+func TestPrepareAddsResourceFee(t *testing.T) {
+	server, source, contractID := setup(t)
+	client := server.Client()
+
+	tx, _, err := prepare(t, client, source, contractID)
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	if tx.MaxFee() != baseFee+100_000 {
+		t.Errorf("fee %d, want the base fee plus the simulated resource fee", tx.MaxFee())
+	}
+
+	// A costlier simulation raises the fee to match
+	data, _ := xdr.MarshalBase64(xdr.SorobanTransactionData{
+		Resources:   xdr.SorobanResources{Instructions: 5_000_000},
+		ResourceFee: 750_000,
+	})
+	server.Handle("simulateTransaction", func(json.RawMessage) (interface{}, error) {
+		return sorobanrpc.SimulateTransactionResponse{MinResourceFee: 750_000, TransactionData: data}, nil
+	})
+	tx, sim, err := prepare(t, client, source, contractID)
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	if sim.MinResourceFee != 750_000 || tx.MaxFee() != baseFee+750_000 {
+		t.Errorf("min resource fee %d, fee %d; want %d", sim.MinResourceFee, tx.MaxFee(), baseFee+750_000)
+	}
+}
+
+func TestPrepareFailedSimulation(t *testing.T) {
+	server, source, contractID := setup(t)
+	client := server.Client()
+
+	server.Handle("simulateTransaction", func(json.RawMessage) (interface{}, error) {
+		return sorobanrpc.SimulateTransactionResponse{LatestLedger: 7, Error: "HostError: Error(Contract, #3)"}, nil
+	})
+	tx, sim, err := prepare(t, client, source, contractID)
+	if err == nil || !strings.Contains(err.Error(), "Error(Contract, #3)") {
+		t.Fatalf("prepare: %v, want the simulation error", err)
+	}
+	if tx != nil || sim == nil || sim.LatestLedger != 7 {
+		t.Errorf("failed simulation returned tx %v and simulation %+v", tx, sim)
+	}
+
+	// Archived contract state has to be restored before the call can run
+	server.Handle("simulateTransaction", func(json.RawMessage) (interface{}, error) {
+		return sorobanrpc.SimulateTransactionResponse{RestorePreamble: &sorobanrpc.RestorePreamble{MinResourceFee: 1}}, nil
+	})
+	if _, _, err := prepare(t, client, source, contractID); err == nil || !strings.Contains(err.Error(), "restored") {
+		t.Errorf("prepare: %v, want a restore error", err)
+	}
+}
+
+func TestErrorResults(t *testing.T) {
+	server, source, contractID := setup(t)
+	client := server.Client()
+
+	tx, _, err := prepare(t, client, source, contractID)
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	tx, _ = tx.Sign(network.TestNetworkPassphrase, source)
+
+	// The server refuses the request
+	server.Handle("sendTransaction", func(json.RawMessage) (interface{}, error) {
+		return nil, &sorobanrpc.Error{Code: -32602, Message: "invalid parameters"}
+	})
+	var rpcErr *sorobanrpc.Error
+	if _, err := client.SubmitTransaction(context.Background(), tx); !errors.As(err, &rpcErr) || rpcErr.Code != -32602 {
+		t.Errorf("submit: %v, want the RPC error", err)
+	}
+
+	// The transaction is rejected before it reaches the ledger
+	server.Handle("sendTransaction", func(json.RawMessage) (interface{}, error) {
+		return sorobanrpc.SendTransactionResponse{Status: sorobanrpc.SendStatusError, Hash: "ab", ErrorResultXDR: "AAAA"}, nil
+	})
+	if _, err := client.SubmitTransaction(context.Background(), tx); err == nil || !strings.Contains(err.Error(), "ERROR") {
+		t.Errorf("submit: %v, want rejected with status ERROR", err)
+	}
+
+	server.Handle("sendTransaction", func(json.RawMessage) (interface{}, error) {
+		return sorobanrpc.SendTransactionResponse{Status: sorobanrpc.SendStatusTryAgainLater}, nil
+	})
+	if _, err := client.SubmitTransaction(context.Background(), tx); err == nil || !strings.Contains(err.Error(), "try again") {
+		t.Errorf("submit: %v, want try again later", err)
+	}
+
+	// The transaction is applied and fails
+	server.Handle("sendTransaction", func(json.RawMessage) (interface{}, error) {
+		return sorobanrpc.SendTransactionResponse{Status: sorobanrpc.SendStatusPending, Hash: "cd"}, nil
+	})
+	server.Handle("getTransaction", func(json.RawMessage) (interface{}, error) {
+		return sorobanrpc.GetTransactionResponse{Status: sorobanrpc.TransactionStatusFailed, ResultXDR: "BBBB"}, nil
+	})
+	result, err := client.SubmitTransaction(context.Background(), tx)
+	if err == nil || result == nil || result.Status != sorobanrpc.TransactionStatusFailed || result.TxHash != "cd" {
+		t.Errorf("submit: %+v, %v; want the failed result", result, err)
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	server, _, _ := setup(t)
+	client := sorobanrpc.NewClient(server.URL + "/missing")
+	server.Close()
+
+	if _, err := client.GetTransaction(context.Background(), "ab"); err == nil {
+		t.Errorf("get transaction from a closed server succeeded")
+	}
+}
+
+func TestWaitForTransactionPollsWhileNotFound(t *testing.T) {
+	server, _, _ := setup(t)
+	client := server.Client()
+
+	var polls int32
+	server.Handle("getTransaction", func(json.RawMessage) (interface{}, error) {
+		if atomic.AddInt32(&polls, 1) < 3 {
+			return sorobanrpc.GetTransactionResponse{Status: sorobanrpc.TransactionStatusNotFound}, nil
+		}
+		return sorobanrpc.GetTransactionResponse{Status: sorobanrpc.TransactionStatusSuccess, TxHash: "ab", Ledger: 12}, nil
+	})
+
+	result, err := client.WaitForTransaction(context.Background(), "ab")
+	if err != nil || result.Status != sorobanrpc.TransactionStatusSuccess || result.Ledger != 12 {
+		t.Fatalf("wait: %+v, %v", result, err)
+	}
+	if polls != 3 {
+		t.Errorf("%d polls, want 3", polls)
+	}
+}
+
+func TestWaitForTransactionTimesOut(t *testing.T) {
+	server, _, _ := setup(t)
+	client := server.Client()
+	client.PollInterval = 5 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	result, err := client.WaitForTransaction(ctx, "ab")
+	if result != nil || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wait: %+v, %v; want the deadline exceeded", result, err)
+	}
+}
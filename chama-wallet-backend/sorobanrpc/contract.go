@@ -0,0 +1,175 @@
+package sorobanrpc
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/stellar/go/strkey"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+)
+
+// ScAddressFromString converts a G... account or C... contract address
+func ScAddressFromString(address string) (xdr.ScAddress, error) {
+	switch {
+	case strings.HasPrefix(address, "G"):
+		accountID, err := xdr.AddressToAccountId(address)
+		if err != nil {
+			return xdr.ScAddress{}, fmt.Errorf("invalid account address: %w", err)
+		}
+		return xdr.ScAddress{Type: xdr.ScAddressTypeScAddressTypeAccount, AccountId: &accountID}, nil
+	case strings.HasPrefix(address, "C"):
+		decoded, err := strkey.Decode(strkey.VersionByteContract, address)
+		if err != nil {
+			return xdr.ScAddress{}, fmt.Errorf("invalid contract address: %w", err)
+		}
+		var contractID xdr.ContractId
+		copy(contractID[:], decoded)
+		return xdr.ScAddress{Type: xdr.ScAddressTypeScAddressTypeContract, ContractId: &contractID}, nil
+	}
+	return xdr.ScAddress{}, fmt.Errorf("unsupported address %q", address)
+}
+
+// AddressVal builds an Address argument
+func AddressVal(address string) (xdr.ScVal, error) {
+	scAddress, err := ScAddressFromString(address)
+	if err != nil {
+		return xdr.ScVal{}, err
+	}
+	return xdr.ScVal{Type: xdr.ScValTypeScvAddress, Address: &scAddress}, nil
+}
+
+// I128Val builds an i128 argument
+func I128Val(value int64) xdr.ScVal {
+	return xdr.ScVal{
+		Type: xdr.ScValTypeScvI128,
+		I128: &xdr.Int128Parts{
+			Hi: xdr.Int64(value >> 63), // sign extension
+			Lo: xdr.Uint64(uint64(value)),
+		},
+	}
+}
+
+// FormatScVal renders a contract return value as text. Vectors are rendered as
+// JSON arrays and numbers in decimal.
+func FormatScVal(val xdr.ScVal) string {
+	switch val.Type {
+	case xdr.ScValTypeScvVoid:
+		return ""
+	case xdr.ScValTypeScvI128:
+		value := new(big.Int).Lsh(big.NewInt(int64(val.I128.Hi)), 64)
+		return value.Or(value, new(big.Int).SetUint64(uint64(val.I128.Lo))).String()
+	case xdr.ScValTypeScvVec:
+		var items []string
+		if vec := *val.Vec; vec != nil {
+			for _, item := range *vec {
+				items = append(items, FormatScVal(item))
+			}
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	}
+	return val.String()
+}
+
+// InvokeContractOp builds the operation calling function on a contract
+func InvokeContractOp(contractID, function string, args ...xdr.ScVal) (*txnbuild.InvokeHostFunction, error) {
+	contract, err := ScAddressFromString(contractID)
+	if err != nil {
+		return nil, err
+	}
+	return &txnbuild.InvokeHostFunction{
+		HostFunction: xdr.HostFunction{
+			Type: xdr.HostFunctionTypeHostFunctionTypeInvokeContract,
+			InvokeContract: &xdr.InvokeContractArgs{
+				ContractAddress: contract,
+				FunctionName:    xdr.ScSymbol(function),
+				Args:            xdr.ScVec(args),
+			},
+		},
+	}, nil
+}
+
+// UploadWasmOp builds the operation installing contract code
+func UploadWasmOp(wasm []byte) *txnbuild.InvokeHostFunction {
+	return &txnbuild.InvokeHostFunction{
+		HostFunction: xdr.HostFunction{
+			Type: xdr.HostFunctionTypeHostFunctionTypeUploadContractWasm,
+			Wasm: &wasm,
+		},
+	}
+}
+
+// CreateContractOp builds the operation creating a contract instance of uploaded code
+func CreateContractOp(deployer string, wasmHash xdr.Hash, salt xdr.Uint256) (*txnbuild.InvokeHostFunction, error) {
+	preimage, err := addressPreimage(deployer, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &txnbuild.InvokeHostFunction{
+		HostFunction: xdr.HostFunction{
+			Type: xdr.HostFunctionTypeHostFunctionTypeCreateContract,
+			CreateContract: &xdr.CreateContractArgs{
+				ContractIdPreimage: preimage,
+				Executable: xdr.ContractExecutable{
+					Type:     xdr.ContractExecutableTypeContractExecutableWasm,
+					WasmHash: &wasmHash,
+				},
+			},
+		},
+	}, nil
+}
+
+// ContractIDFor derives the address of a contract created by deployer with salt
+func ContractIDFor(networkPassphrase, deployer string, salt xdr.Uint256) (string, error) {
+	preimage, err := addressPreimage(deployer, salt)
+	if err != nil {
+		return "", err
+	}
+	hashPreimage := xdr.HashIdPreimage{
+		Type: xdr.EnvelopeTypeEnvelopeTypeContractId,
+		ContractId: &xdr.HashIdPreimageContractId{
+			NetworkId:          xdr.Hash(sha256.Sum256([]byte(networkPassphrase))),
+			ContractIdPreimage: preimage,
+		},
+	}
+	raw, err := hashPreimage.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	contractID := sha256.Sum256(raw)
+	return strkey.Encode(strkey.VersionByteContract, contractID[:])
+}
+
+// ContractInstanceKey is the ledger key of a contract's instance entry
+func ContractInstanceKey(contractID string) (xdr.LedgerKey, error) {
+	contract, err := ScAddressFromString(contractID)
+	if err != nil {
+		return xdr.LedgerKey{}, err
+	}
+	var key xdr.LedgerKey
+	err = key.SetContractData(contract, xdr.ScVal{Type: xdr.ScValTypeScvLedgerKeyContractInstance}, xdr.ContractDataDurabilityPersistent)
+	return key, err
+}
+
+// ContractCodeKey is the ledger key of uploaded contract code
+func ContractCodeKey(wasmHash xdr.Hash) (xdr.LedgerKey, error) {
+	var key xdr.LedgerKey
+	err := key.SetContractCode(wasmHash)
+	return key, err
+}
+
+func addressPreimage(deployer string, salt xdr.Uint256) (xdr.ContractIdPreimage, error) {
+	address, err := ScAddressFromString(deployer)
+	if err != nil {
+		return xdr.ContractIdPreimage{}, err
+	}
+	return xdr.ContractIdPreimage{
+		Type: xdr.ContractIdPreimageTypeContractIdPreimageFromAddress,
+		FromAddress: &xdr.ContractIdPreimageFromAddress{
+			Address: address,
+			Salt:    salt,
+		},
+	}, nil
+}
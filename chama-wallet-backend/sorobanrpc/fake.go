@@ -0,0 +1,286 @@
+package sorobanrpc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+)
+
+// FakeHandler answers one JSON-RPC method. Returning an *Error sends it as the RPC error.
+type FakeHandler func(params json.RawMessage) (interface{}, error)
+
+// FakeServer is an in-process RPC server for local development and tests. It keeps
+// ledger entries in memory, accepts every transaction and reports it as successful.
+// Any method can be overridden with Handle.
+type FakeServer struct {
+	*httptest.Server
+
+	mu                sync.Mutex
+	networkPassphrase string
+	handlers          map[string]FakeHandler
+	entries           map[string]string // base64 ledger key -> base64 entry data
+	returnValue       xdr.ScVal
+	sent              map[string]string // tx hash -> envelope
+	ledger            uint32
+}
+
+func NewFakeServer(networkPassphrase string) *FakeServer {
+	f := &FakeServer{
+		networkPassphrase: networkPassphrase,
+		handlers:          map[string]FakeHandler{},
+		entries:           map[string]string{},
+		returnValue:       xdr.ScVal{Type: xdr.ScValTypeScvVoid},
+		sent:              map[string]string{},
+		ledger:            1000,
+	}
+	f.handlers["simulateTransaction"] = f.simulateTransaction
+	f.handlers["sendTransaction"] = f.sendTransaction
+	f.handlers["getTransaction"] = f.getTransaction
+	f.handlers["getLedgerEntries"] = f.getLedgerEntries
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	return f
+}
+
+// Client returns a client pointed at the fake that polls without delay
+func (f *FakeServer) Client() *Client {
+	client := NewClient(f.URL)
+	client.PollInterval = 1
+	return client
+}
+
+// Handle replaces the handler for a method
+func (f *FakeServer) Handle(method string, handler FakeHandler) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[method] = handler
+}
+
+// SetReturnValue sets the value simulated and submitted contract calls return
+func (f *FakeServer) SetReturnValue(val xdr.ScVal) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.returnValue = val
+}
+
+// SetLedgerEntry stores an entry returned by getLedgerEntries
+func (f *FakeServer) SetLedgerEntry(key xdr.LedgerKey, data xdr.LedgerEntryData) error {
+	keyXDR, err := xdr.MarshalBase64(key)
+	if err != nil {
+		return err
+	}
+	dataXDR, err := xdr.MarshalBase64(data)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries[keyXDR] = dataXDR
+	return nil
+}
+
+// SetAccount creates or updates an account entry with the given sequence number
+func (f *FakeServer) SetAccount(address string, sequence int64) error {
+	accountID, err := xdr.AddressToAccountId(address)
+	if err != nil {
+		return err
+	}
+	var key xdr.LedgerKey
+	if err := key.SetAccount(accountID); err != nil {
+		return err
+	}
+	return f.SetLedgerEntry(key, xdr.LedgerEntryData{
+		Type: xdr.LedgerEntryTypeAccount,
+		Account: &xdr.AccountEntry{
+			AccountId: accountID,
+			Balance:   xdr.Int64(10_000 * 10_000_000),
+			SeqNum:    xdr.SequenceNumber(sequence),
+		},
+	})
+}
+
+// SetContract registers a deployed contract instance
+func (f *FakeServer) SetContract(contractID string) error {
+	key, err := ContractInstanceKey(contractID)
+	if err != nil {
+		return err
+	}
+	data := key.MustContractData()
+	return f.SetLedgerEntry(key, xdr.LedgerEntryData{
+		Type: xdr.LedgerEntryTypeContractData,
+		ContractData: &xdr.ContractDataEntry{
+			Contract:   data.Contract,
+			Key:        data.Key,
+			Durability: data.Durability,
+			Val: xdr.ScVal{
+				Type:     xdr.ScValTypeScvContractInstance,
+				Instance: &xdr.ScContractInstance{Executable: xdr.ContractExecutable{Type: xdr.ContractExecutableTypeContractExecutableStellarAsset}},
+			},
+		},
+	})
+}
+
+// Sent returns the envelopes submitted so far, keyed by transaction hash
+func (f *FakeServer) Sent() map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sent := make(map[string]string, len(f.sent))
+	for hash, envelope := range f.sent {
+		sent[hash] = envelope
+	}
+	return sent
+}
+
+func (f *FakeServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     int64           `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	handler, ok := f.handlers[req.Method]
+	f.mu.Unlock()
+
+	resp := response{JSONRPC: "2.0", ID: req.ID}
+	if !ok {
+		resp.Error = &Error{Code: -32601, Message: "method not found"}
+	} else if result, err := handler(req.Params); err != nil {
+		rpcErr, isRPC := err.(*Error)
+		if !isRPC {
+			rpcErr = &Error{Code: -32603, Message: err.Error()}
+		}
+		resp.Error = rpcErr
+	} else {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			resp.Error = &Error{Code: -32603, Message: err.Error()}
+		}
+		resp.Result = raw
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (f *FakeServer) simulateTransaction(params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Transaction string `json:"transaction"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &Error{Code: -32602, Message: err.Error()}
+	}
+	if _, err := txnbuild.TransactionFromXDR(p.Transaction); err != nil {
+		return nil, &Error{Code: -32602, Message: fmt.Sprintf("invalid transaction: %v", err)}
+	}
+
+	data, err := xdr.MarshalBase64(xdr.SorobanTransactionData{
+		Resources:   xdr.SorobanResources{Instructions: 1_000_000, DiskReadBytes: 1_000, WriteBytes: 1_000},
+		ResourceFee: 100_000,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	result, err := xdr.MarshalBase64(f.returnValue)
+	if err != nil {
+		return nil, err
+	}
+	return SimulateTransactionResponse{
+		LatestLedger:    f.ledger,
+		MinResourceFee:  100_000,
+		TransactionData: data,
+		Results:         []SimulateHostFunctionResult{{Auth: []string{}, XDR: result}},
+	}, nil
+}
+
+func (f *FakeServer) sendTransaction(params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Transaction string `json:"transaction"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &Error{Code: -32602, Message: err.Error()}
+	}
+
+	generic, err := txnbuild.TransactionFromXDR(p.Transaction)
+	if err != nil {
+		return nil, &Error{Code: -32602, Message: fmt.Sprintf("invalid transaction: %v", err)}
+	}
+	tx, ok := generic.Transaction()
+	if !ok {
+		return nil, &Error{Code: -32602, Message: "fee bump transactions are not supported"}
+	}
+	hash, err := tx.Hash(f.networkPassphrase)
+	if err != nil {
+		return nil, err
+	}
+	hexHash := hex.EncodeToString(hash[:])
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ledger++
+	f.sent[hexHash] = p.Transaction
+	return SendTransactionResponse{Status: SendStatusPending, Hash: hexHash, LatestLedger: f.ledger}, nil
+}
+
+func (f *FakeServer) getTransaction(params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Hash string `json:"hash"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &Error{Code: -32602, Message: err.Error()}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	envelope, ok := f.sent[p.Hash]
+	if !ok {
+		return GetTransactionResponse{Status: TransactionStatusNotFound, LatestLedger: f.ledger}, nil
+	}
+
+	meta, err := xdr.MarshalBase64(xdr.TransactionMeta{
+		V:  3,
+		V3: &xdr.TransactionMetaV3{SorobanMeta: &xdr.SorobanTransactionMeta{ReturnValue: f.returnValue}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetTransactionResponse{
+		Status:        TransactionStatusSuccess,
+		TxHash:        p.Hash,
+		LatestLedger:  f.ledger,
+		Ledger:        f.ledger,
+		EnvelopeXDR:   envelope,
+		ResultMetaXDR: meta,
+	}, nil
+}
+
+func (f *FakeServer) getLedgerEntries(params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Keys []string `json:"keys"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &Error{Code: -32602, Message: err.Error()}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := GetLedgerEntriesResponse{Entries: []LedgerEntryResult{}, LatestLedger: f.ledger}
+	for _, key := range p.Keys {
+		if data, ok := f.entries[key]; ok {
+			resp.Entries = append(resp.Entries, LedgerEntryResult{Key: key, XDR: data, LastModifiedLedger: f.ledger})
+		}
+	}
+	return resp, nil
+}
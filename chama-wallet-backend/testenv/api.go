@@ -0,0 +1,162 @@
+package testenv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+
+	"github.com/stellar/go/txnbuild"
+
+	"chama-wallet-backend/keystore"
+	"chama-wallet-backend/models"
+	"chama-wallet-backend/repository"
+)
+
+// Request sends a request to the app as the holder of token, if any, with body encoded
+// as JSON. The response is decoded into out unless out is nil. It returns the status.
+func (e *Env) Request(method, path, token string, body, out interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := e.App.Test(req, -1)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil && err != io.EOF {
+			return resp.StatusCode, fmt.Errorf("%s %s: invalid response body: %w", method, path, err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// expect sends a request and fails unless the app answers with status
+func (e *Env) expect(status int, method, path, token string, body, out interface{}) error {
+	var raw map[string]interface{}
+	if out == nil {
+		out = &raw
+	}
+	got, err := e.Request(method, path, token, body, out)
+	if err != nil {
+		return err
+	}
+	if got != status {
+		return fmt.Errorf("%s %s: status %d, want %d (%v)", method, path, got, status, out)
+	}
+	return nil
+}
+
+// Group creates a group as creator with the members approved, and approves it so it can
+// be activated
+func (e *Env) Group(creator models.AuthResponse, members ...models.AuthResponse) (models.Group, error) {
+	var created struct {
+		Group models.Group `json:"group"`
+	}
+	if err := e.expect(201, "POST", "/group/create", creator.Token,
+		map[string]string{"name": "Test Chama", "description": "testenv group"}, &created); err != nil {
+		return models.Group{}, err
+	}
+	groupID := created.Group.ID
+	if groupID == "" {
+		return models.Group{}, fmt.Errorf("group create returned no group")
+	}
+
+	for _, member := range members {
+		if err := e.expect(200, "POST", "/group/"+groupID+"/join", member.Token, map[string]string{}, nil); err != nil {
+			return models.Group{}, err
+		}
+		pending, err := repository.Default.Members.Find(groupID, member.User.ID)
+		if err != nil {
+			return models.Group{}, err
+		}
+		if err := e.expect(200, "POST", "/group/"+groupID+"/approve-member", creator.Token,
+			map[string]string{"member_id": pending.ID, "action": "approve"}, nil); err != nil {
+			return models.Group{}, err
+		}
+	}
+
+	if err := e.expect(200, "POST", "/group/"+groupID+"/approve", creator.Token, nil, nil); err != nil {
+		return models.Group{}, err
+	}
+	return repository.Default.Groups.ByID(groupID)
+}
+
+// ActiveGroup creates and approves a group like Group and activates it with settings
+func (e *Env) ActiveGroup(creator models.AuthResponse, members []models.AuthResponse, settings models.GroupSettings) (models.Group, error) {
+	group, err := e.Group(creator, members...)
+	if err != nil {
+		return group, err
+	}
+	if err := e.expect(200, "POST", "/group/"+group.ID+"/activate", creator.Token, settings, nil); err != nil {
+		return group, err
+	}
+	return repository.Default.Groups.ByID(group.ID)
+}
+
+// Members registers n users named member1, member2 and so on
+func (e *Env) Members(n int) ([]models.AuthResponse, error) {
+	var members []models.AuthResponse
+	for i := 1; i <= n; i++ {
+		auth, err := e.Register(fmt.Sprintf("Member %d", i), fmt.Sprintf("member%d@example.com", i))
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, auth)
+	}
+	return members, nil
+}
+
+// Contribute pays member's contribution to a round through the API, signing the prepared
+// transaction with the member's custodial key
+func (e *Env) Contribute(member models.AuthResponse, groupID string, round int, amount float64) error {
+	var prepared struct {
+		ContributionID string `json:"contribution_id"`
+		UnsignedXDR    string `json:"unsigned_xdr"`
+	}
+	if err := e.expect(200, "POST", "/group/"+groupID+"/contribute-round/prepare", member.Token,
+		map[string]interface{}{"round": round, "amount": amount}, &prepared); err != nil {
+		return err
+	}
+
+	signed, err := e.Sign(member.User, prepared.UnsignedXDR)
+	if err != nil {
+		return err
+	}
+	return e.expect(200, "POST", "/group/"+groupID+"/contribute-round", member.Token,
+		map[string]string{"contribution_id": prepared.ContributionID, "signed_xdr": signed}, nil)
+}
+
+// Sign signs a transaction envelope with the user's custodial key, as their wallet would
+func (e *Env) Sign(user models.User, envelopeXDR string) (string, error) {
+	generic, err := txnbuild.TransactionFromXDR(envelopeXDR)
+	if err != nil {
+		return "", err
+	}
+	tx, ok := generic.Transaction()
+	if !ok {
+		return "", fmt.Errorf("envelope is a fee bump transaction")
+	}
+	signer, err := keystore.Default.Signer(user.SecretKey)
+	if err != nil {
+		return "", err
+	}
+	if tx, err = signer.SignTransaction(tx); err != nil {
+		return "", err
+	}
+	return tx.Base64()
+}
@@ -0,0 +1,63 @@
+package totp_test
+
+import (
+	"testing"
+	"time"
+
+	"chama-wallet-backend/totp"
+)
+
+// rfcSecret is the RFC 6238 SHA-1 test key, "12345678901234567890", in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeMatchesRFC6238Vectors(t *testing.T) {
+	// The RFC's codes have 8 digits; ours are their last 6
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, v := range vectors {
+		code, err := totp.Code(rfcSecret, totp.Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != v.code {
+			t.Errorf("code at %d = %s, want %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestMatchAcceptsOneStepEitherSide(t *testing.T) {
+	at := time.Unix(1234567890, 0)
+	now := totp.Step(at)
+
+	for offset := int64(-2); offset <= 2; offset++ {
+		code, err := totp.Code(rfcSecret, now+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		step, ok := totp.Match(rfcSecret, code, at)
+		if want := offset >= -totp.Skew && offset <= totp.Skew; ok != want {
+			t.Errorf("step %+d: match %v, want %v", offset, ok, want)
+		} else if ok && step != now+offset {
+			t.Errorf("step %+d: matched step %d, want %d", offset, step, now+offset)
+		}
+	}
+
+	if _, ok := totp.Match(rfcSecret, "005 924", at); !ok {
+		t.Error("a code typed with a space should match")
+	}
+	if _, ok := totp.Match(rfcSecret, "05924", at); ok {
+		t.Error("a short code matched")
+	}
+	if _, ok := totp.Match("not base32!", "005924", at); ok {
+		t.Error("a code matched an invalid secret")
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"log/slog"
 
 	"github.com/stellar/go/keypair"
 )
@@ -33,6 +34,7 @@ func GenerateStellarWallet() (*StellarWallet, error) {
 		SecretKey: pair.Seed(),
 	}
 
-	fmt.Printf("✅ Generated wallet: %s\n", wallet.PublicKey)
+	slog.Info("generated wallet", "address", wallet.PublicKey)
+
 	return wallet, nil
 }